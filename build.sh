@@ -11,4 +11,7 @@ go build -o $BUILD_DIR/keygen $MAIN_DIR_PREFIX/keygen/main.go
 go build -o $BUILD_DIR/client $MAIN_DIR_PREFIX/client/*.go
 go build -o $BUILD_DIR/anti996 $MAIN_DIR_PREFIX/anti996/*.go
 go build -o $BUILD_DIR/dbbrowser $MAIN_DIR_PREFIX/dbbrowser/main.go
+go build -o $BUILD_DIR/diffsim $MAIN_DIR_PREFIX/diffsim/main.go
 
+go build -o $BUILD_DIR/genesis $MAIN_DIR_PREFIX/genesis/main.go
+go build -o $BUILD_DIR/snapshot $MAIN_DIR_PREFIX/snapshot/main.go
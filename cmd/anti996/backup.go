@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// restoreBackup writes the backup fetched by the client into the empty database
+func restoreBackup(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, err := db.Restore(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("restore failed:%v", err)
+	}
+	fmt.Printf("The backup created at %s is restored, the latest block is %d %s.\n",
+		time.Unix(header.Time, 0).Format(time.RFC3339), header.Height, utils.ToHex(header.Hash))
+	return nil
+}
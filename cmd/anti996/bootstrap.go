@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/bootstrap"
+)
+
+// importBlocks adds the blocks of the bootstrap file to the stored chain
+func importBlocks(path string, conf *blockchain.Config) error {
+	c := blockchain.NewChain()
+	if err := c.Init(conf); err != nil {
+		return err
+	}
+
+	imported, err := bootstrap.Import(path, c)
+	if err != nil {
+		return fmt.Errorf("import failed after %d blocks:%v", imported, err)
+	}
+	fmt.Printf("%d blocks are imported.\n", imported)
+	return nil
+}
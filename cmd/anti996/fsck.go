@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/db"
+)
+
+// fsck reports the inconsistent entries of the database and repairs the indexes if repair is true
+func fsck(repair bool) error {
+	result, err := db.CheckConsistency(repair)
+	if err != nil {
+		return err
+	}
+
+	var unrepairable int
+	for _, i := range result {
+		mark := ""
+		if !i.Repairable() {
+			mark = " (unrepairable)"
+			unrepairable++
+		}
+		fmt.Printf("%v%s\n", i, mark)
+	}
+
+	repairable := len(result) - unrepairable
+	if repair {
+		fmt.Printf("%d inconsistent entries are repaired.\n", repairable)
+	} else if repairable != 0 {
+		fmt.Printf("%d inconsistent entries can be repaired with -repair.\n", repairable)
+	}
+	if unrepairable != 0 {
+		return fmt.Errorf("%d block entries are missing or broken, run with -reindex to truncate the chain", unrepairable)
+	}
+	if len(result) == 0 {
+		fmt.Println("The database is consistent.")
+	}
+	return nil
+}
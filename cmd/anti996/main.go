@@ -6,36 +6,76 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"syscall"
 
 	"net/http"
 	_ "net/http/pprof"
 
-	"github.com/btcsuite/btcd/btcec"
+	"github.com/996BC/996.Blockchain/cmd/internal/config"
 	"github.com/996BC/996.Blockchain/core"
 	"github.com/996BC/996.Blockchain/core/blockchain"
 	"github.com/996BC/996.Blockchain/crypto"
 	"github.com/996BC/996.Blockchain/db"
 	"github.com/996BC/996.Blockchain/p2p"
 	"github.com/996BC/996.Blockchain/p2p/peer"
+	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/rpc"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 func main() {
 	// load the config file
 	cf := flag.String("c", "", "config file")
 	pprofPort := flag.Int("pprof", 0, "pprof port, used by developers")
+	verify := flag.Bool("verify-chain", false, "verify the stored blocks and indexes from the genesis, report the first bad height and exit")
+	reindexing := flag.Bool("reindex", false, "verify the stored blocks from the genesis, rebuild the indexes, truncate to the first bad height and exit")
+	importPath := flag.String("import", "", "import the blocks of the bootstrap file exported by dbbrowser through the normal verification and exit")
+	fsckFlag := flag.Bool("fsck", false, "cross-check the stored blocks, indexes, scores and latest height, report the inconsistent entries and exit")
+	repair := flag.Bool("repair", false, "used with -fsck, rewrite or remove the inconsistent indexes, scores and entries not on the chain")
+	restorePath := flag.String("restore", "", "restore the backup fetched by the client into the empty database and exit")
+	snapshotPath := flag.String("snapshot", "", "import the snapshot signed by the snapshot_keys into the empty database before starting")
 	flag.Parse()
 
-	conf, err := parseConfig(*cf)
+	conf, err := config.Parse(*cf)
 	if err != nil {
 		log.Fatal(err)
 	}
 	utils.SetLogLevel(conf.LogLevel)
 	logger := utils.GetStdoutLog()
 
+	chainConfig, err := newChainConfig(conf)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// the offline database maintenance
+	if *verify || *reindexing || *fsckFlag || len(*importPath) != 0 || len(*restorePath) != 0 {
+		if err = db.InitWithEngine(conf.DBEngine, conf.DataPath); err != nil {
+			logger.Fatal("init db failed:%v\n", err)
+		}
+
+		if *verify {
+			err = verifyChain(chainConfig)
+		} else if len(*importPath) != 0 {
+			err = importBlocks(*importPath, chainConfig)
+		} else if len(*restorePath) != 0 {
+			err = restoreBackup(*restorePath)
+		} else if *fsckFlag {
+			err = fsck(*repair)
+		} else {
+			err = reindex(chainConfig)
+		}
+		db.Close()
+
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		return
+	}
+
 	// load the key
 	var privKey *btcec.PrivateKey
 	if conf.Key.Type == crypto.PlainKeyType {
@@ -50,15 +90,20 @@ func main() {
 			logger.Fatal("resotre pKey failed:%v\n", err)
 		}
 	}
-	pubKey := privKey.PubKey()
 
 	// p2p peer provider
-	provider := peer.NewProvider(conf.IP, conf.Port, pubKey)
+	// the known peers survive restarts, the node is not isolated if the seeds are down
+	provider := peer.NewProvider(conf.IP, conf.Port, privKey, conf.AcceptDiscoverV1,
+		filepath.Join(conf.DataPath, "peers.json"))
 	seeds := parseSeeds(conf.Seeds)
 	provider.AddSeeds(seeds)
 	provider.Start()
 
 	// p2p node
+	capabilities := params.NodeCapabilities(conf.NodeType)
+	if conf.Compression {
+		capabilities |= params.CapCompression
+	}
 	nodeConfig := &p2p.Config{
 		NodeIP:     conf.IP,
 		NodePort:   conf.Port,
@@ -67,43 +112,43 @@ func main() {
 		PrivKey:    privKey,
 		Type:       conf.NodeType,
 		ChainID:    conf.ChainID,
+
+		Capabilities: capabilities,
+
+		// the banned peers survive restarts
+		BanListPath: filepath.Join(conf.DataPath, "bans.json"),
+		// the anchor peers are connected first after restarts
+		AnchorsPath: filepath.Join(conf.DataPath, "anchors.json"),
 	}
 	node := p2p.NewNode(nodeConfig)
 	node.Start()
 
 	// db
-	if err = db.Init(conf.DataPath); err != nil {
+	if err = db.InitWithEngine(conf.DBEngine, conf.DataPath); err != nil {
 		logger.Fatal("init db failed:%v\n", err)
 	}
-	logger.Info("database initialize successfully under the data path:%s\n", conf.DataPath)
+	logger.Info("database initialize successfully under the data path:%s with engine %s\n", conf.DataPath, conf.DBEngine)
+	if len(*snapshotPath) != 0 {
+		if err = importSnapshot(*snapshotPath, conf, chainConfig); err != nil {
+			logger.Fatal("import snapshot failed:%v\n", err)
+		}
+	}
 
 	// core module
-	blockDiffLimit, err := strconv.ParseUint(conf.BlockDifficultyLimit, 16, 32)
-	if err != nil {
-		logger.Fatalln(err)
-	}
-	evidenceDiffLimit, err := strconv.ParseUint(conf.EvidenceDifficultyLimit, 16, 32)
-	if err != nil {
-		logger.Fatalln(err)
-	}
 	coreInstance := core.NewCore(&core.Config{
 		Node:         node,
 		NodeType:     conf.NodeType,
 		PrivKey:      privKey,
 		ParallelMine: conf.ParallelMine,
-
-		Config: &blockchain.Config{
-			BlockTargetLimit:    uint32(blockDiffLimit),
-			EvidenceTargetLimit: uint32(evidenceDiffLimit),
-			BlockInterval:       conf.BlockInterval,
-			Genesis:             conf.Genesis,
-		},
+		Devnet:       conf.Devnet,
+		Config:       chainConfig,
 	})
 
 	// local http server
 	httpConfig := &rpc.Config{
-		Port: conf.HTTPPort,
-		C:    coreInstance,
+		Port:  conf.HTTPPort,
+		C:     coreInstance,
+		Admin: conf.AdminRPC,
 	}
 	httpServer := rpc.NewServer(httpConfig)
 	httpServer.Start()
@@ -117,7 +162,7 @@ func main() {
 	}
 
 	// waiting gracefully shutdown
-	sc := make(chan os.Signal)
+	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, os.Interrupt)
 	signal.Notify(sc, syscall.SIGTERM)
 	select {
@@ -126,8 +171,38 @@ func main() {
 		httpServer.Stop()
 		coreInstance.Stop()
 		node.Stop()
+		provider.Stop()
 		db.Close()
 		logger.Infoln("Bye!")
 		return
 	}
 }
+
+func newChainConfig(conf *config.Config) (*blockchain.Config, error) {
+	blockDiffLimit, err := strconv.ParseUint(conf.BlockDifficultyLimit, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	evidenceDiffLimit, err := strconv.ParseUint(conf.EvidenceDifficultyLimit, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	var difficultyForks []*blockchain.DifficultyFork
+	for _, fork := range conf.DifficultyForks {
+		difficultyForks = append(difficultyForks, &blockchain.DifficultyFork{
+			Height:    fork.Height,
+			Algorithm: fork.Algorithm,
+		})
+	}
+
+	return &blockchain.Config{
+		BlockTargetLimit:    uint32(blockDiffLimit),
+		EvidenceTargetLimit: uint32(evidenceDiffLimit),
+		BlockInterval:       conf.BlockInterval,
+		Genesis:             conf.Genesis,
+		Checkpoints:         conf.Checkpoints,
+		MaxReorgDepth:       conf.MaxReorgDepth,
+		DifficultyForks:     difficultyForks,
+		LightNode:           conf.NodeType == params.LightNode,
+	}, nil
+}
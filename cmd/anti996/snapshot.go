@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/cmd/internal/config"
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/snapshot"
+)
+
+// importSnapshot imports the snapshot signed by the trusted keys into the empty database,
+// the node syncs the blocks after the snapshot height from the network as usual
+func importSnapshot(path string, conf *config.Config, chainConf *blockchain.Config) error {
+	if len(conf.SnapshotKeys) == 0 {
+		return fmt.Errorf("no trusted snapshot keys, set snapshot_keys in the config")
+	}
+
+	minSignatures := conf.SnapshotMinSignatures
+	if minSignatures == 0 {
+		minSignatures = 1
+	}
+
+	return snapshot.Import(path, &snapshot.ImportConfig{
+		TrustedKeys:   conf.SnapshotKeys,
+		MinSignatures: minSignatures,
+		Chain:         chainConf,
+	})
+}
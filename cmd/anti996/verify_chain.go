@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+)
+
+// verifyChain verifies the stored blocks and their indexes without modifying the database
+func verifyChain(conf *blockchain.Config) error {
+	var indexErr error
+	var lastHeight uint64
+	scores := make(map[string]uint64)
+
+	handler := func(cb *cp.Block, height uint64) error {
+		lastHeight = height
+		scores[string(cb.Miner)]++
+		if indexErr == nil {
+			indexErr = indexCheck(cb, height)
+		}
+		return nil
+	}
+
+	if err := blockchain.VerifyStoredChain(conf, handler); err != nil {
+		if _, ok := err.(blockchain.ErrBadStoredBlock); ok {
+			return fmt.Errorf("%v, run with -reindex to truncate the chain to the height", err)
+		}
+		return err
+	}
+
+	if indexErr == nil {
+		for miner, expect := range scores {
+			score, err := db.GetScoreViaKey([]byte(miner))
+			if err != nil || score != expect {
+				indexErr = fmt.Errorf("mismatch score of miner %X, expect %d, stored %d", miner, expect, score)
+				break
+			}
+		}
+	}
+	if indexErr != nil {
+		return fmt.Errorf("broken index:%v, run with -reindex to rebuild the indexes", indexErr)
+	}
+
+	fmt.Printf("All %d blocks are valid.\n", lastHeight)
+	return nil
+}
+
+func indexCheck(cb *cp.Block, height uint64) error {
+	hash := cb.GetSerializedHash()
+	if _, storedHeight, err := db.GetHeaderViaHash(hash); err != nil || storedHeight != height {
+		return fmt.Errorf("height %d, block %X index mismatch", height, hash)
+	}
+
+	for _, e := range cb.Evds {
+		if _, storedHeight, err := db.GetEvidenceViaHash(e.Hash); err != nil || storedHeight != height {
+			return fmt.Errorf("height %d, evidence %X index mismatch", height, e.Hash)
+		}
+	}
+	return nil
+}
+
+// reindex rebuilds the indexes while verifying the stored blocks,
+// the blocks from the first bad height are removed
+func reindex(conf *blockchain.Config) error {
+	if !db.HasGenesis() {
+		return fmt.Errorf("empty database")
+	}
+
+	if err := db.DropIndexes(); err != nil {
+		return fmt.Errorf("drop indexes failed:%v", err)
+	}
+
+	var lastHeight uint64
+	handler := func(cb *cp.Block, height uint64) error {
+		lastHeight = height
+		return db.PutIndexes(cb, height)
+	}
+
+	err := blockchain.VerifyStoredChain(conf, handler)
+	if badErr, ok := err.(blockchain.ErrBadStoredBlock); ok {
+		if badErr.Height() <= 1 {
+			return fmt.Errorf("%v, remove the database and synchronize again", err)
+		}
+
+		fmt.Printf("%v, truncate the chain to height %d\n", err, badErr.Height()-1)
+		if err := db.Truncate(badErr.Height() - 1); err != nil {
+			return fmt.Errorf("truncate failed:%v", err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := db.FinishReindex(); err != nil {
+		return err
+	}
+	fmt.Printf("Reindex finished, %d blocks remain.\n", lastHeight)
+	return nil
+}
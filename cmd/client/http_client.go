@@ -9,16 +9,18 @@ import (
 	"math/big"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/core/blockchain"
 	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/db"
 	"github.com/996BC/996.Blockchain/rpc"
 	"github.com/996BC/996.Blockchain/serialize/cp"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 type httpClient struct {
@@ -220,11 +222,50 @@ func (hc *httpClient) queryEvidence(params string) error {
 
 	handler := func() {
 		for _, evd := range queryEvidenceResp.Data {
-			content := "Evidence <%s>\n[Version] %d\n[PubKey] %s\n[Signature] %s\n[Description] %s\n[Nonce] %d\n[Height] %d\n[Block] %s\n[Time] %s\n\n"
+			printEvidence(evd)
+		}
+	}
+	hc.responseHandle(rpcResp, handler)
+
+	return nil
+}
+
+func (hc *httpClient) searchEvidence(keywords string, page int, self bool) error {
+	var err error
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+	var requestBody []byte
+
+	searchReq := &rpc.SearchEvidenceReq{
+		Keywords: keywords,
+		Page:     page,
+	}
+	if self {
+		searchReq.Account = crypto.PrivKeyToID(hc.privKey)
+	}
+	if requestBody, err = json.Marshal(searchReq); err != nil {
+		return err
+	}
+
+	if req, err = hc.genRequest(http.MethodPost, rpc.SearchEvidenceV1Path, nil, nil, requestBody); err != nil {
+		return err
+	}
+
+	if httpResp, err = hc.client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	searchEvidenceResp := &rpc.SearchEvidenceResp{}
+	if rpcResp, err = hc.parseResponse(httpResp, searchEvidenceResp); err != nil {
+		return err
+	}
 
-			fmt.Println("--------------------------------------------------------")
-			fmt.Printf(content, evd.Hash, evd.Version, evd.PubKey, evd.Sig, evd.Description,
-				evd.Nonce, evd.Height, evd.BlockHash, utils.TimeToString(evd.Time))
+	handler := func() {
+		fmt.Printf(">>> found %d evidences, page %d\n", searchEvidenceResp.Total, page)
+		for _, evd := range searchEvidenceResp.Data {
+			printEvidence(evd)
 		}
 	}
 	hc.responseHandle(rpcResp, handler)
@@ -232,6 +273,14 @@ func (hc *httpClient) queryEvidence(params string) error {
 	return nil
 }
 
+func printEvidence(evd *rpc.EvidenceJSON) {
+	content := "Evidence <%s>\n[Version] %d\n[PubKey] %s\n[Signature] %s\n[Description] %s\n[Nonce] %d\n[Height] %d\n[Block] %s\n[Time] %s\n\n"
+
+	fmt.Println("--------------------------------------------------------")
+	fmt.Printf(content, evd.Hash, evd.Version, evd.PubKey, evd.Sig, evd.Description,
+		evd.Nonce, evd.Height, evd.BlockHash, utils.TimeToString(evd.Time))
+}
+
 func (hc *httpClient) queryBlocks(params string) error {
 	var err error
 	var req *http.Request
@@ -254,41 +303,38 @@ func (hc *httpClient) queryBlocks(params string) error {
 	}
 
 	handler := func() {
-		for _, block := range blocksResponse.Data {
-			blockContent := `
-Block <%s> Height:%d
-Time		%s
-Version		%d
-Nonce		%d
-Difficulty	%X
-LastBlock	%s
-Miner		%s
-Root		%s
+		printBlocks(blocksResponse.Data)
+	}
+	hc.responseHandle(rpcResp, handler)
 
-Evidece details:
-No	Hash									Owner
-%s
-`
+	return nil
+}
 
-			var evidenceContent string
-			for i := 0; i < len(block.Evds); i++ {
-				evidenceContent += fmt.Sprintf("[%d]\t%s\t%s\n", i,
-					block.Evds[i].Hash, block.Evds[i].Owner)
-			}
-
-			diff := blockchain.TargetToDiff(block.Target)
-			fmt.Printf(blockContent, block.Hash, block.Height,
-				utils.TimeToString(block.Time),
-				block.Version,
-				block.Nonce,
-				diff,
-				block.LastHash,
-				block.Miner,
-				block.EvidenceRoot,
-				evidenceContent,
-			)
-
-			fmt.Println("--------------------------------------------------------")
+func (hc *httpClient) mineBlocks(num int) error {
+	var err error
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+
+	if req, err = hc.genRequest(http.MethodPost, rpc.MineBlocksV1Path,
+		[]string{rpc.GetNumParam}, []string{strconv.Itoa(num)}, nil); err != nil {
+		return err
+	}
+
+	if httpResp, err = hc.client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	mineJSON := &rpc.MineBlocksResponse{}
+	if rpcResp, err = hc.parseResponse(httpResp, mineJSON); err != nil {
+		return err
+	}
+
+	handler := func() {
+		fmt.Printf("Mined %d blocks:\n", len(mineJSON.Hash))
+		for i, hash := range mineJSON.Hash {
+			fmt.Printf("\t%d.%s\n", i+1, hash)
 		}
 	}
 	hc.responseHandle(rpcResp, handler)
@@ -296,6 +342,124 @@ No	Hash									Owner
 	return nil
 }
 
+func (hc *httpClient) getBans() error {
+	var err error
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+
+	if req, err = hc.genRequest(http.MethodGet, rpc.GetBansV1Path, nil, nil, nil); err != nil {
+		return err
+	}
+
+	if httpResp, err = hc.client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	bansJSON := &rpc.GetBansResponse{}
+	if rpcResp, err = hc.parseResponse(httpResp, bansJSON); err != nil {
+		return err
+	}
+
+	handler := func() {
+		fmt.Printf("%d banned peers:\n", len(bansJSON.Bans))
+		for i, b := range bansJSON.Bans {
+			fmt.Printf("\t%d.%s until %s, %s\n", i+1, b.ID, utils.TimeToString(b.Until), b.Reason)
+		}
+	}
+	hc.responseHandle(rpcResp, handler)
+
+	return nil
+}
+
+func (hc *httpClient) banPeer(id string, duration string) error {
+	keys := []string{rpc.GetIDParam}
+	values := []string{id}
+	if len(duration) != 0 {
+		keys = append(keys, rpc.GetDurationParam)
+		values = append(values, duration)
+	}
+	return hc.adminPost(rpc.BanPeerV1Path, keys, values)
+}
+
+func (hc *httpClient) unbanPeer(id string) error {
+	return hc.adminPost(rpc.UnbanPeerV1Path, []string{rpc.GetIDParam}, []string{id})
+}
+
+func (hc *httpClient) adminPost(path string, keys, values []string) error {
+	var err error
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+
+	if req, err = hc.genRequest(http.MethodPost, path, keys, values, nil); err != nil {
+		return err
+	}
+
+	if httpResp, err = hc.client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	if rpcResp, err = hc.parseResponse(httpResp, nil); err != nil {
+		return err
+	}
+	hc.responseHandle(rpcResp, func() {})
+
+	return nil
+}
+
+func (hc *httpClient) backup(file string) error {
+	var err error
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+
+	if req, err = hc.genRequest(http.MethodGet, rpc.BackupV1Path, nil, nil, nil); err != nil {
+		return err
+	}
+
+	// the backup may take longer than the request timeout
+	client := &http.Client{}
+	if httpResp, err = client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.Header.Get("Content-Type") != rpc.BackupContentType {
+		if rpcResp, err = hc.parseResponse(httpResp, nil); err != nil {
+			return err
+		}
+		return fmt.Errorf("backup failed:%s", rpcResp.Message)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, httpResp.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(file)
+		return fmt.Errorf("read http body failed:%v", err)
+	}
+
+	if f, err = os.Open(file); err != nil {
+		return err
+	}
+	defer f.Close()
+	header, err := db.CheckBackup(f)
+	if err != nil {
+		os.Remove(file)
+		return fmt.Errorf("the backup is broken:%v", err)
+	}
+
+	fmt.Printf("Saved the backup to %s, the latest block is %d %s\n",
+		file, header.Height, utils.ToHex(header.Hash))
+	return nil
+}
+
 func (hc *httpClient) genRequest(method string, path string, key, value []string, postData []byte) (*http.Request, error) {
 	u, _ := url.Parse(hc.scheme + "://" + hc.serverIP + ":" + hc.serverPort)
 	u.Path = path
@@ -349,3 +513,148 @@ func (hc *httpClient) responseHandle(httpResponse *rpc.HTTPResponse, f func()) {
 		fmt.Printf("response unknown code:%d\n", httpResponse.Code)
 	}
 }
+
+func printBlocks(blocks []*rpc.BlockJSON) {
+	for _, block := range blocks {
+		blockContent := `
+Block <%s> Height:%d
+Time		%s
+Version		%d
+Nonce		%d
+Difficulty	%X
+LastBlock	%s
+Miner		%s
+Root		%s
+
+Evidece details:
+No	Hash									Owner
+%s
+`
+
+		var evidenceContent string
+		for i := 0; i < len(block.Evds); i++ {
+			evidenceContent += fmt.Sprintf("[%d]\t%s\t%s\n", i,
+				block.Evds[i].Hash, block.Evds[i].Owner)
+		}
+
+		diff := blockchain.TargetToDiff(block.Target)
+		fmt.Printf(blockContent, block.Hash, block.Height,
+			utils.TimeToString(block.Time),
+			block.Version,
+			block.Nonce,
+			diff,
+			block.LastHash,
+			block.Miner,
+			block.EvidenceRoot,
+			evidenceContent,
+		)
+
+		fmt.Println("--------------------------------------------------------")
+	}
+}
+
+func (hc *httpClient) queryBlockViaTime(params string) error {
+	t, err := parseTime(params, false)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+
+	if req, err = hc.genRequest(http.MethodGet, rpc.QueryBlockViaTimeV1Path,
+		[]string{rpc.GetTimeParam}, []string{strconv.FormatInt(t, 10)}, nil); err != nil {
+		return err
+	}
+
+	if httpResp, err = hc.client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	blocksResponse := &rpc.GetBlocksResponse{}
+	if rpcResp, err = hc.parseResponse(httpResp, blocksResponse); err != nil {
+		return err
+	}
+
+	handler := func() {
+		fmt.Printf(">>> the chain head at %s\n", utils.TimeToString(t))
+		printBlocks(blocksResponse.Data)
+	}
+	hc.responseHandle(rpcResp, handler)
+
+	return nil
+}
+
+func (hc *httpClient) queryEvidenceViaTime(params string, page int) error {
+	times := strings.Split(params, ",")
+	if len(times) != 2 {
+		return fmt.Errorf("invalid time range %s", params)
+	}
+	begin, err := parseTime(times[0], false)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(times[1], true)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	var httpResp *http.Response
+	var rpcResp *rpc.HTTPResponse
+	var requestBody []byte
+
+	queryReq := &rpc.QueryEvidenceViaTimeReq{
+		Begin: begin,
+		End:   end,
+		Page:  page,
+	}
+	if requestBody, err = json.Marshal(queryReq); err != nil {
+		return err
+	}
+
+	if req, err = hc.genRequest(http.MethodPost, rpc.QueryEvidenceViaTimeV1Path, nil, nil, requestBody); err != nil {
+		return err
+	}
+
+	if httpResp, err = hc.client.Do(req); err != nil {
+		return fmt.Errorf("do request err:%v", err)
+	}
+	defer httpResp.Body.Close()
+
+	queryResp := &rpc.QueryEvidenceViaTimeResp{}
+	if rpcResp, err = hc.parseResponse(httpResp, queryResp); err != nil {
+		return err
+	}
+
+	handler := func() {
+		fmt.Printf(">>> found %d evidences from %s to %s, page %d\n", queryResp.Total,
+			utils.TimeToString(begin), utils.TimeToString(end), page)
+		for _, evd := range queryResp.Data {
+			printEvidence(evd)
+		}
+	}
+	hc.responseHandle(rpcResp, handler)
+
+	return nil
+}
+
+// parseTime parses the local time in the format "2006/01/02 15:04:05" or "2006/01/02",
+// the date only time means the end of the day if endOfDay is true
+func parseTime(s string, endOfDay bool) (int64, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006/01/02 15:04:05", s, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+
+	t, err := time.ParseInLocation("2006/01/02", s, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, expect the format 2006/01/02 15:04:05 or 2006/01/02", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t.Unix(), nil
+}
@@ -7,10 +7,10 @@ import (
 	"os"
 	"strconv"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/core/blockchain"
 	"github.com/996BC/996.Blockchain/crypto"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 func main() {
@@ -24,6 +24,17 @@ func main() {
 	qe := flag.String("qe", "", `query the evidence information, you can seperate multiple parameters with ","`)
 	qb := flag.String("qb", "", `query the specified height blocks information, 
 support range format like "1-100", or multiple height seperated with ",", or the latest block with -1`)
+	mine := flag.Int("mine", 0, "mine the specified number of blocks immediately, only available when the node runs in devnet")
+	backup := flag.String("backup", "", "save a consistent backup of the node database into the file while the node keeps running")
+	qt := flag.String("qt", "", `query the chain head at the local time, in the format "2006/01/02 15:04:05" or "2006/01/02"`)
+	qet := flag.String("qet", "", `query the evidences between the local times seperated with ",", like "2019/05/01,2019/05/31"`)
+	search := flag.String("search", "", "search the evidences whose descriptions contain all the keywords, from the newer to the older")
+	page := flag.Int("page", 1, "the page of the -search or -qet result")
+	self := flag.Bool("self", false, "only search the evidences of this account")
+	bans := flag.Bool("bans", false, "list the peers banned by the node")
+	ban := flag.String("ban", "", "ban the peer of the id, it is disconnected and refused to connect for the -duration")
+	duration := flag.String("duration", "", `the duration of -ban like "72h", the default is 24h`)
+	unban := flag.String("unban", "", "allow the banned peer of the id to connect again")
 	flag.Parse()
 
 	var err error
@@ -56,6 +67,22 @@ support range format like "1-100", or multiple height seperated with ",", or the
 		err = client.queryEvidence(*qe)
 	} else if len(*qb) != 0 {
 		err = client.queryBlocks(*qb)
+	} else if *mine > 0 {
+		err = client.mineBlocks(*mine)
+	} else if len(*backup) != 0 {
+		err = client.backup(*backup)
+	} else if len(*qt) != 0 {
+		err = client.queryBlockViaTime(*qt)
+	} else if len(*qet) != 0 {
+		err = client.queryEvidenceViaTime(*qet, *page)
+	} else if len(*search) != 0 {
+		err = client.searchEvidence(*search, *page, *self)
+	} else if *bans {
+		err = client.getBans()
+	} else if len(*ban) != 0 {
+		err = client.banPeer(*ban, *duration)
+	} else if len(*unban) != 0 {
+		err = client.unbanPeer(*unban)
 	} else {
 		fmt.Printf("unknown operation")
 		os.Exit(1)
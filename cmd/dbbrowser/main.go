@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/bootstrap"
 	"github.com/996BC/996.Blockchain/db"
 	"github.com/996BC/996.Blockchain/serialize/cp"
 	"github.com/996BC/996.Blockchain/utils"
@@ -19,6 +20,7 @@ func main() {
 	r := flag.String("range", "", `view block via height range, like "1-100", "56", "-1"`)
 	b := flag.String("b", "", `view block via hash in hex format`)
 	e := flag.String("e", "", `view evidence via hash in hex format`)
+	export := flag.String("export", "", `export the blocks of "-range" (default all) into the bootstrap file, anti996 can import it via "-import"`)
 
 	o := flag.String("o", "", `result output file; if it's null it will print to stdout`)
 	flag.Parse()
@@ -39,6 +41,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(*export) != 0 {
+		if err = exportBlocks(*export, *r); err != nil {
+			fmt.Printf("error happen: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Finish.")
+		return
+	}
+
 	if len(*o) != 0 {
 		if err = utils.AccessCheck(*o); err != nil {
 			fmt.Println(err)
@@ -73,39 +84,60 @@ func main() {
 }
 
 func rangeView(r string) error {
-	var begin, end uint64
+	begin, end, err := parseRange(r)
+	if err != nil {
+		return err
+	}
+
+	for i := begin; i <= end; i++ {
+		block, hash, err := db.GetBlockViaHeight(i)
+		if err != nil {
+			return fmt.Errorf("get height %d block failed", i)
+		}
+		formatOutputBlock(block, hash, i)
+	}
+
+	return nil
+}
 
+func exportBlocks(path string, r string) error {
+	var begin, end uint64 = 1, 0
+	var err error
+	if len(r) != 0 {
+		if begin, end, err = parseRange(r); err != nil {
+			return err
+		}
+	} else if end, err = db.GetLatestHeight(); err != nil {
+		return err
+	}
+
+	if err := bootstrap.Export(path, begin, end); err != nil {
+		return err
+	}
+	fmt.Printf("export blocks %d-%d to %s\n", begin, end, path)
+	return nil
+}
+
+func parseRange(r string) (begin uint64, end uint64, err error) {
 	num, err := strconv.ParseInt(r, 10, 64)
 	if err == nil {
 		if num == -1 {
 			height, err := db.GetLatestHeight()
 			if err != nil {
-				return fmt.Errorf("err %v", err)
+				return 0, 0, fmt.Errorf("err %v", err)
 			}
-			begin = height
-			end = height
+			return height, height, nil
 		} else if num > 0 {
-			begin = uint64(num)
-			end = uint64(num)
-		} else {
-			return fmt.Errorf("invalid index %d", num)
-		}
-	} else {
-		n, err := fmt.Sscanf(r, "%d-%d", &begin, &end)
-		if err != nil || n != 2 || begin >= end {
-			return fmt.Errorf("invalid range")
+			return uint64(num), uint64(num), nil
 		}
+		return 0, 0, fmt.Errorf("invalid index %d", num)
 	}
 
-	for i := begin; i <= end; i++ {
-		block, hash, err := db.GetBlockViaHeight(i)
-		if err != nil {
-			return fmt.Errorf("get height %d block failed", i)
-		}
-		formatOutputBlock(block, hash, i)
+	n, err := fmt.Sscanf(r, "%d-%d", &begin, &end)
+	if err != nil || n != 2 || begin >= end {
+		return 0, 0, fmt.Errorf("invalid range")
 	}
-
-	return nil
+	return begin, end, nil
 }
 
 func blockView(hash string) error {
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	// the equilibrium difficulty is 'baseHashRateScale' times harder than the limit
+	baseHashRateScale = 16
+
+	// movingAverageBlocks is the window to measure the oscillation
+	movingAverageBlocks = 20
+
+	defaultBlocks = 5000
+)
+
+// hashRate returns the hashes per second at the simulated time (seconds)
+type hashRate func(t float64) float64
+
+func main() {
+	algos := flag.String("algos", strings.Join([]string{blockchain.WeightedAverageAlgorithm,
+		blockchain.LWMAAlgorithm, blockchain.ASERTAlgorithm}, ","), "difficulty algorithms to simulate, separated by comma")
+	interval := flag.Int("interval", 90, "expected block interval(seconds)")
+	limit := flag.String("limit", "E8100000", "block difficulty limit")
+	blocks := flag.Int("blocks", 0, "number of blocks to simulate, default is 5000 or the recorded blocks number")
+	curve := flag.String("curve", "oscillate", `synthetic hash rate curve:
+constant: the hash rate never changes
+step: the hash rate changes to 'amplitude' times in the middle
+oscillate: the hash rate switches between 1 and 'amplitude' times every 'period' blocks interval`)
+	amplitude := flag.Float64("amplitude", 4, "hash rate multiple of the step or oscillate curve")
+	period := flag.Int("period", 200, "half cycle of the oscillate curve, in blocks interval")
+	dbpath := flag.String("dbpath", "", "replay the recorded block times in the database instead of the synthetic curve")
+	seed := flag.Int64("seed", 1, "random seed")
+	flag.Parse()
+
+	utils.SetLogLevel(utils.LogErrorLevel)
+
+	targetLimit, err := strconv.ParseUint(*limit, 16, 32)
+	if err != nil || len(*limit) != 8 {
+		fmt.Printf("invalid difficulty limit %s\n", *limit)
+		os.Exit(1)
+	}
+	if *interval <= 0 {
+		fmt.Printf("invalid interval %d\n", *interval)
+		os.Exit(1)
+	}
+	blockInterval := time.Duration(*interval) * time.Second
+
+	var hr hashRate
+	var desc string
+	blocksNum := *blocks
+	if len(*dbpath) != 0 {
+		var recorded int
+		if hr, recorded, err = recordedHashRate(*dbpath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if blocksNum == 0 {
+			blocksNum = recorded
+		}
+		desc = fmt.Sprintf("replay %d recorded blocks of %s", recorded, *dbpath)
+	} else {
+		if blocksNum <= 0 {
+			blocksNum = defaultBlocks
+		}
+		base := baseHashRate(uint32(targetLimit), *interval)
+		if hr, err = syntheticHashRate(*curve, base, *amplitude, float64(*period**interval), float64(blocksNum**interval)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		desc = fmt.Sprintf("synthetic curve %s, amplitude %.2f, period %d blocks", *curve, *amplitude, *period)
+	}
+
+	fmt.Printf("simulate %d blocks, interval %v, limit %s, %s\n\n", blocksNum, blockInterval, *limit, desc)
+	fmt.Printf("%-10s %12s %14s %12s %12s %12s %12s\n",
+		"algorithm", "mean(s)", "variance(s^2)", "stddev(s)", "slow(>4T)", "swing", "oscillation")
+	for _, name := range strings.Split(*algos, ",") {
+		algorithm, err := blockchain.NewDifficultyAlgorithm(strings.TrimSpace(name), uint32(targetLimit), blockInterval)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		rd := rand.New(rand.NewSource(*seed))
+		intervals := simulate(algorithm, uint32(targetLimit), blocksNum, float64(*interval), hr, rd)
+		report(algorithm.Name(), intervals, float64(*interval))
+	}
+
+	fmt.Printf(`
+slow: the percentage of blocks slower than 4 times of interval
+swing: the max %d-block average interval divided by the min one
+oscillation: the standard deviation of %d-block average interval divided by interval
+`, movingAverageBlocks, movingAverageBlocks)
+}
+
+// simulate mines blocks from the genesis and returns the block intervals;
+// the target is refreshed every round like the miner updates the block time
+func simulate(algorithm blockchain.DifficultyAlgorithm, targetLimit uint32, blocksNum int,
+	interval float64, hr hashRate, rd *rand.Rand) []float64 {
+	window := algorithm.Window()
+	round := math.Max(1, interval/30)
+
+	history := []*blockchain.BlockTiming{&blockchain.BlockTiming{Time: 0, Target: targetLimit}}
+	var intervals []float64
+	now := 0.0
+	last := 0.0
+	for len(intervals) < blocksNum {
+		target := targetLimit
+		if len(history) > window { // ignore the genesis block
+			target = algorithm.NextTarget(history[len(history)-window:], int64(now))
+		}
+
+		// the solve time follows the exponential distribution
+		expectSolveTime := expectHashes(target) / hr(now)
+		solveTime := rd.ExpFloat64() * expectSolveTime
+		if solveTime > round {
+			now += round
+			continue
+		}
+
+		now += solveTime
+		history = append(history, &blockchain.BlockTiming{Time: int64(now), Target: target})
+		intervals = append(intervals, now-last)
+		last = now
+	}
+	return intervals
+}
+
+func report(name string, intervals []float64, interval float64) {
+	mean, variance := meanVariance(intervals)
+
+	slow := 0
+	for _, i := range intervals {
+		if i > 4*interval {
+			slow++
+		}
+	}
+
+	var averages []float64
+	for i := movingAverageBlocks; i <= len(intervals); i++ {
+		avg, _ := meanVariance(intervals[i-movingAverageBlocks : i])
+		averages = append(averages, avg)
+	}
+	swing := 0.0
+	oscillation := 0.0
+	if len(averages) != 0 {
+		sort.Float64s(averages)
+		swing = averages[len(averages)-1] / averages[0]
+		_, avgVariance := meanVariance(averages)
+		oscillation = math.Sqrt(avgVariance) / interval
+	}
+
+	fmt.Printf("%-10s %12.2f %14.2f %12.2f %11.2f%% %12.2f %12.3f\n",
+		name, mean, variance, math.Sqrt(variance),
+		float64(slow)*100/float64(len(intervals)), swing, oscillation)
+}
+
+func meanVariance(data []float64) (float64, float64) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+
+	sum := 0.0
+	for _, d := range data {
+		sum += d
+	}
+	mean := sum / float64(len(data))
+
+	squareSum := 0.0
+	for _, d := range data {
+		squareSum += (d - mean) * (d - mean)
+	}
+	return mean, squareSum / float64(len(data))
+}
+
+// expectHashes returns the expected hashes number to find a pow under the target
+func expectHashes(target uint32) float64 {
+	space := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	diff := new(big.Float).SetInt(blockchain.TargetToDiff(target))
+	result, _ := new(big.Float).Quo(space, diff).Float64()
+	return result
+}
+
+func baseHashRate(targetLimit uint32, interval int) float64 {
+	return expectHashes(targetLimit) * baseHashRateScale / float64(interval)
+}
+
+func syntheticHashRate(curve string, base float64, amplitude float64, period float64, total float64) (hashRate, error) {
+	if amplitude <= 0 {
+		return nil, fmt.Errorf("invalid amplitude %.2f", amplitude)
+	}
+
+	switch curve {
+	case "constant":
+		return func(t float64) float64 {
+			return base
+		}, nil
+	case "step":
+		return func(t float64) float64 {
+			if t < total/2 {
+				return base
+			}
+			return base * amplitude
+		}, nil
+	case "oscillate":
+		if period <= 0 {
+			return nil, fmt.Errorf("invalid period")
+		}
+		return func(t float64) float64 {
+			if int64(t/period)%2 == 0 {
+				return base
+			}
+			return base * amplitude
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown curve %s", curve)
+	}
+}
+
+// recordedHashRate estimates the hash rate over time from the recorded blocks,
+// the hash rate of a block is the average of the last 'movingAverageBlocks' blocks
+func recordedHashRate(dbpath string) (hashRate, int, error) {
+	if err := utils.AccessCheck(dbpath); err != nil {
+		return nil, 0, err
+	}
+	if err := db.Init(dbpath); err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+
+	latest, err := db.GetLatestHeight()
+	if err != nil {
+		return nil, 0, err
+	}
+	if latest < 2 {
+		return nil, 0, fmt.Errorf("not enough recorded blocks")
+	}
+
+	var times []int64
+	var hashes []float64
+	for height := uint64(1); height <= latest; height++ {
+		header, _, err := db.GetHeaderViaHeight(height)
+		if err != nil {
+			return nil, 0, fmt.Errorf("get header of height %d failed:%v", height, err)
+		}
+		times = append(times, header.Time)
+		hashes = append(hashes, expectHashes(header.Target))
+	}
+
+	// rates[i] works in [times[i] - times[0], times[i+1] - times[0])
+	var rates []float64
+	for i := 1; i < len(times); i++ {
+		begin := i - movingAverageBlocks
+		if begin < 0 {
+			begin = 0
+		}
+
+		duration := float64(times[i] - times[begin])
+		if duration < 1 {
+			duration = 1
+		}
+		sum := 0.0
+		for j := begin + 1; j <= i; j++ {
+			sum += hashes[j]
+		}
+		rates = append(rates, sum/duration)
+	}
+
+	hr := func(t float64) float64 {
+		i := sort.Search(len(rates), func(i int) bool {
+			return float64(times[i+1]-times[0]) > t
+		})
+		if i >= len(rates) {
+			i = len(rates) - 1
+		}
+		return rates[i]
+	}
+	return hr, len(rates), nil
+}
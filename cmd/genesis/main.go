@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/996BC/996.Blockchain/cmd/internal/config"
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+const (
+	defaultBlockDiffLimit    = "E8100000"
+	defaultEvidenceDiffLimit = "EE100000"
+	defaultBlockInterval     = 90
+)
+
+// seedEvidence is the evidence packed in the genesis block
+type seedEvidence struct {
+	Hash        string `json:"hash"`
+	Description string `json:"description"`
+}
+
+func main() {
+	keyType := flag.Int("t", crypto.PlainKeyType, "key type, 1: plain key, 2: sealed key")
+	keyPath := flag.String("k", "", "key path, the key owner is the miner of the genesis block and signs the seed evidences")
+	timestamp := flag.Int64("time", 0, "genesis block time in unix seconds, default is now")
+	chainID := flag.Int("chain_id", 0, "chain id of the new chain, it should be different from other chains")
+	blockLimit := flag.String("block_diff_limit", defaultBlockDiffLimit, "block difficulty limit")
+	evidenceLimit := flag.String("evidence_diff_limit", defaultEvidenceDiffLimit, "evidence difficulty limit")
+	interval := flag.Int("block_interval", defaultBlockInterval, "expected block interval(seconds)")
+	seeds := flag.String("evidence", "", `optional seed evidences file, format:
+[{"hash": "xxx", "description": "yyy"}]`)
+	parallel := flag.Int("parallel", runtime.NumCPU(), "mining thread number")
+	output := flag.String("o", "./config.json", "output path of the config.json template")
+	decode := flag.String("d", "", "decode and validate the genesis hex with the difficulty limits")
+	cf := flag.String("c", "", "decode and validate the genesis in the anti996 config file")
+	flag.Parse()
+
+	var err error
+	if len(*cf) != 0 {
+		err = validateConfig(*cf)
+	} else if len(*decode) != 0 {
+		err = validate(*decode, *blockLimit, *evidenceLimit)
+	} else if len(*keyPath) != 0 {
+		err = generate(&generateParams{
+			keyType:       *keyType,
+			keyPath:       *keyPath,
+			timestamp:     *timestamp,
+			chainID:       *chainID,
+			blockLimit:    *blockLimit,
+			evidenceLimit: *evidenceLimit,
+			interval:      *interval,
+			seeds:         *seeds,
+			parallel:      *parallel,
+			output:        *output,
+		})
+	} else {
+		fmt.Println("unknown operation, -k to generate a genesis block, -d or -c to validate a genesis block")
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed:%v\n", err)
+		os.Exit(1)
+	}
+}
+
+type generateParams struct {
+	keyType       int
+	keyPath       string
+	timestamp     int64
+	chainID       int
+	blockLimit    string
+	evidenceLimit string
+	interval      int
+	seeds         string
+	parallel      int
+	output        string
+}
+
+func generate(p *generateParams) error {
+	if p.chainID <= 0 || p.chainID > math.MaxUint8 || p.chainID == int(params.DevnetChainID) {
+		return fmt.Errorf("invalid chain id %d", p.chainID)
+	}
+	blockTarget, err := parseLimit(p.blockLimit)
+	if err != nil {
+		return err
+	}
+	evidenceTarget, err := parseLimit(p.evidenceLimit)
+	if err != nil {
+		return err
+	}
+	if p.interval <= 0 {
+		return fmt.Errorf("invalid block interval %d", p.interval)
+	}
+	if p.parallel <= 0 {
+		return fmt.Errorf("invalid parallel num %d", p.parallel)
+	}
+	if _, err := os.Stat(p.output); err == nil {
+		return fmt.Errorf("%s already exists", p.output)
+	}
+	if p.timestamp == 0 {
+		p.timestamp = time.Now().Unix()
+	}
+
+	privKey, err := restoreKey(p.keyType, p.keyPath)
+	if err != nil {
+		return err
+	}
+
+	var evds []*cp.Evidence
+	if len(p.seeds) != 0 {
+		if evds, err = genSeedEvidences(p.seeds, privKey, blockchain.TargetToDiff(evidenceTarget)); err != nil {
+			return err
+		}
+	}
+
+	cb := blockchain.NewGenesis(privKey.PubKey().SerializeCompressed(), p.timestamp, blockTarget, evds)
+	if err := blockchain.VerifyBlockLimits(cb); err != nil {
+		return err
+	}
+
+	fmt.Printf("mining the genesis block with %d threads, wait...\n", p.parallel)
+	begin := time.Now()
+	nonce, err := mine(cb.BlockHeader, p.parallel)
+	if err != nil {
+		return err
+	}
+	cb.SetNonce(nonce)
+	fmt.Printf("found nonce %d in %v\n", nonce, time.Since(begin))
+
+	if err := blockchain.VerifyGenesis(cb, blockTarget, evidenceTarget); err != nil {
+		return fmt.Errorf("verify the generated genesis failed:%v", err)
+	}
+
+	genesis := utils.ToHex(cb.Marshal())
+	printGenesis(cb)
+	fmt.Printf("\ngenesis:\n%s\n\n", genesis)
+
+	conf := &config.Config{
+		NodeType: params.FullNode,
+		IP:       "0.0.0.0",
+		Port:     10080,
+		Seeds:    []string{},
+		MaxPeers: 128,
+		LogLevel: utils.LogInfoLevel,
+		DataPath: "./data",
+		DBEngine: db.BadgerEngine,
+		Key: config.KeyConfig{
+			Type: p.keyType,
+			Path: "./",
+		},
+		ChainID:                 uint8(p.chainID),
+		BlockDifficultyLimit:    fmt.Sprintf("%08X", blockTarget),
+		EvidenceDifficultyLimit: fmt.Sprintf("%08X", evidenceTarget),
+		BlockInterval:           p.interval,
+		ParallelMine:            1,
+		Genesis:                 genesis,
+		Checkpoints:             map[uint64]string{},
+		MaxReorgDepth:           32,
+		DifficultyForks:         []config.DifficultyFork{},
+		HTTPPort:                23666,
+		SnapshotKeys:            []string{},
+		Compression:             true,
+	}
+	confB, err := json.MarshalIndent(conf, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p.output, confB, 0600); err != nil {
+		return fmt.Errorf("write config template failed:%v", err)
+	}
+	fmt.Printf("Finish, the config template is saved to %s, fill in the seeds before running anti996\n", p.output)
+	return nil
+}
+
+func validate(genesis string, blockLimit string, evidenceLimit string) error {
+	blockTarget, err := parseLimit(blockLimit)
+	if err != nil {
+		return err
+	}
+	evidenceTarget, err := parseLimit(evidenceLimit)
+	if err != nil {
+		return err
+	}
+
+	cb, err := blockchain.DecodeGenesis(genesis)
+	if err != nil {
+		return fmt.Errorf("decode genesis failed:%v", err)
+	}
+	printGenesis(cb)
+
+	if err := blockchain.VerifyGenesis(cb, blockTarget, evidenceTarget); err != nil {
+		return fmt.Errorf("invalid genesis:%v", err)
+	}
+	fmt.Println("\nThe genesis block is valid.")
+	return nil
+}
+
+func validateConfig(cf string) error {
+	if err := utils.AccessCheck(cf); err != nil {
+		return err
+	}
+
+	confB, err := ioutil.ReadFile(cf)
+	if err != nil {
+		return fmt.Errorf("read config file failed:%v", err)
+	}
+
+	conf := &config.Config{}
+	if err := json.Unmarshal(confB, conf); err != nil {
+		return fmt.Errorf("config parse failed:%v", err)
+	}
+
+	if conf.Devnet {
+		fmt.Println("devnet mode, validate the built-in devnet genesis")
+		limit := fmt.Sprintf("%08X", params.DevnetTargetLimit)
+		return validate(blockchain.DevnetGenesis(), limit, limit)
+	}
+	fmt.Printf("chain id %d\n", conf.ChainID)
+	return validate(conf.Genesis, conf.BlockDifficultyLimit, conf.EvidenceDifficultyLimit)
+}
+
+func parseLimit(limit string) (uint32, error) {
+	target, err := strconv.ParseUint(limit, 16, 32)
+	if err != nil || len(limit) != 8 {
+		return 0, fmt.Errorf("invalid difficulty limit %s", limit)
+	}
+	return uint32(target), nil
+}
+
+func restoreKey(keyType int, path string) (*btcec.PrivateKey, error) {
+	switch keyType {
+	case crypto.PlainKeyType:
+		return crypto.RestorePKey(path)
+	case crypto.SealKeyType:
+		return crypto.RestoreSKey(path)
+	default:
+		return nil, fmt.Errorf("invalid key type %d", keyType)
+	}
+}
+
+func genSeedEvidences(file string, privKey *btcec.PrivateKey, difficulty *big.Int) ([]*cp.Evidence, error) {
+	if err := utils.AccessCheck(file); err != nil {
+		return nil, err
+	}
+
+	seedsB, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read seed evidences file failed:%v", err)
+	}
+
+	var seeds []*seedEvidence
+	if err := json.Unmarshal(seedsB, &seeds); err != nil {
+		return nil, fmt.Errorf("parse seed evidences failed:%v", err)
+	}
+
+	pubKey := privKey.PubKey().SerializeCompressed()
+	var result []*cp.Evidence
+	for _, seed := range seeds {
+		hash, err := utils.FromHex(seed.Hash)
+		if err != nil || len(hash) != utils.HashLength {
+			return nil, fmt.Errorf("invalid seed evidence hash %s", seed.Hash)
+		}
+		if err := cp.VerifyDescription(seed.Description); err != nil {
+			return nil, err
+		}
+
+		evd := cp.NewEvidenceV1(hash, []byte(seed.Description), pubKey)
+		if err := evd.Sign(privKey); err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("doing pow for evidence %s, wait...\n", seed.Hash)
+		for evd.NextNonce().Cmp(difficulty) >= 0 {
+			continue
+		}
+		result = append(result, evd)
+	}
+	return result, nil
+}
+
+// mine finds the nonce parallelly in the whole nonce space
+func mine(header *cp.BlockHeader, parallel int) (uint32, error) {
+	difficulty := blockchain.TargetToDiff(header.Target)
+	indexInterval := uint32(math.MaxUint32 / parallel)
+
+	found := make(chan uint32, parallel)
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		begin := uint32(i) * indexInterval
+		end := begin + indexInterval - 1
+		if i == parallel-1 {
+			end = math.MaxUint32
+		}
+
+		h := header.ShallowCopy()
+		h.SetNonce(begin)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the first NextNonce hashes the header as it is,
+			// so the nonce begin is tried before any increment
+			pow := h.NextNonce()
+			for {
+				if pow.Cmp(difficulty) < 0 {
+					found <- h.Nonce
+					return
+				}
+				if h.Nonce == end {
+					return
+				}
+
+				// check the stop signal occasionally
+				if h.Nonce&0xFFFF == 0 {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+				pow = h.NextNonce()
+			}
+		}()
+	}
+
+	finished := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case nonce := <-found:
+		close(stop)
+		wg.Wait()
+		return nonce, nil
+	case <-finished:
+		select {
+		case nonce := <-found:
+			return nonce, nil
+		default:
+			return 0, fmt.Errorf("nonce not found, try another time")
+		}
+	}
+}
+
+func printGenesis(cb *cp.Block) {
+	fmt.Printf("Hash:\t\t%X\n", cb.GetSerializedHash())
+	fmt.Printf("Version:\t%d\n", cb.Version)
+	fmt.Printf("Time:\t\t%s (%d)\n", utils.TimeToString(cb.Time), cb.Time)
+	fmt.Printf("Nonce:\t\t%d\n", cb.Nonce)
+	fmt.Printf("Target:\t\t%08X\n", cb.Target)
+	fmt.Printf("Miner:\t\t%s\n", crypto.BytesToID(cb.Miner))
+	fmt.Printf("EvidenceRoot:\t%X\n", cb.EvidenceRoot)
+	fmt.Printf("Evidences:\t%d\n", len(cb.Evds))
+	for i, evd := range cb.Evds {
+		fmt.Printf("\t%d.%X %s (owner %s)\n", i+1, evd.Hash, string(evd.Description),
+			crypto.BytesToID(evd.PubKey))
+	}
+}
@@ -0,0 +1,195 @@
+// Package config is the config file of anti996, it's shared with the tools generating or reading it
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"runtime"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// Config is the content of the config file
+type Config struct {
+	NodeType                params.NodeType   `json:"node_type"`
+	IP                      string            `json:"ip"`
+	Port                    int               `json:"port"`
+	Seeds                   []string          `json:"seeds"`
+	MaxPeers                int               `json:"max_peers"`
+	LogLevel                int               `json:"log_level"`
+	DataPath                string            `json:"data_path"`
+	DBEngine                string            `json:"db_engine"`
+	Key                     KeyConfig         `json:"key"`
+	ChainID                 uint8             `json:"chain_id"`
+	BlockDifficultyLimit    string            `json:"block_diff_limit"`
+	EvidenceDifficultyLimit string            `json:"evidence_diff_limit"`
+	BlockInterval           int               `json:"block_interval"`
+	ParallelMine            int               `json:"parallel_mine"`
+	Genesis                 string            `json:"genesis"`
+	Checkpoints             map[uint64]string `json:"checkpoints"`
+	MaxReorgDepth           uint64            `json:"max_reorg_depth"`
+	DifficultyForks         []DifficultyFork  `json:"difficulty_forks"`
+	HTTPPort                int               `json:"http_port"`
+	AdminRPC                bool              `json:"admin_rpc"`
+	Devnet                  bool              `json:"devnet"`
+	SnapshotKeys            []string          `json:"snapshot_keys"`
+	SnapshotMinSignatures   int               `json:"snapshot_min_signatures"`
+	AcceptDiscoverV1        bool              `json:"accept_discover_v1"`
+	Compression             bool              `json:"compression"`
+}
+
+type DifficultyFork struct {
+	Height    uint64 `json:"height"`
+	Algorithm string `json:"algorithm"`
+}
+
+type KeyConfig struct {
+	Type int    `json:"type"`
+	Path string `json:"path"`
+}
+
+// Parse reads and verifies the config file, the chain parameters are overridden in devnet mode
+func Parse(cf string) (*Config, error) {
+	if len(cf) == 0 {
+		return nil, fmt.Errorf("miss config file")
+	}
+
+	if err := utils.AccessCheck(cf); err != nil {
+		return nil, err
+	}
+
+	jsonContent, err := ioutil.ReadFile(cf)
+	if err != nil {
+		return nil, fmt.Errorf("read config file failed:%v", err)
+	}
+
+	conf := &Config{}
+	if err := json.Unmarshal(jsonContent, &conf); err != nil {
+		return nil, fmt.Errorf("config parse failed:%v", err)
+	}
+
+	if conf.Devnet {
+		setDevnetConfig(conf)
+	} else if conf.ChainID == params.DevnetChainID {
+		return nil, fmt.Errorf("chain id %d is reserved for devnet", params.DevnetChainID)
+	}
+
+	if err := verifyConfig(conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func verifyConfig(c *Config) error {
+
+	if c.NodeType != params.FullNode && c.NodeType != params.LightNode {
+		return fmt.Errorf("invalid node type:%d", c.NodeType)
+	}
+
+	if ip := net.ParseIP(c.IP); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("invalid IPv4:%s", c.IP)
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port:%d", c.Port)
+	}
+
+	if c.MaxPeers <= 0 {
+		return fmt.Errorf("invalid max peer number:%d", c.MaxPeers)
+	}
+
+	if c.LogLevel < utils.LogErrorLevel || c.LogLevel > utils.LogDebugLevel {
+		return fmt.Errorf("invalid log level:%d", c.LogLevel)
+	}
+
+	if err := utils.AccessCheck(c.DataPath); err != nil {
+		return err
+	}
+	fmt.Printf("data path:%s\n", c.DataPath)
+
+	if len(c.DBEngine) == 0 {
+		c.DBEngine = db.BadgerEngine
+	}
+	if c.DBEngine != db.BadgerEngine && c.DBEngine != db.BoltEngine && c.DBEngine != db.MemoryEngine {
+		return fmt.Errorf("invalid db engine:%s", c.DBEngine)
+	}
+
+	if c.Key.Type != crypto.SealKeyType && c.Key.Type != crypto.PlainKeyType {
+		return fmt.Errorf("invalid key type")
+	}
+
+	if err := utils.AccessCheck(c.Key.Path); err != nil {
+		return err
+	}
+
+	if len(c.BlockDifficultyLimit) != 8 || len(c.EvidenceDifficultyLimit) != 8 {
+		return fmt.Errorf("invalid difficulty limit")
+	}
+
+	if c.BlockInterval <= 0 {
+		return fmt.Errorf("invalid block interval")
+	}
+
+	if c.ParallelMine < 0 || c.ParallelMine > runtime.NumCPU() {
+		return fmt.Errorf("invalid parallel num")
+	}
+
+	if c.NodeType == params.LightNode && c.ParallelMine != 0 {
+		return fmt.Errorf("the light node doesn't mine, set parallel_mine to 0")
+	}
+
+	if len(c.Genesis) == 0 {
+		return fmt.Errorf("invalid genesis")
+	}
+
+	for height, hash := range c.Checkpoints {
+		if height == 0 || len(hash) != 2*utils.HashLength {
+			return fmt.Errorf("invalid checkpoint %s at height %d", hash, height)
+		}
+	}
+
+	for _, fork := range c.DifficultyForks {
+		if fork.Height == 0 || len(fork.Algorithm) == 0 {
+			return fmt.Errorf("invalid difficulty fork %s at height %d", fork.Algorithm, fork.Height)
+		}
+		if fork.Algorithm == blockchain.FixedAlgorithm && !c.Devnet {
+			return fmt.Errorf("difficulty algorithm %s is only for devnet", fork.Algorithm)
+		}
+	}
+
+	if c.HTTPPort <= 0 || c.HTTPPort > 65535 || c.HTTPPort == c.Port {
+		return fmt.Errorf("invalid http port:%d", c.HTTPPort)
+	}
+
+	for _, id := range c.SnapshotKeys {
+		if crypto.IDToPubKey(id) == nil {
+			return fmt.Errorf("invalid snapshot key:%s", id)
+		}
+	}
+
+	if c.SnapshotMinSignatures < 0 || c.SnapshotMinSignatures > len(c.SnapshotKeys) {
+		return fmt.Errorf("invalid snapshot min signatures:%d", c.SnapshotMinSignatures)
+	}
+
+	return nil
+}
+
+// setDevnetConfig overrides the chain parameters with the built-in devnet ones
+func setDevnetConfig(c *Config) {
+	c.ChainID = params.DevnetChainID
+	c.BlockDifficultyLimit = fmt.Sprintf("%08X", params.DevnetTargetLimit)
+	c.EvidenceDifficultyLimit = fmt.Sprintf("%08X", params.DevnetTargetLimit)
+	c.BlockInterval = params.DevnetBlockInterval
+	c.Genesis = blockchain.DevnetGenesis()
+	c.Checkpoints = nil
+	// the blocks mined back to back don't raise the difficulty
+	c.DifficultyForks = []DifficultyFork{{Height: 1, Algorithm: blockchain.FixedAlgorithm}}
+	fmt.Printf("devnet mode, chain id %d\n", c.ChainID)
+}
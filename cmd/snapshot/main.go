@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/996BC/996.Blockchain/core/snapshot"
+	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+func main() {
+	dbpath := flag.String("dbpath", "", "path of database to export, the node should be stopped")
+	output := flag.String("o", "", "output path of the snapshot, the manifest is saved with the .manifest suffix")
+	height := flag.Uint64("height", 0, "export the blocks up to the height, default is the latest height")
+	nodeType := flag.Int("type", int(params.FullNode), "node type of the database to export, 1: full node, 2: light node")
+	sign := flag.String("s", "", "sign the manifest of the snapshot path")
+	keyType := flag.Int("t", crypto.PlainKeyType, "key type, 1: plain key, 2: sealed key")
+	keyPath := flag.String("k", "", "key path of the signer")
+	info := flag.String("i", "", "show the manifest of the snapshot path and check the data file")
+	flag.Parse()
+
+	var err error
+	if len(*dbpath) != 0 {
+		err = export(*dbpath, *output, *height, params.NodeType(*nodeType))
+	} else if len(*sign) != 0 {
+		err = signManifest(*sign, *keyType, *keyPath)
+	} else if len(*info) != 0 {
+		err = showManifest(*info)
+	} else {
+		fmt.Println("unknown operation, -dbpath to export a snapshot, -s to sign it, -i to show it")
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed:%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func export(dbpath string, output string, height uint64, nodeType params.NodeType) error {
+	if len(output) == 0 {
+		return fmt.Errorf("empty output path")
+	}
+	if err := utils.AccessCheck(dbpath); err != nil {
+		return err
+	}
+	if err := db.Init(dbpath); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	manifest, err := snapshot.Export(output, height, nodeType)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("export snapshot of height %d with %d entries to %s\n", manifest.Height, manifest.Entries, output)
+	return nil
+}
+
+func signManifest(path string, keyType int, keyPath string) error {
+	manifest, err := snapshot.LoadManifest(path + snapshot.ManifestSuffix)
+	if err != nil {
+		return err
+	}
+	if err := manifest.CheckDigest(path); err != nil {
+		return err
+	}
+
+	privKey, err := restoreKey(keyType, keyPath)
+	if err != nil {
+		return err
+	}
+	if err := manifest.Sign(privKey); err != nil {
+		return err
+	}
+	if err := manifest.Save(path + snapshot.ManifestSuffix); err != nil {
+		return err
+	}
+	fmt.Printf("signed by %s\n", crypto.PrivKeyToID(privKey))
+	return nil
+}
+
+func showManifest(path string) error {
+	manifest, err := snapshot.LoadManifest(path + snapshot.ManifestSuffix)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version:  %d\n", manifest.Version)
+	fmt.Printf("genesis:  %s\n", manifest.Genesis)
+	fmt.Printf("type:     %d\n", manifest.NodeType)
+	fmt.Printf("height:   %d\n", manifest.Height)
+	fmt.Printf("hash:     %s\n", manifest.Hash)
+	fmt.Printf("entries:  %d\n", manifest.Entries)
+	fmt.Printf("digest:   %s\n", manifest.Digest)
+	fmt.Printf("time:     %s\n", utils.TimeToString(manifest.Time))
+	for _, s := range manifest.Signatures {
+		valid := "valid"
+		if err := manifest.VerifySignatures([]string{s.Signer}, 1); err != nil {
+			valid = err.Error()
+		}
+		fmt.Printf("signer:   %s (%s)\n", s.Signer, valid)
+	}
+
+	if err := manifest.CheckDigest(path); err != nil {
+		return err
+	}
+	fmt.Println("data file matches the manifest")
+	return nil
+}
+
+func restoreKey(keyType int, path string) (*btcec.PrivateKey, error) {
+	switch keyType {
+	case crypto.PlainKeyType:
+		return crypto.RestorePKey(path)
+	case crypto.SealKeyType:
+		return crypto.RestoreSKey(path)
+	default:
+		return nil, fmt.Errorf("invalid key type %d", keyType)
+	}
+}
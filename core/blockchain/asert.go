@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+)
+
+const (
+	// asertHalfLifeBlocks is the number of block intervals
+	// that the difficulty doubles or halves if blocks are continuously late or early by it
+	asertHalfLifeBlocks = 72
+
+	asertRadixBits = 16
+	asertRadix     = 1 << asertRadixBits
+)
+
+// asert is the absolutely scheduled exponentially rising targets algorithm in relative form,
+// the difficulty changes exponentially by how far the latest solve time is away from the interval
+type asert struct {
+	difficultyParams
+}
+
+func newASERT(targetLimit uint32, interval time.Duration) *asert {
+	return &asert{newDifficultyParams(targetLimit, interval)}
+}
+
+func (a *asert) Name() string {
+	return ASERTAlgorithm
+}
+
+func (a *asert) Window() int {
+	return 2
+}
+
+func (a *asert) NextTarget(prev []*BlockTiming, newBlockTime int64) uint32 {
+	interval := int64(a.interval / time.Second)
+	halfLife := asertHalfLifeBlocks * interval
+
+	head := prev[len(prev)-1]
+	solveTime := head.Time - prev[len(prev)-2].Time
+
+	// next = last * 2^((solveTime - interval) / halfLife)
+	// the exponent is a fixed-point number with 16 fractional bits
+	exponent := (solveTime - interval) * asertRadix / halfLife
+	shifts := exponent >> asertRadixBits
+	frac := uint64(exponent - shifts<<asertRadixBits)
+
+	// 2^frac is approximated by a cubic polynomial within 0.013% error
+	factor := asertRadix + ((195766423245049*frac +
+		971821376*frac*frac +
+		5127*frac*frac*frac +
+		(1 << 47)) >> 48)
+
+	nextDiff := TargetToDiff(head.Target)
+	nextDiff.Mul(nextDiff, new(big.Int).SetUint64(factor))
+	if shifts < 0 {
+		nextDiff.Rsh(nextDiff, uint(-shifts))
+	} else {
+		nextDiff.Lsh(nextDiff, uint(shifts))
+	}
+	nextDiff.Rsh(nextDiff, asertRadixBits)
+
+	return a.limitTarget(nextDiff)
+}
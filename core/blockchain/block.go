@@ -90,3 +90,22 @@ func (b *block) remove() (*block, error) {
 	b.removeBackward()
 	return backward, nil
 }
+
+// commonAncestor returns the fork point of two blocks, nil if it has been removed from the cache
+func commonAncestor(a *block, b *block) *block {
+	for a != nil && b != nil && a != b {
+		if a.height > b.height {
+			a = a.backward
+		} else if b.height > a.height {
+			b = b.backward
+		} else {
+			a = a.backward
+			b = b.backward
+		}
+	}
+
+	if a != b {
+		return nil
+	}
+	return a
+}
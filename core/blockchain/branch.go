@@ -19,12 +19,16 @@ type branch struct {
 
 	evidenceCache sync.Map // <string, *cp.Evidence>, hex(hash) of evidence as key
 	blockCache    sync.Map // <string, *block>
+
+	// evidenceExists checks whether the evidence is in the blocks out of the cache
+	evidenceExists func(hash []byte) bool
 }
 
 func newBranch(begin *block) *branch {
 	result := &branch{
-		head: begin,
-		tail: begin,
+		head:           begin,
+		tail:           begin,
+		evidenceExists: db.HasEvidence,
 	}
 
 	iter := begin
@@ -50,7 +54,9 @@ func newBranch(begin *block) *branch {
 // the branch should never use after removing
 // eg.
 // A --> B --> C --> D           (main branch)
-//             | --> E --> F     (fork branch)
+//
+//	| --> E --> F     (fork branch)
+//
 // if the fork branch call remove(), then the C will not point to E, the E will not point to F,
 // but the C still points to D
 func (b *branch) remove() {
@@ -85,6 +91,20 @@ func (b *branch) add(newBlock *block) error {
 	return nil
 }
 
+// trim removes the blocks from the tail and keeps the latest 'num' blocks
+func (b *branch) trim(num int) {
+	newTail := b.head
+	for i := 1; i < num && newTail.backward != nil; i++ {
+		newTail = newTail.backward
+	}
+
+	for iter := newTail.backward; iter != nil; iter = iter.backward {
+		b.removeFromCache(iter)
+	}
+	newTail.removeBackward()
+	b.tail = newTail
+}
+
 func (b *branch) hash() []byte {
 	return b.head.hash
 }
@@ -94,25 +114,26 @@ func (b *branch) height() uint64 {
 }
 
 func (b *branch) nextBlockTarget(newBlockTime int64) uint32 {
-	if b.head.height <= ReferenceBlocks+1 { // ignore the genesis block
+	algorithm := difficultyAlgorithmAt(b.head.height + 1)
+	window := algorithm.Window()
+	if b.head.height <= uint64(window) { // ignore the genesis block
 		return BlockTargetLimit
 	}
 
-	newTime := time.Unix(newBlockTime, 0)
-	headTime := time.Unix(b.head.time(), 0)
-
+	prev := make([]*BlockTiming, window)
 	preBlock := b.head
-	for i := 0; i < ReferenceBlocks; i++ {
-		if preBlock.backward == nil {
+	for i := window - 1; i >= 0; i-- {
+		if preBlock == nil {
 			logger.Fatal("bug: i %d, b.head.heigh %d, branch info %s\n", i, b.head.height, b.String())
 		}
+		prev[i] = &BlockTiming{
+			Time:   preBlock.time(),
+			Target: preBlock.target(),
+		}
 		preBlock = preBlock.backward
 	}
-	tailBlockTime := time.Unix(preBlock.time(), 0)
 
-	lastTarget := b.head.target()
-	return CalculateTarget(lastTarget, newTime.Sub(headTime),
-		headTime.Sub(tailBlockTime))
+	return algorithm.NextTarget(prev, newBlockTime)
 }
 
 func (b *branch) getBlock(hash []byte) *block {
@@ -136,17 +157,44 @@ func (b *branch) getEvidence(hash []byte) *cp.Evidence {
 	return nil
 }
 
-func (b *branch) verifyBlock(cb *cp.Block) error {
+// verifyBlock checks the block appended to the branch,
+// the evidences are verified one by one if fully is true even if the block is assumed valid
+func (b *branch) verifyBlock(cb *cp.Block, fully bool) error {
+	height := b.height() + 1
+
+	// the evidences of the checkpointed blocks are not verified one by one
+	skipEvidence := !fully && assumeValid(cb.GetSerializedHash())
+
+	// the cheap limits are checked before the signatures of the evidences
+	if err := VerifyBlockLimits(cb); err != nil {
+		return err
+	}
+
 	// basically check via block itself
-	if err := cb.Verify(); err != nil {
-		return fmt.Errorf("block struct verify failed:%v", err)
+	if headerOnly {
+		if err := cb.BlockHeader.Verify(); err != nil {
+			return fmt.Errorf("block header verify failed:%v", err)
+		}
+	} else if skipEvidence {
+		if err := cb.VerifyWithoutEvidence(); err != nil {
+			return fmt.Errorf("block struct verify failed:%v", err)
+		}
+	} else {
+		if err := cb.Verify(); err != nil {
+			return fmt.Errorf("block struct verify failed:%v", err)
+		}
 	}
 
 	// deeply check via blockchain context
+	// 0. checkpoint
+	if err := checkpointCheck(height, cb.GetSerializedHash()); err != nil {
+		return err
+	}
+
 	// 1. time
 	t := time.Unix(cb.Time, 0)
 	if t.Sub(time.Now()) > 3*time.Second {
-		return fmt.Errorf("invalid future time")
+		return ErrFutureBlock{cb.Time}
 	}
 	if t.Before(time.Unix(b.head.time(), 0)) {
 		return fmt.Errorf("invalid past time")
@@ -168,15 +216,17 @@ func (b *branch) verifyBlock(cb *cp.Block) error {
 		return fmt.Errorf("pow check failed")
 	}
 
-	// 5. evidence
-	if cb.IsEmptyEvidenceRoot() {
+	// 5. evidence, the light node doesn't have it
+	if cb.IsEmptyEvidenceRoot() || headerOnly {
 		return nil
 	}
 
 	var leafs merkle.MerkleLeafs
 	for _, e := range cb.Evds {
-		if err := b.verifyEvidence(e); err != nil {
-			return err
+		if !skipEvidence {
+			if err := b.verifyEvidence(e); err != nil {
+				return err
+			}
 		}
 		leafs = append(leafs, e.GetSerializedHash())
 	}
@@ -194,15 +244,11 @@ func (b *branch) verifyBlock(cb *cp.Block) error {
 // 2. whether the account has uploaded the evidence before
 func (b *branch) verifyEvidence(e *cp.Evidence) error {
 	// basically check via evidence itself
-	if err := e.Verify(); err != nil {
-		return fmt.Errorf("evidence struct verify failed:%v", err)
+	if err := VerifyEvidence(e); err != nil {
+		return err
 	}
 
 	// deeply check via blockchain context
-	// pow
-	if !b.powCheck(EvidenceDifficultyLimit, e.GetPow()) {
-		return fmt.Errorf("pow check of %X failed", e.Hash)
-	}
 
 	// cache checking
 	if v := b.getEvidence(e.Hash); v != nil {
@@ -210,7 +256,7 @@ func (b *branch) verifyEvidence(e *cp.Evidence) error {
 	}
 
 	// db checking
-	if db.HasEvidence(e.Hash) {
+	if b.evidenceExists(e.Hash) {
 		return ErrEvidenceAlreadyExist{e.Hash}
 	}
 
@@ -24,15 +24,27 @@ const (
 
 var logger = utils.NewLogger("chain")
 
+// InvalidBlock reports the peer who sends the block which fails the verification
+type InvalidBlock struct {
+	Peer string
+	Err  ErrInvalidBlock
+}
+
+type peerBlocks struct {
+	blocks []*cp.Block
+	peer   string
+}
+
 type Chain struct {
 	PassiveChangeNotify chan bool
+	InvalidBlockNotify  chan *InvalidBlock
 
 	oldestBlock   *block
 	branches      []*branch
 	longestBranch *branch
 	lastHeight    uint64
 	branchLock    sync.Mutex
-	pendingBlocks chan []*cp.Block
+	pendingBlocks chan *peerBlocks
 	lm            *utils.LoopMode
 }
 
@@ -40,7 +52,8 @@ type Chain struct {
 func NewChain() *Chain {
 	return &Chain{
 		PassiveChangeNotify: make(chan bool, 1),
-		pendingBlocks:       make(chan []*cp.Block, 16),
+		InvalidBlockNotify:  make(chan *InvalidBlock, 16),
+		pendingBlocks:       make(chan *peerBlocks, 16),
 		lm:                  utils.NewLoop(1),
 	}
 }
@@ -50,11 +63,37 @@ type Config struct {
 	EvidenceTargetLimit uint32
 	BlockInterval       int
 	Genesis             string
+
+	// Checkpoints are the hex hashes of blocks indexed by height
+	Checkpoints   map[uint64]string
+	MaxReorgDepth uint64
+
+	// DifficultyForks switches the difficulty algorithm at the heights,
+	// the weighted average algorithm is used if it's empty
+	DifficultyForks []*DifficultyFork
+
+	// LightNode only verifies and stores the block headers
+	LightNode bool
 }
 
 // Init initializes the chain from db, should call only once
 func (c *Chain) Init(conf *Config) error {
 	initMiningParams(conf)
+	initHeaderOnly(conf)
+	if err := initDifficultySchedule(conf); err != nil {
+		logger.Warn("chain init failed:%v\n", err)
+		return err
+	}
+	if err := initCheckpoints(conf); err != nil {
+		logger.Warn("chain init failed:%v\n", err)
+		return err
+	}
+
+	if db.IsImporting() {
+		err := fmt.Errorf("the snapshot import is incomplete, remove the data path and import again")
+		logger.Warn("chain init failed:%v\n", err)
+		return err
+	}
 
 	if !db.HasGenesis() {
 		logger.Info("chain starts with empty database")
@@ -65,6 +104,17 @@ func (c *Chain) Init(conf *Config) error {
 		return nil
 	}
 
+	if db.IsReindexing() {
+		err := fmt.Errorf("the indexes are incomplete, run with -reindex to finish reindexing")
+		logger.Warn("chain init failed:%v\n", err)
+		return err
+	}
+
+	if err := genesisCheck(conf.Genesis); err != nil {
+		logger.Warn("chain init failed:%v\n", err)
+		return err
+	}
+
 	return c.initFromDB()
 }
 
@@ -83,7 +133,16 @@ func (c *Chain) AddBlocks(blocks []*cp.Block, local bool) {
 		c.addBlocks(blocks, local)
 		return
 	}
-	c.pendingBlocks <- blocks
+	c.pendingBlocks <- &peerBlocks{blocks: blocks}
+}
+
+// AddPeerBlocks appends new blocks received from the peer to the chain,
+// the peer will be reported by InvalidBlockNotify if the blocks fail the verification
+func (c *Chain) AddPeerBlocks(blocks []*cp.Block, peerID string) {
+	c.pendingBlocks <- &peerBlocks{
+		blocks: blocks,
+		peer:   peerID,
+	}
 }
 
 // NextBlockTarget returns next block required target
@@ -101,6 +160,13 @@ func (c *Chain) LatestBlockHash() []byte {
 	return c.longestBranch.hash()
 }
 
+// LatestHeight returns the longest branch latest block height
+func (c *Chain) LatestHeight() uint64 {
+	c.branchLock.Lock()
+	defer c.branchLock.Unlock()
+	return c.longestBranch.height()
+}
+
 // GetSyncHash returns the synchronize used block hash and height difference
 func (c *Chain) GetSyncHash(base []byte) (end []byte, heightDiff uint32, err error) {
 	c.branchLock.Lock()
@@ -164,16 +230,16 @@ func (c *Chain) GetSyncBlocks(base []byte, end []byte, onlyHeader bool) ([]*cp.B
 	if baseBlock != nil && endBlock != nil && baseBlock.height < endBlock.height {
 		iter := endBlock
 		for {
-			if iter.height == baseBlock.height {
-				// ignore the base block
-				break
-			}
-
 			if iter == nil {
 				// flushing cache to db happens during this time
 				return nil, ErrFlushingCache{base}
 			}
 
+			if iter.height == baseBlock.height {
+				// ignore the base block
+				break
+			}
+
 			result = append([]*cp.Block{iter.Block.ShallowCopy(onlyHeader)}, result...)
 			iter = iter.backward
 		}
@@ -194,7 +260,11 @@ func (c *Chain) GetSyncBlocks(base []byte, end []byte, onlyHeader bool) ([]*cp.B
 	sEndBlock, endHeight, _ := db.GetBlockViaHash(end)
 	if sBaseBlock != nil && sEndBlock != nil && baseHeight < endHeight {
 		for i := baseHeight + 1; i <= endHeight; i++ {
-			sBlock, _, _ := db.GetBlockViaHeight(i)
+			sBlock, _, err := db.GetBlockViaHeight(i)
+			if err != nil {
+				logger.Warn("height %d, broken db data for block:%v\n", i, err)
+				return nil, err
+			}
 			result = append(result, sBlock.ShallowCopy(onlyHeader))
 		}
 		return result, nil
@@ -207,6 +277,94 @@ func (c *Chain) GetSyncBlocks(base []byte, end []byte, onlyHeader bool) ([]*cp.B
 	return nil, ErrHashNotFound{base}
 }
 
+// VerifySyncHeaders checks the checkpoints and the targets of the synced headers after the base
+// against the difficulty algorithms, so a peer can't feed a long header chain of the easiest targets,
+// the blocks of the headers reaching the last checkpoint are assumed valid;
+// it returns ErrHashNotFound or ErrFlushingCache if the blocks before the base are unavailable
+func (c *Chain) VerifySyncHeaders(base []byte, headers []*cp.BlockHeader) error {
+	c.branchLock.Lock()
+	defer c.branchLock.Unlock()
+
+	window := maxDifficultyWindow()
+	prev, baseHeight, err := c.getPrevHeaders(base, window)
+	if err != nil {
+		return err
+	}
+
+	// the headers are checked on a temporary branch of the headers only
+	firstHeight := baseHeight - uint64(len(prev)) + 1
+	bc := newBranch(newBlock(cp.NewBlock(prev[0], nil), firstHeight, true))
+	for i, h := range prev[1:] {
+		bc.add(newBlock(cp.NewBlock(h, nil), firstHeight+uint64(i)+1, true))
+	}
+
+	var hashes [][]byte
+	for i, h := range headers {
+		height := baseHeight + uint64(i) + 1
+		hash := h.GetSerializedHash()
+		if err := checkpointCheck(height, hash); err != nil {
+			return err
+		}
+		if expected := bc.nextBlockTarget(h.Time); h.Target != expected {
+			return fmt.Errorf("header %X of height %d mismatch target %d, expect %d",
+				hash, height, h.Target, expected)
+		}
+		bc.add(newBlock(cp.NewBlock(h, nil), height, true))
+		bc.trim(window)
+		hashes = append(hashes, hash)
+	}
+
+	// the headers are linked, so the ones not higher than the last checkpoint are its ancestors
+	lastHeight := baseHeight + uint64(len(headers))
+	if lastCheckpointHeight > baseHeight && lastCheckpointHeight <= lastHeight {
+		setAssumedValid(hashes[:lastCheckpointHeight-baseHeight])
+	}
+	return nil
+}
+
+// getPrevHeaders returns at most num headers ending at the hash in increasing height order, and the height of the hash
+func (c *Chain) getPrevHeaders(hash []byte, num int) ([]*cp.BlockHeader, uint64, error) {
+	var iter *block
+	for _, bc := range c.branches {
+		if iter = bc.getBlock(hash); iter != nil {
+			break
+		}
+	}
+
+	var height uint64
+	if iter != nil {
+		height = iter.height
+	} else {
+		_, h, err := db.GetHeaderViaHash(hash)
+		if err != nil {
+			return nil, 0, ErrHashNotFound{hash}
+		}
+		height = h
+	}
+
+	// the blocks out of the cache are read from the db
+	var result []*cp.BlockHeader
+	for h := height; h >= 1 && len(result) < num; h-- {
+		if iter != nil {
+			result = append(result, iter.BlockHeader)
+			iter = iter.backward
+			continue
+		}
+
+		header, _, err := db.GetHeaderViaHeight(h)
+		if err != nil {
+			// flushing cache to db happens during this time
+			return nil, 0, ErrFlushingCache{hash}
+		}
+		result = append(result, header)
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, height, nil
+}
+
 // GetSyncBlockHash returns the latest block hash of each branches
 func (c *Chain) GetSyncBlockHash() [][]byte {
 	c.branchLock.Lock()
@@ -257,16 +415,34 @@ func (c *Chain) GetUnstoredBlocks() ([]*cp.Block, []uint64) {
 	return blocks, heights
 }
 
-func (c *Chain) initGenesis(genesis string) error {
-	var genesisB []byte
-	var cb *cp.Block
-	var err error
+// Flush stores all the unstored blocks of the longest branch into db,
+// it's used by the offline import which runs without the maintaining loop
+func (c *Chain) Flush() error {
+	c.maintain()
 
-	if genesisB, err = utils.FromHex(genesis); err != nil {
+	c.branchLock.Lock()
+	defer c.branchLock.Unlock()
+
+	var unstored []*block
+	for iter := c.longestBranch.head; iter != nil && !iter.isStored(); iter = iter.backward {
+		unstored = append(unstored, iter)
+	}
+	for i := len(unstored) - 1; i >= 0; i-- {
+		if err := db.PutBlock(unstored[i].Block, unstored[i].height); err != nil {
+			return err
+		}
+		unstored[i].stored = true
+	}
+	return nil
+}
+
+func (c *Chain) initGenesis(genesis string) error {
+	cb, err := DecodeGenesis(genesis)
+	if err != nil {
 		return err
 	}
 
-	if cb, err = cp.UnmarshalBlock(bytes.NewReader(genesisB)); err != nil {
+	if err = checkpointCheck(1, cb.GetSerializedHash()); err != nil {
 		return err
 	}
 
@@ -286,15 +462,22 @@ func (c *Chain) initFromDB() error {
 		logger.Warn("get latest height failed:%v\n", err)
 		return err
 	}
-	if lastHeight > ReferenceBlocks {
-		beginHeight = lastHeight - ReferenceBlocks // only takes the last 'ReferenceBlocks' blocks into cache
+	if err := storedCheckpointsCheck(lastHeight); err != nil {
+		logger.Warn("checkpoints check failed:%v\n", err)
+		return err
+	}
+
+	// only takes the blocks required by difficulty adjustment into cache
+	window := uint64(maxDifficultyWindow())
+	if lastHeight > window {
+		beginHeight = lastHeight - window
 	}
 
 	var blocks []*block
 	for height := beginHeight; height <= lastHeight; height++ {
 		cb, _, err := db.GetBlockViaHeight(height)
 		if err != nil {
-			return fmt.Errorf("height %d, broken db data for block", height)
+			return fmt.Errorf("height %d, broken db data for block:%v, run with -verify-chain to check the database", height, err)
 		}
 
 		blocks = append(blocks, newBlock(cb, height, true))
@@ -328,8 +511,11 @@ func (c *Chain) loop() {
 			return
 		case <-maintainTicker.C:
 			c.maintain()
-		case blocks := <-c.pendingBlocks:
-			c.addBlocks(blocks, false)
+		case pb := <-c.pendingBlocks:
+			err := c.addBlocks(pb.blocks, false)
+			if invalid, ok := err.(ErrInvalidBlock); ok && len(pb.peer) != 0 {
+				c.reportInvalidBlock(pb.peer, invalid)
+			}
 		case <-statusReportTicker.C:
 			c.statusReport()
 		}
@@ -398,13 +584,13 @@ func (c *Chain) maintain() {
 	}
 }
 
-func (c *Chain) addBlocks(blocks []*cp.Block, local bool) {
+func (c *Chain) addBlocks(blocks []*cp.Block, local bool) error {
 	c.branchLock.Lock()
 	defer c.branchLock.Unlock()
 
 	if len(blocks) == 0 {
 		logger.Warnln("add blocks failed:empyth blocks")
-		return
+		return fmt.Errorf("empty blocks")
 	}
 
 	var err error
@@ -414,14 +600,17 @@ func (c *Chain) addBlocks(blocks []*cp.Block, local bool) {
 	if bc == nil {
 		if bc, err = c.createBranch(blocks[0]); err != nil {
 			logger.Info("add blocks failed:%v\n", err)
-			return
+			return err
 		}
 	}
 
 	for _, cb := range blocks {
-		if err := bc.verifyBlock(cb); err != nil {
+		if headerOnly {
+			cb = cb.ShallowCopy(true)
+		}
+		if err := bc.verifyBlock(cb, false); err != nil {
 			logger.Warn("verify blocks failed:%v\n", err)
-			return
+			return ErrInvalidBlock{cb.GetSerializedHash(), err}
 		}
 		bc.add(newBlock(cb, bc.height()+1, false))
 	}
@@ -429,6 +618,18 @@ func (c *Chain) addBlocks(blocks []*cp.Block, local bool) {
 	if !local {
 		c.notifyCheck()
 	}
+	return nil
+}
+
+func (c *Chain) reportInvalidBlock(peerID string, err ErrInvalidBlock) {
+	select {
+	case c.InvalidBlockNotify <- &InvalidBlock{
+		Peer: peerID,
+		Err:  err,
+	}:
+	default:
+		logger.Warn("invalid block notify queue full, drop report of %s\n", peerID)
+	}
 }
 
 func (c *Chain) getBranch(blochHash []byte) *branch {
@@ -451,6 +652,11 @@ func (c *Chain) createBranch(newBlock *cp.Block) (*branch, error) {
 					b.height(), matchBlock.height)
 			}
 
+			if c.longestBranch.height() >= lastCheckpointHeight && matchBlock.height < lastCheckpointHeight {
+				return nil, fmt.Errorf("the block forks at height %d under the last checkpoint %d",
+					matchBlock.height, lastCheckpointHeight)
+			}
+
 			if matchBlock.isBackwardOf(newBlock) {
 				return nil, fmt.Errorf("duplicated new block")
 			}
@@ -487,6 +693,14 @@ func (c *Chain) getLongestBranch() *branch {
 func (c *Chain) notifyCheck() {
 	longestBranch := c.getLongestBranch()
 	if longestBranch.height() > c.lastHeight {
+		if longestBranch != c.longestBranch {
+			if err := c.reorgCheck(longestBranch); err != nil {
+				logger.Warn("refuse to switch to branch %X:%v\n", longestBranch.hash(), err)
+				c.removeBranch(longestBranch)
+				return
+			}
+		}
+
 		c.longestBranch = longestBranch
 		c.lastHeight = c.longestBranch.height()
 
@@ -497,6 +711,38 @@ func (c *Chain) notifyCheck() {
 	}
 }
 
+// reorgCheck checks how many blocks of the longest branch will be replaced by switching to the branch
+func (c *Chain) reorgCheck(bc *branch) error {
+	if MaxReorgDepth == 0 {
+		return nil
+	}
+
+	var forkHeight uint64
+	if forkPoint := commonAncestor(c.longestBranch.head, bc.head); forkPoint != nil {
+		forkHeight = forkPoint.height
+	} else {
+		// the fork point has been removed from the cache, it is at least older than the oldest block
+		forkHeight = c.oldestBlock.height - 1
+	}
+
+	depth := c.longestBranch.height() - forkHeight
+	if depth > MaxReorgDepth {
+		return ErrReorgTooDeep{depth, MaxReorgDepth}
+	}
+	return nil
+}
+
+func (c *Chain) removeBranch(bc *branch) {
+	var reservedBranches []*branch
+	for _, b := range c.branches {
+		if b != bc {
+			reservedBranches = append(reservedBranches, b)
+		}
+	}
+	c.branches = reservedBranches
+	bc.remove()
+}
+
 func (c *Chain) statusReport() {
 	if utils.GetLogLevel() < utils.LogDebugLevel {
 		return
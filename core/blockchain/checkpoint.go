@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+var (
+	// checkpoints are the known block hashes of some heights,
+	// blocks conflict with them are never accepted
+	checkpoints          map[uint64][]byte
+	lastCheckpointHeight uint64
+
+	// MaxReorgDepth is the max number of blocks in the longest branch which can be replaced by other branch;
+	// 0 means no limit
+	MaxReorgDepth uint64
+
+	// assumedValid are the hashes of the synced headers linked to the last checkpoint,
+	// the evidences of their blocks don't have to be verified one by one
+	assumedValid     map[string]bool
+	assumedValidLock sync.Mutex
+)
+
+func initCheckpoints(conf *Config) error {
+	checkpoints = make(map[uint64][]byte)
+	lastCheckpointHeight = 0
+	setAssumedValid(nil)
+
+	for height, hexHash := range conf.Checkpoints {
+		hash, err := utils.FromHex(hexHash)
+		if err != nil || len(hash) != utils.HashLength {
+			return fmt.Errorf("invalid checkpoint %s at height %d", hexHash, height)
+		}
+
+		checkpoints[height] = hash
+		if height > lastCheckpointHeight {
+			lastCheckpointHeight = height
+		}
+	}
+	MaxReorgDepth = conf.MaxReorgDepth
+
+	logger.Info("initialize checkpoints: %d checkpoints, last checkpoint height %d, max reorg depth %d",
+		len(checkpoints), lastCheckpointHeight, MaxReorgDepth)
+	return nil
+}
+
+// checkpointCheck checks whether the block hash conflicts with the checkpoint of the height
+func checkpointCheck(height uint64, hash []byte) error {
+	expect, ok := checkpoints[height]
+	if ok && !bytes.Equal(expect, hash) {
+		return ErrCheckpointMismatch{height, hash, expect}
+	}
+	return nil
+}
+
+// storedCheckpointsCheck checks the checkpoints against the stored blocks
+func storedCheckpointsCheck(lastHeight uint64) error {
+	for height := range checkpoints {
+		if height > lastHeight {
+			continue
+		}
+
+		hash, err := db.GetHash(height)
+		if err != nil {
+			return fmt.Errorf("height %d, broken db data for checkpoint:%v", height, err)
+		}
+		if err := checkpointCheck(height, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAssumedValid replaces the assumed valid blocks with the hashes
+func setAssumedValid(hashes [][]byte) {
+	assumedValidLock.Lock()
+	defer assumedValidLock.Unlock()
+
+	assumedValid = make(map[string]bool)
+	for _, hash := range hashes {
+		assumedValid[string(hash)] = true
+	}
+}
+
+// assumeValid returns true if the block of the hash is an ancestor of the last checkpoint
+// matched by the synced headers, its evidences don't have to be verified one by one;
+// a block under the last checkpoint from other branches is always fully verified
+func assumeValid(hash []byte) bool {
+	assumedValidLock.Lock()
+	defer assumedValidLock.Unlock()
+
+	if !assumedValid[string(hash)] {
+		return false
+	}
+	delete(assumedValid, string(hash))
+	return true
+}
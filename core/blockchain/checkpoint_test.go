@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestCheckpointCheck(t *testing.T) {
+	cpBlock := genBlock(10)
+	otherBlock := genBlock(10)
+
+	conf := &Config{
+		Checkpoints: map[uint64]string{
+			5:  utils.ToHex(genBlock(5).hash),
+			10: utils.ToHex(cpBlock.hash),
+		},
+	}
+	if err := initCheckpoints(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer initCheckpoints(&Config{})
+
+	if err := utils.TCheckUint64("last checkpoint height", 10, lastCheckpointHeight); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkpointCheck(10, cpBlock.hash); err != nil {
+		t.Fatalf("expect matched checkpoint, but %v", err)
+	}
+	if err := checkpointCheck(10, otherBlock.hash); err == nil {
+		t.Fatal("expect conflicting with checkpoint")
+	} else if _, ok := err.(ErrCheckpointMismatch); !ok {
+		t.Fatalf("unexpected error type %v", err)
+	}
+	if err := checkpointCheck(11, otherBlock.hash); err != nil {
+		t.Fatalf("expect no checkpoint, but %v", err)
+	}
+
+	setAssumedValid([][]byte{cpBlock.hash})
+	if assumeValid(otherBlock.hash) || !assumeValid(cpBlock.hash) {
+		t.Fatal("assume valid block mismatch")
+	}
+	if assumeValid(cpBlock.hash) {
+		t.Fatal("expect the assumed valid block consumed")
+	}
+
+	conf.Checkpoints[20] = "00"
+	if err := initCheckpoints(conf); err == nil {
+		t.Fatal("expect invalid checkpoint error")
+	}
+}
+
+// generate two branches looks like
+// A -> B -> C -> D -> E -> F
+//
+//	| -> G -> H -> I -> J -> K (fork from B)
+func TestReorgCheck(t *testing.T) {
+	var mainBlocks []*block
+	for i := 0; i < 6; i++ {
+		mainBlocks = append(mainBlocks, genBlock(uint64(i)+1))
+	}
+	mainBranch := newBranch(mainBlocks[0])
+	for i := 1; i < len(mainBlocks); i++ {
+		mainBranch.add(mainBlocks[i])
+	}
+
+	forkBranch := newBranch(mainBlocks[1])
+	for i := 0; i < 5; i++ {
+		forkBranch.add(genBlock(uint64(i) + 3))
+	}
+
+	forkPoint := commonAncestor(mainBranch.head, forkBranch.head)
+	if forkPoint != mainBlocks[1] {
+		t.Fatal("fork point mismatch")
+	}
+
+	c := &Chain{
+		oldestBlock:   mainBlocks[0],
+		branches:      []*branch{mainBranch, forkBranch},
+		longestBranch: mainBranch,
+	}
+	defer func() { MaxReorgDepth = 0 }()
+
+	var cases = []struct {
+		maxDepth uint64
+		refused  bool
+	}{
+		{0, false},
+		{3, true},
+		{4, false},
+	}
+	for i, cs := range cases {
+		MaxReorgDepth = cs.maxDepth
+		err := c.reorgCheck(forkBranch)
+		if cs.refused && err == nil {
+			t.Fatalf("case %d expect refused", i)
+		}
+		if !cs.refused && err != nil {
+			t.Fatalf("case %d unexpected error %v", i, err)
+		}
+	}
+
+	MaxReorgDepth = 3
+	c.lastHeight = mainBranch.height()
+	c.notifyCheck()
+	if c.longestBranch != mainBranch {
+		t.Fatal("expect keeping the main branch")
+	}
+	if err := utils.TCheckInt("branch number", 1, len(c.branches)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("fork point forward block amount", 1, mainBlocks[1].forwardNum()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssumeValid(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	conf := devnetTestConfig()
+	c := NewChain()
+	if err := c.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer initCheckpoints(&Config{})
+
+	genesis := c.LatestBlockHash()
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+	var headers []*cp.BlockHeader
+	for i := 0; i < 3; i++ {
+		headers = append(headers, testutil.MineBlock(t, c, TargetToDiff, miner, nil).BlockHeader)
+	}
+
+	// the chain is syncing towards the checkpoint, a peer forks a block under it
+	// with an evidence of the forged signature
+	conf.Checkpoints = map[uint64]string{10: utils.ToHex(utils.Hash([]byte("checkpoint")))}
+	if err := initCheckpoints(conf); err != nil {
+		t.Fatal(err)
+	}
+	forged := cp.GenEvidenceFromParams(cp.NewEvidenceParams())
+	forged.Sig = cp.GenEvidenceFromParams(cp.NewEvidenceParams()).Sig
+	testutil.MineEvidences([]*cp.Evidence{forged}, EvidenceDifficultyLimit)
+	root, _ := merkle.ComputeRoot(merkle.MerkleLeafs{forged.GetSerializedHash()})
+	header := cp.NewBlockHeaderV1(genesis, miner, root)
+	header.SetTarget(headers[0].Target)
+	testutil.MineHeader(t, header, TargetToDiff(header.Target))
+	fork := cp.NewBlock(header, []*cp.Evidence{forged})
+	if err := c.addBlocks([]*cp.Block{fork}, false); err == nil {
+		t.Fatal("expect the forked block of the forged evidence invalid")
+	}
+
+	// only the blocks linked to the last checkpoint by the synced headers are assumed valid
+	conf.Checkpoints = map[uint64]string{3: utils.ToHex(headers[1].GetSerializedHash())}
+	if err := initCheckpoints(conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifySyncHeaders(genesis, headers); err != nil {
+		t.Fatal(err)
+	}
+	if assumeValid(fork.GetSerializedHash()) || assumeValid(headers[2].GetSerializedHash()) {
+		t.Fatal("expect the blocks out of the checkpointed chain not assumed valid")
+	}
+	for i := 0; i < 2; i++ {
+		if !assumeValid(headers[i].GetSerializedHash()) {
+			t.Fatalf("expect the block of height %d assumed valid", i+2)
+		}
+	}
+
+	conf.Checkpoints = map[uint64]string{3: utils.ToHex(headers[2].GetSerializedHash())}
+	if err := initCheckpoints(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.VerifySyncHeaders(genesis, headers).(ErrCheckpointMismatch); !ok {
+		t.Fatal("expect the headers conflicting with the checkpoint invalid")
+	}
+}
@@ -28,9 +28,7 @@ var (
 	EvidenceDifficultyLimit *big.Int
 
 	// BlockInterval expects every new block generation interval
-	BlockInterval           time.Duration
-	floatBlockInterval      *big.Float
-	expectReferenceInterval time.Duration
+	BlockInterval time.Duration
 )
 
 func initMiningParams(conf *Config) {
@@ -40,52 +38,16 @@ func initMiningParams(conf *Config) {
 	EvidenceDifficultyLimit = TargetToDiff(EvidenceTargetLimit)
 
 	BlockInterval = time.Duration(conf.BlockInterval) * time.Second
-	floatBlockInterval = big.NewFloat(float64(BlockInterval))
-	expectReferenceInterval = BlockInterval * ReferenceBlocks
 
 	logger.Info("initialize mining params: BlockDifficultyLimit %s, EvidenceDifficultyLimit %s, interval %v",
 		utils.ReadableBigInt(BlockDifficultyLimit), utils.ReadableBigInt(EvidenceDifficultyLimit), BlockInterval)
 }
 
-// CalculateTarget calculates latest targest
+// CalculateTarget calculates latest targest via the weighted average algorithm
 // lastDuration is the interval between now and the latest block
 // preDuration is the interval between the latest block and the 20 blocks before it
 func CalculateTarget(lastTarget uint32, lastDuration time.Duration, preDuration time.Duration) uint32 {
-	lastDiff := TargetToDiff(lastTarget)
-	floatLastDiff := new(big.Float).SetInt(lastDiff)
-
-	if lastDuration < 1*time.Second {
-		lastDuration = 1 * time.Second
-	}
-
-	averageInterval := big.NewFloat(float64(lastDuration)*LastDurationWeight +
-		float64(preDuration/ReferenceBlocks)*PreviousDurationWeight)
-	scale := new(big.Float).Quo(averageInterval, floatBlockInterval)
-	floatCurrDiff := new(big.Float).Mul(floatLastDiff, scale)
-
-	// check the lower bound
-	const lowerBoundScale = 0.5
-	lowerBoundDiff := new(big.Float).Mul(floatLastDiff, big.NewFloat(lowerBoundScale))
-	if floatCurrDiff.Cmp(lowerBoundDiff) < 0 {
-		logger.Debug("trigger lower bound, scale change to 0.5")
-		scale.SetFloat64(lowerBoundScale)
-		floatCurrDiff = lowerBoundDiff
-	}
-
-	intCurrDiff := new(big.Int)
-	floatCurrDiff.Int(intCurrDiff)
-
-	// check the limit
-	if intCurrDiff.Cmp(BlockDifficultyLimit) > 0 {
-		return BlockTargetLimit
-	}
-
-	logger.Debug("past %d blocks use %v, expect %v, %v away last block, scale %.2f, get diff %s\n",
-		ReferenceBlocks, preDuration, expectReferenceInterval, lastDuration,
-		scale, utils.ReadableBigInt(intCurrDiff))
-
-	currTarget := DiffToTarget(intCurrDiff)
-	return currTarget
+	return newWeightedAverage(BlockTargetLimit, BlockInterval).calculate(lastTarget, lastDuration, preDuration)
 }
 
 // TargetToDiff transforms 32 bits target to 256 bits difficulty
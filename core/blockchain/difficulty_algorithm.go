@@ -0,0 +1,245 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	WeightedAverageAlgorithm = "weighted"
+	LWMAAlgorithm            = "lwma"
+	ASERTAlgorithm           = "asert"
+
+	// FixedAlgorithm always uses the target limit, it's only for devnet
+	FixedAlgorithm = "fixed"
+)
+
+// BlockTiming is the information of a previous block used in difficulty adjustment
+type BlockTiming struct {
+	Time   int64
+	Target uint32
+}
+
+// DifficultyAlgorithm adjusts the target of the new block via the previous blocks
+type DifficultyAlgorithm interface {
+	Name() string
+
+	// Window returns how many previous blocks it needs, including the latest block
+	Window() int
+
+	// NextTarget returns the target of the new block;
+	// prev is sorted by height in increasing order and its length is equal to Window(),
+	// the last one is the latest block
+	NextTarget(prev []*BlockTiming, newBlockTime int64) uint32
+}
+
+// DifficultyFork activates the difficulty algorithm from the height
+type DifficultyFork struct {
+	Height    uint64
+	Algorithm string
+}
+
+type difficultyActivation struct {
+	height    uint64
+	algorithm DifficultyAlgorithm
+}
+
+// difficultySchedule is sorted by height in increasing order
+var difficultySchedule []*difficultyActivation
+
+// NewDifficultyAlgorithm returns the algorithm of the name
+// targetLimit is the max (easiest) target, interval is the expected block interval
+func NewDifficultyAlgorithm(name string, targetLimit uint32, interval time.Duration) (DifficultyAlgorithm, error) {
+	switch name {
+	case WeightedAverageAlgorithm:
+		return newWeightedAverage(targetLimit, interval), nil
+	case LWMAAlgorithm:
+		return newLWMA(targetLimit, interval), nil
+	case ASERTAlgorithm:
+		return newASERT(targetLimit, interval), nil
+	case FixedAlgorithm:
+		return newFixedTarget(targetLimit), nil
+	default:
+		return nil, fmt.Errorf("unknown difficulty algorithm %s", name)
+	}
+}
+
+func initDifficultySchedule(conf *Config) error {
+	forks := append([]*DifficultyFork{}, conf.DifficultyForks...)
+	sort.SliceStable(forks, func(i, j int) bool {
+		return forks[i].Height < forks[j].Height
+	})
+
+	// the weighted average algorithm works from the genesis by default
+	if len(forks) == 0 || forks[0].Height > 1 {
+		forks = append([]*DifficultyFork{&DifficultyFork{
+			Height:    1,
+			Algorithm: WeightedAverageAlgorithm,
+		}}, forks...)
+	}
+
+	difficultySchedule = nil
+	for _, fork := range forks {
+		algorithm, err := NewDifficultyAlgorithm(fork.Algorithm, BlockTargetLimit, BlockInterval)
+		if err != nil {
+			return err
+		}
+
+		// the blocks out of syncMaxBlocks may be removed from cache
+		if algorithm.Window() > int(syncMaxBlocks) {
+			return fmt.Errorf("difficulty algorithm %s window %d exceeds %d",
+				fork.Algorithm, algorithm.Window(), syncMaxBlocks)
+		}
+
+		difficultySchedule = append(difficultySchedule, &difficultyActivation{
+			height:    fork.Height,
+			algorithm: algorithm,
+		})
+		logger.Info("difficulty algorithm %s activates at height %d\n", fork.Algorithm, fork.Height)
+	}
+	return nil
+}
+
+// difficultyAlgorithmAt returns the activated difficulty algorithm of the height
+func difficultyAlgorithmAt(height uint64) DifficultyAlgorithm {
+	result := difficultySchedule[0].algorithm
+	for _, activation := range difficultySchedule {
+		if activation.height > height {
+			break
+		}
+		result = activation.algorithm
+	}
+	return result
+}
+
+// maxDifficultyWindow returns the max window of all scheduled algorithms
+func maxDifficultyWindow() int {
+	result := 0
+	for _, activation := range difficultySchedule {
+		if w := activation.algorithm.Window(); w > result {
+			result = w
+		}
+	}
+	return result
+}
+
+// difficultyParams contains the common parameters of algorithms
+type difficultyParams struct {
+	targetLimit uint32
+	diffLimit   *big.Int
+	interval    time.Duration
+}
+
+func newDifficultyParams(targetLimit uint32, interval time.Duration) difficultyParams {
+	return difficultyParams{
+		targetLimit: targetLimit,
+		diffLimit:   TargetToDiff(targetLimit),
+		interval:    interval,
+	}
+}
+
+// limitTarget makes the difficulty not exceed the limit
+func (d *difficultyParams) limitTarget(diff *big.Int) uint32 {
+	if diff.Cmp(d.diffLimit) > 0 {
+		return d.targetLimit
+	}
+	if diff.Sign() <= 0 {
+		diff = big.NewInt(1)
+	}
+	return DiffToTarget(diff)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// weightedAverage adjusts the difficulty by the weighted average of
+// the latest interval and the average interval of 'ReferenceBlocks' blocks
+type weightedAverage struct {
+	difficultyParams
+}
+
+func newWeightedAverage(targetLimit uint32, interval time.Duration) *weightedAverage {
+	return &weightedAverage{newDifficultyParams(targetLimit, interval)}
+}
+
+func (w *weightedAverage) Name() string {
+	return WeightedAverageAlgorithm
+}
+
+func (w *weightedAverage) Window() int {
+	return ReferenceBlocks + 1
+}
+
+func (w *weightedAverage) NextTarget(prev []*BlockTiming, newBlockTime int64) uint32 {
+	head := prev[len(prev)-1]
+	tail := prev[0]
+
+	newTime := time.Unix(newBlockTime, 0)
+	headTime := time.Unix(head.Time, 0)
+	tailTime := time.Unix(tail.Time, 0)
+	return w.calculate(head.Target, newTime.Sub(headTime), headTime.Sub(tailTime))
+}
+
+func (w *weightedAverage) calculate(lastTarget uint32, lastDuration time.Duration, preDuration time.Duration) uint32 {
+	lastDiff := TargetToDiff(lastTarget)
+	floatLastDiff := new(big.Float).SetInt(lastDiff)
+
+	if lastDuration < 1*time.Second {
+		lastDuration = 1 * time.Second
+	}
+
+	averageInterval := big.NewFloat(float64(lastDuration)*LastDurationWeight +
+		float64(preDuration/ReferenceBlocks)*PreviousDurationWeight)
+	scale := new(big.Float).Quo(averageInterval, big.NewFloat(float64(w.interval)))
+	floatCurrDiff := new(big.Float).Mul(floatLastDiff, scale)
+
+	// check the lower bound
+	const lowerBoundScale = 0.5
+	lowerBoundDiff := new(big.Float).Mul(floatLastDiff, big.NewFloat(lowerBoundScale))
+	if floatCurrDiff.Cmp(lowerBoundDiff) < 0 {
+		logger.Debug("trigger lower bound, scale change to 0.5")
+		scale.SetFloat64(lowerBoundScale)
+		floatCurrDiff = lowerBoundDiff
+	}
+
+	intCurrDiff := new(big.Int)
+	floatCurrDiff.Int(intCurrDiff)
+
+	// check the limit
+	if intCurrDiff.Cmp(w.diffLimit) > 0 {
+		return w.targetLimit
+	}
+
+	logger.Debug("past %d blocks use %v, expect %v, %v away last block, scale %.2f, get diff %s\n",
+		ReferenceBlocks, preDuration, w.interval*ReferenceBlocks, lastDuration,
+		scale, utils.ReadableBigInt(intCurrDiff))
+
+	return DiffToTarget(intCurrDiff)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// fixedTarget never adjusts the difficulty, so the devnet blocks mined back to back
+// don't make the difficulty grow
+type fixedTarget struct {
+	targetLimit uint32
+}
+
+func newFixedTarget(targetLimit uint32) *fixedTarget {
+	return &fixedTarget{targetLimit}
+}
+
+func (f *fixedTarget) Name() string {
+	return FixedAlgorithm
+}
+
+func (f *fixedTarget) Window() int {
+	return 1
+}
+
+func (f *fixedTarget) NextTarget(prev []*BlockTiming, newBlockTime int64) uint32 {
+	return f.targetLimit
+}
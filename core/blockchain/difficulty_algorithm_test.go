@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testTargetLimit = 0xF0100000
+	testInterval    = 90
+)
+
+func TestDifficultySchedule(t *testing.T) {
+	initMiningParams(&Config{
+		BlockTargetLimit:    testTargetLimit,
+		EvidenceTargetLimit: testTargetLimit,
+		BlockInterval:       testInterval,
+	})
+
+	conf := &Config{
+		DifficultyForks: []*DifficultyFork{
+			&DifficultyFork{Height: 200, Algorithm: ASERTAlgorithm},
+			&DifficultyFork{Height: 100, Algorithm: LWMAAlgorithm},
+		},
+	}
+	if err := initDifficultySchedule(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer initDifficultySchedule(&Config{})
+
+	var cases = []struct {
+		height    uint64
+		algorithm string
+	}{
+		{1, WeightedAverageAlgorithm},
+		{99, WeightedAverageAlgorithm},
+		{100, LWMAAlgorithm},
+		{199, LWMAAlgorithm},
+		{200, ASERTAlgorithm},
+		{10000, ASERTAlgorithm},
+	}
+	for _, c := range cases {
+		if name := difficultyAlgorithmAt(c.height).Name(); name != c.algorithm {
+			t.Fatalf("height %d expect %s, but %s", c.height, c.algorithm, name)
+		}
+	}
+
+	if window := maxDifficultyWindow(); window != lwmaBlocks+1 {
+		t.Fatalf("expect max window %d, but %d", lwmaBlocks+1, window)
+	}
+
+	conf.DifficultyForks = append(conf.DifficultyForks, &DifficultyFork{Height: 300, Algorithm: "unknown"})
+	if err := initDifficultySchedule(conf); err == nil {
+		t.Fatal("expect unknown algorithm error")
+	}
+}
+
+func TestDifficultyAlgorithms(t *testing.T) {
+	const lastTarget = 0xE8100000
+	lastDiff := TargetToDiff(lastTarget)
+
+	for _, name := range []string{WeightedAverageAlgorithm, LWMAAlgorithm, ASERTAlgorithm} {
+		algorithm, err := NewDifficultyAlgorithm(name, testTargetLimit, testInterval*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var cases = []struct {
+			solveTime int64
+			cmp       int // compare the next difficulty with the last difficulty
+		}{
+			{testInterval / 3, -1}, // too fast, harder
+			{testInterval * 3, 1},  // too slow, easier
+		}
+		for _, c := range cases {
+			prev := genBlockTimings(algorithm.Window(), lastTarget, c.solveTime)
+			newBlockTime := prev[len(prev)-1].Time + c.solveTime
+			nextDiff := TargetToDiff(algorithm.NextTarget(prev, newBlockTime))
+			if cmp := nextDiff.Cmp(lastDiff); cmp != c.cmp {
+				t.Fatalf("%s solve time %d expect compare result %d, but %d", name, c.solveTime, c.cmp, cmp)
+			}
+		}
+
+		// steady blocks keep the difficulty within 1%
+		prev := genBlockTimings(algorithm.Window(), lastTarget, testInterval)
+		nextTarget := algorithm.NextTarget(prev, prev[len(prev)-1].Time+testInterval)
+		if err := checkDiffClose(lastTarget, nextTarget, 0.01); err != nil {
+			t.Fatalf("%s %v", name, err)
+		}
+
+		// never exceeds the limit
+		prev = genBlockTimings(algorithm.Window(), testTargetLimit, testInterval*100)
+		nextTarget = algorithm.NextTarget(prev, prev[len(prev)-1].Time+testInterval*100)
+		if nextTarget != testTargetLimit {
+			t.Fatalf("%s expect target limit, but %X", name, nextTarget)
+		}
+	}
+}
+
+func genBlockTimings(num int, target uint32, solveTime int64) []*BlockTiming {
+	var result []*BlockTiming
+	for i := 0; i < num; i++ {
+		result = append(result, &BlockTiming{
+			Time:   int64(i) * solveTime,
+			Target: target,
+		})
+	}
+	return result
+}
+
+func checkDiffClose(expect uint32, result uint32, tolerance float64) error {
+	expectDiff, _ := new(big.Float).SetInt(TargetToDiff(expect)).Float64()
+	resultDiff, _ := new(big.Float).SetInt(TargetToDiff(result)).Float64()
+	if ratio := resultDiff / expectDiff; ratio > 1+tolerance || ratio < 1-tolerance {
+		return fmt.Errorf("difficulty ratio %.4f out of tolerance %.4f", ratio, tolerance)
+	}
+	return nil
+}
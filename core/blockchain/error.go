@@ -2,6 +2,8 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/996BC/996.Blockchain/utils"
 )
 
 type ErrAlreadyUpToDate struct {
@@ -43,3 +45,95 @@ type ErrEvidenceAlreadyExist struct {
 func (e ErrEvidenceAlreadyExist) Error() string {
 	return fmt.Sprintf("evidence %X exists", e.evd)
 }
+
+type ErrCheckpointMismatch struct {
+	height uint64
+	hash   []byte
+	expect []byte
+}
+
+func (c ErrCheckpointMismatch) Error() string {
+	return fmt.Sprintf("block %X conflicts with checkpoint %X at height %d", c.hash, c.expect, c.height)
+}
+
+type ErrReorgTooDeep struct {
+	depth uint64
+	limit uint64
+}
+
+func (r ErrReorgTooDeep) Error() string {
+	return fmt.Sprintf("reorg depth %d exceeds the limit %d", r.depth, r.limit)
+}
+
+type ErrBlockOversize struct {
+	size  int
+	limit int
+}
+
+func (b ErrBlockOversize) Error() string {
+	return fmt.Sprintf("block size %d exceeds the limit %d", b.size, b.limit)
+}
+
+type ErrTooManyEvidences struct {
+	num   int
+	limit int
+}
+
+func (t ErrTooManyEvidences) Error() string {
+	return fmt.Sprintf("block has %d evidences, exceeds the limit %d", t.num, t.limit)
+}
+
+type ErrDuplicatedEvidence struct {
+	evd []byte
+}
+
+func (d ErrDuplicatedEvidence) Error() string {
+	return fmt.Sprintf("evidence %X is duplicated in the block", d.evd)
+}
+
+type ErrFutureBlock struct {
+	time int64
+}
+
+func (f ErrFutureBlock) Error() string {
+	return fmt.Sprintf("invalid future time %s", utils.TimeToString(f.time))
+}
+
+// ErrInvalidBlock means the block fails the verification
+type ErrInvalidBlock struct {
+	hash []byte
+	err  error
+}
+
+func (i ErrInvalidBlock) Error() string {
+	return fmt.Sprintf("invalid block %X:%v", i.hash, i.err)
+}
+
+// Severe returns true if an honest peer never sends the block;
+// the block from the future or with the existing evidence might be sent because of
+// a skewed clock or the race of mining
+func (i ErrInvalidBlock) Severe() bool {
+	if isLimitsViolation(i.err) {
+		return true
+	}
+
+	switch i.err.(type) {
+	case ErrFutureBlock, ErrEvidenceAlreadyExist:
+		return false
+	}
+	return true
+}
+
+type ErrBadStoredBlock struct {
+	height uint64
+	err    error
+}
+
+func (b ErrBadStoredBlock) Error() string {
+	return fmt.Sprintf("bad stored block at height %d:%v", b.height, b.err)
+}
+
+// Height returns the height of the bad block
+func (b ErrBadStoredBlock) Height() uint64 {
+	return b.height
+}
@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	// 2020-01-01 00:00:00 UTC
+	devnetGenesisTime = 1577836800
+
+	// the compressed generator point of secp256k1, nobody owns its private key
+	devnetGenesisMiner = "0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798"
+)
+
+// DevnetGenesis returns the hex of the built-in genesis block of devnet
+func DevnetGenesis() string {
+	miner, _ := utils.FromHex(devnetGenesisMiner)
+	cb := NewGenesis(miner, devnetGenesisTime, params.DevnetTargetLimit, nil)
+
+	difficulty := TargetToDiff(cb.Target)
+	for cb.NextNonce().Cmp(difficulty) >= 0 {
+		continue
+	}
+	return utils.ToHex(cb.Marshal())
+}
+
+// NewGenesis returns an unmined genesis block,
+// the evidences should have been signed and passed the pow
+func NewGenesis(miner []byte, timestamp int64, target uint32, evds []*cp.Evidence) *cp.Block {
+	root := cp.EmptyEvidenceRoot
+	if len(evds) != 0 {
+		var leafs merkle.MerkleLeafs
+		for _, e := range evds {
+			leafs = append(leafs, e.GetSerializedHash())
+		}
+		root, _ = merkle.ComputeRoot(leafs)
+	}
+
+	header := cp.NewBlockHeaderV1(make([]byte, utils.HashLength), miner, root)
+	header.Time = timestamp
+	header.SetTarget(target)
+	return cp.NewBlock(header, evds)
+}
+
+// DecodeGenesis decodes the genesis block from hex
+func DecodeGenesis(genesis string) (*cp.Block, error) {
+	genesisB, err := utils.FromHex(genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	return cp.UnmarshalBlock(bytes.NewReader(genesisB))
+}
+
+// VerifyGenesis verifies the genesis block with the difficulty limits of the chain
+func VerifyGenesis(cb *cp.Block, blockTargetLimit uint32, evidenceTargetLimit uint32) error {
+	if err := cb.Verify(); err != nil {
+		return fmt.Errorf("block struct verify failed:%v", err)
+	}
+
+	if err := VerifyBlockLimits(cb); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(cb.LastHash, make([]byte, utils.HashLength)) {
+		return fmt.Errorf("last hash %X is not empty", cb.LastHash)
+	}
+
+	if cb.Target != blockTargetLimit {
+		return fmt.Errorf("mismatch target %08X, expect %08X", cb.Target, blockTargetLimit)
+	}
+
+	if cb.GetPow().Cmp(TargetToDiff(cb.Target)) >= 0 {
+		return fmt.Errorf("pow check failed")
+	}
+
+	if cb.IsEmptyEvidenceRoot() {
+		return nil
+	}
+
+	evidenceDiffLimit := TargetToDiff(evidenceTargetLimit)
+	var leafs merkle.MerkleLeafs
+	for _, e := range cb.Evds {
+		if e.GetPow().Cmp(evidenceDiffLimit) >= 0 {
+			return fmt.Errorf("evidence %X pow check failed", e.Hash)
+		}
+		leafs = append(leafs, e.GetSerializedHash())
+	}
+	if root, _ := merkle.ComputeRoot(leafs); !bytes.Equal(root, cb.EvidenceRoot) {
+		return fmt.Errorf("mismatch evidence root")
+	}
+	return nil
+}
+
+// genesisCheck checks whether the stored genesis block is the same as the configured one
+func genesisCheck(genesis string) error {
+	cb, err := DecodeGenesis(genesis)
+	if err != nil {
+		return err
+	}
+
+	storedHash, err := db.GetHash(1)
+	if err != nil {
+		return fmt.Errorf("broken db data for genesis:%v", err)
+	}
+
+	if hash := cb.GetSerializedHash(); !bytes.Equal(hash, storedHash) {
+		return fmt.Errorf("mismatch genesis %X, the database belongs to the chain with genesis %X", hash, storedHash)
+	}
+	return nil
+}
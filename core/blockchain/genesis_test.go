@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestDevnetGenesis(t *testing.T) {
+	genesis := DevnetGenesis()
+	if genesis != DevnetGenesis() {
+		t.Fatal("expect the same devnet genesis")
+	}
+
+	cb, err := DecodeGenesis(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyGenesis(cb, params.DevnetTargetLimit, params.DevnetTargetLimit); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint32("genesis target", params.DevnetTargetLimit, cb.Target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the genesis of the main network
+const mainGenesis = "01000000005D64F7BF05BD9D8DE81000002000000000000000000000000000000000000000000000000000000000000000002103EC9ABD43CA6FB616A58AA81D08AE52935A62FF61204C9A2CB27AA1EC95FB3B292036DE9253617274EFC1ACBA896827F0F3AB096DFC36A13325D416C589507B5766000201001A010C20D424D7950F219A9F055CAB4691E7B3FB68A557D39A0A8F774FE38ED70F94F4D400002103EC9ABD43CA6FB616A58AA81D08AE52935A62FF61204C9A2CB27AA1EC95FB3B2900473045022100D20A91AECEE1D5A3291CD0785B525DB30EDBBF7DD29FFD028D6CF78027718EEA022016A6F7BD62136511E7CC045A5114BCDE2FC96B3F55486EF077E65A8BFD35C3A2010069FCA9208A86DD096DE111DC910BD24DABB88ED3A59D460C99A99E7DB88D2FF231D3A6B300002103EC9ABD43CA6FB616A58AA81D08AE52935A62FF61204C9A2CB27AA1EC95FB3B2900473045022100E12F9D8FF2BE7352A5CCE05DFB997FD9769AE07EFE9F1D4890C4DA93E0B2DFE002200503AF03C63FCBB4E4918020D0C24C9FC279F3A9E5A05F05943422437E7B1FD9"
+
+func TestVerifyGenesis(t *testing.T) {
+	cb, err := DecodeGenesis(mainGenesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyGenesis(cb, 0xE8100000, 0xEE100000); err != nil {
+		t.Fatalf("expect valid main network genesis, but %v", err)
+	}
+	if err := VerifyGenesis(cb, 0xE9100000, 0xEE100000); err == nil {
+		t.Fatal("expect target mismatch")
+	}
+	if err := VerifyGenesis(cb, 0xE8100000, 0x01000000); err == nil {
+		t.Fatal("expect evidence pow check failed")
+	}
+
+	// generate a genesis with evidences
+	evds := cp.GenBlockFromParams(cp.NewBlockParams(false)).Evds
+	testutil.MineEvidences(evds, TargetToDiff(params.DevnetTargetLimit))
+	genesis := NewGenesis(evds[0].PubKey, 1577836800, params.DevnetTargetLimit, evds)
+	testutil.MineHeader(t, genesis.BlockHeader, TargetToDiff(genesis.Target))
+	if err := VerifyGenesis(genesis, params.DevnetTargetLimit, params.DevnetTargetLimit); err != nil {
+		t.Fatalf("expect valid genesis, but %v", err)
+	}
+
+	genesis.LastHash = genesis.EvidenceRoot
+	if err := VerifyGenesis(genesis, params.DevnetTargetLimit, params.DevnetTargetLimit); err == nil {
+		t.Fatal("expect non-empty last hash error")
+	}
+}
+
+func TestDevnetMining(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	conf := devnetTestConfig()
+	c := NewChain()
+	if err := c.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.MineBlocks(t, c, TargetToDiff, 3)
+
+	// the database belongs to devnet
+	conf.Genesis = utils.ToHex(cp.GenBlockFromParams(cp.NewBlockParams(true)).Marshal())
+	if err := NewChain().Init(conf); err == nil {
+		t.Fatal("expect genesis mismatch")
+	}
+}
+
+func devnetTestConfig() *Config {
+	return &Config{
+		BlockTargetLimit:    params.DevnetTargetLimit,
+		EvidenceTargetLimit: params.DevnetTargetLimit,
+		BlockInterval:       params.DevnetBlockInterval,
+		Genesis:             DevnetGenesis(),
+	}
+}
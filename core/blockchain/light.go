@@ -0,0 +1,172 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// headerOnly means the chain only verifies and stores the block headers, it's used by the light node;
+// the evidences are fetched from the full nodes with their merkle proofs on demand
+var headerOnly bool
+
+func initHeaderOnly(conf *Config) {
+	headerOnly = conf.LightNode
+	if headerOnly {
+		logger.Info("initialize header only chain for light node")
+	}
+}
+
+// GetEvidenceProof returns the proof of the evidence in the longest branch
+func (c *Chain) GetEvidenceProof(hash []byte) (*cp.EvidenceProof, error) {
+	c.branchLock.Lock()
+	defer c.branchLock.Unlock()
+
+	// search in the longest branch
+	for iter := c.longestBranch.head; iter != nil; iter = iter.backward {
+		for _, e := range iter.Evds {
+			if bytes.Equal(e.Hash, hash) {
+				return evidenceProof(iter.Block, iter.hash, hash)
+			}
+		}
+	}
+
+	// search in the db
+	_, height, err := db.GetEvidenceViaHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("evidence %X not found", hash)
+	}
+
+	cb, blockHash, err := db.GetBlockViaHeight(height)
+	if err != nil {
+		return nil, fmt.Errorf("height %d, broken db data for block:%v", height, err)
+	}
+	return evidenceProof(cb, blockHash, hash)
+}
+
+// GetAccountEvidenceProofs returns the proofs of the evidences uploaded by the account in the longest branch
+func (c *Chain) GetAccountEvidenceProofs(pubKey []byte) ([]*cp.EvidenceProof, error) {
+	c.branchLock.Lock()
+	defer c.branchLock.Unlock()
+
+	var result []*cp.EvidenceProof
+	found := make(map[string]bool)
+
+	// search in the longest branch
+	for iter := c.longestBranch.head; iter != nil; iter = iter.backward {
+		for _, e := range iter.Evds {
+			if !bytes.Equal(e.PubKey, pubKey) {
+				continue
+			}
+
+			proof, err := evidenceProof(iter.Block, iter.hash, e.Hash)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, proof)
+			found[utils.ToHex(e.Hash)] = true
+		}
+	}
+
+	// search in the db
+	evdsHash, heights, err := db.GetEvidenceViaKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	storedBlocks := make(map[uint64]*cp.Block)
+	storedHashes := make(map[uint64][]byte)
+	for i, hash := range evdsHash {
+		if found[utils.ToHex(hash)] {
+			continue
+		}
+
+		height := heights[i]
+		if _, ok := storedBlocks[height]; !ok {
+			cb, blockHash, err := db.GetBlockViaHeight(height)
+			if err != nil {
+				return nil, fmt.Errorf("height %d, broken db data for block:%v", height, err)
+			}
+			storedBlocks[height] = cb
+			storedHashes[height] = blockHash
+		}
+
+		proof, err := evidenceProof(storedBlocks[height], storedHashes[height], hash)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, proof)
+	}
+
+	return result, nil
+}
+
+// VerifyEvidenceProof checks whether the evidence belongs to a block of the longest branch,
+// returns the header and height of the block
+func (c *Chain) VerifyEvidenceProof(p *cp.EvidenceProof) (*cp.BlockHeader, uint64, error) {
+	if err := p.Verify(); err != nil {
+		return nil, 0, err
+	}
+
+	header, height, err := c.getHeader(p.BlockHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if header.IsEmptyEvidenceRoot() {
+		return nil, 0, fmt.Errorf("block %X contains no evidence", p.BlockHash)
+	}
+
+	proof := &merkle.Proof{
+		Index:    int(p.Index),
+		LeafNum:  int(p.LeafNum),
+		Siblings: p.Siblings,
+	}
+	if !merkle.VerifyProof(p.Evidence.GetSerializedHash(), proof, header.EvidenceRoot) {
+		return nil, 0, fmt.Errorf("evidence %X mismatch merkle root of block %X", p.Hash, p.BlockHash)
+	}
+
+	return header, height, nil
+}
+
+func (c *Chain) getHeader(hash []byte) (*cp.BlockHeader, uint64, error) {
+	c.branchLock.Lock()
+	defer c.branchLock.Unlock()
+
+	if b := c.longestBranch.getBlock(hash); b != nil {
+		return b.BlockHeader, b.height, nil
+	}
+
+	header, height, err := db.GetHeaderViaHash(hash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("block %X not found", hash)
+	}
+	return header, height, nil
+}
+
+func evidenceProof(cb *cp.Block, blockHash []byte, hash []byte) (*cp.EvidenceProof, error) {
+	index := -1
+	var leafs merkle.MerkleLeafs
+	for i, e := range cb.Evds {
+		if bytes.Equal(e.Hash, hash) {
+			index = i
+		}
+		leafs = append(leafs, e.GetSerializedHash())
+	}
+
+	if index == -1 {
+		return nil, fmt.Errorf("evidence %X not found in block %X", hash, blockHash)
+	}
+
+	proof, err := merkle.ComputeProof(leafs, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return cp.NewEvidenceProof(cb.Evds[index], blockHash, uint16(proof.Index),
+		uint16(proof.LeafNum), proof.Siblings), nil
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestEvidenceProof(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	conf := devnetTestConfig()
+	full := NewChain()
+	if err := full.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	miner := cp.GenBlockFromParams(cp.NewBlockParams(true)).Miner
+	var blocks []*cp.Block
+	var evds []*cp.Evidence
+	for i := 0; i < 4; i++ {
+		var blockEvds []*cp.Evidence
+		if i%2 == 0 {
+			blockEvds = cp.GenBlockFromParams(cp.NewBlockParams(false)).Evds
+			testutil.MineEvidences(blockEvds, EvidenceDifficultyLimit)
+			evds = append(evds, blockEvds...)
+		}
+		blocks = append(blocks, testutil.MineBlock(t, full, TargetToDiff, miner, blockEvds))
+	}
+
+	var proofs []*cp.EvidenceProof
+	for _, e := range evds {
+		proof, err := full.GetEvidenceProof(e.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofs = append(proofs, proof)
+	}
+	if _, err := full.GetEvidenceProof(utils.Hash([]byte("not exist"))); err == nil {
+		t.Fatal("expect getting proof of unknown evidence failed")
+	}
+
+	accountProofs, err := full.GetAccountEvidenceProofs(evds[0].PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("account proofs number", 1, len(accountProofs)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("account evidence", evds[0].Hash, accountProofs[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// the light node only keeps the headers
+	conf.LightNode = true
+	light := NewChain()
+	if err := light.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	light.AddBlocks(blocks, true)
+	if err := utils.TCheckBytes("light latest hash", full.LatestBlockHash(), light.LatestBlockHash()); err != nil {
+		t.Fatal(err)
+	}
+	unstored, _ := light.GetUnstoredBlocks()
+	for _, cb := range unstored {
+		if len(cb.Evds) != 0 {
+			t.Fatal("expect the light node keeps no evidence")
+		}
+	}
+
+	for i, proof := range proofs {
+		header, height, err := light.VerifyEvidenceProof(proof)
+		if err != nil {
+			t.Fatalf("[%d] verify proof failed:%v", i, err)
+		}
+		if err := utils.TCheckBytes("block hash", proof.BlockHash, header.GetSerializedHash()); err != nil {
+			t.Fatal(err)
+		}
+		if height != 2 && height != 4 {
+			t.Fatalf("[%d] unexpected height %d", i, height)
+		}
+	}
+
+	forged := *proofs[0]
+	forged.Evidence = evds[len(evds)-1]
+	if _, _, err := light.VerifyEvidenceProof(&forged); err == nil {
+		t.Fatal("expect verifying forged evidence failed")
+	}
+
+	forged = *proofs[0]
+	forged.BlockHash = blocks[1].GetSerializedHash()
+	if _, _, err := light.VerifyEvidenceProof(&forged); err == nil {
+		t.Fatal("expect verifying evidence of wrong block failed")
+	}
+}
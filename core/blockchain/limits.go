@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// VerifyBlockLimits checks the consensus limits of a block without the blockchain context:
+// 1. the serialized size
+// 2. the evidence number
+// 3. no duplicated evidence in the block
+func VerifyBlockLimits(cb *cp.Block) error {
+	if num := len(cb.Evds); num > params.MaxEvidencesInBlock {
+		return ErrTooManyEvidences{num, params.MaxEvidencesInBlock}
+	}
+
+	if size := len(cb.Marshal()); size > params.BlockSize {
+		return ErrBlockOversize{size, params.BlockSize}
+	}
+
+	evds := make(map[string]bool)
+	for _, e := range cb.Evds {
+		key := utils.ToHex(e.Hash)
+		if evds[key] {
+			return ErrDuplicatedEvidence{e.Hash}
+		}
+		evds[key] = true
+	}
+
+	return nil
+}
+
+// VerifyEvidence checks an evidence without the blockchain context:
+// 1. the struct and the signature
+// 2. the pow
+func VerifyEvidence(e *cp.Evidence) error {
+	if err := e.Verify(); err != nil {
+		return fmt.Errorf("evidence struct verify failed:%v", err)
+	}
+
+	if e.GetPow().Cmp(EvidenceDifficultyLimit) != -1 {
+		return fmt.Errorf("pow check of %X failed", e.Hash)
+	}
+	return nil
+}
+
+// VerifyHeaders checks the header chain downloaded before the blocks without the blockchain context:
+// 1. the struct of each header
+// 2. each header links to the previous one, and the first links to the base
+// 3. the pow satisfies the target of the header, and the target doesn't exceed the limit
+func VerifyHeaders(base []byte, headers []*cp.BlockHeader) error {
+	last := base
+	for _, h := range headers {
+		if err := h.Verify(); err != nil {
+			return fmt.Errorf("block header verify failed:%v", err)
+		}
+
+		hash := h.GetSerializedHash()
+		if !bytes.Equal(h.LastHash, last) {
+			return fmt.Errorf("header %X doesn't link to %X", hash, last)
+		}
+
+		if err := VerifyHeaderPow(h); err != nil {
+			return err
+		}
+		last = hash
+	}
+	return nil
+}
+
+// VerifyHeaderPow checks the pow satisfies the target of the header, and the target doesn't exceed the limit
+func VerifyHeaderPow(h *cp.BlockHeader) error {
+	hash := h.GetSerializedHash()
+	diff := TargetToDiff(h.Target)
+	if diff.Cmp(BlockDifficultyLimit) == 1 {
+		return fmt.Errorf("header %X target %d exceeds the limit", hash, h.Target)
+	}
+	if h.GetPow().Cmp(diff) != -1 {
+		return fmt.Errorf("pow check of header %X failed", hash)
+	}
+	return nil
+}
+
+// isLimitsViolation returns true if the error is caused by breaking the consensus limits,
+// which means the sender is misbehaving
+func isLimitsViolation(err error) bool {
+	switch err.(type) {
+	case ErrBlockOversize, ErrTooManyEvidences, ErrDuplicatedEvidence:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+func TestVerifyBlockLimits(t *testing.T) {
+	// normal
+	cb := cp.GenBlockFromParams(cp.NewBlockParams(false))
+	if err := VerifyBlockLimits(cb); err != nil {
+		t.Fatal(err)
+	}
+
+	// duplicated evidence
+	dupBlock := cb.ShallowCopy(false)
+	dupBlock.Evds = append(dupBlock.Evds, dupBlock.Evds[0])
+	if _, ok := VerifyBlockLimits(dupBlock).(ErrDuplicatedEvidence); !ok {
+		t.Fatal("expect duplicated evidence error")
+	}
+
+	// too many evidences
+	evd := genLargeEvidence()
+	manyBlock := cb.ShallowCopy(true)
+	for i := 0; i <= params.MaxEvidencesInBlock; i++ {
+		manyBlock.Evds = append(manyBlock.Evds, evd)
+	}
+	if _, ok := VerifyBlockLimits(manyBlock).(ErrTooManyEvidences); !ok {
+		t.Fatal("expect too many evidences error")
+	}
+
+	// oversize
+	largeBlock := cb.ShallowCopy(true)
+	for len(largeBlock.Evds) < params.MaxEvidencesInBlock {
+		largeBlock.Evds = append(largeBlock.Evds, evd)
+	}
+	if _, ok := VerifyBlockLimits(largeBlock).(ErrBlockOversize); !ok {
+		t.Fatal("expect block oversize error")
+	}
+
+	for _, err := range []error{
+		ErrBlockOversize{}, ErrTooManyEvidences{}, ErrDuplicatedEvidence{},
+	} {
+		if !isLimitsViolation(err) {
+			t.Fatalf("expect %T is limits violation", err)
+		}
+	}
+	if isLimitsViolation(ErrEvidenceAlreadyExist{}) {
+		t.Fatal("expect not limits violation")
+	}
+}
+
+func TestInvalidBlockSeverity(t *testing.T) {
+	for _, err := range []error{
+		ErrBlockOversize{}, ErrDuplicatedEvidence{}, fmt.Errorf("pow check failed"),
+	} {
+		if !(ErrInvalidBlock{err: err}).Severe() {
+			t.Fatalf("expect %v severe", err)
+		}
+	}
+	for _, err := range []error{
+		ErrFutureBlock{}, ErrEvidenceAlreadyExist{},
+	} {
+		if (ErrInvalidBlock{err: err}).Severe() {
+			t.Fatalf("expect %T not severe", err)
+		}
+	}
+}
+
+func genLargeEvidence() *cp.Evidence {
+	key, _ := btcec.NewPrivateKey(btcec.S256())
+	description := []byte(strings.Repeat("a", cp.EvidenceMaxDescriptionLen))
+	evd := cp.NewEvidenceV1(utils.Hash(description), description, key.PubKey().SerializeCompressed())
+	evd.Sign(key)
+	return evd
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	initMiningParams(devnetTestConfig())
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+
+	base := utils.Hash([]byte("base"))
+	var headers []*cp.BlockHeader
+	last := base
+	for i := 0; i < 3; i++ {
+		h := cp.NewBlockHeaderV1(last, miner, cp.EmptyEvidenceRoot)
+		h.SetTarget(params.DevnetTargetLimit)
+		testutil.MineHeader(t, h, TargetToDiff(h.Target))
+		headers = append(headers, h)
+		last = h.GetSerializedHash()
+	}
+	if err := VerifyHeaders(base, headers); err != nil {
+		t.Fatal(err)
+	}
+
+	// broken link
+	if err := VerifyHeaders(base, headers[1:]); err == nil {
+		t.Fatal("expect the headers not linking to the base invalid")
+	}
+
+	// pow
+	bad := *headers[2]
+	for bad.NextNonce().Cmp(TargetToDiff(bad.Target)) == -1 {
+	}
+	if err := VerifyHeaders(base, []*cp.BlockHeader{headers[0], headers[1], &bad}); err == nil {
+		t.Fatal("expect the header failing pow invalid")
+	}
+}
+
+func TestVerifySyncHeaders(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	c := NewChain()
+	if err := c.Init(devnetTestConfig()); err != nil {
+		t.Fatal(err)
+	}
+	base := c.LatestBlockHash()
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+
+	// the difficulty grows after the reference blocks since the blocks are mined back to back
+	num := ReferenceBlocks + 4
+	var headers []*cp.BlockHeader
+	for i := 0; i < num; i++ {
+		headers = append(headers, testutil.MineBlock(t, c, TargetToDiff, miner, nil).BlockHeader)
+	}
+	if err := c.VerifySyncHeaders(base, headers); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifySyncHeaders(headers[num/2-1].GetSerializedHash(), headers[num/2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the easiest headers mined back to back
+	var easy []*cp.BlockHeader
+	last := base
+	for i := 0; i < num; i++ {
+		h := cp.NewBlockHeaderV1(last, miner, cp.EmptyEvidenceRoot)
+		h.SetTarget(params.DevnetTargetLimit)
+		testutil.MineHeader(t, h, TargetToDiff(h.Target))
+		easy = append(easy, h)
+		last = h.GetSerializedHash()
+	}
+	if err := VerifyHeaders(base, easy); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifySyncHeaders(base, easy); err == nil {
+		t.Fatal("expect the headers mismatching the difficulty algorithm invalid")
+	}
+
+	if _, ok := c.VerifySyncHeaders(utils.Hash([]byte("unknown")), headers).(ErrHashNotFound); !ok {
+		t.Fatal("expect the unknown base not found")
+	}
+}
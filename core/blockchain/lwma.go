@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+)
+
+const (
+	// lwmaBlocks is the number of solve times taken into account
+	lwmaBlocks = 45
+
+	// a solve time is limited in [1, lwmaMaxSolveTimeScale * interval]
+	// to reduce the effect of timestamp manipulation
+	lwmaMaxSolveTimeScale = 6
+)
+
+// lwma is the linearly weighted moving average algorithm,
+// the newer solve time has the higher weight
+type lwma struct {
+	difficultyParams
+}
+
+func newLWMA(targetLimit uint32, interval time.Duration) *lwma {
+	return &lwma{newDifficultyParams(targetLimit, interval)}
+}
+
+func (l *lwma) Name() string {
+	return LWMAAlgorithm
+}
+
+func (l *lwma) Window() int {
+	return lwmaBlocks + 1
+}
+
+func (l *lwma) NextTarget(prev []*BlockTiming, newBlockTime int64) uint32 {
+	interval := int64(l.interval / time.Second)
+	maxSolveTime := lwmaMaxSolveTimeScale * interval
+
+	n := int64(len(prev) - 1)
+	var weightedSolveTime int64
+	sumDiff := new(big.Int)
+	for i := int64(1); i <= n; i++ {
+		solveTime := prev[i].Time - prev[i-1].Time
+		if solveTime < 1 {
+			solveTime = 1
+		}
+		if solveTime > maxSolveTime {
+			solveTime = maxSolveTime
+		}
+
+		weightedSolveTime += solveTime * i
+		sumDiff.Add(sumDiff, TargetToDiff(prev[i].Target))
+	}
+
+	// next = average difficulty * weighted average solve time / interval,
+	// the sum of weights is n*(n+1)/2
+	k := n * (n + 1) / 2
+	nextDiff := new(big.Int).Mul(sumDiff, big.NewInt(weightedSolveTime))
+	nextDiff.Div(nextDiff, big.NewInt(n*k*interval))
+
+	return l.limitTarget(nextDiff)
+}
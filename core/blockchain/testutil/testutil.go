@@ -0,0 +1,86 @@
+// Package testutil provides the chain fixtures shared by the tests,
+// it doesn't import blockchain so that the tests of blockchain can use it too
+package testutil
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+)
+
+// maxTries is the max nonces tried for a header, the tests mine at the trivial difficulty
+const maxTries = 1024
+
+// Chain is the chain which the test blocks are mined on, like *blockchain.Chain
+type Chain interface {
+	LatestBlockHash() []byte
+	NextBlockTarget(newBlockTime int64) uint32
+	AddBlocks(blocks []*cp.Block, local bool)
+}
+
+// TargetToDiff transforms the target to the difficulty, like blockchain.TargetToDiff
+type TargetToDiff func(target uint32) *big.Int
+
+// SetupDB initializes the memory database, the returned function closes it
+func SetupDB(t *testing.T) func() {
+	if err := db.InitWithEngine(db.MemoryEngine, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	return db.Close
+}
+
+// MineHeader finds the nonce of the header satisfying the difficulty
+func MineHeader(t *testing.T, h *cp.BlockHeader, difficulty *big.Int) {
+	for tries := 0; h.NextNonce().Cmp(difficulty) >= 0; tries++ {
+		if tries > maxTries {
+			t.Fatal("nonce not found")
+		}
+	}
+}
+
+// MineEvidences finds the nonces of the evidences satisfying the difficulty
+func MineEvidences(evds []*cp.Evidence, difficulty *big.Int) {
+	for _, e := range evds {
+		for e.NextNonce().Cmp(difficulty) >= 0 {
+		}
+	}
+}
+
+// MineBlock mines a block of the mined evidences on the latest block of the chain and adds it
+func MineBlock(t *testing.T, c Chain, toDiff TargetToDiff, miner []byte, evds []*cp.Evidence) *cp.Block {
+	root := cp.EmptyEvidenceRoot
+	if len(evds) != 0 {
+		var leafs merkle.MerkleLeafs
+		for _, e := range evds {
+			leafs = append(leafs, e.GetSerializedHash())
+		}
+		root, _ = merkle.ComputeRoot(leafs)
+	}
+
+	header := cp.NewBlockHeaderV1(c.LatestBlockHash(), miner, root)
+	header.SetTarget(c.NextBlockTarget(header.Time))
+	MineHeader(t, header, toDiff(header.Target))
+
+	cb := cp.NewBlock(header, evds)
+	c.AddBlocks([]*cp.Block{cb}, true)
+	if !bytes.Equal(header.GetSerializedHash(), c.LatestBlockHash()) {
+		t.Fatal("block is not accepted")
+	}
+	return cb
+}
+
+// MineBlocks mines num empty blocks of a random miner on the latest block of the chain
+func MineBlocks(t *testing.T, c Chain, toDiff TargetToDiff, num int) []*cp.Block {
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+
+	var result []*cp.Block
+	for i := 0; i < num; i++ {
+		result = append(result, MineBlock(t, c, toDiff, miner, nil))
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+)
+
+// verifyProgressInterval is the blocks number between two progress logs
+const verifyProgressInterval = 10000
+
+// StoredBlockHandler handles the verified stored block, it's called in increasing height order
+type StoredBlockHandler func(cb *cp.Block, height uint64) error
+
+// VerifyStoredChain walks the stored blocks from the genesis and verifies them like receiving them
+// from the network, but the evidences under the checkpoints are verified too; it returns ErrBadStoredBlock with the first bad height,
+// the handler is never called with the bad block and the blocks after it
+func VerifyStoredChain(conf *Config, handler StoredBlockHandler) error {
+	initMiningParams(conf)
+	initHeaderOnly(conf)
+	if err := initDifficultySchedule(conf); err != nil {
+		return err
+	}
+	if err := initCheckpoints(conf); err != nil {
+		return err
+	}
+
+	if !db.HasGenesis() {
+		return fmt.Errorf("empty database")
+	}
+	lastHeight, err := db.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+
+	genesis, err := DecodeGenesis(conf.Genesis)
+	if err != nil {
+		return fmt.Errorf("invalid genesis:%v", err)
+	}
+	cb, err := getStoredBlock(1)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(cb.GetSerializedHash(), genesis.GetSerializedHash()) {
+		return ErrBadStoredBlock{1, fmt.Errorf("mismatch configured genesis")}
+	}
+	if err := cb.Verify(); err != nil {
+		return ErrBadStoredBlock{1, err}
+	}
+	if err := handler(cb, 1); err != nil {
+		return err
+	}
+
+	// the evidences of the verified blocks, the indexes in db may be broken
+	verified := make(map[string]bool)
+	for _, e := range cb.Evds {
+		verified[string(e.Hash)] = true
+	}
+
+	bc := newBranch(newBlock(cb, 1, true))
+	bc.evidenceExists = func(hash []byte) bool {
+		return verified[string(hash)]
+	}
+	window := maxDifficultyWindow() + 1
+
+	for height := uint64(2); height <= lastHeight; height++ {
+		cb, err := getStoredBlock(height)
+		if err != nil {
+			return err
+		}
+
+		// the stored evidences are always verified, no matter the checkpoints
+		if err := bc.verifyBlock(cb, true); err != nil {
+			return ErrBadStoredBlock{height, err}
+		}
+		if err := handler(cb, height); err != nil {
+			return err
+		}
+
+		for _, e := range cb.Evds {
+			verified[string(e.Hash)] = true
+		}
+		bc.add(newBlock(cb, height, true))
+		bc.trim(window)
+
+		if height%verifyProgressInterval == 0 {
+			logger.Info("verified %d/%d blocks\n", height, lastHeight)
+		}
+	}
+	return nil
+}
+
+func getStoredBlock(height uint64) (*cp.Block, error) {
+	cb, hash, err := db.GetBlockViaHeight(height)
+	if err != nil {
+		return nil, ErrBadStoredBlock{height, fmt.Errorf("unreadable block:%v", err)}
+	}
+
+	if !bytes.Equal(hash, cb.GetSerializedHash()) {
+		return nil, ErrBadStoredBlock{height, fmt.Errorf("mismatch stored hash %X", hash)}
+	}
+	return cb, nil
+}
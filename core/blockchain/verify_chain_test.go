@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestVerifyStoredChain(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	conf := devnetTestConfig()
+	c := NewChain()
+	if err := c.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	miner := cp.GenBlockFromParams(cp.NewBlockParams(true)).Miner
+	evds := cp.GenBlockFromParams(cp.NewBlockParams(false)).Evds
+	testutil.MineEvidences(evds, EvidenceDifficultyLimit)
+	var blocks []*cp.Block
+	for i := 0; i < 5; i++ {
+		var blockEvds []*cp.Evidence
+		if i == 1 {
+			blockEvds = evds
+		}
+		blocks = append(blocks, testutil.MineBlock(t, c, TargetToDiff, miner, blockEvds))
+	}
+	for i, cb := range blocks {
+		if err := db.PutBlock(cb, uint64(i)+2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var verified uint64
+	handler := func(cb *cp.Block, height uint64) error {
+		verified = height
+		return nil
+	}
+	if err := VerifyStoredChain(conf, handler); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("verified height", 6, verified); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the 4th block with a block not linked to the 3th
+	if err := db.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	header := cp.NewBlockHeaderV1(make([]byte, utils.HashLength), miner, cp.EmptyEvidenceRoot)
+	header.SetTarget(conf.BlockTargetLimit)
+	if err := db.PutBlock(cp.NewBlock(header, nil), 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBlock(blocks[3], 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// reindex
+	if err := db.DropIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	err := VerifyStoredChain(conf, db.PutIndexes)
+	badErr, ok := err.(ErrBadStoredBlock)
+	if !ok {
+		t.Fatalf("expect bad stored block, but %v", err)
+	}
+	if err := utils.TCheckUint64("bad height", 4, badErr.Height()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Truncate(badErr.Height() - 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishReindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range evds {
+		if !db.HasEvidence(e.Hash) {
+			t.Fatalf("expect evidence %X reindexed", e.Hash)
+		}
+	}
+	if _, height, err := db.GetHeaderViaHash(blocks[1].GetSerializedHash()); err != nil || height != 3 {
+		t.Fatal("expect the 3th block reindexed")
+	}
+	if score, _ := db.GetScoreViaKey(miner); score != 2 {
+		t.Fatalf("expect score 2, but %d", score)
+	}
+	if err := VerifyStoredChain(conf, handler); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("verified height", 3, verified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyStoredChainUnderCheckpoint(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	conf := devnetTestConfig()
+	c := NewChain()
+	if err := c.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer initCheckpoints(&Config{})
+
+	// store a block of the evidence with a corrupted signature
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+	forged := cp.GenEvidenceFromParams(cp.NewEvidenceParams())
+	forged.Sig = cp.GenEvidenceFromParams(cp.NewEvidenceParams()).Sig
+	testutil.MineEvidences([]*cp.Evidence{forged}, EvidenceDifficultyLimit)
+	root, _ := merkle.ComputeRoot(merkle.MerkleLeafs{forged.GetSerializedHash()})
+	header := cp.NewBlockHeaderV1(c.LatestBlockHash(), miner, root)
+	header.SetTarget(c.NextBlockTarget(header.Time))
+	testutil.MineHeader(t, header, TargetToDiff(header.Target))
+	cb := cp.NewBlock(header, []*cp.Evidence{forged})
+	if err := db.PutBlock(cb, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Checkpoints = map[uint64]string{2: utils.ToHex(header.GetSerializedHash())}
+	handler := func(cb *cp.Block, height uint64) error {
+		return nil
+	}
+	err := VerifyStoredChain(conf, handler)
+	badErr, ok := err.(ErrBadStoredBlock)
+	if !ok {
+		t.Fatalf("expect bad stored block, but %v", err)
+	}
+	if err := utils.TCheckUint64("bad height", 2, badErr.Height()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored chain is verified fully even if the block is assumed valid
+	genesis, err := DecodeGenesis(conf.Genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newBranch(newBlock(genesis, 1, true))
+	setAssumedValid([][]byte{header.GetSerializedHash()})
+	if err := bc.verifyBlock(cb, true); err == nil {
+		t.Fatal("expect the evidence of the forged signature invalid")
+	}
+	setAssumedValid([][]byte{header.GetSerializedHash()})
+	if err := bc.verifyBlock(cb, false); err != nil {
+		t.Fatalf("expect the evidences of the assumed valid block skipped, but %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package bootstrap exports the stored blocks into a portable file and imports the file into a node,
+// it's used to seed the offline nodes and to archive the chain.
+//
+// The file contains a header, the length prefixed blocks and the checksum of all the content before it:
+//
+//	| magic | version (1 byte) | begin height (8 bytes) | end height (8 bytes) |
+//	| block length (4 bytes) | block | ...
+//	| sha256 checksum (32 bytes) |
+package bootstrap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	version = 1
+
+	// importBatchSize is the blocks number added to the chain at a time
+	importBatchSize = 64
+
+	// maxBlockSize limits the block length read from the file, the length doesn't count its own prefix
+	// and the stored blocks have passed the limits, so the serialized block is at most params.BlockSize
+	maxBlockSize = params.BlockSize
+)
+
+var (
+	magic  = []byte("996BLKS")
+	logger = utils.NewLogger("bootstrap")
+)
+
+// Export writes the stored blocks from begin to end height into the path, the database should be initialized
+func Export(path string, begin uint64, end uint64) error {
+	latestHeight, err := db.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+	if begin == 0 || begin > end || end > latestHeight {
+		return fmt.Errorf("invalid range %d-%d, the latest height is %d", begin, end, latestHeight)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	checksum := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, checksum))
+	w.Write(magic)
+	w.WriteByte(version)
+	binary.Write(w, binary.BigEndian, begin)
+	binary.Write(w, binary.BigEndian, end)
+
+	for height := begin; height <= end; height++ {
+		cb, _, err := db.GetBlockViaHeight(height)
+		if err != nil {
+			return fmt.Errorf("height %d, broken db data for block:%v", height, err)
+		}
+
+		blockB := cb.Marshal()
+		binary.Write(w, binary.BigEndian, utils.Uint32Len(blockB))
+		if _, err := w.Write(blockB); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, err = f.Write(checksum.Sum(nil))
+	return err
+}
+
+// Import adds the blocks in the path to the chain through the normal verification,
+// the blocks already stored are skipped; it returns the number of the imported blocks
+func Import(path string, c *blockchain.Chain) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if err := checkChecksum(f); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(f)
+	begin, end, err := readHeader(r)
+	if err != nil {
+		return 0, err
+	}
+	latestHeight, err := db.GetLatestHeight()
+	if err != nil {
+		return 0, err
+	}
+	if begin > latestHeight+1 {
+		return 0, fmt.Errorf("the file begins at height %d, the chain only has %d blocks", begin, latestHeight)
+	}
+	logger.Info("importing blocks %d-%d, the latest height is %d\n", begin, end, latestHeight)
+
+	var imported uint64
+	var batch []*cp.Block
+	for height := begin; height <= end; height++ {
+		cb, err := readBlock(r)
+		if err != nil {
+			return imported, fmt.Errorf("height %d, %v", height, err)
+		}
+
+		if height <= latestHeight {
+			storedHash, err := db.GetHash(height)
+			if err != nil {
+				return imported, err
+			}
+			if !bytes.Equal(storedHash, cb.GetSerializedHash()) {
+				return imported, fmt.Errorf("block of height %d mismatch the stored one", height)
+			}
+			continue
+		}
+
+		batch = append(batch, cb)
+		if len(batch) < importBatchSize && height != end {
+			continue
+		}
+
+		c.AddBlocks(batch, true)
+		if !bytes.Equal(c.LatestBlockHash(), batch[len(batch)-1].GetSerializedHash()) {
+			return imported, fmt.Errorf("blocks %d-%d are rejected by the chain",
+				height-uint64(len(batch))+1, height)
+		}
+		if err := c.Flush(); err != nil {
+			return imported, err
+		}
+		imported += uint64(len(batch))
+		batch = nil
+		logger.Info("imported blocks up to height %d\n", height)
+	}
+
+	return imported, nil
+}
+
+func checkChecksum(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < sha256.Size {
+		return fmt.Errorf("invalid bootstrap file")
+	}
+
+	checksum := sha256.New()
+	if _, err := io.CopyN(checksum, f, info.Size()-sha256.Size); err != nil {
+		return err
+	}
+	expect := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(f, expect); err != nil {
+		return err
+	}
+	if !bytes.Equal(expect, checksum.Sum(nil)) {
+		return fmt.Errorf("bootstrap file checksum mismatch")
+	}
+	return nil
+}
+
+func readHeader(r io.Reader) (begin uint64, end uint64, err error) {
+	header := make([]byte, len(magic)+1)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(header[:len(magic)], magic) || header[len(magic)] != version {
+		return 0, 0, fmt.Errorf("invalid bootstrap file header")
+	}
+
+	if err = binary.Read(r, binary.BigEndian, &begin); err != nil {
+		return 0, 0, err
+	}
+	if err = binary.Read(r, binary.BigEndian, &end); err != nil {
+		return 0, 0, err
+	}
+	if begin == 0 || begin > end {
+		return 0, 0, fmt.Errorf("invalid range %d-%d", begin, end)
+	}
+	return begin, end, nil
+}
+
+func readBlock(r io.Reader) (*cp.Block, error) {
+	var blockLen uint32
+	if err := binary.Read(r, binary.BigEndian, &blockLen); err != nil {
+		return nil, err
+	}
+	if blockLen > maxBlockSize {
+		return nil, fmt.Errorf("invalid block length %d", blockLen)
+	}
+
+	blockB := make([]byte, blockLen)
+	if _, err := io.ReadFull(r, blockB); err != nil {
+		return nil, err
+	}
+	return cp.UnmarshalBlock(bytes.NewReader(blockB))
+}
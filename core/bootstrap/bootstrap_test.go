@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestBootstrap(t *testing.T) {
+	conf := &blockchain.Config{
+		BlockTargetLimit:    params.DevnetTargetLimit,
+		EvidenceTargetLimit: params.DevnetTargetLimit,
+		BlockInterval:       params.DevnetBlockInterval,
+		Genesis:             blockchain.DevnetGenesis(),
+	}
+
+	cleanup := testutil.SetupDB(t)
+	src := blockchain.NewChain()
+	if err := src.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	blocks := testutil.MineBlocks(t, src, blockchain.TargetToDiff, 4)
+	if err := src.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.TempDir() + "/bootstrap_test_tmp"
+	os.Remove(path)
+	defer os.Remove(path)
+	if err := Export(path, 1, 6); err == nil {
+		t.Fatal("expect exporting the unknown height failed")
+	}
+	err := Export(path, 1, 5)
+	cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup = testutil.SetupDB(t)
+	defer cleanup()
+	c := blockchain.NewChain()
+	if err := c.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)/2]++
+	ioutil.WriteFile(path, tampered, 0644)
+	if _, err := Import(path, c); err == nil {
+		t.Fatal("expect checksum mismatch")
+	}
+
+	ioutil.WriteFile(path, data, 0644)
+	imported, err := Import(path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("imported", 4, imported); err != nil {
+		t.Fatal(err)
+	}
+	height, _ := db.GetLatestHeight()
+	if err := utils.TCheckUint64("latest height", 5, height); err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := db.GetHash(5)
+	if !bytes.Equal(hash, blocks[3].GetSerializedHash()) {
+		t.Fatal("imported block mismatch")
+	}
+
+	// the stored blocks are skipped
+	if imported, err = Import(path, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("imported again", 0, imported); err != nil {
+		t.Fatal(err)
+	}
+}
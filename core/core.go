@@ -1,10 +1,16 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/db"
 	"github.com/996BC/996.Blockchain/p2p"
 	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/serialize/cp"
@@ -14,6 +20,9 @@ import (
 
 var (
 	logger = utils.NewLogger("core")
+
+	// ErrLightNode means the operation requires the full node
+	ErrLightNode = errors.New("not supported by the light node")
 )
 
 type Config struct {
@@ -22,16 +31,23 @@ type Config struct {
 	PrivKey      *btcec.PrivateKey
 	ParallelMine int
 
+	// Devnet enables mining blocks on demand
+	Devnet bool
+
 	*blockchain.Config
 }
 
 type Core struct {
+	node       p2p.Node
 	chain      *blockchain.Chain
 	evPool     *evidencePool
 	n          *net
 	queryCache *qCache
 	s          *scheduler
 	mining     bool
+	devnet     bool
+	lightNode  bool
+	mineLock   sync.Mutex
 }
 
 func NewCore(conf *Config) *Core {
@@ -40,6 +56,8 @@ func NewCore(conf *Config) *Core {
 		logger.Fatal("init core module failed:%v\n", err)
 	}
 	chain.Start()
+	// the peers know how far behind they are in the handshake
+	conf.Node.SetBestHeightFunc(chain.LatestHeight)
 
 	evPool := newEvidencePool(conf.PrivKey)
 
@@ -52,22 +70,31 @@ func NewCore(conf *Config) *Core {
 
 	var s *scheduler
 	mining := false
-	if conf.ParallelMine == 0 {
+	pubKey := conf.PrivKey.PubKey()
+	if conf.NodeType == params.LightNode {
+		logger.Info("the light node won't do any mining")
+	} else if conf.ParallelMine == 0 {
 		logger.Info("parallel mining thread number is 0, the program won't do any mining")
+		if conf.Devnet {
+			// only mines blocks on demand
+			s = newScheduler(evPool, chain, n, pubKey.SerializeCompressed(), 1)
+		}
 	} else {
-		pubKey := conf.PrivKey.PubKey()
 		s = newScheduler(evPool, chain, n, pubKey.SerializeCompressed(), conf.ParallelMine)
 		s.start()
 		mining = true
 	}
 
 	return &Core{
+		node:       conf.Node,
 		chain:      chain,
 		evPool:     evPool,
 		n:          n,
 		queryCache: queryCache,
 		s:          s,
 		mining:     mining,
+		devnet:     conf.Devnet,
+		lightNode:  conf.NodeType == params.LightNode,
 	}
 }
 
@@ -82,9 +109,74 @@ func (c *Core) Stop() {
 	c.chain.Stop()
 }
 
+// MineBlocks mines num blocks immediately and returns their hashes,
+// it's only available in devnet
+func (c *Core) MineBlocks(num int) ([][]byte, error) {
+	if !c.devnet {
+		return nil, fmt.Errorf("mining on demand is only available in devnet")
+	}
+	if c.lightNode {
+		return nil, ErrLightNode
+	}
+
+	c.mineLock.Lock()
+	defer c.mineLock.Unlock()
+
+	var result [][]byte
+	for i := 0; i < num; i++ {
+		hash, err := c.s.mineBlock()
+		if err != nil {
+			return result, err
+		}
+		result = append(result, hash)
+	}
+	return result, nil
+}
+
+// Backup writes a consistent copy of the database into w while the node keeps running
+func (c *Core) Backup(w io.Writer) (*db.BackupHeader, error) {
+	return db.Backup(w)
+}
+
+// GetBans returns the banned peers
+func (c *Core) GetBans() []*p2p.Ban {
+	return c.node.GetBans()
+}
+
+// BanPeer disconnects the peer and refuses to connect it for the duration
+func (c *Core) BanPeer(id string, duration time.Duration) error {
+	if err := checkPeerID(id); err != nil {
+		return err
+	}
+	c.node.BanPeer(id, duration, "banned by the admin")
+	return nil
+}
+
+// UnbanPeer allows the banned peer to connect again
+func (c *Core) UnbanPeer(id string) error {
+	if err := checkPeerID(id); err != nil {
+		return err
+	}
+	if !c.node.UnbanPeer(id) {
+		return fmt.Errorf("peer %s is not banned", id)
+	}
+	return nil
+}
+
+func checkPeerID(id string) error {
+	if len(crypto.IDToBytes(id)) != btcec.PubKeyBytesLenCompressed {
+		return fmt.Errorf("invalid peer id %s", id)
+	}
+	return nil
+}
+
 // UploadEvidenceRaw uploads the hash of evidence
 // the node will sign it and broadcast to the network
 func (c *Core) UploadEvidenceRaw(evds []*RawEvidence) error {
+	if c.lightNode {
+		return ErrLightNode
+	}
+
 	for _, evd := range evds {
 		if len(evd.Hash) != utils.HashLength {
 			return fmt.Errorf("invalid hash size[%X]", evd.Hash)
@@ -97,6 +189,10 @@ func (c *Core) UploadEvidenceRaw(evds []*RawEvidence) error {
 
 // UploadEvidence uploads the evidence
 func (c *Core) UploadEvidence(evds []*cp.Evidence) error {
+	if c.lightNode {
+		return ErrLightNode
+	}
+
 	for _, evd := range evds {
 		if err := c.chain.VerifyEvidence(evd); err != nil {
 			if _, ok := err.(blockchain.ErrEvidenceAlreadyExist); ok {
@@ -111,11 +207,54 @@ func (c *Core) UploadEvidence(evds []*cp.Evidence) error {
 }
 
 func (c *Core) QueryEvidence(hash []string) []*EvidenceInfo {
-	return c.queryCache.getEvidence(hash)
+	result := c.queryCache.getEvidence(hash)
+	if !c.lightNode {
+		return result
+	}
+
+	// the light node fetches the evidences which are not found locally
+	found := make(map[string]bool)
+	for _, e := range result {
+		found[utils.ToHex(e.Hash)] = true
+	}
+
+	var toFetch [][]byte
+	for _, h := range hash {
+		hashB, err := utils.FromHex(h)
+		if err != nil || len(hashB) != utils.HashLength || found[utils.ToHex(hashB)] {
+			continue
+		}
+		toFetch = append(toFetch, hashB)
+	}
+	if len(toFetch) == 0 {
+		return result
+	}
+
+	return append(result, c.n.fetchEvidences(nil, toFetch)...)
 }
 
 func (c *Core) QueryAccount(id string) ([][]byte, uint64) {
-	return c.queryCache.getAccount(id)
+	evds, score := c.queryCache.getAccount(id)
+	if !c.lightNode {
+		return evds, score
+	}
+
+	// the light node fetches the evidences of the account, the score is counted from the headers
+	accountKeyB := crypto.IDToBytes(id)
+	if accountKeyB == nil {
+		return evds, score
+	}
+
+	found := make(map[string]bool)
+	for _, h := range evds {
+		found[utils.ToHex(h)] = true
+	}
+	for _, e := range c.n.fetchEvidences(accountKeyB, nil) {
+		if !found[utils.ToHex(e.Hash)] {
+			evds = append(evds, e.Hash)
+		}
+	}
+	return evds, score
 }
 
 func (c *Core) QueryBlockViaHeights(heights []uint64) []*BlockInfo {
@@ -161,3 +300,46 @@ func (c *Core) QueryBlockViaHash(hash []string) []*BlockInfo {
 
 	return result
 }
+
+// QueryBlockViaTime returns the chain head at the time, which is the highest block whose time is not after t
+func (c *Core) QueryBlockViaTime(t int64) *BlockInfo {
+	return c.queryCache.getBlockViaTime(t)
+}
+
+// QueryEvidenceViaTime returns a page of the evidences in the blocks whose time is in [begin, end]
+// from the older to the newer and the total number of the evidences in the time window
+func (c *Core) QueryEvidenceViaTime(begin, end int64, offset, limit int) ([]*EvidenceInfo, int, error) {
+	if c.lightNode {
+		return nil, 0, ErrLightNode
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	// the unstored evidences are newer than the stored ones
+	latestHeight, err := db.GetLatestHeight()
+	if err != nil {
+		return nil, 0, err
+	}
+	unstored := c.queryCache.getEvidenceViaTime(begin, end, latestHeight)
+
+	refs, stored, err := db.GetEvidenceViaTime(begin, end, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var hexHashes []string
+	for _, ref := range refs {
+		hexHashes = append(hexHashes, utils.ToHex(ref.Hash))
+	}
+	result := c.queryCache.getEvidence(hexHashes)
+
+	i := offset - stored
+	if i < 0 {
+		i = 0
+	}
+	for ; i < len(unstored) && len(result) < limit; i++ {
+		result = append(result, unstored[i])
+	}
+	return result, stored + len(unstored), nil
+}
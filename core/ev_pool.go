@@ -3,14 +3,24 @@ package core
 import (
 	"math/big"
 	"sync"
+	"time"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/serialize/cp"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
-const evdsCacheSize = 1024
+const (
+	evdsCacheSize = 1024
+
+	// the evidences are kept for recentEvidenceTime after inserted,
+	// even they are taken by the miner, to rebuild the compact blocks;
+	// the oldest ones are dropped once there are maxRecentEvidences
+	recentEvidenceTime = 10 * time.Minute
+	maxRecentEvidences = 4 * params.MaxEvidencesInBlock
+)
 
 type RawEvidence struct {
 	Hash        []byte
@@ -22,10 +32,17 @@ type weightedEvidence struct {
 	weight *big.Int
 }
 
+type recentEvidence struct {
+	*cp.Evidence
+	time time.Time
+}
+
 type evidencePool struct {
 	key       *btcec.PrivateKey
 	raws      chan *RawEvidence
 	evds      []*weightedEvidence //ascending order
+	recent    map[string]*recentEvidence
+	recentKey []string // the keys of recent in the inserted order
 	evdsMutex sync.Mutex
 	broadcast chan<- []*cp.Evidence
 	lm        *utils.LoopMode
@@ -33,9 +50,10 @@ type evidencePool struct {
 
 func newEvidencePool(key *btcec.PrivateKey) *evidencePool {
 	ep := &evidencePool{
-		key:  key,
-		raws: make(chan *RawEvidence, evdsCacheSize),
-		lm:   utils.NewLoop(1),
+		key:    key,
+		raws:   make(chan *RawEvidence, evdsCacheSize),
+		recent: make(map[string]*recentEvidence),
+		lm:     utils.NewLoop(1),
 	}
 	return ep
 }
@@ -48,12 +66,17 @@ func (e *evidencePool) start() {
 	go func() {
 		e.lm.Add()
 		defer e.lm.Done()
+
+		cleanTicker := time.NewTicker(time.Minute)
+		defer cleanTicker.Stop()
 		for {
 			select {
 			case <-e.lm.D:
 				return
 			case raw := <-e.raws:
 				e.calculateRaw(raw)
+			case <-cleanTicker.C:
+				e.cleanRecent()
 			}
 		}
 	}()
@@ -78,6 +101,7 @@ func (e *evidencePool) addRawEvidence(evds []*RawEvidence) {
 
 func (e *evidencePool) addEvidence(evds []*cp.Evidence, fromBroadcast bool) {
 	for _, evd := range evds {
+		e.addRecent(evd)
 		e.insert(&weightedEvidence{evd, evd.GetPow()})
 	}
 
@@ -99,6 +123,51 @@ func (e *evidencePool) nextEvidence() *cp.Evidence {
 	return result.Evidence
 }
 
+// recentEvidences returns the evidences inserted in recentEvidenceTime
+func (e *evidencePool) recentEvidences() []*cp.Evidence {
+	e.evdsMutex.Lock()
+	defer e.evdsMutex.Unlock()
+
+	var result []*cp.Evidence
+	for _, r := range e.recent {
+		result = append(result, r.Evidence)
+	}
+	return result
+}
+
+func (e *evidencePool) addRecent(evd *cp.Evidence) {
+	e.evdsMutex.Lock()
+	defer e.evdsMutex.Unlock()
+
+	key := utils.ToHex(evd.GetSerializedHash())
+	if _, ok := e.recent[key]; ok {
+		return
+	}
+	e.recent[key] = &recentEvidence{evd, time.Now()}
+	e.recentKey = append(e.recentKey, key)
+
+	if len(e.recentKey) > maxRecentEvidences {
+		delete(e.recent, e.recentKey[0])
+		e.recentKey = e.recentKey[1:]
+	}
+}
+
+func (e *evidencePool) cleanRecent() {
+	e.evdsMutex.Lock()
+	defer e.evdsMutex.Unlock()
+
+	// the older ones are in the front
+	now := time.Now()
+	for len(e.recentKey) > 0 {
+		key := e.recentKey[0]
+		if now.Sub(e.recent[key].time) <= recentEvidenceTime {
+			break
+		}
+		delete(e.recent, key)
+		e.recentKey = e.recentKey[1:]
+	}
+}
+
 func (e *evidencePool) calculateRaw(raw *RawEvidence) {
 	pubKey := e.key.PubKey()
 	evd := cp.NewEvidenceV1(raw.Hash, []byte(raw.Description), pubKey.SerializeCompressed())
@@ -114,6 +183,7 @@ func (e *evidencePool) calculateRaw(raw *RawEvidence) {
 	}
 	logger.Debug("find nonce %d for evidence %X\n", evd.Nonce, raw)
 
+	e.addRecent(evd)
 	e.insert(&weightedEvidence{evd, weight})
 	select {
 	case e.broadcast <- []*cp.Evidence{evd}:
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
+	"github.com/996BC/996.Blockchain/serialize/cp"
 	"github.com/996BC/996.Blockchain/utils"
 )
 
@@ -62,3 +64,35 @@ func TestInsert(t *testing.T) {
 		}
 	}
 }
+
+func TestRecentEvidences(t *testing.T) {
+	evp := newEvidencePool(nil)
+	base := cp.GenEvidenceFromParams(cp.NewEvidenceParams())
+	for i := 0; i < maxRecentEvidences+10; i++ {
+		e := *base
+		e.SetNonce(uint32(i))
+		evp.addRecent(&e)
+	}
+	if err := utils.TCheckInt("recent evidences", maxRecentEvidences, len(evp.recentEvidences())); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest ones are dropped first
+	first := *base
+	first.SetNonce(0)
+	if _, ok := evp.recent[utils.ToHex(first.GetSerializedHash())]; ok {
+		t.Fatal("expect the oldest evidence dropped")
+	}
+
+	expired := 100
+	for _, key := range evp.recentKey[:expired] {
+		evp.recent[key].time = time.Now().Add(-recentEvidenceTime - time.Second)
+	}
+	evp.cleanRecent()
+	if err := utils.TCheckInt("unexpired evidences", maxRecentEvidences-expired, len(evp.recent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("unexpired keys", maxRecentEvidences-expired, len(evp.recentKey)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	maxEvidencesInResponse = 64
+	evidenceFetchTimeout   = 5 * time.Second
+	peerInactiveTimeout    = 1 * time.Minute
+)
+
+// evidenceFetch fetches the evidences from the full nodes for the light node,
+// via the evidence hashes or via the account
+type evidenceFetch struct {
+	id       uint32
+	account  []byte
+	hashes   map[string]bool // hex hash as key
+	result   map[string]*EvidenceInfo
+	peersNum int
+	finished map[string]bool // the peers which have finished replying
+	done     chan []*EvidenceInfo
+}
+
+func newEvidenceFetch(account []byte, hashes [][]byte) *evidenceFetch {
+	result := &evidenceFetch{
+		account:  account,
+		hashes:   make(map[string]bool),
+		result:   make(map[string]*EvidenceInfo),
+		finished: make(map[string]bool),
+		done:     make(chan []*EvidenceInfo, 1),
+	}
+	for _, h := range hashes {
+		result.hashes[utils.ToHex(h)] = true
+	}
+	return result
+}
+
+func (f *evidenceFetch) isDone() bool {
+	if len(f.finished) >= f.peersNum {
+		return true
+	}
+
+	if f.account != nil {
+		return false
+	}
+	return len(f.result) == len(f.hashes)
+}
+
+func (f *evidenceFetch) isExpected(e *cp.Evidence) bool {
+	if f.account != nil {
+		return bytes.Equal(e.PubKey, f.account)
+	}
+	return f.hashes[utils.ToHex(e.Hash)]
+}
+
+// fetchEvidences sends the request to the full nodes and waits for the verified evidences,
+// only the evidences in the longest branch are returned
+func (n *net) fetchEvidences(account []byte, hashes [][]byte) []*EvidenceInfo {
+	f := newEvidenceFetch(account, hashes)
+	select {
+	case n.fetchC <- f:
+	case <-n.lm.D:
+		return nil
+	}
+
+	select {
+	case result := <-f.done:
+		return result
+	case <-time.After(evidenceFetchTimeout):
+	}
+
+	// give up waiting for the other responses
+	select {
+	case n.fetchTimeoutC <- f:
+	case <-n.lm.D:
+		return nil
+	}
+
+	select {
+	case result := <-f.done:
+		return result
+	case <-n.lm.D:
+		return nil
+	}
+}
+
+func (n *net) startFetch(f *evidenceFetch) {
+	n.fetchID++
+	f.id = n.fetchID
+	f.peersNum = len(n.peers)
+
+	var hashes [][]byte
+	for h := range f.hashes {
+		hash, _ := utils.FromHex(h)
+		hashes = append(hashes, hash)
+	}
+
+	request := cp.NewEvidenceRequest(f.id, f.account, hashes).Marshal()
+	for peerID := range n.peers {
+		n.send(request, peerID)
+	}
+
+	n.fetches[f.id] = f
+	if f.peersNum == 0 {
+		logger.Warn("no peers to fetch evidences from\n")
+		n.finishFetch(f)
+	}
+}
+
+func (n *net) finishFetch(f *evidenceFetch) {
+	if _, ok := n.fetches[f.id]; !ok {
+		return
+	}
+	delete(n.fetches, f.id)
+
+	var result []*EvidenceInfo
+	for _, info := range f.result {
+		result = append(result, info)
+	}
+	f.done <- result
+}
+
+func (n *net) handleEvidenceRequest(r *cp.EvidenceRequest, peerID string) {
+	if err := r.Verify(); err != nil {
+		logger.Warn("receive invalid EvidenceRequest from %s:%v\n", peerID, err)
+		n.pr.Punish(peerID, malformedMessageScore, err.Error())
+		return
+	}
+	logger.Debug("receive EvidenceRequest from %s, %v\n", peerID, r)
+
+	var proofs []*cp.EvidenceProof
+	if r.IsAccountRequest() {
+		var err error
+		if proofs, err = n.chain.GetAccountEvidenceProofs(r.Account); err != nil {
+			logger.Warn("get evidence proofs of account %X failed:%v\n", r.Account, err)
+			return
+		}
+	} else {
+		for _, hash := range r.Hashes {
+			if proof, err := n.chain.GetEvidenceProof(hash); err == nil {
+				proofs = append(proofs, proof)
+			}
+		}
+	}
+
+	logger.Debug("reply EvidenceRequest with %d evidences\n", len(proofs))
+	remain := (len(proofs) - 1) / maxEvidencesInResponse
+	for {
+		sendNum := maxEvidencesInResponse
+		if len(proofs) < maxEvidencesInResponse {
+			sendNum = len(proofs)
+		}
+
+		response := cp.NewEvidenceResponse(r.ID, uint16(remain), proofs[:sendNum]).Marshal()
+		n.send(response, peerID)
+
+		proofs = proofs[sendNum:]
+		if remain <= 0 {
+			break
+		}
+		remain--
+	}
+}
+
+func (n *net) handleEvidenceResponse(r *cp.EvidenceResponse, peerID string) {
+	f, ok := n.fetches[r.ID]
+	if !ok {
+		return
+	}
+	logger.Debug("receive EvidenceResponse from %s, %v\n", peerID, r)
+
+	for _, p := range r.Proofs {
+		if !f.isExpected(p.Evidence) {
+			logger.Warn("receive unexpected evidence %X from %s\n", p.Hash, peerID)
+			continue
+		}
+
+		header, height, err := n.chain.VerifyEvidenceProof(p)
+		if err != nil {
+			logger.Warn("verify evidence proof from %s failed:%v\n", peerID, err)
+			continue
+		}
+
+		f.result[utils.ToHex(p.Hash)] = &EvidenceInfo{
+			Evidence:  p.Evidence,
+			Height:    height,
+			BlockHash: p.BlockHash,
+			Time:      header.Time,
+		}
+	}
+
+	if r.Remain == 0 {
+		f.finished[peerID] = true
+	}
+	if f.isDone() {
+		n.finishFetch(f)
+	}
+}
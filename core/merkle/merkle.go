@@ -74,3 +74,86 @@ func SortByteArray(leafs MerkleLeafs) {
 
 	sort.Sort(leafs)
 }
+
+// Proof is the merkle path from a leaf to the root
+type Proof struct {
+	Index   int
+	LeafNum int
+
+	// Siblings are the hashes needed to compute the root, from the bottom to the top
+	Siblings [][]byte
+}
+
+// ComputeProof returns the proof of the leaf at the index,
+// the input parameter won't be modified
+func ComputeProof(leafs MerkleLeafs, index int) (*Proof, error) {
+	if index < 0 || index >= leafs.Len() {
+		return nil, fmt.Errorf("invalid index %d of %d leafs", index, leafs.Len())
+	}
+
+	result := &Proof{
+		Index:   index,
+		LeafNum: leafs.Len(),
+	}
+
+	harray := make(MerkleLeafs, leafs.Len())
+	copy(harray, leafs)
+	for len(harray) > 1 {
+		if index%2 == 1 {
+			result.Siblings = append(result.Siblings, harray[index-1])
+		} else if index+1 < len(harray) {
+			result.Siblings = append(result.Siblings, harray[index+1])
+		}
+
+		var upper MerkleLeafs
+		for i := 0; i < len(harray); i += 2 {
+			if i+1 < len(harray) {
+				upper = append(upper, hashOfTwoNode(harray[i], harray[i+1]))
+			} else {
+				upper = append(upper, harray[i])
+			}
+		}
+
+		harray = upper
+		index /= 2
+	}
+
+	return result, nil
+}
+
+// VerifyProof checks whether the leaf belongs to the merkle tree of the root
+func VerifyProof(leaf []byte, p *Proof, root []byte) bool {
+	if p.Index < 0 || p.Index >= p.LeafNum {
+		return false
+	}
+
+	hash := leaf
+	index, num, used := p.Index, p.LeafNum, 0
+	for num > 1 {
+		// the last node of a level without sibling is moved up directly
+		if index%2 == 1 || index+1 < num {
+			if used == len(p.Siblings) {
+				return false
+			}
+
+			if index%2 == 1 {
+				hash = hashOfTwoNode(p.Siblings[used], hash)
+			} else {
+				hash = hashOfTwoNode(hash, p.Siblings[used])
+			}
+			used++
+		}
+
+		index /= 2
+		num = (num + 1) / 2
+	}
+
+	return used == len(p.Siblings) && bytes.Equal(hash, root)
+}
+
+func hashOfTwoNode(left []byte, right []byte) []byte {
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	data = append(data, right...)
+	return utils.Hash(data)
+}
@@ -71,3 +71,38 @@ func toByteArray(sa []string) [][]byte {
 	}
 	return result
 }
+
+func TestProof(t *testing.T) {
+	hashes := []string{"hash_111", "hash_222", "hash_333", "hash_444", "hash_555", "hash_666", "hash_777"}
+
+	for num := 1; num <= len(hashes); num++ {
+		leafs := toByteArray(hashes[:num])
+		root, _ := ComputeRoot(toByteArray(hashes[:num]))
+
+		for i := 0; i < num; i++ {
+			proof, err := ComputeProof(leafs, i)
+			if err != nil {
+				t.Fatalf("[%d-%d] compute proof failed:%v\n", num, i, err)
+			}
+
+			if !VerifyProof([]byte(hashes[i]), proof, root) {
+				t.Fatalf("[%d-%d] verify proof failed\n", num, i)
+			}
+
+			if VerifyProof([]byte("hash_000"), proof, root) {
+				t.Fatalf("[%d-%d] expect verifying wrong leaf failed\n", num, i)
+			}
+
+			if num > 1 {
+				proof.Index = (i + 1) % num
+				if VerifyProof([]byte(hashes[i]), proof, root) {
+					t.Fatalf("[%d-%d] expect verifying wrong index failed\n", num, i)
+				}
+			}
+		}
+	}
+
+	if _, err := ComputeProof(toByteArray(hashes), len(hashes)); err == nil {
+		t.Fatal("expect computing proof of invalid index failed")
+	}
+}
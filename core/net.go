@@ -2,11 +2,12 @@ package core
 
 import (
 	"bytes"
-	"encoding/base64"
 	"fmt"
 	"time"
 
 	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/db"
 	"github.com/996BC/996.Blockchain/p2p"
 	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/serialize/cp"
@@ -17,15 +18,90 @@ const (
 	coreProtocolID           = 100
 	coreProtocol             = "CoreProtocol"
 	maxBlocksNumInResponse   = 16
+	maxHeadersNumInResponse  = 256
 	initializingSyncInterval = 1 * time.Second
 	syncInterval             = 5 * time.Second
+
+	// the misbehavior scores, the peer is banned once its score reaches p2p.BanScore
+	malformedMessageScore = 10
+	invalidEvidenceScore  = 20
+	invalidBlockScore     = 20
+
+	// the announced items are served to GetData for relayCacheTime,
+	// an item not replied in getDataTimeout is requested from the next announcer
+	relayCacheTime       = 2 * time.Minute
+	getDataTimeout       = 30 * time.Second
+	getDataRetryInterval = 5 * time.Second
+	maxAnnouncers        = 8
+	knownInvTime         = 1 * time.Hour
+
+	// the blocks are synced in windows of maxBlocksNumInResponse blocks after the headers,
+	// a peer is assigned at most maxWindowsPerPeer windows at the same time
+	maxWindowsPerPeer = 4
+	headersTimeout    = 30 * time.Second
+	windowTimeout     = 30 * time.Second
 )
 
-type waitingBlocks struct {
-	peerID           string
-	lastResponseTime time.Time
-	remainNums       uint32
-	response         []*cp.BlockResponse
+// relayItem is the announced block or evidence
+type relayItem struct {
+	block    *cp.Block
+	evidence *cp.Evidence
+	time     time.Time
+}
+
+// getDataRequest is an item requested with GetData from peerID,
+// the later announcers are kept to request the item in order
+type getDataRequest struct {
+	item       *cp.InvItem
+	peerID     string
+	announcers []string
+	time       time.Time
+}
+
+func (r *getDataRequest) addAnnouncer(peerID string) {
+	if peerID == r.peerID || len(r.announcers) >= maxAnnouncers {
+		return
+	}
+	for _, a := range r.announcers {
+		if a == peerID {
+			return
+		}
+	}
+	r.announcers = append(r.announcers, peerID)
+}
+
+// compactBlock is the CompactBlock waiting for its missing evidences
+type compactBlock struct {
+	header  *cp.BlockHeader
+	evds    []*cp.Evidence
+	missing []uint16 // indexes of the missing evidences
+	peerID  string
+	full    bool // all the evidences are requested
+	time    time.Time
+}
+
+// headersSync downloads the headers of the sync range from a peer first,
+// then the blocks in windows from all the peers ahead of us in parallel
+type headersSync struct {
+	base        []byte
+	end         []byte
+	heightDiff  uint32
+	headersPeer string
+	lastActive  time.Time // the last time receiving the headers
+	headers     []*cp.BlockHeader
+
+	peers   []string        // the peers ahead of us
+	stalled map[string]bool // the peers timeout or replying mismatched blocks
+	windows []*syncWindow
+	next    int // index of the next window to add to the chain
+}
+
+type syncWindow struct {
+	base        []byte
+	hashes      [][]byte
+	peerID      string // empty if not assigned
+	requestTime time.Time
+	blocks      []*cp.Block
 }
 
 // net runs the "CoreProtocol" with other peers
@@ -41,30 +117,52 @@ type net struct {
 	chain     *blockchain.Chain
 	pool      *evidencePool
 
-	syncTicker    *time.Ticker
-	syncHashResp  map[string]*cp.SyncResponse // peerID as key
-	watingHash    bool
-	waitingBlocks []*waitingBlocks
-
-	evdsToBroadcast chan []*cp.Evidence
-	broadcastFilter map[string]time.Time
-	lm              *utils.LoopMode
+	syncTicker   *time.Ticker
+	syncHashResp map[string]*cp.SyncResponse // peerID as key
+	watingHash   bool
+	hs           *headersSync
+
+	evdsToBroadcast   chan []*cp.Evidence
+	blocksToBroadcast chan *cp.Block
+	lm                *utils.LoopMode
+
+	// the blocks and evidences are announced with Inventory and fetched with GetData,
+	// the item key as the key of the maps
+	knownInv   map[string]time.Time // the items received or announced
+	relayCache map[string]*relayItem
+	requested  map[string]*getDataRequest // waiting for the reply of GetData
+	compacts   map[string]*compactBlock
+
+	// the light node fetches evidences from the active peers
+	peers         map[string]time.Time // last active time of the peers
+	fetchID       uint32
+	fetches       map[uint32]*evidenceFetch
+	fetchC        chan *evidenceFetch
+	fetchTimeoutC chan *evidenceFetch
 }
 
 func newNet(node p2p.Node, chain *blockchain.Chain, pool *evidencePool, nodeType params.NodeType) *net {
 	result := &net{
-		InitFinishC:     make(chan bool, 1),
-		inited:          false,
-		lightNode:       nodeType == params.LightNode,
-		sendQ:           make(chan *p2p.PeerData, 512),
-		chain:           chain,
-		pool:            pool,
-		syncTicker:      time.NewTicker(initializingSyncInterval),
-		syncHashResp:    make(map[string]*cp.SyncResponse),
-		watingHash:      false,
-		evdsToBroadcast: make(chan []*cp.Evidence, evdsCacheSize),
-		broadcastFilter: make(map[string]time.Time),
-		lm:              utils.NewLoop(2),
+		InitFinishC:       make(chan bool, 1),
+		inited:            false,
+		lightNode:         nodeType == params.LightNode,
+		sendQ:             make(chan *p2p.PeerData, 512),
+		chain:             chain,
+		pool:              pool,
+		syncTicker:        time.NewTicker(initializingSyncInterval),
+		syncHashResp:      make(map[string]*cp.SyncResponse),
+		watingHash:        false,
+		evdsToBroadcast:   make(chan []*cp.Evidence, evdsCacheSize),
+		blocksToBroadcast: make(chan *cp.Block, 16),
+		lm:                utils.NewLoop(2),
+		knownInv:          make(map[string]time.Time),
+		relayCache:        make(map[string]*relayItem),
+		requested:         make(map[string]*getDataRequest),
+		compacts:          make(map[string]*compactBlock),
+		peers:             make(map[string]time.Time),
+		fetches:           make(map[uint32]*evidenceFetch),
+		fetchC:            make(chan *evidenceFetch),
+		fetchTimeoutC:     make(chan *evidenceFetch),
 	}
 
 	result.pr = node.AddProtocol(result)
@@ -94,6 +192,7 @@ func (n *net) loop() {
 	defer n.lm.Done()
 
 	cleanupTicker := time.NewTicker(30 * time.Second)
+	getDataTicker := time.NewTicker(getDataRetryInterval)
 	recvPktChan := n.pr.GetRecvChan()
 
 	for {
@@ -105,13 +204,38 @@ func (n *net) loop() {
 		case <-n.syncTicker.C:
 			n.sync()
 		case evds := <-n.evdsToBroadcast:
-			n.broadcastEvidence(evds)
+			n.relayEvidences(evds)
+		case b := <-n.blocksToBroadcast:
+			n.relayBlock(b)
+		case invalid := <-n.chain.InvalidBlockNotify:
+			score := invalidBlockScore
+			if invalid.Err.Severe() {
+				score = p2p.BanScore
+			}
+			n.pr.Punish(invalid.Peer, score, invalid.Err.Error())
+		case f := <-n.fetchC:
+			n.startFetch(f)
+		case f := <-n.fetchTimeoutC:
+			n.finishFetch(f)
+		case <-getDataTicker.C:
+			n.retryGetData()
 		case <-cleanupTicker.C:
 			now := time.Now()
 
-			for k, v := range n.broadcastFilter {
-				if now.Sub(v) > 1*time.Hour {
-					delete(n.broadcastFilter, k)
+			for k, v := range n.knownInv {
+				if now.Sub(v) > knownInvTime {
+					delete(n.knownInv, k)
+				}
+			}
+			for k, v := range n.relayCache {
+				if now.Sub(v.time) > relayCacheTime {
+					delete(n.relayCache, k)
+				}
+			}
+
+			for k, v := range n.peers {
+				if now.Sub(v) > peerInactiveTimeout {
+					delete(n.peers, k)
 				}
 			}
 
@@ -127,10 +251,6 @@ func (n *net) send(data []byte, peerID string) {
 }
 
 func (n *net) broadcast(data []byte) {
-	h := utils.Hash(data)
-	encoded := base64.StdEncoding.EncodeToString(h)
-	n.broadcastFilter[encoded] = time.Now()
-
 	select {
 	case n.sendQ <- &p2p.PeerData{
 		Data: data,
@@ -161,16 +281,28 @@ func (n *net) handleRecvPacket(pd *p2p.PeerData) {
 	var msg *cp.Head
 
 	if msg, err = cp.UnmarshalHead(bytes.NewReader(pd.Data)); err != nil {
+		n.pr.Punish(pd.Peer, malformedMessageScore, "malformed message head")
 		return
 	}
 
+	// the unknown message type is ignored, it might be added by the newer version
 	errorlog := func() {
 		logger.Warn("receive err type(%d) msg from %s\n", msg.Type, pd.Peer)
-		return
+		n.pr.Punish(pd.Peer, malformedMessageScore, fmt.Sprintf("malformed message of type %d", msg.Type))
 	}
 
+	n.peers[pd.Peer] = time.Now()
+
 	// ignore broadcast before init finish
-	if !n.inited && (msg.Type == cp.MsgBlockBroadcast || msg.Type == cp.MsgEvidenceBroadcast) {
+	if !n.inited && (msg.Type == cp.MsgBlockBroadcast || msg.Type == cp.MsgEvidenceBroadcast ||
+		msg.Type == cp.MsgInventory || msg.Type == cp.MsgCompactBlock) {
+		return
+	}
+
+	// the light node doesn't serve other nodes and doesn't verify evidences
+	if n.lightNode && (msg.Type == cp.MsgSyncReq || msg.Type == cp.MsgBlockRequest ||
+		msg.Type == cp.MsgEvidenceRequest || msg.Type == cp.MsgEvidenceBroadcast ||
+		msg.Type == cp.MsgCompactRequest || msg.Type == cp.MsgCompactResponse) {
 		return
 	}
 
@@ -214,7 +346,7 @@ func (n *net) handleRecvPacket(pd *p2p.PeerData) {
 			errorlog()
 			return
 		}
-		n.handleBlockBroadcast(pd.Data, block, pd.Peer)
+		n.handleBlockBroadcast(block, pd.Peer)
 
 	case cp.MsgEvidenceBroadcast:
 		var evds *cp.EvidenceBroadcast
@@ -222,40 +354,101 @@ func (n *net) handleRecvPacket(pd *p2p.PeerData) {
 			errorlog()
 			return
 		}
-		n.handleEvidenceBroadcase(pd.Data, evds, pd.Peer)
+		n.handleEvidenceBroadcase(evds, pd.Peer)
+
+	case cp.MsgEvidenceRequest:
+		var evdRequest *cp.EvidenceRequest
+		if evdRequest, err = cp.UnmarshalEvidenceRequest(data); err != nil {
+			errorlog()
+			return
+		}
+		n.handleEvidenceRequest(evdRequest, pd.Peer)
+
+	case cp.MsgEvidenceResponse:
+		var evdResponse *cp.EvidenceResponse
+		if evdResponse, err = cp.UnmarshalEvidenceResponse(data); err != nil {
+			errorlog()
+			return
+		}
+		n.handleEvidenceResponse(evdResponse, pd.Peer)
+
+	case cp.MsgInventory:
+		var inv *cp.Inventory
+		if inv, err = cp.UnmarshalInventory(data); err != nil || inv.Verify() != nil {
+			errorlog()
+			return
+		}
+		n.handleInventory(inv, pd.Peer)
+
+	case cp.MsgGetData:
+		var getData *cp.GetData
+		if getData, err = cp.UnmarshalGetData(data); err != nil || getData.Verify() != nil {
+			errorlog()
+			return
+		}
+		n.handleGetData(getData, pd.Peer)
+
+	case cp.MsgCompactBlock:
+		var compact *cp.CompactBlock
+		if compact, err = cp.UnmarshalCompactBlock(data); err != nil || compact.Verify() != nil {
+			errorlog()
+			return
+		}
+		n.handleCompactBlock(compact, pd.Peer)
+
+	case cp.MsgCompactRequest:
+		var compactRequest *cp.CompactRequest
+		if compactRequest, err = cp.UnmarshalCompactRequest(data); err != nil || compactRequest.Verify() != nil {
+			errorlog()
+			return
+		}
+		n.handleCompactRequest(compactRequest, pd.Peer)
+
+	case cp.MsgCompactResponse:
+		var compactResponse *cp.CompactResponse
+		if compactResponse, err = cp.UnmarshalCompactResponse(data); err != nil {
+			errorlog()
+			return
+		}
+		n.handleCompactResponse(compactResponse, pd.Peer)
 
 	default:
-		errorlog()
+		logger.Warn("receive unknown type(%d) msg from %s\n", msg.Type, pd.Peer)
 	}
 }
 
 // sync asks the neighbours to sync blocks in 2 steps:
 // step 1. sync the hash of blocks
-// step 2. sync the blocks
-// so it will take 2 * syncInterval time to finish
+// step 2. sync the headers and then the blocks
+// so it will take 2 * syncInterval time to start downloading
 func (n *net) sync() {
-	// if it is not waiting for blocks， do the sync request
-	if len(n.waitingBlocks) == 0 {
+	// if it is not syncing the headers or blocks, do the sync request
+	if n.hs == nil {
 		n.syncRequest()
 		return
 	}
 
-	// otherwise clean up the timeout wating
 	now := time.Now()
-	var waiting []*waitingBlocks
-	for _, exp := range n.waitingBlocks {
-		// expect transfering a block per 5 seconds
-		if now.Sub(exp.lastResponseTime) <= time.Duration(5*maxBlocksNumInResponse)*time.Second {
-			waiting = append(waiting, exp)
-			continue
+	hs := n.hs
+	if hs.windows == nil {
+		if now.Sub(hs.lastActive) > headersTimeout {
+			logger.Info("peer %s response headers timeout, received %d of %d\n",
+				hs.headersPeer, len(hs.headers), hs.heightDiff)
+			n.hs = nil
 		}
+		return
+	}
 
-		logger.Info("peer %s response blocks timeout(now %s, last active %s), remain %d\n",
-			exp.peerID, utils.TimeToString(now),
-			utils.TimeToString(exp.lastResponseTime), exp.remainNums)
-
+	// reassign the timeout windows
+	for _, w := range hs.windows[hs.next:] {
+		if w.blocks == nil && len(w.peerID) != 0 && now.Sub(w.requestTime) > windowTimeout {
+			logger.Info("peer %s response blocks timeout(request at %s), reassign %d blocks from %X\n",
+				w.peerID, utils.TimeToString(w.requestTime), len(w.hashes), w.base)
+			hs.stalled[w.peerID] = true
+			w.peerID = ""
+		}
 	}
-	n.waitingBlocks = waiting
+	n.assignWindows()
 }
 
 func (n *net) syncRequest() {
@@ -270,8 +463,9 @@ func (n *net) syncRequest() {
 		return
 	}
 
-	// otherwise send sync request for blocks
-	queryFilter := make(map[string]bool)
+	// otherwise request the headers from the peer furthest ahead
+	var best *cp.SyncResponse
+	var bestPeer string
 	alreadyUptodate := true
 	for peerID, resp := range n.syncHashResp {
 		if resp.IsUptodate() {
@@ -279,25 +473,32 @@ func (n *net) syncRequest() {
 		}
 		alreadyUptodate = false
 
-		// filters the same response
-		queryFlag := fmt.Sprintf("%X-%d", resp.End, resp.HeightDiff)
-		if _, find := queryFilter[queryFlag]; find {
-			continue
+		if resp.HeightDiff != 0 && (best == nil || resp.HeightDiff > best.HeightDiff) {
+			best = resp
+			bestPeer = peerID
 		}
-		queryFilter[queryFlag] = true
-
-		request := cp.NewBlockRequest(resp.Base, resp.End, n.lightNode).Marshal()
-		n.send(request, peerID)
+	}
 
-		// add to waiting list
-		exp := &waitingBlocks{
-			peerID:           peerID,
-			lastResponseTime: time.Now(),
-			remainNums:       resp.HeightDiff,
+	if best != nil {
+		hs := &headersSync{
+			base:        best.Base,
+			end:         best.End,
+			heightDiff:  best.HeightDiff,
+			headersPeer: bestPeer,
+			lastActive:  time.Now(),
+			stalled:     make(map[string]bool),
 		}
-		n.waitingBlocks = append(n.waitingBlocks, exp)
-		logger.Debug("add block response expection, peer:%s remainNums:%d, from %X to %X\n",
-			exp.peerID, exp.remainNums, resp.Base, resp.End)
+		for peerID, resp := range n.syncHashResp {
+			if !resp.IsUptodate() && bytes.Equal(resp.Base, best.Base) {
+				hs.peers = append(hs.peers, peerID)
+			}
+		}
+		n.hs = hs
+
+		request := cp.NewBlockRequest(best.Base, best.End, true).Marshal()
+		n.send(request, bestPeer)
+		logger.Debug("request %d headers from %s, from %X to %X, %d peers ahead\n",
+			best.HeightDiff, bestPeer, best.Base, best.End, len(hs.peers))
 	}
 
 	// cleanup
@@ -315,14 +516,161 @@ func (n *net) syncRequest() {
 	}
 }
 
+// handleSyncHeaders checks the received headers, the blocks of them
+// are split into windows once all the headers are received
+func (n *net) handleSyncHeaders(blocks []*cp.Block, peerID string) {
+	hs := n.hs
+	hs.lastActive = time.Now()
+
+	last := hs.base
+	if len(hs.headers) != 0 {
+		last = hs.headers[len(hs.headers)-1].GetSerializedHash()
+	}
+	var headers []*cp.BlockHeader
+	for _, b := range blocks {
+		headers = append(headers, b.BlockHeader)
+	}
+	if err := blockchain.VerifyHeaders(last, headers); err != nil {
+		n.hs = nil
+		n.pr.Punish(peerID, invalidBlockScore, err.Error())
+		return
+	}
+
+	hs.headers = append(hs.headers, headers...)
+	if uint32(len(hs.headers)) < hs.heightDiff {
+		return
+	}
+	last = hs.headers[len(hs.headers)-1].GetSerializedHash()
+	if uint32(len(hs.headers)) > hs.heightDiff || !bytes.Equal(last, hs.end) {
+		n.hs = nil
+		n.pr.Punish(peerID, invalidBlockScore, fmt.Sprintf("headers mismatch the sync response end %X", hs.end))
+		return
+	}
+	logger.Debug("receive %d headers from %s\n", len(hs.headers), peerID)
+
+	// the targets are recomputed via the blocks before the base
+	if err := n.chain.VerifySyncHeaders(hs.base, hs.headers); err != nil {
+		n.hs = nil
+		switch err.(type) {
+		case blockchain.ErrHashNotFound, blockchain.ErrFlushingCache:
+			logger.Info("verify the headers from %s failed:%v\n", peerID, err)
+		default:
+			n.pr.Punish(peerID, invalidBlockScore, err.Error())
+		}
+		return
+	}
+
+	// the light node only needs the headers
+	if n.lightNode {
+		var result []*cp.Block
+		for _, h := range hs.headers {
+			result = append(result, cp.NewBlock(h, nil))
+		}
+		n.chain.AddPeerBlocks(result, peerID)
+		n.hs = nil
+		return
+	}
+
+	base := hs.base
+	for i := 0; i < len(hs.headers); i += maxBlocksNumInResponse {
+		w := &syncWindow{base: base}
+		for j := i; j < i+maxBlocksNumInResponse && j < len(hs.headers); j++ {
+			w.hashes = append(w.hashes, hs.headers[j].GetSerializedHash())
+		}
+		hs.windows = append(hs.windows, w)
+		base = w.hashes[len(w.hashes)-1]
+	}
+	n.assignWindows()
+}
+
+// assignWindows requests the unassigned windows from the least loaded peers
+func (n *net) assignWindows() {
+	hs := n.hs
+	load := make(map[string]int)
+	for _, w := range hs.windows[hs.next:] {
+		if w.blocks == nil && len(w.peerID) != 0 {
+			load[w.peerID]++
+		}
+	}
+
+	var available []string
+	for _, p := range hs.peers {
+		if !hs.stalled[p] {
+			available = append(available, p)
+		}
+	}
+	if len(available) == 0 {
+		logger.Info("no peer to sync blocks from %X, %d of %d windows finished\n",
+			hs.base, hs.next, len(hs.windows))
+		n.hs = nil
+		return
+	}
+
+	now := time.Now()
+	for _, w := range hs.windows[hs.next:] {
+		if w.blocks != nil || len(w.peerID) != 0 {
+			continue
+		}
+
+		var peerID string
+		for _, p := range available {
+			if load[p] < maxWindowsPerPeer && (len(peerID) == 0 || load[p] < load[peerID]) {
+				peerID = p
+			}
+		}
+		if len(peerID) == 0 {
+			return
+		}
+
+		w.peerID = peerID
+		w.requestTime = now
+		load[peerID]++
+		request := cp.NewBlockRequest(w.base, w.hashes[len(w.hashes)-1], false).Marshal()
+		n.send(request, peerID)
+	}
+}
+
+// broadcastBlock announces the block mined by us
 func (n *net) broadcastBlock(b *cp.Block) {
-	content := cp.NewBlockBroadcast(b).Marshal()
-	n.broadcast(content)
+	select {
+	case n.blocksToBroadcast <- b:
+	default:
+		logger.Warn("block broadcast queue full, drop block %X\n", b.GetSerializedHash())
+	}
 }
 
-func (n *net) broadcastEvidence(evds []*cp.Evidence) {
-	content := cp.NewEvidenceBroadcast(evds).Marshal()
-	n.broadcast(content)
+// relayBlock caches the block for GetData and announces it
+func (n *net) relayBlock(b *cp.Block) {
+	item := cp.NewInvItem(cp.InvBlock, b.GetSerializedHash())
+	n.relayCache[item.Key()] = &relayItem{block: b, time: time.Now()}
+	n.announce([]*cp.InvItem{item})
+}
+
+// relayEvidences caches the evidences for GetData and announces them
+func (n *net) relayEvidences(evds []*cp.Evidence) {
+	var items []*cp.InvItem
+	for _, e := range evds {
+		item := cp.NewInvItem(cp.InvEvidence, e.Hash)
+		n.relayCache[item.Key()] = &relayItem{evidence: e, time: time.Now()}
+		items = append(items, item)
+	}
+	n.announce(items)
+}
+
+func (n *net) announce(items []*cp.InvItem) {
+	now := time.Now()
+	for _, item := range items {
+		n.knownInv[item.Key()] = now
+	}
+
+	for len(items) > 0 {
+		sendNum := cp.MaxInvItems
+		if len(items) < cp.MaxInvItems {
+			sendNum = len(items)
+		}
+		n.broadcast(cp.NewInventory(items[:sendNum]).Marshal())
+		items = items[sendNum:]
+	}
 }
 
 func (n *net) handleSyncRequest(r *cp.SyncRequest, peerID string) {
@@ -369,9 +717,13 @@ func (n *net) handleBlocksRequest(r *cp.BlockRequest, peerID string) {
 	}
 
 	logger.Debug("reply BlockRequest with %d blocks\n", len(blocks))
+	maxNum := maxBlocksNumInResponse
+	if r.IsOnlyHeader() {
+		maxNum = maxHeadersNumInResponse
+	}
 	for len(blocks) > 0 {
-		sendNum := maxBlocksNumInResponse
-		if len(blocks) < maxBlocksNumInResponse {
+		sendNum := maxNum
+		if len(blocks) < maxNum {
 			sendNum = len(blocks)
 		}
 
@@ -388,61 +740,376 @@ func (n *net) handleBlocksRequest(r *cp.BlockRequest, peerID string) {
 
 func (n *net) handleBlocksResponse(r *cp.BlockResponse, peerID string) {
 	logger.Debug("receive BlockResponse from %s, %d blocks\n", peerID, len(r.Blocks))
-	for i, exp := range n.waitingBlocks {
-		if exp.peerID == peerID {
-			exp.lastResponseTime = time.Now()
-			exp.remainNums -= uint32(len(r.Blocks))
-			exp.response = append(exp.response, r)
-
-			remove := false
-			if exp.remainNums == 0 {
-				logger.Info("finish blocks sync from %s\n", peerID)
-
-				var toAddBlocks []*cp.Block
-				for _, resp := range exp.response {
-					toAddBlocks = append(toAddBlocks, resp.Blocks...)
-				}
-				n.chain.AddBlocks(toAddBlocks, false)
-				remove = true
-			}
-			if exp.remainNums < 0 {
-				logger.Warn("receiv err block response from %s\n", peerID)
-				remove = true
+	hs := n.hs
+	if hs == nil || len(r.Blocks) == 0 {
+		return
+	}
+
+	if hs.windows == nil {
+		if peerID == hs.headersPeer {
+			n.handleSyncHeaders(r.Blocks, peerID)
+		}
+		return
+	}
+
+	var window *syncWindow
+	for _, w := range hs.windows[hs.next:] {
+		if w.peerID == peerID && w.blocks == nil && bytes.Equal(w.base, r.Blocks[0].LastHash) {
+			window = w
+			break
+		}
+	}
+	if window == nil {
+		return
+	}
+
+	// the blocks breaking the consensus limits are dropped before they are verified by the chain
+	for _, b := range r.Blocks {
+		if err := blockchain.VerifyBlockLimits(b); err != nil {
+			n.pr.Punish(peerID, p2p.BanScore, err.Error())
+			hs.stalled[peerID] = true
+			window.peerID = ""
+			n.assignWindows()
+			return
+		}
+	}
+
+	// the peer may be on another branch, or the headers peer lied
+	mismatch := len(r.Blocks) != len(window.hashes)
+	for i := 0; !mismatch && i < len(r.Blocks); i++ {
+		mismatch = !bytes.Equal(r.Blocks[i].GetSerializedHash(), window.hashes[i])
+	}
+	if mismatch {
+		logger.Warn("blocks from %s mismatch the headers, reassign %d blocks from %X\n",
+			peerID, len(window.hashes), window.base)
+		hs.stalled[peerID] = true
+		window.peerID = ""
+		n.assignWindows()
+		return
+	}
+	window.blocks = r.Blocks
+
+	// add the windows to the chain in order
+	for hs.next < len(hs.windows) && hs.windows[hs.next].blocks != nil {
+		w := hs.windows[hs.next]
+		n.chain.AddPeerBlocks(w.blocks, w.peerID)
+		hs.next++
+	}
+	if hs.next == len(hs.windows) {
+		logger.Info("finish %d blocks sync from %X\n", len(hs.headers), hs.base)
+		n.hs = nil
+		return
+	}
+	n.assignWindows()
+}
+
+func (n *net) handleBlockBroadcast(b *cp.BlockBroadcast, peerID string) {
+	n.acceptBlock(b.Block, peerID)
+}
+
+// acceptBlock relays the new block and adds it to the chain
+func (n *net) acceptBlock(cb *cp.Block, peerID string) {
+	// don't relay the block which breaks the consensus limits
+	if err := blockchain.VerifyBlockLimits(cb); err != nil {
+		n.pr.Punish(peerID, p2p.BanScore, err.Error())
+		return
+	}
+
+	hash := cb.GetSerializedHash()
+	key := cp.NewInvItem(cp.InvBlock, hash).Key()
+	delete(n.requested, key)
+	if _, ok := n.knownInv[key]; ok {
+		return
+	}
+
+	logger.Debug("first time receive block from %s, hash %X\n", peerID, hash)
+	if n.lightNode {
+		// the light node doesn't serve other nodes
+		n.knownInv[key] = time.Now()
+	} else {
+		n.relayBlock(cb)
+	}
+	n.chain.AddPeerBlocks([]*cp.Block{cb}, peerID)
+}
+
+func (n *net) handleEvidenceBroadcase(b *cp.EvidenceBroadcast, peerID string) {
+	// don't relay the evidence spam
+	for _, e := range b.Evds {
+		if err := blockchain.VerifyEvidence(e); err != nil {
+			n.pr.Punish(peerID, invalidEvidenceScore, err.Error())
+			return
+		}
+	}
+
+	var evds []*cp.Evidence
+	for _, e := range b.Evds {
+		key := cp.NewInvItem(cp.InvEvidence, e.Hash).Key()
+		delete(n.requested, key)
+		if _, ok := n.knownInv[key]; !ok {
+			evds = append(evds, e)
+		}
+	}
+	if len(evds) == 0 {
+		return
+	}
+
+	logger.Debug("first time receive %d evidences from %s\n", len(evds), peerID)
+	n.relayEvidences(evds)
+	n.pool.addEvidence(evds, true)
+}
+
+// handleInventory requests the announced items which are neither known nor being requested,
+// the peer announcing an item being requested is remembered as its next source
+func (n *net) handleInventory(inv *cp.Inventory, peerID string) {
+	now := time.Now()
+	var wanted []*cp.InvItem
+	for _, item := range inv.Items {
+		// the light node doesn't verify evidences
+		if n.lightNode && item.Type == cp.InvEvidence {
+			continue
+		}
+
+		key := item.Key()
+		if _, ok := n.knownInv[key]; ok {
+			continue
+		}
+		if r, ok := n.requested[key]; ok {
+			r.addAnnouncer(peerID)
+			continue
+		}
+		if n.hasItem(item) {
+			n.knownInv[key] = now
+			continue
+		}
+
+		n.requested[key] = &getDataRequest{
+			item:   item,
+			peerID: peerID,
+			time:   now,
+		}
+		wanted = append(wanted, item)
+	}
+
+	if len(wanted) != 0 {
+		n.send(cp.NewGetData(wanted).Marshal(), peerID)
+	}
+}
+
+// retryGetData requests the items not replied in getDataTimeout from their next announcers,
+// the item is given up if no more peer announced it
+func (n *net) retryGetData() {
+	now := time.Now()
+
+	// the compact block whose peer doesn't reply the missing evidences is dropped,
+	// its GetData times out at the same time and the block is requested from the next announcer
+	for k, c := range n.compacts {
+		if now.Sub(c.time) > getDataTimeout {
+			logger.Debug("peer %s doesn't reply the evidences of compact block %s\n", c.peerID, k)
+			delete(n.compacts, k)
+		}
+	}
+
+	wanted := make(map[string][]*cp.InvItem)
+	for k, r := range n.requested {
+		if now.Sub(r.time) <= getDataTimeout {
+			continue
+		}
+		if len(r.announcers) == 0 {
+			delete(n.requested, k)
+			continue
+		}
+
+		logger.Debug("peer %s doesn't reply item %s, request from %s\n", r.peerID, k, r.announcers[0])
+		r.peerID = r.announcers[0]
+		r.announcers = r.announcers[1:]
+		r.time = now
+		wanted[r.peerID] = append(wanted[r.peerID], r.item)
+	}
+
+	for peerID, items := range wanted {
+		for len(items) > 0 {
+			sendNum := cp.MaxInvItems
+			if len(items) < cp.MaxInvItems {
+				sendNum = len(items)
 			}
+			n.send(cp.NewGetData(items[:sendNum]).Marshal(), peerID)
+			items = items[sendNum:]
+		}
+	}
+}
+
+// handleGetData replies the items still in the relay cache
+func (n *net) handleGetData(r *cp.GetData, peerID string) {
+	var evds []*cp.Evidence
+	for _, item := range r.Items {
+		cached, ok := n.relayCache[item.Key()]
+		if !ok {
+			continue
+		}
+		if cached.block == nil {
+			evds = append(evds, cached.evidence)
+		} else if n.peerHas(peerID, params.CapCompactBlock) {
+			n.send(cp.NewCompactBlock(cached.block).Marshal(), peerID)
+		} else {
+			n.send(cp.NewBlockBroadcast(cached.block).Marshal(), peerID)
+		}
+	}
+
+	if len(evds) != 0 {
+		n.send(cp.NewEvidenceBroadcast(evds).Marshal(), peerID)
+	}
+}
+
+// peerHas returns true if the peer advertised the capability in the handshake
+func (n *net) peerHas(peerID string, c params.Capability) bool {
+	info := n.pr.GetPeerInfo(peerID)
+	return info != nil && info.Has(c)
+}
+
+// handleCompactBlock rebuilds the block from the recent evidences of the pool,
+// and requests the missing ones from the peer
+func (n *net) handleCompactBlock(c *cp.CompactBlock, peerID string) {
+	if len(c.ShortIDs) > params.MaxEvidencesInBlock {
+		n.pr.Punish(peerID, p2p.BanScore, fmt.Sprintf("compact block has %d evidences, exceeds the limit %d",
+			len(c.ShortIDs), params.MaxEvidencesInBlock))
+		return
+	}
+
+	hash := c.Header.GetSerializedHash()
+	key := cp.NewInvItem(cp.InvBlock, hash).Key()
+	if _, ok := n.knownInv[key]; ok {
+		delete(n.requested, key)
+		return
+	}
+	if _, ok := n.compacts[key]; ok {
+		return
+	}
+
+	// the header is checked before rebuilding, so the fake compact blocks cost the pow
+	if err := blockchain.VerifyHeaderPow(c.Header); err != nil {
+		n.pr.Punish(peerID, invalidBlockScore, err.Error())
+		return
+	}
 
-			if remove {
-				n.waitingBlocks = append(n.waitingBlocks[:i], n.waitingBlocks[i+1:]...)
+	// the light node only verifies the header
+	if n.lightNode {
+		n.acceptBlock(cp.NewBlock(c.Header, nil), peerID)
+		return
+	}
+
+	// the evidences with the same short id are ambiguous, requested from the peer
+	candidates := make(map[string]*cp.Evidence)
+	for _, e := range n.pool.recentEvidences() {
+		id := utils.ToHex(cp.ShortID(hash, e))
+		if _, ok := candidates[id]; ok {
+			candidates[id] = nil
+		} else {
+			candidates[id] = e
+		}
+	}
+
+	pending := &compactBlock{
+		header: c.Header,
+		evds:   make([]*cp.Evidence, len(c.ShortIDs)),
+		peerID: peerID,
+		time:   time.Now(),
+	}
+	for i, id := range c.ShortIDs {
+		if e := candidates[utils.ToHex(id)]; e != nil {
+			pending.evds[i] = e
+		} else {
+			pending.missing = append(pending.missing, uint16(i))
+		}
+	}
+	logger.Debug("receive compact block %X from %s, %d evidences, %d missing\n",
+		hash, peerID, len(pending.evds), len(pending.missing))
+
+	n.compacts[key] = pending
+	if r, ok := n.requested[key]; ok {
+		r.time = pending.time
+	}
+	n.completeCompact(key, pending)
+}
+
+func (n *net) completeCompact(key string, pending *compactBlock) {
+	hash := pending.header.GetSerializedHash()
+	if len(pending.missing) != 0 {
+		n.send(cp.NewCompactRequest(hash, pending.missing).Marshal(), pending.peerID)
+		return
+	}
+	delete(n.compacts, key)
+
+	if len(pending.evds) != 0 {
+		var leafs merkle.MerkleLeafs
+		for _, e := range pending.evds {
+			leafs = append(leafs, e.GetSerializedHash())
+		}
+		root, _ := merkle.ComputeRoot(leafs)
+		if !bytes.Equal(root, pending.header.EvidenceRoot) {
+			if pending.full {
+				n.pr.Punish(pending.peerID, invalidBlockScore,
+					fmt.Sprintf("compact block %X mismatch evidence root", hash))
+				return
 			}
 
+			// the short id collides, request all the evidences
+			logger.Debug("compact block %X mismatch evidence root, request all the evidences\n", hash)
+			pending.full = true
+			pending.missing = nil
+			for i := range pending.evds {
+				pending.missing = append(pending.missing, uint16(i))
+			}
+			n.compacts[key] = pending
+			n.send(cp.NewCompactRequest(hash, pending.missing).Marshal(), pending.peerID)
 			return
 		}
 	}
 
+	n.acceptBlock(cp.NewBlock(pending.header, pending.evds), pending.peerID)
 }
 
-func (n *net) handleBlockBroadcast(originData []byte, b *cp.BlockBroadcast, peerID string) {
-	if n.relayBroadcast(originData) {
-		hash := b.Block.GetSerializedHash()
-		logger.Debug("first time receive block broadcast from %s, hash %X\n", peerID, hash)
-		n.chain.AddBlocks([]*cp.Block{b.Block}, false)
+func (n *net) handleCompactRequest(r *cp.CompactRequest, peerID string) {
+	cached, ok := n.relayCache[cp.NewInvItem(cp.InvBlock, r.BlockHash).Key()]
+	if !ok || cached.block == nil {
+		return
 	}
-}
 
-func (n *net) handleEvidenceBroadcase(originData []byte, b *cp.EvidenceBroadcast, peerID string) {
-	if n.relayBroadcast(originData) {
-		logger.Debug("first time receive evidence broadcast from %s, %v\n", peerID, b)
-		n.pool.addEvidence(b.Evds, true)
+	var evds []*cp.Evidence
+	for _, i := range r.Indexes {
+		if int(i) >= len(cached.block.Evds) {
+			n.pr.Punish(peerID, malformedMessageScore, fmt.Sprintf("invalid compact request index %d", i))
+			return
+		}
+		evds = append(evds, cached.block.Evds[i])
 	}
+	n.send(cp.NewCompactResponse(r.BlockHash, evds).Marshal(), peerID)
 }
 
-func (n *net) relayBroadcast(originData []byte) bool {
-	h := utils.Hash(originData)
-	encoded := base64.StdEncoding.EncodeToString(h)
-	if _, ok := n.broadcastFilter[encoded]; ok {
-		return false
+func (n *net) handleCompactResponse(r *cp.CompactResponse, peerID string) {
+	key := cp.NewInvItem(cp.InvBlock, r.BlockHash).Key()
+	pending, ok := n.compacts[key]
+	if !ok || pending.peerID != peerID {
+		return
+	}
+
+	if err := r.Verify(); err != nil || len(r.Evds) != len(pending.missing) {
+		delete(n.compacts, key)
+		n.pr.Punish(peerID, invalidEvidenceScore, fmt.Sprintf("invalid compact response of block %X", r.BlockHash))
+		return
 	}
 
-	n.broadcastFilter[encoded] = time.Now()
-	n.broadcast(originData)
-	return true
+	for i, index := range pending.missing {
+		pending.evds[index] = r.Evds[i]
+	}
+	pending.missing = nil
+	n.completeCompact(key, pending)
+}
+
+// hasItem returns true if the item is already on the chain
+func (n *net) hasItem(item *cp.InvItem) bool {
+	if item.Type == cp.InvEvidence {
+		return db.HasEvidence(item.Hash)
+	}
+	_, _, err := db.GetHeaderViaHash(item.Hash)
+	return err == nil
 }
@@ -0,0 +1,449 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/core/merkle"
+	"github.com/996BC/996.Blockchain/p2p"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func newNetForTest(lightNode bool) *net {
+	return &net{
+		lightNode:  lightNode,
+		sendQ:      make(chan *p2p.PeerData, 16),
+		knownInv:   make(map[string]time.Time),
+		relayCache: make(map[string]*relayItem),
+		requested:  make(map[string]*getDataRequest),
+		compacts:   make(map[string]*compactBlock),
+	}
+}
+
+// protocolRunnerMock only returns the peer infos, the messages are sent via the sendQ of net
+type protocolRunnerMock struct {
+	infos map[string]*p2p.PeerInfo
+}
+
+func newProtocolRunnerMock(infos map[string]*p2p.PeerInfo) *protocolRunnerMock {
+	return &protocolRunnerMock{infos: infos}
+}
+
+func (p *protocolRunnerMock) Send(dp *p2p.PeerData) error                  { return nil }
+func (p *protocolRunnerMock) GetRecvChan() <-chan *p2p.PeerData            { return nil }
+func (p *protocolRunnerMock) Punish(peer string, score int, reason string) {}
+func (p *protocolRunnerMock) GetPeerInfo(peer string) *p2p.PeerInfo        { return p.infos[peer] }
+
+func recvGetData(t *testing.T, n *net, peerID string) *cp.GetData {
+	select {
+	case pd := <-n.sendQ:
+		if err := utils.TCheckString("GetData peer", peerID, pd.Peer); err != nil {
+			t.Fatal(err)
+		}
+		r, err := cp.UnmarshalGetData(bytes.NewReader(pd.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	default:
+		return nil
+	}
+}
+
+func TestHandleInventory(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	known := cp.NewInvItem(cp.InvEvidence, utils.Hash([]byte("known")))
+	evidence := cp.NewInvItem(cp.InvEvidence, utils.Hash([]byte("evidence")))
+	block := cp.NewInvItem(cp.InvBlock, utils.Hash([]byte("block")))
+	inv := cp.NewInventory([]*cp.InvItem{known, evidence, block})
+
+	n := newNetForTest(false)
+	n.knownInv[known.Key()] = time.Now()
+	n.handleInventory(inv, "PeerA")
+	r := recvGetData(t, n, "PeerA")
+	if r == nil {
+		t.Fatal("expect GetData for the unknown items")
+	}
+	if err := utils.TCheckInt("requested items", 2, len(r.Items)); err != nil {
+		t.Fatal(err)
+	}
+
+	// requested and not timeout, the announcers are remembered
+	n.handleInventory(inv, "PeerB")
+	n.handleInventory(inv, "PeerC")
+	n.handleInventory(inv, "PeerB")
+	if recvGetData(t, n, "PeerB") != nil || recvGetData(t, n, "PeerC") != nil {
+		t.Fatal("expect no GetData for the items being requested")
+	}
+	n.retryGetData()
+	if err := utils.TCheckInt("GetData before timeout", 0, len(n.sendQ)); err != nil {
+		t.Fatal(err)
+	}
+
+	// requested from the next announcers in order after timeout
+	for _, next := range []string{"PeerB", "PeerC"} {
+		n.requested[block.Key()].time = time.Now().Add(-getDataTimeout - time.Second)
+		n.retryGetData()
+		if r = recvGetData(t, n, next); r == nil {
+			t.Fatal("expect GetData for the timeout item")
+		}
+		if err := utils.TCheckInt("timeout items", 1, len(r.Items)); err != nil {
+			t.Fatal(err)
+		}
+		if err := utils.TCheckString("timeout item", block.Key(), r.Items[0].Key()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// given up without more announcers
+	n.requested[block.Key()].time = time.Now().Add(-getDataTimeout - time.Second)
+	n.retryGetData()
+	if _, ok := n.requested[block.Key()]; ok {
+		t.Fatal("expect the item given up")
+	}
+
+	// the light node doesn't request evidences
+	light := newNetForTest(true)
+	light.handleInventory(inv, "PeerA")
+	if r = recvGetData(t, light, "PeerA"); r == nil {
+		t.Fatal("expect GetData for the block")
+	}
+	if err := utils.TCheckInt("light node requested items", 1, len(r.Items)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleGetData(t *testing.T) {
+	n := newNetForTest(false)
+	var evds []*cp.Evidence
+	for i := 0; i < 3; i++ {
+		evds = append(evds, cp.GenEvidenceFromParams(cp.NewEvidenceParams()))
+	}
+	n.relayEvidences(evds)
+	if err := utils.TCheckInt("announcement", 1, len(n.sendQ)); err != nil {
+		t.Fatal(err)
+	}
+	<-n.sendQ
+
+	missing := cp.NewInvItem(cp.InvEvidence, utils.Hash([]byte("missing")))
+	n.handleGetData(cp.NewGetData([]*cp.InvItem{
+		cp.NewInvItem(cp.InvEvidence, evds[0].Hash),
+		missing,
+		cp.NewInvItem(cp.InvEvidence, evds[2].Hash),
+	}), "PeerA")
+
+	pd := <-n.sendQ
+	resp, err := cp.UnmarshalEvidenceBroadcast(bytes.NewReader(pd.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("replied evidences", 2, len(resp.Evds)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(evds[2].Hash, resp.Evds[1].Hash) {
+		t.Fatal("expect the requested evidence replied")
+	}
+}
+
+func TestCompactBlockRelay(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+	chain := newDevnetChainForTest(t)
+
+	var evds []*cp.Evidence
+	var leafs merkle.MerkleLeafs
+	for i := 0; i < 3; i++ {
+		e := cp.GenEvidenceFromParams(cp.NewEvidenceParams())
+		evds = append(evds, e)
+		leafs = append(leafs, e.GetSerializedHash())
+	}
+	root, _ := merkle.ComputeRoot(leafs)
+	header := cp.NewBlockHeaderV1(utils.Hash([]byte("last")), evds[0].PubKey, root)
+	header.SetTarget(params.DevnetTargetLimit)
+	for header.NextNonce().Cmp(blockchain.TargetToDiff(header.Target)) != -1 {
+	}
+	block := cp.NewBlock(header, evds)
+	hash := block.GetSerializedHash()
+
+	sender := newNetForTest(false)
+	sender.pr = newProtocolRunnerMock(map[string]*p2p.PeerInfo{
+		"Receiver": {Capabilities: params.CapCompactBlock},
+	})
+	sender.relayBlock(block)
+	<-sender.sendQ
+	sender.handleGetData(cp.NewGetData([]*cp.InvItem{cp.NewInvItem(cp.InvBlock, hash)}), "Receiver")
+	compact, err := cp.UnmarshalCompactBlock(bytes.NewReader((<-sender.sendQ).Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the receiver has the first two evidences
+	receiver := newNetForTest(false)
+	receiver.pr = newProtocolRunnerMock(nil)
+	receiver.pool = newEvidencePool(nil)
+	receiver.chain = chain
+	receiver.pool.addEvidence(evds[:2], true)
+
+	// the fake header failing the pow is rejected before rebuilding
+	fake := *compact
+	fakeHeader := *compact.Header
+	fake.Header = &fakeHeader
+	for fakeHeader.GetPow().Cmp(blockchain.TargetToDiff(fakeHeader.Target)) == -1 {
+		fakeHeader.Time++
+	}
+	receiver.handleCompactBlock(&fake, "Sender")
+	if err := utils.TCheckInt("pending fake compact blocks", 0, len(receiver.compacts)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("fake compact requests", 0, len(receiver.sendQ)); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver.handleCompactBlock(compact, "Sender")
+	request, err := cp.UnmarshalCompactRequest(bytes.NewReader((<-receiver.sendQ).Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("missing evidences", 1, len(request.Indexes)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint16("missing index", 2, request.Indexes[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	sender.handleCompactRequest(request, "Receiver")
+	response, err := cp.UnmarshalCompactResponse(bytes.NewReader((<-sender.sendQ).Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver.handleCompactResponse(response, "Sender")
+
+	key := cp.NewInvItem(cp.InvBlock, hash).Key()
+	if _, ok := receiver.knownInv[key]; !ok {
+		t.Fatal("expect the rebuilt block accepted")
+	}
+	if err := utils.TCheckInt("pending compact blocks", 0, len(receiver.compacts)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, receiver.relayCache[key].block.EvidenceRoot) {
+		t.Fatal("expect the rebuilt block relayed")
+	}
+
+	// the peer without the capability receives the full block
+	sender.handleGetData(cp.NewGetData([]*cp.InvItem{cp.NewInvItem(cp.InvBlock, hash)}), "Legacy")
+	full, err := cp.UnmarshalBlockBroadcast(bytes.NewReader((<-sender.sendQ).Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("block evidences", len(evds), len(full.Block.Evds)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompactBlockTimeout(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+
+	evds := []*cp.Evidence{cp.GenEvidenceFromParams(cp.NewEvidenceParams())}
+	root, _ := merkle.ComputeRoot(merkle.MerkleLeafs{evds[0].GetSerializedHash()})
+	chain := newDevnetChainForTest(t)
+	header := cp.NewBlockHeaderV1(utils.Hash([]byte("last")), evds[0].PubKey, root)
+	header.SetTarget(params.DevnetTargetLimit)
+	for header.NextNonce().Cmp(blockchain.TargetToDiff(header.Target)) != -1 {
+	}
+	block := cp.NewBlock(header, evds)
+	item := cp.NewInvItem(cp.InvBlock, block.GetSerializedHash())
+	inv := cp.NewInventory([]*cp.InvItem{item})
+
+	n := newNetForTest(false)
+	n.pr = newProtocolRunnerMock(nil)
+	n.pool = newEvidencePool(nil)
+	n.chain = chain
+	n.handleInventory(inv, "PeerA")
+	n.handleInventory(inv, "PeerB")
+	if recvGetData(t, n, "PeerA") == nil {
+		t.Fatal("expect GetData for the block")
+	}
+
+	// PeerA withholds the missing evidence
+	n.handleCompactBlock(cp.NewCompactBlock(block), "PeerA")
+	if _, err := cp.UnmarshalCompactRequest(bytes.NewReader((<-n.sendQ).Data)); err != nil {
+		t.Fatal(err)
+	}
+	n.handleCompactBlock(cp.NewCompactBlock(block), "PeerB")
+	if err := utils.TCheckInt("compact requests to the later peer", 0, len(n.sendQ)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the block is requested from PeerB after timeout
+	timeout := time.Now().Add(-getDataTimeout - time.Second)
+	n.compacts[item.Key()].time = timeout
+	n.requested[item.Key()].time = timeout
+	n.retryGetData()
+	if err := utils.TCheckInt("pending compact blocks", 0, len(n.compacts)); err != nil {
+		t.Fatal(err)
+	}
+	if recvGetData(t, n, "PeerB") == nil {
+		t.Fatal("expect GetData for the block from the next announcer")
+	}
+
+	n.handleCompactBlock(cp.NewCompactBlock(block), "PeerB")
+	pd := <-n.sendQ
+	if err := utils.TCheckString("compact request peer", "PeerB", pd.Peer); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// genTestHeaders mines the headers of the devnet target limit after the base,
+// the chain of newDevnetChainForTest initializes the difficulty limit checked by them
+func genTestHeaders(base []byte, num int) []*cp.BlockHeader {
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+
+	var result []*cp.BlockHeader
+	last := base
+	for i := 0; i < num; i++ {
+		h := cp.NewBlockHeaderV1(last, miner, cp.EmptyEvidenceRoot)
+		h.SetTarget(params.DevnetTargetLimit)
+		for h.NextNonce().Cmp(blockchain.TargetToDiff(h.Target)) != -1 {
+		}
+		result = append(result, h)
+		last = h.GetSerializedHash()
+	}
+	return result
+}
+
+func recvBlockRequest(t *testing.T, n *net) (*cp.BlockRequest, string) {
+	pd := <-n.sendQ
+	r, err := cp.UnmarshalBlockRequest(bytes.NewReader(pd.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, pd.Peer
+}
+
+// newDevnetChainForTest initializes the devnet chain of the fixed difficulty
+func newDevnetChainForTest(t *testing.T) *blockchain.Chain {
+	chain := blockchain.NewChain()
+	if err := chain.Init(&blockchain.Config{
+		BlockTargetLimit:    params.DevnetTargetLimit,
+		EvidenceTargetLimit: params.DevnetTargetLimit,
+		BlockInterval:       params.DevnetBlockInterval,
+		Genesis:             blockchain.DevnetGenesis(),
+		DifficultyForks: []*blockchain.DifficultyFork{
+			{Height: 1, Algorithm: blockchain.FixedAlgorithm},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func TestHeadersFirstSync(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+	chain := newDevnetChainForTest(t)
+
+	base := chain.LatestBlockHash()
+	headers := genTestHeaders(base, 2*maxBlocksNumInResponse+8)
+	end := headers[len(headers)-1].GetSerializedHash()
+	var blocks []*cp.Block
+	for _, h := range headers {
+		blocks = append(blocks, cp.NewBlock(h, nil))
+	}
+
+	n := newNetForTest(false)
+	n.chain = chain
+	n.syncHashResp = map[string]*cp.SyncResponse{
+		"PeerA": cp.NewSyncResponse(base, end, uint32(len(headers)), false),
+		"PeerB": cp.NewSyncResponse(base, end, uint32(len(headers)), false),
+		"PeerC": cp.NewSyncResponse(nil, nil, 0, true),
+	}
+	n.syncRequest()
+	r, headersPeer := recvBlockRequest(t, n)
+	if !r.IsOnlyHeader() {
+		t.Fatal("expect requesting the headers first")
+	}
+
+	// the headers are received in 2 responses
+	n.handleBlocksResponse(cp.NewBlockResponse(blocks[:10]), headersPeer)
+	if n.hs.windows != nil {
+		t.Fatal("expect waiting for the remaining headers")
+	}
+	n.handleBlocksResponse(cp.NewBlockResponse(blocks[10:]), headersPeer)
+	if err := utils.TCheckInt("windows", 3, len(n.hs.windows)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the windows are downloaded from both peers
+	assigned := make(map[string]bool)
+	for i := 0; i < len(n.hs.windows); i++ {
+		r, peerID := recvBlockRequest(t, n)
+		if r.IsOnlyHeader() {
+			t.Fatal("expect requesting the blocks")
+		}
+		assigned[peerID] = true
+	}
+	if err := utils.TCheckInt("peers", 2, len(assigned)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stalled window is reassigned to the other peer
+	stalled := n.hs.windows[0]
+	stalledPeer := stalled.peerID
+	stalled.requestTime = time.Now().Add(-windowTimeout - time.Second)
+	n.sync()
+	if _, peerID := recvBlockRequest(t, n); peerID == stalledPeer {
+		t.Fatal("expect the window reassigned to another peer")
+	}
+
+	// the windows are added in order
+	n.handleBlocksResponse(cp.NewBlockResponse(blocks[maxBlocksNumInResponse:2*maxBlocksNumInResponse]),
+		n.hs.windows[1].peerID)
+	if err := utils.TCheckInt("added windows", 0, n.hs.next); err != nil {
+		t.Fatal(err)
+	}
+	n.handleBlocksResponse(cp.NewBlockResponse(blocks[:maxBlocksNumInResponse]), stalled.peerID)
+	if err := utils.TCheckInt("added windows", 2, n.hs.next); err != nil {
+		t.Fatal(err)
+	}
+	n.handleBlocksResponse(cp.NewBlockResponse(blocks[2*maxBlocksNumInResponse:]), n.hs.windows[2].peerID)
+	if n.hs != nil {
+		t.Fatal("expect the sync finished")
+	}
+}
+
+func TestSyncBlocksLimits(t *testing.T) {
+	base := utils.Hash([]byte("base"))
+	e := cp.GenEvidenceFromParams(cp.NewEvidenceParams())
+	header := cp.NewBlockHeaderV1(base, e.PubKey, utils.Hash([]byte("root")))
+	duplicated := cp.NewBlock(header, []*cp.Evidence{e, e})
+
+	n := newNetForTest(false)
+	n.pr = newProtocolRunnerMock(nil)
+	n.hs = &headersSync{
+		base:    base,
+		peers:   []string{"PeerA", "PeerB"},
+		stalled: make(map[string]bool),
+		windows: []*syncWindow{{
+			base:   base,
+			hashes: [][]byte{duplicated.GetSerializedHash()},
+			peerID: "PeerA",
+		}},
+	}
+
+	// the block breaking the limits is dropped even it matches the header
+	n.handleBlocksResponse(cp.NewBlockResponse([]*cp.Block{duplicated}), "PeerA")
+	if !n.hs.stalled["PeerA"] {
+		t.Fatal("expect the peer stalled")
+	}
+	if _, peerID := recvBlockRequest(t, n); peerID != "PeerB" {
+		t.Fatal("expect the window reassigned to another peer")
+	}
+}
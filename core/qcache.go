@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -109,6 +111,57 @@ func (qc *qCache) getLatestBlock() *BlockInfo {
 	}
 }
 
+// getBlockViaTime returns the highest block whose time is not after t
+func (qc *qCache) getBlockViaTime(t int64) *BlockInfo {
+	qc.refresh()
+	sbs := qc.sortedBlocks
+	for _, b := range sbs.blocks {
+		if b.Time <= t {
+			return b
+		}
+	}
+
+	height, err := db.GetHeightViaTime(t)
+	if err != nil {
+		return nil
+	}
+
+	cb, hash, err := db.GetBlockViaHeight(height)
+	if err != nil {
+		return nil
+	}
+
+	return &BlockInfo{
+		Block:     cb,
+		Height:    height,
+		BlockHash: hash,
+	}
+}
+
+// getEvidenceViaTime returns the unstored evidences higher than the height in the blocks
+// whose time is in [begin, end], from the older to the newer
+func (qc *qCache) getEvidenceViaTime(begin, end int64, height uint64) []*EvidenceInfo {
+	qc.refresh()
+	sbs := qc.sortedBlocks
+
+	var result []*EvidenceInfo
+	for i := len(sbs.blocks) - 1; i >= 0; i-- {
+		b := sbs.blocks[i]
+		if b.Height <= height || b.Time < begin || b.Time > end {
+			continue
+		}
+		for _, evd := range b.Evds {
+			result = append(result, &EvidenceInfo{
+				Evidence:  evd,
+				Height:    b.Height,
+				BlockHash: b.BlockHash,
+				Time:      b.Time,
+			})
+		}
+	}
+	return result
+}
+
 func (qc *qCache) getEvidence(hexHash []string) []*EvidenceInfo {
 	qc.refresh()
 	cacheEvds := qc.evidences
@@ -146,6 +199,40 @@ func (qc *qCache) getEvidence(hexHash []string) []*EvidenceInfo {
 	return result
 }
 
+// searchEvidence returns the unstored evidences whose descriptions have all the tokens,
+// from the higher to the lower height
+func (qc *qCache) searchEvidence(tokens []string) []*EvidenceInfo {
+	qc.refresh()
+	cacheEvds := qc.evidences
+
+	var result []*EvidenceInfo
+	for _, e := range cacheEvds {
+		indexed := make(map[string]bool)
+		for _, token := range utils.IndexTokens(string(e.Description)) {
+			indexed[token] = true
+		}
+
+		matched := true
+		for _, token := range tokens {
+			if !indexed[token] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, e)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Height != result[j].Height {
+			return result[i].Height > result[j].Height
+		}
+		return bytes.Compare(result[i].Hash, result[j].Hash) < 0
+	})
+	return result
+}
+
 func (qc *qCache) getAccount(id string) ([][]byte, uint64) {
 	qc.refresh()
 	cacheAccounts := qc.accounts
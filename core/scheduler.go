@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"fmt"
 	"math/big"
 
 	"github.com/996BC/996.Blockchain/core/blockchain"
@@ -10,6 +12,10 @@ import (
 	"github.com/996BC/996.Blockchain/utils"
 )
 
+// blockHeaderReservedSize is the space reserved for the block header
+// and the evidence number field while packing evidences
+const blockHeaderReservedSize = 1024
+
 // scheduler shcedules mining round by round,
 // it collects infomation needed for mining from evidence pool and existed blockchain,
 // and broadcast the block once it found the nonce
@@ -107,17 +113,27 @@ func (s *scheduler) schedule() {
 func (s *scheduler) getEvidence() []*cp.Evidence {
 	evds := make(map[string]*cp.Evidence)
 
-	evdSize := 0
-	for evdSize < params.BlockSize {
+	// reserve the space for block header
+	evdSize := blockHeaderReservedSize
+	for len(evds) < params.MaxEvidencesInBlock {
 		e := s.pool.nextEvidence()
 		if e == nil {
 			break
 		}
 
+		if evdSize+e.Size() > params.BlockSize {
+			// put it back for the next block
+			s.pool.insert(&weightedEvidence{e, e.GetPow()})
+			break
+		}
+
 		if err := s.chain.VerifyEvidence(e); err == nil {
+			key := utils.ToHex(e.Hash)
 			// exclude the same evidence
-			evds[utils.ToHex(e.Hash)] = e
-			evdSize += e.Size()
+			if _, ok := evds[key]; !ok {
+				evds[key] = e
+				evdSize += e.Size()
+			}
 		}
 	}
 
@@ -151,3 +167,34 @@ func (s *scheduler) genEmptyBlock(lastHash []byte) *cp.Block {
 
 	return block
 }
+
+// mineBlock mines a block on the latest block synchronously and returns its hash,
+// it only works with the trivial difficulty of devnet
+func (s *scheduler) mineBlock() ([]byte, error) {
+	const maxTries = 1 << 20
+
+	block := s.genBlock(s.getEvidence(), s.chain.LatestBlockHash())
+	block.SetTarget(s.chain.NextBlockTarget(block.Time))
+	difficulty := blockchain.TargetToDiff(block.Target)
+
+	found := false
+	for i := 0; i < maxTries; i++ {
+		if block.NextNonce().Cmp(difficulty) < 0 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("nonce not found in %d tries, difficulty %s",
+			maxTries, utils.ReadableBigInt(difficulty))
+	}
+
+	hash := block.GetSerializedHash()
+	s.network.broadcastBlock(block)
+	s.chain.AddBlocks([]*cp.Block{block}, true)
+
+	if !bytes.Equal(hash, s.chain.LatestBlockHash()) {
+		return nil, fmt.Errorf("mined block %X is not accepted", hash)
+	}
+	return hash, nil
+}
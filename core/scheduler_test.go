@@ -0,0 +1,30 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestMineDevnetBlocks(t *testing.T) {
+	cleanup := testutil.SetupDB(t)
+	defer cleanup()
+	chain := newDevnetChainForTest(t)
+
+	miner := cp.GenBlockHeaderFromParams(cp.NewBlockHeaderParams()).Miner
+	s := newScheduler(newEvidencePool(nil), chain, newNetForTest(false), miner, 1)
+
+	// the blocks mined back to back keep the trivial difficulty
+	const num = 128
+	for i := 0; i < num; i++ {
+		if _, err := s.mineBlock(); err != nil {
+			t.Fatalf("mine block %d failed:%v", i+1, err)
+		}
+	}
+	// the genesis is at height 1
+	if err := utils.TCheckUint64("height", num+1, chain.LatestHeight()); err != nil {
+		t.Fatal(err)
+	}
+}
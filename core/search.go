@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// SearchQuery finds the evidences by the keywords of their descriptions
+type SearchQuery struct {
+	Keywords string
+
+	// PubKey filters the evidences of the account, nil means all accounts
+	PubKey []byte
+
+	// Begin and End filter the block time in unix seconds, 0 means unlimited
+	Begin int64
+	End   int64
+
+	Offset int
+	Limit  int
+}
+
+func (q *SearchQuery) matchTime(t int64) bool {
+	return (q.Begin == 0 || t >= q.Begin) && (q.End == 0 || t <= q.End)
+}
+
+// SearchEvidence returns a page of the matched evidences from the newer to the older
+// and the total number of the matched evidences
+func (c *Core) SearchEvidence(q *SearchQuery) ([]*EvidenceInfo, int, error) {
+	if c.lightNode {
+		return nil, 0, ErrLightNode
+	}
+
+	tokens := utils.QueryTokens(q.Keywords)
+	if len(tokens) == 0 {
+		return nil, 0, fmt.Errorf("no searchable keywords")
+	}
+
+	// the unstored evidences are newer than the stored ones
+	var matched []string
+	found := make(map[string]bool)
+	for _, e := range c.queryCache.searchEvidence(tokens) {
+		if q.PubKey != nil && !bytes.Equal(e.PubKey, q.PubKey) {
+			continue
+		}
+		if !q.matchTime(e.Time) {
+			continue
+		}
+		hexHash := utils.ToHex(e.Hash)
+		found[hexHash] = true
+		matched = append(matched, hexHash)
+	}
+
+	refs, err := db.SearchDescription(tokens)
+	if err != nil {
+		return nil, 0, err
+	}
+	blockTime := make(map[uint64]int64)
+	for _, ref := range refs {
+		if q.PubKey != nil && !bytes.Equal(ref.PubKey, q.PubKey) {
+			continue
+		}
+
+		t, ok := blockTime[ref.Height]
+		if !ok {
+			header, _, err := db.GetHeaderViaHeight(ref.Height)
+			if err != nil {
+				return nil, 0, err
+			}
+			t = header.Time
+			blockTime[ref.Height] = t
+		}
+		if !q.matchTime(t) {
+			continue
+		}
+
+		hexHash := utils.ToHex(ref.Hash)
+		if !found[hexHash] {
+			found[hexHash] = true
+			matched = append(matched, hexHash)
+		}
+	}
+
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	total := len(matched)
+	if q.Offset >= total {
+		return nil, total, nil
+	}
+	end := q.Offset + q.Limit
+	if end > total {
+		end = total
+	}
+	return c.queryCache.getEvidence(matched[q.Offset:end]), total, nil
+}
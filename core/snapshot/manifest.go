@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// ManifestSuffix is appended to the snapshot path as the manifest path
+const ManifestSuffix = ".manifest"
+
+// Manifest describes the snapshot data file, it's signed by the keys that the operators trust
+type Manifest struct {
+	Version    uint8           `json:"version"`
+	Genesis    string          `json:"genesis"`   // hex hash of the genesis block
+	NodeType   params.NodeType `json:"node_type"` // the light node database has no evidences
+	Height     uint64          `json:"height"`
+	Hash       string          `json:"hash"` // hex hash of the block at the height
+	Entries    uint64          `json:"entries"`
+	Digest     string          `json:"digest"` // hex sha256 of the data file
+	Time       int64           `json:"time"`
+	Signatures []*Signature    `json:"signatures"`
+}
+
+// Signature is the signature of the manifest content
+type Signature struct {
+	Signer string `json:"signer"` // account id
+	Sig    string `json:"signature"`
+}
+
+// LoadManifest reads the manifest from the path
+func LoadManifest(path string) (*Manifest, error) {
+	if err := utils.AccessCheck(path); err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Manifest{}
+	if err := json.Unmarshal(content, result); err != nil {
+		return nil, fmt.Errorf("invalid manifest:%v", err)
+	}
+	if result.Version != version {
+		return nil, fmt.Errorf("unsupported snapshot version %d", result.Version)
+	}
+	if result.NodeType != params.FullNode && result.NodeType != params.LightNode {
+		return nil, fmt.Errorf("invalid snapshot node type %d", result.NodeType)
+	}
+	return result, nil
+}
+
+// Save writes the manifest to the path
+func (m *Manifest) Save(path string) error {
+	content, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// Sign adds the signature of the key, the old signature of the same key is replaced
+func (m *Manifest) Sign(privKey *btcec.PrivateKey) error {
+	sig, err := privKey.Sign(m.getSignContentHash())
+	if err != nil {
+		return err
+	}
+
+	signer := crypto.PrivKeyToID(privKey)
+	for _, s := range m.Signatures {
+		if s.Signer == signer {
+			s.Sig = utils.ToHex(sig.Serialize())
+			return nil
+		}
+	}
+	m.Signatures = append(m.Signatures, &Signature{
+		Signer: signer,
+		Sig:    utils.ToHex(sig.Serialize()),
+	})
+	return nil
+}
+
+// VerifySignatures checks that at least min trusted keys have signed the manifest
+func (m *Manifest) VerifySignatures(trusted []string, min int) error {
+	if min <= 0 {
+		return fmt.Errorf("invalid minimum signatures %d", min)
+	}
+
+	trustedSet := make(map[string]bool)
+	for _, id := range trusted {
+		trustedSet[id] = true
+	}
+
+	hash := m.getSignContentHash()
+	signed := make(map[string]bool)
+	for _, s := range m.Signatures {
+		if !trustedSet[s.Signer] || signed[s.Signer] {
+			continue
+		}
+
+		pubKey := crypto.IDToPubKey(s.Signer)
+		if pubKey == nil {
+			return fmt.Errorf("invalid signer %s", s.Signer)
+		}
+		sigB, err := utils.FromHex(s.Sig)
+		if err != nil {
+			return fmt.Errorf("invalid signature of %s:%v", s.Signer, err)
+		}
+		sig, err := btcec.ParseSignature(sigB, btcec.S256())
+		if err != nil {
+			return fmt.Errorf("invalid signature of %s:%v", s.Signer, err)
+		}
+		if !sig.Verify(hash, pubKey) {
+			return fmt.Errorf("signature of %s verify failed", s.Signer)
+		}
+		signed[s.Signer] = true
+	}
+
+	if len(signed) < min {
+		return fmt.Errorf("only %d trusted signatures, require %d", len(signed), min)
+	}
+	return nil
+}
+
+func (m *Manifest) getSignContentHash() []byte {
+	content := new(bytes.Buffer)
+	binary.Write(content, binary.BigEndian, m.Version)
+	binary.Write(content, binary.BigEndian, []byte(m.Genesis))
+	binary.Write(content, binary.BigEndian, m.NodeType)
+	binary.Write(content, binary.BigEndian, m.Height)
+	binary.Write(content, binary.BigEndian, []byte(m.Hash))
+	binary.Write(content, binary.BigEndian, m.Entries)
+	binary.Write(content, binary.BigEndian, []byte(m.Digest))
+	binary.Write(content, binary.BigEndian, m.Time)
+	return utils.Hash(content.Bytes())
+}
@@ -0,0 +1,230 @@
+// Package snapshot exports the blocks and the indexes of the database up to a height into a file,
+// a node can import the file signed by the trusted keys to bootstrap fast
+// and then sync the blocks after the height from the network.
+//
+// The data file starts with the magic and the version, followed by the entries:
+//
+//	| key length (2 bytes) | key | value length (4 bytes) | value |
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const version = 1
+
+var (
+	magic  = []byte("996SNAP")
+	logger = utils.NewLogger("snapshot")
+)
+
+// ImportConfig is the config to import a snapshot
+type ImportConfig struct {
+	TrustedKeys   []string // account ids
+	MinSignatures int
+	Chain         *blockchain.Config
+}
+
+// Export writes the database of the node type up to the height into the path and the unsigned manifest
+// into the path with ManifestSuffix, the database should be initialized
+func Export(path string, height uint64, nodeType params.NodeType) (*Manifest, error) {
+	if nodeType != params.FullNode && nodeType != params.LightNode {
+		return nil, fmt.Errorf("invalid node type %d", nodeType)
+	}
+
+	genesisHash, err := db.GetHash(1)
+	if err != nil {
+		return nil, fmt.Errorf("get genesis failed:%v", err)
+	}
+	if height == 0 {
+		if height, err = db.GetLatestHeight(); err != nil {
+			return nil, err
+		}
+	}
+	hash, err := db.GetHash(height)
+	if err != nil {
+		return nil, fmt.Errorf("get block of height %d failed:%v", height, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, digest))
+	w.Write(magic)
+	w.WriteByte(version)
+
+	var entries uint64
+	write := func(key, value []byte) error {
+		binary.Write(w, binary.BigEndian, uint16(len(key)))
+		w.Write(key)
+		binary.Write(w, binary.BigEndian, uint32(len(value)))
+		if _, err := w.Write(value); err != nil {
+			return err
+		}
+		entries++
+		return nil
+	}
+	if err := db.ExportEntries(height, write); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version:  version,
+		Genesis:  utils.ToHex(genesisHash),
+		NodeType: nodeType,
+		Height:   height,
+		Hash:     utils.ToHex(hash),
+		Entries:  entries,
+		Digest:   utils.ToHex(digest.Sum(nil)),
+		Time:     time.Now().Unix(),
+	}
+	return manifest, manifest.Save(path + ManifestSuffix)
+}
+
+// Import verifies the snapshot in the path with its manifest and writes it into the empty database,
+// the imported blocks are verified against the header chain before the database is usable
+func Import(path string, conf *ImportConfig) error {
+	manifest, err := LoadManifest(path + ManifestSuffix)
+	if err != nil {
+		return err
+	}
+	if err := manifest.VerifySignatures(conf.TrustedKeys, conf.MinSignatures); err != nil {
+		return err
+	}
+
+	genesis, err := blockchain.DecodeGenesis(conf.Chain.Genesis)
+	if err != nil {
+		return fmt.Errorf("invalid genesis:%v", err)
+	}
+	if manifest.Genesis != utils.ToHex(genesis.GetSerializedHash()) {
+		return fmt.Errorf("snapshot genesis %s mismatch the configured genesis", manifest.Genesis)
+	}
+
+	// the light node database has no evidences, it can't be imported into a full node, and vice versa
+	nodeType := params.FullNode
+	if conf.Chain.LightNode {
+		nodeType = params.LightNode
+	}
+	if manifest.NodeType != nodeType {
+		return fmt.Errorf("snapshot of node type %d mismatch the node type %d", manifest.NodeType, nodeType)
+	}
+
+	if err := manifest.CheckDigest(path); err != nil {
+		return err
+	}
+
+	logger.Info("importing snapshot of height %d with %d entries\n", manifest.Height, manifest.Entries)
+	if err := importEntries(path, manifest.Entries); err != nil {
+		return err
+	}
+
+	// the full node verifies the evidences and the evidence roots of the blocks as well as the headers
+	tipCheck := func(cb *cp.Block, height uint64) error {
+		if height == manifest.Height && utils.ToHex(cb.GetSerializedHash()) != manifest.Hash {
+			return fmt.Errorf("block of height %d mismatch the manifest", height)
+		}
+		return nil
+	}
+	if err := blockchain.VerifyStoredChain(conf.Chain, tipCheck); err != nil {
+		return err
+	}
+	if latestHeight, _ := db.GetLatestHeight(); latestHeight != manifest.Height {
+		return fmt.Errorf("imported height %d mismatch the manifest height %d", latestHeight, manifest.Height)
+	}
+
+	if err := db.FinishImport(); err != nil {
+		return err
+	}
+	logger.Info("import snapshot of height %d successfully\n", manifest.Height)
+	return nil
+}
+
+// CheckDigest checks the data file in the path against the manifest digest
+func (m *Manifest) CheckDigest(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return err
+	}
+	if utils.ToHex(digest.Sum(nil)) != m.Digest {
+		return fmt.Errorf("snapshot digest mismatch the manifest")
+	}
+	return nil
+}
+
+func importEntries(path string, expectEntries uint64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("invalid snapshot:%v", err)
+	}
+	if !bytes.Equal(header[:len(magic)], magic) || header[len(magic)] != version {
+		return fmt.Errorf("invalid snapshot header")
+	}
+
+	var entries uint64
+	next := func() ([]byte, []byte, error) {
+		var keyLen uint16
+		if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+			return nil, nil, err
+		}
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot entry:%v", err)
+		}
+
+		var valueLen uint32
+		if err := binary.Read(r, binary.BigEndian, &valueLen); err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot entry:%v", err)
+		}
+		value := make([]byte, valueLen)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot entry:%v", err)
+		}
+
+		entries++
+		if entries%1000000 == 0 {
+			logger.Info("imported %d/%d entries\n", entries, expectEntries)
+		}
+		return key, value, nil
+	}
+	if err := db.ImportEntries(next); err != nil {
+		return err
+	}
+
+	if entries != expectEntries {
+		return fmt.Errorf("imported %d entries mismatch the manifest entries %d", entries, expectEntries)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package snapshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/core/blockchain/testutil"
+	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/db"
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+func TestSnapshot(t *testing.T) {
+	conf := &blockchain.Config{
+		BlockTargetLimit:    params.DevnetTargetLimit,
+		EvidenceTargetLimit: params.DevnetTargetLimit,
+		BlockInterval:       params.DevnetBlockInterval,
+		Genesis:             blockchain.DevnetGenesis(),
+	}
+
+	// export a devnet chain of 4 blocks at height 3
+	cleanup := testutil.SetupDB(t)
+	src := blockchain.NewChain()
+	if err := src.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+	blocks := testutil.MineBlocks(t, src, blockchain.TargetToDiff, 3)
+	if err := src.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetHash(4); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.TempDir() + "/snapshot_test_tmp"
+	defer os.Remove(path)
+	defer os.Remove(path + ManifestSuffix)
+	os.Remove(path)
+	manifest, err := Export(path, 3, params.FullNode)
+	cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("manifest height", 3, manifest.Height); err != nil {
+		t.Fatal(err)
+	}
+
+	// sign with two keys
+	keyA, _ := btcec.NewPrivateKey(btcec.S256())
+	keyB, _ := btcec.NewPrivateKey(btcec.S256())
+	keyC, _ := btcec.NewPrivateKey(btcec.S256())
+	manifest.Sign(keyA)
+	manifest.Sign(keyB)
+	manifest.Sign(keyA)
+	if err := utils.TCheckInt("signatures", 2, len(manifest.Signatures)); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Save(path + ManifestSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	importConf := &ImportConfig{
+		TrustedKeys:   []string{crypto.PrivKeyToID(keyA), crypto.PrivKeyToID(keyC)},
+		MinSignatures: 2,
+		Chain:         conf,
+	}
+	cleanup = testutil.SetupDB(t)
+	defer cleanup()
+	if err := Import(path, importConf); err == nil {
+		t.Fatal("expect not enough trusted signatures")
+	}
+
+	// tamper the data file
+	data, _ := ioutil.ReadFile(path)
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1]++
+	ioutil.WriteFile(path, tampered, 0644)
+	importConf.TrustedKeys = append(importConf.TrustedKeys, crypto.PrivKeyToID(keyB))
+	if err := Import(path, importConf); err == nil {
+		t.Fatal("expect digest mismatch")
+	}
+
+	ioutil.WriteFile(path, data, 0644)
+
+	// the snapshot of a full node can't be imported into a light node
+	lightConf := *conf
+	lightConf.LightNode = true
+	importConf.Chain = &lightConf
+	if err := Import(path, importConf); err == nil {
+		t.Fatal("expect node type mismatch")
+	}
+
+	importConf.Chain = conf
+	if err := Import(path, importConf); err != nil {
+		t.Fatal(err)
+	}
+	if db.IsImporting() {
+		t.Fatal("expect import finished")
+	}
+	height, _ := db.GetLatestHeight()
+	if err := utils.TCheckUint64("imported height", 3, height); err != nil {
+		t.Fatal(err)
+	}
+	cb, _, err := db.GetBlockViaHeight(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cb.GetSerializedHash(), blocks[1].GetSerializedHash()) {
+		t.Fatal("imported block mismatch")
+	}
+
+	c := blockchain.NewChain()
+	if err := c.Init(conf); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,244 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// the backup contains a header, the entries written by the engine and the checksum of all the content before it:
+//
+//	| magic | version (1 byte) | engine length (1 byte) | engine |
+//	| schema version (8 bytes) | height (8 bytes) | hash length (1 byte) | hash | time (8 bytes) |
+//	| entries in the engine format |
+//	| sha256 checksum (32 bytes) |
+const backupVersion = 1
+
+var backupMagic = []byte("996BKUP")
+
+// BackupHeader records the database captured by the backup
+type BackupHeader struct {
+	Engine string
+	Schema uint64
+	Height uint64
+	Hash   []byte
+	Time   int64
+}
+
+func (h *BackupHeader) marshal() []byte {
+	buf := bytes.NewBuffer(append([]byte{}, backupMagic...))
+	buf.WriteByte(backupVersion)
+	buf.WriteByte(byte(len(h.Engine)))
+	buf.WriteString(h.Engine)
+	binary.Write(buf, binary.BigEndian, h.Schema)
+	binary.Write(buf, binary.BigEndian, h.Height)
+	buf.WriteByte(byte(len(h.Hash)))
+	buf.Write(h.Hash)
+	binary.Write(buf, binary.BigEndian, h.Time)
+	return buf.Bytes()
+}
+
+func readBackupHeader(r io.Reader) (*BackupHeader, error) {
+	head := make([]byte, len(backupMagic)+2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	if !bytes.Equal(head[:len(backupMagic)], backupMagic) {
+		return nil, fmt.Errorf("not a backup file")
+	}
+	if v := head[len(backupMagic)]; v != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", v)
+	}
+
+	result := &BackupHeader{}
+	engine := make([]byte, head[len(backupMagic)+1])
+	if _, err := io.ReadFull(r, engine); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	result.Engine = string(engine)
+
+	if err := binary.Read(r, binary.BigEndian, &result.Schema); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &result.Height); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	hashLen := make([]byte, 1)
+	if _, err := io.ReadFull(r, hashLen); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	result.Hash = make([]byte, hashLen[0])
+	if _, err := io.ReadFull(r, result.Hash); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &result.Time); err != nil {
+		return nil, fmt.Errorf("read backup header failed:%v", err)
+	}
+	return result, nil
+}
+
+// CheckBackup reads the backup to the end and verifies its checksum
+func CheckBackup(r io.Reader) (*BackupHeader, error) {
+	tr := newTrailerReader(r, sha256.Size)
+	checksum := sha256.New()
+	tee := io.TeeReader(tr, checksum)
+
+	header, err := readBackupHeader(tee)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(checksum.Sum(nil), tr.trailer()) {
+		return nil, fmt.Errorf("backup checksum mismatch")
+	}
+	return header, nil
+}
+
+// Backup writes a consistent copy of the database into w while the node keeps running,
+// the latest block in the copy is recorded in the header
+func (s *store) Backup(w io.Writer) (*BackupHeader, error) {
+	checksum := sha256.New()
+	mw := io.MultiWriter(w, checksum)
+	header := &BackupHeader{
+		Engine: s.name,
+		Time:   time.Now().Unix(),
+	}
+
+	// called in the transaction of the copy
+	headerFn := func(tx txn) error {
+		value, err := tx.Get(mLatestHeight)
+		if err == ErrNotFound {
+			return fmt.Errorf("the database has no block")
+		}
+		if err != nil {
+			return err
+		}
+		header.Height = byteh(value)
+
+		if header.Hash, err = tx.Get(getHashKey(header.Height)); err != nil {
+			return err
+		}
+		if value, err = tx.Get(mSchemaVersion); err != nil {
+			return err
+		}
+		header.Schema = byteh(value)
+
+		_, err = mw.Write(header.marshal())
+		return err
+	}
+
+	if err := s.engine.Backup(mw, headerFn); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(checksum.Sum(nil)); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// Restore writes the backup into the empty database, the database is marked importing
+// until the checksum and the latest block recorded in the header are verified
+func (s *store) Restore(r io.Reader) (*BackupHeader, error) {
+	if s.HasGenesis() || s.IsImporting() {
+		return nil, fmt.Errorf("the database is not empty")
+	}
+
+	tr := newTrailerReader(r, sha256.Size)
+	checksum := sha256.New()
+	tee := io.TeeReader(tr, checksum)
+
+	header, err := readBackupHeader(tee)
+	if err != nil {
+		return nil, err
+	}
+	if header.Engine != s.name {
+		return nil, fmt.Errorf("the backup is created by engine %s, but the database uses %s",
+			header.Engine, s.name)
+	}
+	if header.Schema > currentSchemaVersion() {
+		return nil, ErrUnknownSchema{header.Schema, currentSchemaVersion()}
+	}
+
+	wf := func(tx txn) error {
+		return tx.Set(mImporting, placeHolder)
+	}
+	if err := s.update(wf); err != nil {
+		return nil, err
+	}
+
+	if err := s.engine.Load(tee); err != nil {
+		return nil, fmt.Errorf("load backup failed:%v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(checksum.Sum(nil), tr.trailer()) {
+		return nil, fmt.Errorf("backup checksum mismatch")
+	}
+
+	// the new database is created with the current schema version, upgrade the restored one
+	if err := s.setSchemaVersion(header.Schema); err != nil {
+		return nil, err
+	}
+	if err := s.checkSchema(); err != nil {
+		return nil, err
+	}
+
+	height, err := s.GetLatestHeight()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := s.GetHash(header.Height)
+	if err != nil || height != header.Height || !bytes.Equal(hash, header.Hash) {
+		return nil, fmt.Errorf("the restored latest block mismatch the backup header")
+	}
+
+	return header, s.FinishImport()
+}
+
+// trailerReader reads r except the last size bytes, which are kept as the trailer
+type trailerReader struct {
+	r       io.Reader
+	size    int
+	pending []byte
+	buf     []byte
+	err     error
+}
+
+func newTrailerReader(r io.Reader, size int) *trailerReader {
+	return &trailerReader{
+		r:    r,
+		size: size,
+		buf:  make([]byte, 32*1024),
+	}
+}
+
+func (t *trailerReader) Read(p []byte) (int, error) {
+	for len(t.pending) <= t.size && t.err == nil {
+		n, err := t.r.Read(t.buf)
+		t.pending = append(t.pending, t.buf[:n]...)
+		t.err = err
+	}
+
+	available := len(t.pending) - t.size
+	if available <= 0 {
+		return 0, t.err
+	}
+	n := copy(p, t.pending[:available])
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// trailer returns the kept bytes after r is read to the end
+func (t *trailerReader) trailer() []byte {
+	if len(t.pending) != t.size {
+		return nil
+	}
+	return t.pending
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func testBackup(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	insertTestData(t)
+
+	buf := &bytes.Buffer{}
+	header, err := Backup(buf)
+	cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("backup height", tv.fourthHeight, header.Height); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("backup hash", tv.fourthBlock.GetSerializedHash(), header.Hash); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	checked, err := CheckBackup(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckString("checked engine", tv.engine, checked.Engine); err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)/2]++
+	if _, err := CheckBackup(bytes.NewReader(tampered)); err == nil {
+		t.Fatal("expect checksum mismatch")
+	}
+
+	// the truncated backup leaves the database importing
+	setup()
+	if _, err := Restore(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Fatal("expect restoring the truncated backup failed")
+	}
+	if !IsImporting() {
+		t.Fatal("expect the failed restore importing")
+	}
+	cleanup()
+
+	setup()
+	defer cleanup()
+	restored, err := Restore(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("restored height", tv.fourthHeight, restored.Height); err != nil {
+		t.Fatal(err)
+	}
+	if IsImporting() {
+		t.Fatal("expect restore finished")
+	}
+
+	height, err := GetLatestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("latest height", tv.fourthHeight, height); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := GetEvidenceViaHash(tv.evidenceC.Hash); err != nil {
+		t.Fatal(err)
+	}
+	score, _ := GetScoreViaKey(tv.secondBlock.Miner)
+	if err := utils.TCheckUint64("miner score", tv.secondBlockMinerExpectScore, score); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(bytes.NewReader(data)); err == nil {
+		t.Fatal("expect restoring into the not empty database failed")
+	}
+}
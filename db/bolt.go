@@ -0,0 +1,160 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/996BC/996.Blockchain/utils"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltFile = "996.bolt"
+
+var boltBucket = []byte("996")
+
+// boltEngine stores all keys in a bucket of a single file
+type boltEngine struct {
+	*bolt.DB
+}
+
+func (b *boltEngine) Open(path string) error {
+	var dbpath string
+	var err error
+
+	if dbpath, err = filepath.Abs(path); err != nil {
+		return err
+	}
+
+	if err = utils.AccessCheck(dbpath); err != nil {
+		return err
+	}
+
+	// don't wait forever if the file is locked by another instance
+	b.DB, err = bolt.Open(filepath.Join(dbpath, boltFile), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+}
+
+func (b *boltEngine) View(fn func(tx txn) error) error {
+	return b.DB.View(func(tx *bolt.Tx) error {
+		return fn(&boltTxn{tx.Bucket(boltBucket)})
+	})
+}
+
+func (b *boltEngine) Update(fn func(tx txn) error) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTxn{tx.Bucket(boltBucket)})
+	})
+}
+
+// GC does nothing, bolt reuses the freed pages
+func (b *boltEngine) GC() {}
+
+// Backup writes the consistent copy of the database file
+func (b *boltEngine) Backup(w io.Writer, fn func(tx txn) error) error {
+	return b.DB.View(func(tx *bolt.Tx) error {
+		if err := fn(&boltTxn{tx.Bucket(boltBucket)}); err != nil {
+			return err
+		}
+
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+// Load saves the copied file beside the database and copies its bucket
+func (b *boltEngine) Load(r io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(b.Path()), boltFile+".restore")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	backup, err := bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+
+	return backup.View(func(backupTx *bolt.Tx) error {
+		bucket := backupTx.Bucket(boltBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", boltBucket)
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; {
+			wf := func(tx txn) error {
+				for i := 0; k != nil && i < writeBatchSize; i++ {
+					if err := tx.Set(k, v); err != nil {
+						return err
+					}
+					k, v = c.Next()
+				}
+				return nil
+			}
+			if err := b.Update(wf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type boltTxn struct {
+	bucket *bolt.Bucket
+}
+
+func (t *boltTxn) Get(key []byte) ([]byte, error) {
+	value := t.bucket.Get(key)
+	if value == nil {
+		return nil, ErrNotFound
+	}
+
+	// the value is only valid in the transaction
+	return append([]byte{}, value...), nil
+}
+
+func (t *boltTxn) Set(key []byte, value []byte) error {
+	// bolt requires the key and value valid until the transaction finished
+	return t.bucket.Put(append([]byte{}, key...), append([]byte{}, value...))
+}
+
+func (t *boltTxn) Delete(key []byte) error {
+	return t.bucket.Delete(key)
+}
+
+func (t *boltTxn) Iterate(prefix []byte, start []byte, fn func(key []byte, value []byte) error) error {
+	if start == nil {
+		start = prefix
+	}
+
+	c := t.bucket.Cursor()
+	for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		err := fn(append([]byte{}, k...), append([]byte{}, v...))
+		if err == errStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
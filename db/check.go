@@ -0,0 +1,383 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/serialize/storage"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// pubKeyLength is the length of the compressed public key beginning the account keys
+const pubKeyLength = 33
+
+var knownMetaKeys = [][]byte{
+	mLatestHeight,
+	mGenesis,
+	mReindexing,
+	mImporting,
+	mSchemaVersion,
+	mMigration,
+}
+
+// Inconsistency is a broken entry found by CheckConsistency
+type Inconsistency struct {
+	Key    []byte
+	Reason string
+
+	// the indexes, the scores, the latest height and the entries not on the chain
+	// are repairable, the missing or broken block data are not
+	repairable bool
+	value      []byte // the repaired value, nil means removing the key
+}
+
+func (i *Inconsistency) Repairable() bool {
+	return i.repairable
+}
+
+func (i *Inconsistency) String() string {
+	return fmt.Sprintf("%s: %s", describeKey(i.Key), i.Reason)
+}
+
+// checkedHeader is the part of the header needed by the check
+type checkedHeader struct {
+	miner     []byte
+	time      int64
+	emptyEvds bool
+}
+
+// consistencyChecker collects the entries of the keyspace and cross-checks them
+type consistencyChecker struct {
+	hashes    map[uint64][]byte         // height -> block hash
+	headers   map[string]*checkedHeader // header key -> header
+	blocks    map[string][][]byte       // block key -> evidence hashes
+	evidences map[string]*cp.Evidence   // evidence key -> evidence
+	indexes   map[string][]byte         // the stored indexes and scores
+	broken    map[string]bool           // the unreadable block data keys
+	latest    []byte
+
+	result []*Inconsistency
+}
+
+func newConsistencyChecker() *consistencyChecker {
+	return &consistencyChecker{
+		hashes:    make(map[uint64][]byte),
+		headers:   make(map[string]*checkedHeader),
+		blocks:    make(map[string][][]byte),
+		evidences: make(map[string]*cp.Evidence),
+		indexes:   make(map[string][]byte),
+		broken:    make(map[string]bool),
+	}
+}
+
+// CheckConsistency scans the keyspace and cross-checks the blocks, the indexes, the scores
+// and the latest height; the repairable inconsistencies are fixed if repair is true
+func (s *store) CheckConsistency(repair bool) ([]*Inconsistency, error) {
+	if s.IsReindexing() || s.IsImporting() {
+		return nil, fmt.Errorf("the database is reindexing or importing")
+	}
+
+	c := newConsistencyChecker()
+	rf := func(tx txn) error {
+		return tx.Iterate(nil, nil, func(key []byte, value []byte) error {
+			c.collect(key, value)
+			return nil
+		})
+	}
+	if err := s.view(rf); err != nil {
+		return nil, err
+	}
+	c.check()
+
+	if repair {
+		if err := s.repair(c.result); err != nil {
+			return c.result, err
+		}
+	}
+	return c.result, nil
+}
+
+func (s *store) repair(result []*Inconsistency) error {
+	var fixes []*Inconsistency
+	for _, i := range result {
+		if i.repairable {
+			fixes = append(fixes, i)
+		}
+	}
+
+	for len(fixes) != 0 {
+		batch := fixes
+		if len(batch) > writeBatchSize {
+			batch = batch[:writeBatchSize]
+		}
+		fixes = fixes[len(batch):]
+
+		wf := func(tx txn) error {
+			for _, i := range batch {
+				var err error
+				if i.value == nil {
+					err = tx.Delete(i.Key)
+				} else {
+					err = tx.Set(i.Key, i.value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := s.update(wf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *consistencyChecker) report(key []byte, repairable bool, value []byte, format string, args ...interface{}) {
+	c.result = append(c.result, &Inconsistency{
+		Key:        key,
+		Reason:     fmt.Sprintf(format, args...),
+		repairable: repairable,
+		value:      value,
+	})
+}
+
+func (c *consistencyChecker) collect(key []byte, value []byte) {
+	switch {
+	case key[0] == headerPrefix[0] && len(key) == 1+8+len(hashSuffix) && bytes.HasSuffix(key, hashSuffix):
+		c.hashes[byteh(key[1:9])] = value
+
+	case key[0] == headerPrefix[0] && len(key) > 1+8:
+		header, err := storage.UnmarshalBlockHeader(bytes.NewReader(value))
+		if err != nil {
+			c.broken[string(key)] = true
+			c.report(key, false, nil, "unreadable header:%v", err)
+			return
+		}
+		if header.Height != byteh(key[1:9]) || !bytes.Equal(header.GetSerializedHash(), key[9:]) {
+			c.broken[string(key)] = true
+			c.report(key, false, nil, "the header mismatch its key")
+			return
+		}
+		c.headers[string(key)] = &checkedHeader{
+			miner:     header.Miner,
+			time:      header.Time,
+			emptyEvds: header.IsEmptyEvidenceRoot(),
+		}
+
+	case key[0] == blockPrefix[0] && len(key) > 1+8:
+		block, err := storage.UnmarshalBlock(bytes.NewReader(value))
+		if err != nil {
+			c.broken[string(key)] = true
+			c.report(key, false, nil, "unreadable block:%v", err)
+			return
+		}
+		c.blocks[string(key)] = block.EvdsHash
+
+	case key[0] == evidencePrefix[0] && len(key) > 1+8:
+		evd, err := storage.UnmarshalEvidence(bytes.NewReader(value))
+		if err != nil {
+			c.broken[string(key)] = true
+			c.report(key, false, nil, "unreadable evidence:%v", err)
+			return
+		}
+		if !bytes.Equal(evd.Hash, key[9:]) {
+			c.broken[string(key)] = true
+			c.report(key, false, nil, "the evidence mismatch its key")
+			return
+		}
+		c.evidences[string(key)] = evd.Evidence
+
+	case key[0] == headerHeightPrefix[0] && len(key) > 1,
+		key[0] == evidenceHeightPrefix[0] && len(key) > 1,
+		key[0] == descriptionPrefix[0] && len(key) > 1,
+		key[0] == timePrefix[0] && len(key) > 1,
+		isAccountKey(key):
+		c.indexes[string(key)] = value
+
+	case key[0] == 'm' && bytes.Equal(key, mLatestHeight):
+		c.latest = value
+
+	case key[0] == 'm' && isKnownMetaKey(key):
+		// the other meta data are checked when the database is opened
+
+	default:
+		c.report(key, false, nil, "unknown entry")
+	}
+}
+
+// check walks the chain through the block hashes and compares the entries derived from it
+// with the stored ones
+func (c *consistencyChecker) check() {
+	var maxHeight uint64
+	for height := range c.hashes {
+		if height > maxHeight {
+			maxHeight = height
+		}
+	}
+
+	expected := make(map[string][]byte)
+	onChain := make(map[string]bool)
+	scores := make(map[string]uint64)
+
+	for height := uint64(1); height <= maxHeight; height++ {
+		hash, ok := c.hashes[height]
+		if !ok {
+			c.report(getHashKey(height), false, nil, "missing block hash under the highest block %d", maxHeight)
+			continue
+		}
+
+		headerKey := getHeaderKey(height, hash)
+		onChain[string(headerKey)] = true
+		header, ok := c.headers[string(headerKey)]
+		if !ok {
+			if !c.broken[string(headerKey)] {
+				c.report(headerKey, false, nil, "missing header")
+			}
+			continue
+		}
+		expected[string(getHeaderHeightKey(hash))] = hbyte(height)
+		expected[string(getTimeKey(header.time, height))] = hash
+		scores[string(header.miner)]++
+		if header.emptyEvds {
+			continue
+		}
+
+		blockKey := getBlockKey(height, hash)
+		onChain[string(blockKey)] = true
+		evdsHash, ok := c.blocks[string(blockKey)]
+		if !ok {
+			if !c.broken[string(blockKey)] {
+				c.report(blockKey, false, nil, "missing block")
+			}
+			continue
+		}
+
+		for _, evdHash := range evdsHash {
+			evidenceKey := getEvidenceKey(height, evdHash)
+			onChain[string(evidenceKey)] = true
+			evd, ok := c.evidences[string(evidenceKey)]
+			if !ok {
+				if !c.broken[string(evidenceKey)] {
+					c.report(evidenceKey, false, nil, "missing evidence listed by the block")
+				}
+				continue
+			}
+			expected[string(getEvidenceHeightKey(evdHash))] = hbyte(height)
+			expected[string(append(getAccountEvidenceKeyPrefix(evd.PubKey), evdHash...))] = hbyte(height)
+			for _, key := range getDescriptionKeys(evd, height) {
+				expected[string(key)] = evd.PubKey
+			}
+		}
+	}
+	for miner, score := range scores {
+		expected[string(getScoreKey([]byte(miner)))] = hbyte(score)
+	}
+
+	// the block data left by the side branches or the interrupted truncation
+	orphaned := func(key string) {
+		if !onChain[key] {
+			c.report([]byte(key), true, nil, "orphaned entry not on the chain")
+		}
+	}
+	for key := range c.headers {
+		orphaned(key)
+	}
+	for key := range c.blocks {
+		orphaned(key)
+	}
+	for key := range c.evidences {
+		orphaned(key)
+	}
+
+	if c.latest == nil && maxHeight != 0 {
+		c.report(mLatestHeight, true, hbyte(maxHeight), "missing, the highest block is %d", maxHeight)
+	} else if c.latest != nil && byteh(c.latest) != maxHeight {
+		c.report(mLatestHeight, true, hbyte(maxHeight), "stored %d, the highest block is %d",
+			byteh(c.latest), maxHeight)
+	}
+
+	for key, value := range expected {
+		stored, ok := c.indexes[key]
+		if !ok {
+			c.report([]byte(key), true, value, "missing, expect %s", describeValue(value))
+		} else if !bytes.Equal(stored, value) {
+			c.report([]byte(key), true, value, "stored %s, expect %s", describeValue(stored), describeValue(value))
+		}
+	}
+	for key := range c.indexes {
+		if _, ok := expected[key]; !ok {
+			c.report([]byte(key), true, nil, "orphaned entry not derived from the chain")
+		}
+	}
+
+	sort.Slice(c.result, func(i, j int) bool {
+		return bytes.Compare(c.result[i].Key, c.result[j].Key) < 0
+	})
+}
+
+// isAccountKey returns true for the account evidence key and the score key
+func isAccountKey(key []byte) bool {
+	if len(key) <= pubKeyLength || (key[0] != 0x02 && key[0] != 0x03) {
+		return false
+	}
+	suffix := key[pubKeyLength:]
+	return bytes.Equal(suffix, scoreSuffix) ||
+		(len(suffix) > len(evidenceSuffix) && bytes.HasPrefix(suffix, evidenceSuffix))
+}
+
+func isKnownMetaKey(key []byte) bool {
+	for _, meta := range knownMetaKeys {
+		if bytes.Equal(key, meta) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeKey formats the key by the key layout
+func describeKey(key []byte) string {
+	switch {
+	case len(key) == 0:
+		return ""
+	case key[0] == headerPrefix[0] && len(key) == 1+8+len(hashSuffix) && bytes.HasSuffix(key, hashSuffix):
+		return fmt.Sprintf("hash of height %d", byteh(key[1:9]))
+	case key[0] == headerPrefix[0] && len(key) > 1+8:
+		return fmt.Sprintf("header %d %X", byteh(key[1:9]), key[9:])
+	case key[0] == blockPrefix[0] && len(key) > 1+8:
+		return fmt.Sprintf("block %d %X", byteh(key[1:9]), key[9:])
+	case key[0] == evidencePrefix[0] && len(key) > 1+8:
+		return fmt.Sprintf("evidence %d %X", byteh(key[1:9]), key[9:])
+	case key[0] == descriptionPrefix[0] && bytes.IndexByte(key, tokenEnd[0]) > 0:
+		end := bytes.IndexByte(key, tokenEnd[0])
+		ref := key[end+1:]
+		if len(ref) <= 8 {
+			return fmt.Sprintf("description index %q %X", key[1:end], ref)
+		}
+		return fmt.Sprintf("description index %q %d %X", key[1:end], byteh(ref[:8]), ref[8:])
+	case key[0] == timePrefix[0] && len(key) == 1+8+8:
+		return fmt.Sprintf("time index %s %d", utils.TimeToString(int64(byteh(key[1:9]))), byteh(key[9:]))
+	case key[0] == headerHeightPrefix[0]:
+		return fmt.Sprintf("header index %X", key[1:])
+	case key[0] == evidenceHeightPrefix[0]:
+		return fmt.Sprintf("evidence index %X", key[1:])
+	case isAccountKey(key) && bytes.Equal(key[pubKeyLength:], scoreSuffix):
+		return fmt.Sprintf("score of %X", key[:pubKeyLength])
+	case isAccountKey(key):
+		return fmt.Sprintf("account evidence %X %X", key[:pubKeyLength], key[pubKeyLength+len(evidenceSuffix):])
+	case key[0] == 'm':
+		return string(key)
+	default:
+		return fmt.Sprintf("%X", key)
+	}
+}
+
+// describeValue formats the heights and scores as numbers, the public keys in hex
+func describeValue(value []byte) string {
+	if len(value) == 8 {
+		return fmt.Sprintf("%d", byteh(value))
+	}
+	return fmt.Sprintf("%X", value)
+}
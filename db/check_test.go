@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func testCheckConsistency(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+	insertTestData(t)
+
+	result, err := CheckConsistency(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("inconsistencies of the healthy database", 0, len(result)); err != nil {
+		t.Fatal(err)
+	}
+
+	// break the derived entries
+	e := instance.(*store).engine
+	evdCAccountKey := append(getAccountEvidenceKeyPrefix(tv.evidenceC.PubKey), tv.evidenceC.Hash...)
+	err = e.Update(func(tx txn) error {
+		if err := tx.Set(getScoreKey(tv.secondBlock.Miner), hbyte(5)); err != nil {
+			return err
+		}
+		if err := tx.Delete(getEvidenceHeightKey(tv.evidenceB.Hash)); err != nil {
+			return err
+		}
+		if err := tx.Set(getHeaderHeightKey(make([]byte, 32)), hbyte(2)); err != nil {
+			return err
+		}
+		if err := tx.Delete(evdCAccountKey); err != nil {
+			return err
+		}
+		wrongOwnerKey := append(getAccountEvidenceKeyPrefix(tv.evidenceB.PubKey), tv.evidenceC.Hash...)
+		if err := tx.Set(wrongOwnerKey, hbyte(tv.fourthHeight)); err != nil {
+			return err
+		}
+		return tx.Set(mLatestHeight, hbyte(tv.thirdHeight))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err = CheckConsistency(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("inconsistencies", 6, len(result)); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range result {
+		if !i.Repairable() {
+			t.Fatalf("expect %v repairable", i)
+		}
+	}
+
+	if result, err = CheckConsistency(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("inconsistencies after repaired", 0, len(result)); err != nil {
+		t.Fatal(err)
+	}
+	score, _ := GetScoreViaKey(tv.secondBlock.Miner)
+	if err := utils.TCheckUint64("repaired score", tv.secondBlockMinerExpectScore, score); err != nil {
+		t.Fatal(err)
+	}
+	if _, height, err := GetEvidenceViaHash(tv.evidenceB.Hash); err != nil || height != tv.evidenceBHeight {
+		t.Fatalf("expect the evidence index repaired, %v", err)
+	}
+
+	// the missing block data is not repairable
+	err = e.Update(func(tx txn) error {
+		return tx.Delete(getEvidenceKey(tv.evidenceBHeight, tv.evidenceB.Hash))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err = CheckConsistency(true); err != nil {
+		t.Fatal(err)
+	}
+	var unrepairable int
+	for _, i := range result {
+		if !i.Repairable() {
+			unrepairable++
+		}
+	}
+	if err := utils.TCheckInt("unrepairable inconsistencies", 1, unrepairable); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"testing"
+)
+
+// testEngines are the engines which must pass the conformance tests,
+// the data of the not persistent engine is lost after closed
+var testEngines = []struct {
+	name       string
+	persistent bool
+}{
+	{BadgerEngine, true},
+	{BoltEngine, true},
+	{MemoryEngine, false},
+}
+
+var conformanceCases = []struct {
+	name       string
+	test       func(t *testing.T)
+	persistent bool // the test reopens the database
+}{
+	{"Genesis", testGenesis, false},
+	{"GetHash", testGetHash, false},
+	{"GetHeaderViaHeight", testGetHeaderViaHeight, false},
+	{"GetHeaderViaHash", testGetHeaderViaHash, false},
+	{"GetBlockViaHeight", testGetBlockViaHeight, false},
+	{"GetBlockViaHash", testGetBlockViaHash, false},
+	{"GetEvidenceViaHash", testGetEvidenceViaHash, false},
+	{"GetEvidenceViaKey", testGetEvidenceViaKey, false},
+	{"HasEvidence", testHasEvidence, false},
+	{"GetScoreViaKey", testGetScoreViaKey, false},
+	{"GetLatestHeight", testGetLatestHeight, false},
+	{"GetLatestHeader", testGetLatestHeader, false},
+	{"Reindex", testReindex, false},
+	{"Truncate", testTruncate, false},
+	{"ExportEntries", testExportEntries, false},
+	{"Transaction", testTransaction, false},
+	{"Iterate", testIterate, false},
+	{"Backup", testBackup, false},
+	{"CheckConsistency", testCheckConsistency, false},
+	{"SearchDescription", testSearchDescription, false},
+	{"TimeIndex", testTimeIndex, false},
+	{"SchemaVersion", testSchemaVersion, true},
+	{"LegacyMigration", testLegacyMigration, true},
+	{"MigrationResume", testMigrationResume, true},
+}
+
+// TestConformance runs the db tests with every engine
+func TestConformance(t *testing.T) {
+	tv := dbTestVar
+	defer func(engine string) { tv.engine = engine }(tv.engine)
+
+	for _, engine := range testEngines {
+		t.Run(engine.name, func(t *testing.T) {
+			tv.engine = engine.name
+			for _, c := range conformanceCases {
+				if c.persistent && !engine.persistent {
+					continue
+				}
+				t.Run(c.name, c.test)
+			}
+		})
+	}
+}
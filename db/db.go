@@ -1,6 +1,9 @@
 package db
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/996BC/996.Blockchain/serialize/cp"
 	"github.com/996BC/996.Blockchain/utils"
 )
@@ -21,6 +24,21 @@ type db interface {
 	GetScoreViaKey(pubKey []byte) (uint64, error)
 	GetLatestHeight() (uint64, error)
 	GetLatestHeader() (*cp.BlockHeader, uint64, []byte, error)
+	DropIndexes() error
+	PutIndexes(block *cp.Block, height uint64) error
+	FinishReindex() error
+	IsReindexing() bool
+	Truncate(height uint64) error
+	ExportEntries(height uint64, fn func(key, value []byte) error) error
+	ImportEntries(next func() (key, value []byte, err error)) error
+	FinishImport() error
+	IsImporting() bool
+	Backup(w io.Writer) (*BackupHeader, error)
+	Restore(r io.Reader) (*BackupHeader, error)
+	CheckConsistency(repair bool) ([]*Inconsistency, error)
+	SearchDescription(tokens []string) ([]*EvidenceRef, error)
+	GetHeightViaTime(t int64) (uint64, error)
+	GetEvidenceViaTime(begin, end int64, offset, limit int) ([]*EvidenceRef, int, error)
 	Close()
 }
 
@@ -29,8 +47,28 @@ var (
 	instance db
 )
 
+// Init opens the database under the path with its engine, the new database uses badger
 func Init(path string) error {
-	instance = newBadger()
+	engine := detectEngine(path)
+	if len(engine) == 0 {
+		engine = BadgerEngine
+	}
+	return InitWithEngine(engine, path)
+}
+
+// InitWithEngine opens the database under the path with the engine,
+// the memory engine ignores the path
+func InitWithEngine(engine string, path string) error {
+	if existing := detectEngine(path); engine != MemoryEngine && len(existing) != 0 && existing != engine {
+		return fmt.Errorf("the database under %s is created by engine %s", path, existing)
+	}
+
+	e, err := newEngine(engine)
+	if err != nil {
+		return err
+	}
+
+	instance = newStore(engine, e)
 	return instance.Init(path)
 }
 
@@ -90,6 +128,81 @@ func GetLatestHeader() (*cp.BlockHeader, uint64, []byte, error) {
 	return instance.GetLatestHeader()
 }
 
+// DropIndexes removes the indexes for rebuilding them
+func DropIndexes() error {
+	return instance.DropIndexes()
+}
+
+// PutIndexes rebuilds the indexes of the stored block
+func PutIndexes(block *cp.Block, height uint64) error {
+	return instance.PutIndexes(block, height)
+}
+
+// FinishReindex marks the indexes rebuilt
+func FinishReindex() error {
+	return instance.FinishReindex()
+}
+
+// IsReindexing returns true if the indexes have been dropped and not rebuilt
+func IsReindexing() bool {
+	return instance.IsReindexing()
+}
+
+// Truncate removes the blocks higher than the height
+func Truncate(height uint64) error {
+	return instance.Truncate(height)
+}
+
+// ExportEntries walks the entries of the database at the height
+func ExportEntries(height uint64, fn func(key, value []byte) error) error {
+	return instance.ExportEntries(height, fn)
+}
+
+// ImportEntries writes the exported entries into the empty database
+func ImportEntries(next func() (key, value []byte, err error)) error {
+	return instance.ImportEntries(next)
+}
+
+// FinishImport marks the imported entries complete
+func FinishImport() error {
+	return instance.FinishImport()
+}
+
+// IsImporting returns true if the import has not finished
+func IsImporting() bool {
+	return instance.IsImporting()
+}
+
+// Backup writes a consistent copy of the database into w, it's safe while the node is running
+func Backup(w io.Writer) (*BackupHeader, error) {
+	return instance.Backup(w)
+}
+
+// Restore writes the backup into the empty database
+func Restore(r io.Reader) (*BackupHeader, error) {
+	return instance.Restore(r)
+}
+
+// SearchDescription returns the stored evidences whose descriptions have all the tokens
+func SearchDescription(tokens []string) ([]*EvidenceRef, error) {
+	return instance.SearchDescription(tokens)
+}
+
+// GetHeightViaTime returns the height of the highest stored block whose time is not after t
+func GetHeightViaTime(t int64) (uint64, error) {
+	return instance.GetHeightViaTime(t)
+}
+
+// GetEvidenceViaTime returns a page of the stored evidences in the blocks whose time is in [begin, end]
+func GetEvidenceViaTime(begin, end int64, offset, limit int) ([]*EvidenceRef, int, error) {
+	return instance.GetEvidenceViaTime(begin, end, offset, limit)
+}
+
+// CheckConsistency cross-checks the stored entries and repairs the indexes if repair is true
+func CheckConsistency(repair bool) ([]*Inconsistency, error) {
+	return instance.CheckConsistency(repair)
+}
+
 func Close() {
 	if instance != nil {
 		instance.Close()
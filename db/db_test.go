@@ -3,6 +3,7 @@ package db
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -12,6 +13,7 @@ import (
 
 var dbTestVar = &struct {
 	dbPath string
+	engine string
 
 	genesis         *cp.Block
 	secondBlock     *cp.Block
@@ -32,6 +34,7 @@ var dbTestVar = &struct {
 	fourthHeight                uint64
 	secondBlockMinerExpectScore uint64
 }{
+	engine:                      BadgerEngine,
 	genesisHeight:               1,
 	secondHeight:                2,
 	thirdHeight:                 3,
@@ -70,7 +73,7 @@ func setup() {
 		logger.Fatal("create tmp directory failed:%v\n", err)
 	}
 
-	if err := Init(tv.dbPath); err != nil {
+	if err := InitWithEngine(tv.engine, tv.dbPath); err != nil {
 		logger.Fatal("initialize db failed:%v\n", err)
 	}
 }
@@ -107,7 +110,7 @@ func insertTestData(t *testing.T) {
 	}
 }
 
-func TestGenesis(t *testing.T) {
+func testGenesis(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -136,7 +139,7 @@ func TestGenesis(t *testing.T) {
 	checkBlock(t, "", tv.genesis, dbBlock)
 }
 
-func TestGetHash(t *testing.T) {
+func testGetHash(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -164,7 +167,7 @@ func TestGetHash(t *testing.T) {
 	}
 }
 
-func TestGetHeaderViaHeight(t *testing.T) {
+func testGetHeaderViaHeight(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -194,7 +197,7 @@ func TestGetHeaderViaHeight(t *testing.T) {
 	}
 }
 
-func TestGetHeaderViaHash(t *testing.T) {
+func testGetHeaderViaHash(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -224,7 +227,7 @@ func TestGetHeaderViaHash(t *testing.T) {
 	}
 }
 
-func TestGetBlockViaHeight(t *testing.T) {
+func testGetBlockViaHeight(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -254,7 +257,7 @@ func TestGetBlockViaHeight(t *testing.T) {
 	}
 }
 
-func TestGetBlockViaHash(t *testing.T) {
+func testGetBlockViaHash(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -284,7 +287,7 @@ func TestGetBlockViaHash(t *testing.T) {
 	}
 }
 
-func TestGetEvidenceViaHash(t *testing.T) {
+func testGetEvidenceViaHash(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -313,7 +316,7 @@ func TestGetEvidenceViaHash(t *testing.T) {
 	}
 }
 
-func TestGetEvidenceViaKey(t *testing.T) {
+func testGetEvidenceViaKey(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -349,7 +352,7 @@ func TestGetEvidenceViaKey(t *testing.T) {
 	}
 }
 
-func TestHasEvidence(t *testing.T) {
+func testHasEvidence(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -364,7 +367,7 @@ func TestHasEvidence(t *testing.T) {
 	}
 }
 
-func TestGetScoreViaKey(t *testing.T) {
+func testGetScoreViaKey(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -391,7 +394,7 @@ func TestGetScoreViaKey(t *testing.T) {
 	}
 }
 
-func TestGetLatestHeight(t *testing.T) {
+func testGetLatestHeight(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -420,7 +423,7 @@ func TestGetLatestHeight(t *testing.T) {
 	}
 }
 
-func TestGetLatestHeader(t *testing.T) {
+func testGetLatestHeader(t *testing.T) {
 	tv := dbTestVar
 	setup()
 	defer cleanup()
@@ -461,6 +464,184 @@ func TestGetLatestHeader(t *testing.T) {
 	}
 }
 
+func testReindex(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+	insertTestData(t)
+
+	if err := DropIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	if !IsReindexing() {
+		t.Fatal("expect reindexing")
+	}
+	if _, _, err := GetBlockViaHash(tv.secondBlock.GetSerializedHash()); err == nil {
+		t.Fatal("expect header height index dropped")
+	}
+	if HasEvidence(tv.evidenceA.Hash) {
+		t.Fatal("expect evidence height index dropped")
+	}
+	if score, _ := GetScoreViaKey(tv.secondBlock.Miner); score != 0 {
+		t.Fatal("expect score dropped")
+	}
+
+	// the blocks are still readable via height
+	blocks := []*cp.Block{tv.genesis, tv.secondBlock, tv.thirdEmptyBlock, tv.fourthBlock}
+	for i, expect := range blocks {
+		height := uint64(i) + 1
+		block, _, err := GetBlockViaHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkBlock(t, fmt.Sprintf("[%d] ", i), expect, block)
+
+		if err := PutIndexes(block, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := FinishReindex(); err != nil {
+		t.Fatal(err)
+	}
+	if IsReindexing() {
+		t.Fatal("expect reindex finished")
+	}
+
+	_, height, err := GetBlockViaHash(tv.fourthBlock.GetSerializedHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("fourth block height", tv.fourthHeight, height); err != nil {
+		t.Fatal(err)
+	}
+	_, height, err = GetEvidenceViaHash(tv.evidenceB.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("evidence B height", tv.evidenceBHeight, height); err != nil {
+		t.Fatal(err)
+	}
+	score, _ := GetScoreViaKey(tv.secondBlock.Miner)
+	if err := utils.TCheckUint64("score", tv.secondBlockMinerExpectScore, score); err != nil {
+		t.Fatal(err)
+	}
+	evdsHash, _, _ := GetEvidenceViaKey(tv.evidenceA.PubKey)
+	if err := utils.TCheckInt("account evidence number", 2, len(evdsHash)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testTruncate(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+	insertTestData(t)
+
+	if err := Truncate(0); err == nil {
+		t.Fatal("expect refusing to remove genesis")
+	}
+	if err := Truncate(tv.secondHeight); err != nil {
+		t.Fatal(err)
+	}
+
+	height, _ := GetLatestHeight()
+	if err := utils.TCheckUint64("latest height", tv.secondHeight, height); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetHash(tv.thirdHeight); err == nil {
+		t.Fatal("expect the third block removed")
+	}
+	if _, _, err := GetBlockViaHash(tv.fourthBlock.GetSerializedHash()); err == nil {
+		t.Fatal("expect the fourth block removed")
+	}
+	if HasEvidence(tv.evidenceC.Hash) {
+		t.Fatal("expect evidence C removed")
+	}
+	if !HasEvidence(tv.evidenceB.Hash) {
+		t.Fatal("expect evidence B kept")
+	}
+	score, _ := GetScoreViaKey(tv.secondBlock.Miner)
+	if err := utils.TCheckUint64("score", 1, score); err != nil {
+		t.Fatal(err)
+	}
+	evdsHash, _, _ := GetEvidenceViaKey(tv.evidenceA.PubKey)
+	if err := utils.TCheckInt("account evidence number", 1, len(evdsHash)); err != nil {
+		t.Fatal(err)
+	}
+
+	// continue to put blocks
+	if err := PutBlock(tv.thirdEmptyBlock, tv.thirdHeight); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testExportEntries(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	insertTestData(t)
+
+	var keys, values [][]byte
+	export := func(key, value []byte) error {
+		keys = append(keys, key)
+		values = append(values, value)
+		return nil
+	}
+	if err := ExportEntries(tv.fourthHeight+1, export); err == nil {
+		t.Fatal("expect exporting the unknown height failed")
+	}
+	if err := ExportEntries(tv.thirdHeight, export); err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+
+	setup()
+	defer cleanup()
+	index := 0
+	next := func() ([]byte, []byte, error) {
+		if index == len(keys) {
+			return nil, nil, io.EOF
+		}
+		index++
+		return keys[index-1], values[index-1], nil
+	}
+	if err := ImportEntries(next); err != nil {
+		t.Fatal(err)
+	}
+	if !IsImporting() {
+		t.Fatal("expect importing")
+	}
+	if err := FinishImport(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportEntries(next); err == nil {
+		t.Fatal("expect importing into the not empty database failed")
+	}
+
+	height, _ := GetLatestHeight()
+	if err := utils.TCheckUint64("latest height", tv.thirdHeight, height); err != nil {
+		t.Fatal(err)
+	}
+	block, _, err := GetBlockViaHash(tv.secondBlock.GetSerializedHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBlock(t, "second block", tv.secondBlock, block)
+	if !HasEvidence(tv.evidenceB.Hash) {
+		t.Fatal("expect evidence B imported")
+	}
+	if HasEvidence(tv.evidenceC.Hash) {
+		t.Fatal("expect evidence C not exported")
+	}
+	score, _ := GetScoreViaKey(tv.secondBlock.Miner)
+	if err := utils.TCheckUint64("score", 1, score); err != nil {
+		t.Fatal(err)
+	}
+	evdsHash, _, _ := GetEvidenceViaKey(tv.evidenceA.PubKey)
+	if err := utils.TCheckInt("account evidence number", 1, len(evdsHash)); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func checkEvidence(t *testing.T, prefix string, expect *cp.Evidence, result *cp.Evidence) {
 	expectBytes := expect.Marshal()
 	resultBytes := result.Marshal()
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// the supported storage engines
+const (
+	BadgerEngine = "badger"
+	BoltEngine   = "bolt"
+	MemoryEngine = "memory"
+)
+
+// errStopIteration stops the iteration without error
+var errStopIteration = errors.New("stop iteration")
+
+// engine is the key-value storage under the db,
+// the keys and values passed to or returned from it are never modified by both sides
+type engine interface {
+	Open(path string) error
+	Close() error
+
+	// View runs fn in a read-only transaction
+	View(fn func(tx txn) error) error
+
+	// Update runs fn in a read-write transaction, the writes are discarded if fn returns error
+	Update(fn func(tx txn) error) error
+
+	// GC reclaims the disk space, it's called periodically
+	GC()
+
+	// Backup writes the entries seen by a read-only transaction into w in the engine format,
+	// fn is called in the same transaction before the entries are written
+	Backup(w io.Writer, fn func(tx txn) error) error
+
+	// Load writes the entries written by Backup into the database
+	Load(r io.Reader) error
+}
+
+type txn interface {
+	// Get returns ErrNotFound if the key doesn't exist
+	Get(key []byte) ([]byte, error)
+	Set(key []byte, value []byte) error
+	Delete(key []byte) error
+
+	// Iterate calls fn with the keys having the prefix in increasing order, begins from the start key
+	// (nil means from the prefix); it stops without error if fn returns errStopIteration
+	Iterate(prefix []byte, start []byte, fn func(key []byte, value []byte) error) error
+}
+
+func newEngine(name string) (engine, error) {
+	switch name {
+	case BadgerEngine:
+		return &badgerEngine{}, nil
+	case BoltEngine:
+		return &boltEngine{}, nil
+	case MemoryEngine:
+		return newMemoryEngine(), nil
+	default:
+		return nil, fmt.Errorf("unknown db engine %s", name)
+	}
+}
+
+// detectEngine returns the engine of the existing database under the path, or empty if not found
+func detectEngine(path string) string {
+	if _, err := os.Stat(filepath.Join(path, boltFile)); err == nil {
+		return BoltEngine
+	}
+	if _, err := os.Stat(filepath.Join(path, badgerManifestFile)); err == nil {
+		return BadgerEngine
+	}
+	return ""
+}
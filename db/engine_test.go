@@ -0,0 +1,206 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func testTransaction(t *testing.T) {
+	setup()
+	defer cleanup()
+	e := instance.(*store).engine
+
+	key := []byte("tKey")
+	err := e.View(func(tx txn) error {
+		_, err := tx.Get(key)
+		return err
+	})
+	if err != ErrNotFound {
+		t.Fatalf("expect not found, but %v", err)
+	}
+
+	// the writes are visible in the transaction and discarded with the error
+	err = e.Update(func(tx txn) error {
+		if err := tx.Set(key, []byte("1")); err != nil {
+			return err
+		}
+		value, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := utils.TCheckBytes("written value", []byte("1"), value); err != nil {
+			return err
+		}
+		return fmt.Errorf("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("expect rollback, but %v", err)
+	}
+	err = e.View(func(tx txn) error {
+		_, err := tx.Get(key)
+		return err
+	})
+	if err != ErrNotFound {
+		t.Fatalf("expect the rollback value not found, but %v", err)
+	}
+
+	// set and delete
+	if err := e.Update(func(tx txn) error { return tx.Set(key, []byte("2")) }); err != nil {
+		t.Fatal(err)
+	}
+	err = e.View(func(tx txn) error {
+		value, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		return utils.TCheckBytes("committed value", []byte("2"), value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Update(func(tx txn) error {
+		if err := tx.Delete(key); err != nil {
+			return err
+		}
+		if _, err := tx.Get(key); err != ErrNotFound {
+			return fmt.Errorf("expect the deleted key not found in the transaction, but %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testIterate(t *testing.T) {
+	setup()
+	defer cleanup()
+	e := instance.(*store).engine
+
+	prefix := []byte("tPrefix")
+	err := e.Update(func(tx txn) error {
+		for i := 5; i > 0; i-- {
+			if err := tx.Set(append(prefix, byte(i)), []byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		// the keys around the prefix
+		if err := tx.Set([]byte("tPrefiw"), []byte{0}); err != nil {
+			return err
+		}
+		return tx.Set([]byte("tPrefiy"), []byte{0})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iterate := func(tx txn, start []byte, limit int) ([]byte, error) {
+		var result []byte
+		err := tx.Iterate(prefix, start, func(key []byte, value []byte) error {
+			if err := utils.TCheckBytes("iterated key", append(prefix, value[0]), key); err != nil {
+				return err
+			}
+			result = append(result, value[0])
+			if len(result) == limit {
+				return errStopIteration
+			}
+			return nil
+		})
+		return result, err
+	}
+
+	err = e.View(func(tx txn) error {
+		result, err := iterate(tx, nil, 0)
+		if err != nil {
+			return err
+		}
+		if err := utils.TCheckBytes("all keys", []byte{1, 2, 3, 4, 5}, result); err != nil {
+			return err
+		}
+
+		result, err = iterate(tx, append(prefix, 2), 2)
+		if err != nil {
+			return err
+		}
+		return utils.TCheckBytes("keys from start", []byte{2, 3}, result)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes are visible to the iteration in the transaction
+	err = e.Update(func(tx txn) error {
+		if err := tx.Delete(append(prefix, 3)); err != nil {
+			return err
+		}
+		if err := tx.Set(append(prefix, 6), []byte{6}); err != nil {
+			return err
+		}
+		result, err := iterate(tx, nil, 0)
+		if err != nil {
+			return err
+		}
+		return utils.TCheckBytes("written keys", []byte{1, 2, 4, 5, 6}, result)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkEngines measures the block writing and reading of each engine
+func BenchmarkEngines(b *testing.B) {
+	tv := dbTestVar
+	defer func(engine string) { tv.engine = engine }(tv.engine)
+
+	for _, engine := range testEngines {
+		tv.engine = engine.name
+
+		b.Run(engine.name+"/PutBlock", func(b *testing.B) {
+			setup()
+			defer cleanup()
+			if err := PutGenesis(tv.genesis); err != nil {
+				b.Fatal(err)
+			}
+			blocks := genBenchBlocks(b.N)
+
+			b.ResetTimer()
+			for i, cb := range blocks {
+				if err := PutBlock(cb, uint64(i)+2); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(engine.name+"/GetBlock", func(b *testing.B) {
+			setup()
+			defer cleanup()
+			if err := PutGenesis(tv.genesis); err != nil {
+				b.Fatal(err)
+			}
+			blocks := genBenchBlocks(100)
+			for i, cb := range blocks {
+				if err := PutBlock(cb, uint64(i)+2); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := GetBlockViaHeight(uint64(i%len(blocks)) + 2); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func genBenchBlocks(num int) []*cp.Block {
+	var result []*cp.Block
+	for i := 0; i < num; i++ {
+		result = append(result, cp.GenBlockFromParams(cp.NewBlockParams(false)))
+	}
+	return result
+}
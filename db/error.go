@@ -15,6 +15,31 @@ func (i ErrInvalidHeight) Error() string {
 		i.put, i.expect)
 }
 
+// ErrUnknownSchema means the database is created by a newer program
+type ErrUnknownSchema struct {
+	version uint64
+	current uint64
+}
+
+func (u ErrUnknownSchema) Error() string {
+	return fmt.Sprintf("unknown database schema version %d, the program supports version %d",
+		u.version, u.current)
+}
+
+func (u ErrUnknownSchema) Version() uint64 {
+	return u.version
+}
+
+// ErrMigration means the migration from the version failed, it resumes on the next startup
+type ErrMigration struct {
+	version uint64
+	err     error
+}
+
+func (m ErrMigration) Error() string {
+	return fmt.Sprintf("migrate schema from version %d failed:%v", m.version, m.err)
+}
+
 var ErrInternal = errors.New("internal error")
 
 var ErrNotFound = errors.New("not found")
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+)
+
+// memoryEngine keeps all keys in memory, it's used by tests and devnets,
+// the data is lost after closed
+type memoryEngine struct {
+	lock sync.RWMutex
+	data map[string][]byte
+	keys []string // sorted keys of data
+}
+
+func newMemoryEngine() *memoryEngine {
+	return &memoryEngine{
+		data: make(map[string][]byte),
+	}
+}
+
+// Open ignores the path
+func (m *memoryEngine) Open(path string) error {
+	return nil
+}
+
+func (m *memoryEngine) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.data = make(map[string][]byte)
+	m.keys = nil
+	return nil
+}
+
+func (m *memoryEngine) View(fn func(tx txn) error) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return fn(&memoryTxn{engine: m})
+}
+
+// Update runs the transactions one by one, the writes are buffered until fn returns
+func (m *memoryEngine) Update(fn func(tx txn) error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	tx := &memoryTxn{
+		engine:   m,
+		writable: true,
+		writes:   make(map[string][]byte),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for key, value := range tx.writes {
+		m.put(key, value)
+	}
+	return nil
+}
+
+func (m *memoryEngine) GC() {}
+
+// Backup writes the entries as the length prefixed key and value records,
+// the writes wait until it returns
+func (m *memoryEngine) Backup(w io.Writer, fn func(tx txn) error) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if err := fn(&memoryTxn{engine: m}); err != nil {
+		return err
+	}
+
+	for _, key := range m.keys {
+		value := m.data[key]
+		if err := binary.Write(w, binary.BigEndian, uint32(len(key))); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, key); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, uint32(len(value))); err != nil {
+			return err
+		}
+		if _, err := w.Write(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryEngine) Load(r io.Reader) error {
+	readBytes := func() ([]byte, error) {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		result := make([]byte, length)
+		if _, err := io.ReadFull(r, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	for finished := false; !finished; {
+		wf := func(tx txn) error {
+			for i := 0; i < writeBatchSize; i++ {
+				key, err := readBytes()
+				if err == io.EOF {
+					finished = true
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				value, err := readBytes()
+				if err != nil {
+					return io.ErrUnexpectedEOF
+				}
+
+				if err := tx.Set(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := m.Update(wf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put sets the key, nil value means deleting
+func (m *memoryEngine) put(key string, value []byte) {
+	_, exist := m.data[key]
+	index := sort.SearchStrings(m.keys, key)
+
+	if value == nil {
+		if exist {
+			delete(m.data, key)
+			m.keys = append(m.keys[:index], m.keys[index+1:]...)
+		}
+		return
+	}
+
+	m.data[key] = value
+	if !exist {
+		m.keys = append(m.keys, "")
+		copy(m.keys[index+1:], m.keys[index:])
+		m.keys[index] = key
+	}
+}
+
+type memoryTxn struct {
+	engine   *memoryEngine
+	writable bool
+	writes   map[string][]byte // nil value means deleted
+}
+
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	value, ok := t.writes[string(key)]
+	if !ok {
+		value, ok = t.engine.data[string(key)]
+	}
+	if !ok || value == nil {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (t *memoryTxn) Set(key []byte, value []byte) error {
+	if !t.writable {
+		return ErrInternal
+	}
+	t.writes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	if !t.writable {
+		return ErrInternal
+	}
+	t.writes[string(key)] = nil
+	return nil
+}
+
+func (t *memoryTxn) Iterate(prefix []byte, start []byte, fn func(key []byte, value []byte) error) error {
+	if start == nil {
+		start = prefix
+	}
+
+	// merge the stored keys with the written keys of the transaction
+	var keys []string
+	for i := sort.SearchStrings(t.engine.keys, string(start)); i < len(t.engine.keys); i++ {
+		if !bytes.HasPrefix([]byte(t.engine.keys[i]), prefix) {
+			break
+		}
+		if _, ok := t.writes[t.engine.keys[i]]; !ok {
+			keys = append(keys, t.engine.keys[i])
+		}
+	}
+	for key, value := range t.writes {
+		if value != nil && key >= string(start) && bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, _ := t.Get([]byte(key))
+		err := fn([]byte(key), value)
+		if err == errStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"bytes"
+
+	"github.com/996BC/996.Blockchain/serialize/storage"
+)
+
+// migrationBatchSize is the maximum keys number which a migration step should modify,
+// keep it small to avoid the engine transaction being too big
+const migrationBatchSize = 1000
+
+// migration upgrades the database from the version to version+1 in batches,
+// step handles a batch from the cursor and returns the cursor of the next batch, nil means finished;
+// the progress is committed with each batch so that an interrupted migration resumes from the last batch
+type migration struct {
+	version     uint64
+	description string
+	step        func(tx txn, cursor []byte) ([]byte, error)
+}
+
+// migrations are indexed by the version they upgrade from,
+// append a migration for every change of the key layout or the storage formats
+var migrations = []*migration{
+	{
+		version:     0,
+		description: "mark the database created before the schema version",
+		step: func(tx txn, cursor []byte) ([]byte, error) {
+			return nil, nil
+		},
+	},
+	{
+		version:     1,
+		description: "build the description index of the stored evidences",
+		step:        buildDescriptionIndex,
+	},
+	{
+		version:     2,
+		description: "build the time index of the stored blocks",
+		step:        buildTimeIndex,
+	},
+}
+
+// currentSchemaVersion is the schema version of the database created by the program
+func currentSchemaVersion() uint64 {
+	return uint64(len(migrations))
+}
+
+// checkSchema refuses the unknown schema version and upgrades the old one
+func (s *store) checkSchema() error {
+	version, ok, err := s.getSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		if !s.HasGenesis() && !s.IsImporting() {
+			return s.setSchemaVersion(currentSchemaVersion())
+		}
+		// the data created before the schema version
+		version = 0
+	}
+
+	if version > currentSchemaVersion() {
+		return ErrUnknownSchema{version, currentSchemaVersion()}
+	}
+
+	for ; version < currentSchemaVersion(); version++ {
+		if err := s.migrate(migrations[version]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) migrate(m *migration) error {
+	cursor, err := s.getMigrationCursor(m.version)
+	if err != nil {
+		return err
+	}
+	if cursor == nil {
+		logger.Info("migrate schema from version %d:%s\n", m.version, m.description)
+	} else {
+		logger.Info("resume migrating schema from version %d at %X\n", m.version, cursor)
+	}
+
+	for {
+		var next []byte
+		wf := func(tx txn) error {
+			var err error
+			if next, err = m.step(tx, cursor); err != nil {
+				return err
+			}
+
+			if next == nil {
+				if err := tx.Delete(mMigration); err != nil {
+					return err
+				}
+				return tx.Set(mSchemaVersion, hbyte(m.version+1))
+			}
+			return tx.Set(mMigration, append(hbyte(m.version), next...))
+		}
+
+		if err := s.engine.Update(wf); err != nil {
+			return ErrMigration{m.version, err}
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	logger.Info("migrate schema to version %d successfully\n", m.version+1)
+	return nil
+}
+
+// getMigrationCursor returns the cursor of the unfinished migration from the version
+func (s *store) getMigrationCursor(version uint64) ([]byte, error) {
+	var progress []byte
+	rf := func(tx txn) error {
+		var err error
+		progress, err = tx.Get(mMigration)
+		return err
+	}
+
+	err := s.engine.View(rf)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.wrapError(err)
+	}
+
+	if len(progress) < 8 || !bytes.Equal(progress[:8], hbyte(version)) {
+		return nil, ErrMigration{version, ErrInternal}
+	}
+	if len(progress) == 8 {
+		return nil, nil
+	}
+	return progress[8:], nil
+}
+
+func (s *store) getSchemaVersion() (uint64, bool, error) {
+	var version uint64
+	rf := func(tx txn) error {
+		val, err := tx.Get(mSchemaVersion)
+		if err != nil {
+			return err
+		}
+
+		version = byteh(val)
+		return nil
+	}
+
+	err := s.engine.View(rf)
+	if err == ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, s.wrapError(err)
+	}
+	return version, true, nil
+}
+
+func (s *store) setSchemaVersion(version uint64) error {
+	wf := func(tx txn) error {
+		return tx.Set(mSchemaVersion, hbyte(version))
+	}
+
+	return s.update(wf)
+}
+
+// buildDescriptionIndex indexes the evidences from the cursor evidence key,
+// the evidences are read before writing because some engines don't allow writing while iterating
+func buildDescriptionIndex(tx txn, cursor []byte) ([]byte, error) {
+	type indexed struct {
+		key   []byte
+		value []byte
+	}
+	var toWrite []indexed
+	var next []byte
+
+	err := tx.Iterate(evidencePrefix, cursor, func(key []byte, value []byte) error {
+		if len(toWrite) >= migrationBatchSize {
+			next = key
+			return errStopIteration
+		}
+		if len(key) <= 1+8 {
+			return nil
+		}
+
+		evd, err := storage.UnmarshalEvidence(bytes.NewReader(value))
+		if err != nil {
+			logger.Warn("skip indexing the unreadable evidence %X:%v\n", key, err)
+			return nil
+		}
+		for _, indexKey := range getDescriptionKeys(evd.Evidence, byteh(key[1:9])) {
+			toWrite = append(toWrite, indexed{indexKey, evd.PubKey})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range toWrite {
+		if err := tx.Set(entry.key, entry.value); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// buildTimeIndex indexes the block headers from the cursor header key
+func buildTimeIndex(tx txn, cursor []byte) ([]byte, error) {
+	type indexed struct {
+		key   []byte
+		value []byte
+	}
+	var toWrite []indexed
+	var next []byte
+
+	err := tx.Iterate(headerPrefix, cursor, func(key []byte, value []byte) error {
+		if len(toWrite) >= migrationBatchSize {
+			next = key
+			return errStopIteration
+		}
+		// skip the block hash keys
+		if len(key) <= 1+8+len(hashSuffix) {
+			return nil
+		}
+
+		header, err := storage.UnmarshalBlockHeader(bytes.NewReader(value))
+		if err != nil {
+			logger.Warn("skip indexing the unreadable header %X:%v\n", key, err)
+			return nil
+		}
+		toWrite = append(toWrite, indexed{getTimeKey(header.Time, byteh(key[1:9])), key[9:]})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range toWrite {
+		if err := tx.Set(entry.key, entry.value); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
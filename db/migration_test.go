@@ -0,0 +1,218 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func testSchemaVersion(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+
+	b := instance.(*store)
+	version, ok, err := b.getSchemaVersion()
+	if err != nil || !ok {
+		t.Fatalf("expect schema version, ok %v, err %v", ok, err)
+	}
+	if err := utils.TCheckUint64("schema version", currentSchemaVersion(), version); err != nil {
+		t.Fatal(err)
+	}
+
+	// the database created by a newer program
+	if err := b.setSchemaVersion(currentSchemaVersion() + 1); err != nil {
+		t.Fatal(err)
+	}
+	Close()
+	err = Init(tv.dbPath)
+	if _, ok := err.(ErrUnknownSchema); !ok {
+		t.Fatalf("expect unknown schema, but %v", err)
+	}
+
+	// reopen without the schema check for cleanup
+	openWithoutSchemaCheck(tv.dbPath)
+}
+
+func testLegacyMigration(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+
+	// the legacy fixture has data without the schema version, the description index and the time index
+	insertTestData(t)
+	b := instance.(*store)
+	indexKeys, err := b.keysWithPrefix(descriptionPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeKeys, err := b.keysWithPrefix(timePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range [][]byte{descriptionPrefix, timePrefix} {
+		if err := b.deletePrefix(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wf := func(tx txn) error {
+		return tx.Delete(mSchemaVersion)
+	}
+	if err := b.update(wf); err != nil {
+		t.Fatal(err)
+	}
+
+	Close()
+	if err := Init(tv.dbPath); err != nil {
+		t.Fatal(err)
+	}
+	b = instance.(*store)
+	version, _, _ := b.getSchemaVersion()
+	if err := utils.TCheckUint64("schema version", currentSchemaVersion(), version); err != nil {
+		t.Fatal(err)
+	}
+	height, _ := GetLatestHeight()
+	if err := utils.TCheckUint64("latest height", tv.fourthHeight, height); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := b.keysWithPrefix(descriptionPrefix)
+	if err := utils.TCheckInt("rebuilt description index", len(indexKeys), len(rebuilt)); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ = b.keysWithPrefix(timePrefix)
+	if err := utils.TCheckInt("rebuilt time index", len(timeKeys), len(rebuilt)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testMigrationResume(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+
+	// the fixture of the current version has the keys with the old prefix
+	from := currentSchemaVersion()
+	oldPrefix := []byte("xTest")
+	newPrefix := []byte("yTest")
+	keysNum := 10
+	b := instance.(*store)
+	wf := func(tx txn) error {
+		for i := 0; i < keysNum; i++ {
+			key := append(oldPrefix, hbyte(uint64(i))...)
+			if err := tx.Set(key, hbyte(uint64(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := b.update(wf); err != nil {
+		t.Fatal(err)
+	}
+	Close()
+
+	// the migration from the fixture version renames the keys, 3 keys a batch, it fails once at the second batch
+	originMigrations := migrations
+	defer func() { migrations = originMigrations }()
+	failed := false
+	batches := 0
+	rename := func(tx txn, cursor []byte) ([]byte, error) {
+		batches++
+		if batches == 2 && !failed {
+			failed = true
+			return nil, fmt.Errorf("interrupted")
+		}
+
+		var keys, values [][]byte
+		collect := func(key []byte, value []byte) error {
+			if cursor != nil && bytes.Equal(key, cursor) {
+				return nil
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+			if len(keys) == 3 {
+				return errStopIteration
+			}
+			return nil
+		}
+		if err := tx.Iterate(oldPrefix, cursor, collect); err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, nil
+		}
+
+		for i, key := range keys {
+			if err := tx.Delete(key); err != nil {
+				return nil, err
+			}
+			if err := tx.Set(append(newPrefix, key[len(oldPrefix):]...), values[i]); err != nil {
+				return nil, err
+			}
+		}
+		return keys[len(keys)-1], nil
+	}
+	migrations = append(migrations, &migration{
+		version:     from,
+		description: "rename the test keys",
+		step:        rename,
+	})
+
+	err := Init(tv.dbPath)
+	if _, ok := err.(ErrMigration); !ok {
+		t.Fatalf("expect migration failed, but %v", err)
+	}
+
+	// the first batch is committed
+	b = openWithoutSchemaCheck(tv.dbPath)
+	version, _, _ := b.getSchemaVersion()
+	if err := utils.TCheckUint64("schema version", from, version); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := b.getMigrationCursor(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("cursor", append(oldPrefix, hbyte(2)...), cursor); err != nil {
+		t.Fatal(err)
+	}
+	Close()
+
+	if err := Init(tv.dbPath); err != nil {
+		t.Fatal(err)
+	}
+	b = instance.(*store)
+	version, _, _ = b.getSchemaVersion()
+	if err := utils.TCheckUint64("schema version", from+1, version); err != nil {
+		t.Fatal(err)
+	}
+
+	rf := func(tx txn) error {
+		for i := 0; i < keysNum; i++ {
+			if _, err := tx.Get(append(oldPrefix, hbyte(uint64(i))...)); err != ErrNotFound {
+				return fmt.Errorf("old key %d exists", i)
+			}
+			value, err := tx.Get(append(newPrefix, hbyte(uint64(i))...))
+			if err != nil {
+				return fmt.Errorf("new key %d:%v", i, err)
+			}
+			if !bytes.Equal(value, hbyte(uint64(i))) {
+				return fmt.Errorf("new key %d value mismatch", i)
+			}
+		}
+		return nil
+	}
+	if err := b.engine.View(rf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openWithoutSchemaCheck(path string) *store {
+	e, _ := newEngine(dbTestVar.engine)
+	e.Open(path)
+	s := newStore(dbTestVar.engine, e)
+	s.start()
+	instance = s
+	return s
+}
@@ -3,6 +3,9 @@ package db
 import (
 	"bytes"
 	"encoding/binary"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
 )
 
 var (
@@ -15,10 +18,31 @@ var (
 	evidenceHeightPrefix = []byte("E")     // evidenceHeightPrefix + hash -> height
 	scoreSuffix          = []byte("Score") // pubKey + scoreSuffix -> score
 	evidenceSuffix       = []byte("e")     // pubKey + evidenceSuffix + evidenceHash -> height
+	descriptionPrefix    = []byte("D")     // descriptionPrefix + token + tokenEnd + height + evidenceHash -> pubKey
+	timePrefix           = []byte("t")     // timePrefix + block time + height -> hash
+	tokenEnd             = []byte{0}
 
 	// meta data key should begin with 'm'
 	mLatestHeight = []byte("mLatestHeigh")
 	mGenesis      = []byte("mGenesis")
+	mReindexing   = []byte("mReindexing")
+	mImporting    = []byte("mImporting")
+
+	// mSchemaVersion is the version of the key layout and the storage formats,
+	// mMigration is the version and the cursor of the unfinished migration
+	mSchemaVersion = []byte("mSchemaVersion")
+	mMigration     = []byte("mMigration")
+
+	// indexPrefixes are the key prefixes of indexes derived from blocks,
+	// the account keys begin with the compressed public key (0x02 or 0x03)
+	indexPrefixes = [][]byte{
+		headerHeightPrefix,
+		evidenceHeightPrefix,
+		descriptionPrefix,
+		timePrefix,
+		{0x02},
+		{0x03},
+	}
 )
 
 func hbyte(height uint64) []byte {
@@ -73,3 +97,32 @@ func getScoreKey(key []byte) []byte {
 func getAccountEvidenceKeyPrefix(key []byte) []byte {
 	return append(key, evidenceSuffix...)
 }
+
+// D..0..
+func getDescriptionKey(token string, height uint64, hash []byte) []byte {
+	return append(getDescriptionKeyPrefix(token), append(hbyte(height), hash...)...)
+}
+
+// D..0
+func getDescriptionKeyPrefix(token string) []byte {
+	return append(append([]byte{}, descriptionPrefix...), append([]byte(token), tokenEnd...)...)
+}
+
+// t..
+func getTimeKey(t int64, height uint64) []byte {
+	return append(getTimeKeyPrefix(t), hbyte(height)...)
+}
+
+// t.. without the height, the block time is not negative
+func getTimeKeyPrefix(t int64) []byte {
+	return append(append([]byte{}, timePrefix...), hbyte(uint64(t))...)
+}
+
+// getDescriptionKeys returns the description index keys of the evidence
+func getDescriptionKeys(evd *cp.Evidence, height uint64) [][]byte {
+	var result [][]byte
+	for _, token := range utils.IndexTokens(string(evd.Description)) {
+		result = append(result, getDescriptionKey(token, height, evd.Hash))
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func testSearchDescription(t *testing.T) {
+	setup()
+	defer cleanup()
+	insertGenesis(t)
+
+	second := cp.GenBlockFromParams(cp.NewBlockParams(false))
+	second.Evds[0].Description = []byte("加班记录 2019-05")
+	third := cp.GenBlockFromParams(cp.NewBlockParams(false))
+	third.Evds[0].Description = []byte("加班 2019-06")
+	if err := PutBlock(second, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := PutBlock(third, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(keywords string) []*EvidenceRef {
+		result, err := SearchDescription(utils.QueryTokens(keywords))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := search("加班")
+	if err := utils.TCheckInt("matched 加班", 2, len(result)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("the higher first", third.Evds[0].Hash, result[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("owner", third.Evds[0].PubKey, result[0].PubKey); err != nil {
+		t.Fatal(err)
+	}
+
+	result = search("记录 2019-05")
+	if err := utils.TCheckInt("matched 记录 2019-05", 1, len(result)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("matched height", 2, result[0].Height); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("matched 记录 2019-06", 0, len(search("记录 2019-06"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index is removed with the truncated block
+	if err := Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("matched 加班 after truncated", 1, len(search("加班"))); err != nil {
+		t.Fatal(err)
+	}
+}
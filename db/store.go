@@ -0,0 +1,1036 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/serialize/storage"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+var placeHolder = []byte("0")
+
+// writeBatchSize is the maximum keys number written in a transaction by the bulk operations
+const writeBatchSize = 1000
+
+// store implements the db on the key-value engine
+type store struct {
+	name   string
+	engine engine
+	lm     *utils.LoopMode
+}
+
+func newStore(name string, e engine) *store {
+	return &store{
+		name:   name,
+		engine: e,
+		lm:     utils.NewLoop(1),
+	}
+}
+
+func (s *store) Init(path string) error {
+	if err := s.engine.Open(path); err != nil {
+		return s.wrapError(err)
+	}
+
+	if err := s.checkSchema(); err != nil {
+		s.engine.Close()
+		return err
+	}
+
+	s.start()
+	return nil
+}
+
+func (s *store) Close() {
+	s.stop()
+	s.engine.Close()
+}
+
+func (s *store) HasGenesis() bool {
+	rf := func(tx txn) error {
+		_, err := tx.Get(mGenesis)
+		return err
+	}
+
+	err := s.engine.View(rf)
+	if err == nil {
+		return true
+	} else if err == ErrNotFound {
+		return false
+	} else {
+		logger.Fatal("check genesis failed:%v\n", err)
+		return false
+	}
+}
+
+func (s *store) PutGenesis(block *cp.Block) error {
+	wf := func(tx txn) error {
+		if err := tx.Set(mGenesis, placeHolder); err != nil {
+			return err
+		}
+
+		if err := s.putBlockTX(block, 1, tx); err != nil {
+			return err
+		}
+
+		if err := s.updateLatestHeightTX(1, tx); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	return s.update(wf)
+}
+
+// PutBlock stores block into db
+// It should not modify the existed block and the new block's height should be increased by one
+func (s *store) PutBlock(block *cp.Block, height uint64) error {
+	latestHeight, err := s.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+	expectHeight := latestHeight + 1
+	if height != expectHeight {
+		return ErrInvalidHeight{height, expectHeight}
+	}
+
+	wf := func(tx txn) error {
+		if err := s.putBlockTX(block, height, tx); err != nil {
+			return err
+		}
+
+		if err := s.updateLatestHeightTX(height, tx); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	return s.update(wf)
+}
+
+// GetHash gets block hash via its height
+func (s *store) GetHash(height uint64) ([]byte, error) {
+	var result []byte
+	hashKey := getHashKey(height)
+
+	rf := func(tx txn) error {
+		var err error
+		result, err = tx.Get(hashKey)
+		return err
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) GetHeaderViaHeight(height uint64) (*cp.BlockHeader, []byte, error) {
+	hash, err := s.GetHash(height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header, err := s.getHeader(height, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header.BlockHeader, hash, nil
+}
+
+func (s *store) GetHeaderViaHash(h []byte) (*cp.BlockHeader, uint64, error) {
+	height, err := s.getHeaderHeight(h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header, err := s.getHeader(height, h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return header.BlockHeader, height, nil
+}
+
+func (s *store) GetBlockViaHeight(height uint64) (*cp.Block, []byte, error) {
+	hash, err := s.GetHash(height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.getCPBlock(height, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, hash, err
+}
+
+func (s *store) GetBlockViaHash(h []byte) (*cp.Block, uint64, error) {
+	height, err := s.getHeaderHeight(h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result, err := s.getCPBlock(height, h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return result, height, nil
+}
+
+func (s *store) GetEvidenceViaHash(h []byte) (*cp.Evidence, uint64, error) {
+	height, err := s.getEvidenceHeight(h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	evd, err := s.getEvidence(height, h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return evd.Evidence, height, nil
+}
+
+func (s *store) GetEvidenceViaKey(pubKey []byte) ([][]byte, []uint64, error) {
+	var evdsHash [][]byte
+	var heights []uint64
+
+	rf := func(tx txn) error {
+		prefix := getAccountEvidenceKeyPrefix(pubKey)
+		prefixLen := len(prefix)
+		return tx.Iterate(prefix, nil, func(k []byte, v []byte) error {
+			evdsHash = append(evdsHash, k[prefixLen:])
+			heights = append(heights, byteh(v))
+			return nil
+		})
+	}
+
+	if err := s.engine.View(rf); err != nil {
+		return nil, nil, s.wrapError(err)
+	}
+
+	return evdsHash, heights, nil
+}
+
+func (s *store) HasEvidence(h []byte) bool {
+	rf := func(tx txn) error {
+		key := getEvidenceHeightKey(h)
+		_, err := tx.Get(key)
+		return err
+	}
+
+	err := s.engine.View(rf)
+	if err == nil {
+		return true
+	} else if err == ErrNotFound {
+		return false
+	} else {
+		logger.Warn("check evidence failed:%v\n", err)
+		return true
+	}
+}
+
+func (s *store) GetScoreViaKey(pubKey []byte) (uint64, error) {
+	var result uint64
+
+	rf := func(tx txn) error {
+		scoreKey := getScoreKey(pubKey)
+		val, err := tx.Get(scoreKey)
+		if err != nil {
+			return err
+		}
+
+		result = byteh(val)
+		return nil
+	}
+
+	err := s.engine.View(rf)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, s.wrapError(err)
+	}
+	return result, nil
+}
+
+func (s *store) GetLatestHeight() (uint64, error) {
+	var result uint64
+
+	rf := func(tx txn) error {
+		val, err := tx.Get(mLatestHeight)
+		if err != nil {
+			return err
+		}
+
+		result = byteh(val)
+		return nil
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) GetLatestHeader() (*cp.BlockHeader, uint64, []byte, error) {
+	lastHeight, err := s.GetLatestHeight()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	header, hash, err := s.GetHeaderViaHeight(lastHeight)
+	if header == nil {
+		return nil, 0, nil, err
+	}
+
+	return header, lastHeight, hash, nil
+}
+
+// DropIndexes removes all indexes derived from blocks and marks the database reindexing,
+// the node should not run until FinishReindex is called
+func (s *store) DropIndexes() error {
+	wf := func(tx txn) error {
+		return tx.Set(mReindexing, placeHolder)
+	}
+	if err := s.update(wf); err != nil {
+		return err
+	}
+
+	for _, prefix := range indexPrefixes {
+		if err := s.deletePrefix(prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutIndexes stores the indexes of the stored block
+func (s *store) PutIndexes(block *cp.Block, height uint64) error {
+	wf := func(tx txn) error {
+		return s.putIndexesTX(block, block.GetSerializedHash(), height, tx)
+	}
+
+	return s.update(wf)
+}
+
+func (s *store) FinishReindex() error {
+	wf := func(tx txn) error {
+		return tx.Delete(mReindexing)
+	}
+
+	return s.update(wf)
+}
+
+func (s *store) IsReindexing() bool {
+	return s.hasMeta(mReindexing)
+}
+
+// ExportEntries walks the entries of the blocks under the height with their indexes in a fixed order,
+// the indexes are derived from the blocks so that they are the same as the database at the height
+func (s *store) ExportEntries(height uint64, fn func(key, value []byte) error) error {
+	latestHeight, err := s.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+	if height == 0 || height > latestHeight {
+		return fmt.Errorf("invalid height %d, the latest height is %d", height, latestHeight)
+	}
+
+	if err := fn(mGenesis, placeHolder); err != nil {
+		return err
+	}
+
+	scores := make(map[string]uint64)
+	for h := uint64(1); h <= height; h++ {
+		hash, err := s.GetHash(h)
+		if err != nil {
+			return err
+		}
+		block, err := s.getCPBlock(h, hash)
+		if err != nil {
+			return fmt.Errorf("height %d, unreadable block:%v", h, err)
+		}
+
+		for _, prefix := range [][]byte{headerPrefix, blockPrefix, evidencePrefix} {
+			if err := s.walkPrefix(append(prefix, hbyte(h)...), fn); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(getHeaderHeightKey(hash), hbyte(h)); err != nil {
+			return err
+		}
+		if err := fn(getTimeKey(block.Time, h), hash); err != nil {
+			return err
+		}
+		for _, e := range block.Evds {
+			if err := fn(getEvidenceHeightKey(e.Hash), hbyte(h)); err != nil {
+				return err
+			}
+			accountEvidenceKey := append(getAccountEvidenceKeyPrefix(e.PubKey), e.Hash...)
+			if err := fn(accountEvidenceKey, hbyte(h)); err != nil {
+				return err
+			}
+			for _, key := range getDescriptionKeys(e, h) {
+				if err := fn(key, e.PubKey); err != nil {
+					return err
+				}
+			}
+		}
+		scores[string(block.Miner)]++
+	}
+
+	var miners []string
+	for miner := range scores {
+		miners = append(miners, miner)
+	}
+	sort.Strings(miners)
+	for _, miner := range miners {
+		if err := fn(getScoreKey([]byte(miner)), hbyte(scores[miner])); err != nil {
+			return err
+		}
+	}
+
+	return fn(mLatestHeight, hbyte(height))
+}
+
+// ImportEntries writes the entries into the empty database until next returns io.EOF,
+// the database is marked importing, the node should not run until FinishImport is called
+func (s *store) ImportEntries(next func() (key, value []byte, err error)) error {
+	if s.HasGenesis() || s.IsImporting() {
+		return fmt.Errorf("the database is not empty")
+	}
+
+	wf := func(tx txn) error {
+		return tx.Set(mImporting, placeHolder)
+	}
+	if err := s.update(wf); err != nil {
+		return err
+	}
+
+	for finished := false; !finished; {
+		var nextErr error
+		wf := func(tx txn) error {
+			for i := 0; i < writeBatchSize; i++ {
+				key, value, err := next()
+				if err == io.EOF {
+					finished = true
+					return nil
+				}
+				if err != nil {
+					nextErr = err
+					return err
+				}
+
+				if err := tx.Set(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if err := s.update(wf); err != nil {
+			if nextErr != nil {
+				return nextErr
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) FinishImport() error {
+	wf := func(tx txn) error {
+		return tx.Delete(mImporting)
+	}
+
+	return s.update(wf)
+}
+
+func (s *store) IsImporting() bool {
+	return s.hasMeta(mImporting)
+}
+
+// EvidenceRef locates the stored evidence
+type EvidenceRef struct {
+	Hash   []byte
+	Height uint64
+	PubKey []byte // nil if the index doesn't record the owner
+}
+
+// SearchDescription returns the stored evidences whose descriptions have all the tokens,
+// from the higher to the lower height
+func (s *store) SearchDescription(tokens []string) ([]*EvidenceRef, error) {
+	var result []*EvidenceRef
+
+	rf := func(tx txn) error {
+		// the matched evidences keyed by height and hash
+		var matched map[string]*EvidenceRef
+		for _, token := range tokens {
+			prefix := getDescriptionKeyPrefix(token)
+			found := make(map[string]*EvidenceRef)
+			err := tx.Iterate(prefix, nil, func(key []byte, value []byte) error {
+				ref := key[len(prefix):]
+				if len(ref) <= 8 {
+					return nil
+				}
+				if matched == nil || matched[string(ref)] != nil {
+					found[string(ref)] = &EvidenceRef{
+						Hash:   ref[8:],
+						Height: byteh(ref[:8]),
+						PubKey: value,
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			matched = found
+			if len(matched) == 0 {
+				break
+			}
+		}
+
+		for _, ref := range matched {
+			result = append(result, ref)
+		}
+		return nil
+	}
+	if err := s.view(rf); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Height != result[j].Height {
+			return result[i].Height > result[j].Height
+		}
+		return bytes.Compare(result[i].Hash, result[j].Hash) < 0
+	})
+	return result, nil
+}
+
+// GetHeightViaTime returns the height of the highest stored block whose time is not after t,
+// the block time never decreases along the chain
+func (s *store) GetHeightViaTime(t int64) (uint64, error) {
+	if t < 0 {
+		return 0, ErrNotFound
+	}
+
+	var after uint64
+	rf := func(tx txn) error {
+		return tx.Iterate(timePrefix, getTimeKeyPrefix(t+1), func(key []byte, value []byte) error {
+			if len(key) == 1+8+8 {
+				after = byteh(key[9:])
+				return errStopIteration
+			}
+			return nil
+		})
+	}
+	if err := s.view(rf); err != nil {
+		return 0, err
+	}
+
+	if after == 0 {
+		return s.GetLatestHeight()
+	}
+	if after == 1 {
+		// the genesis block is after t
+		return 0, ErrNotFound
+	}
+	return after - 1, nil
+}
+
+// GetEvidenceViaTime returns the stored evidences in the blocks whose time is in [begin, end]
+// from the older to the newer, skipping offset evidences and at most limit ones,
+// and the total number of the evidences in the time window
+func (s *store) GetEvidenceViaTime(begin, end int64, offset, limit int) ([]*EvidenceRef, int, error) {
+	if begin > end {
+		return nil, 0, nil
+	}
+	if begin < 0 {
+		begin = 0
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var first uint64
+	rf := func(tx txn) error {
+		return tx.Iterate(timePrefix, getTimeKeyPrefix(begin), func(key []byte, value []byte) error {
+			if len(key) == 1+8+8 {
+				first = byteh(key[9:])
+				return errStopIteration
+			}
+			return nil
+		})
+	}
+	if err := s.view(rf); err != nil {
+		return nil, 0, err
+	}
+	if first == 0 {
+		return nil, 0, nil
+	}
+
+	last, err := s.GetHeightViaTime(end)
+	if err == ErrNotFound {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var result []*EvidenceRef
+	var total int
+	rf = func(tx txn) error {
+		return tx.Iterate(blockPrefix, getBlockKey(first, nil), func(key []byte, value []byte) error {
+			if len(key) <= 1+8 {
+				return nil
+			}
+			height := byteh(key[1:9])
+			if height > last {
+				return errStopIteration
+			}
+
+			block, err := storage.UnmarshalBlock(bytes.NewReader(value))
+			if err != nil {
+				return err
+			}
+			for _, evdHash := range block.EvdsHash {
+				if total >= offset && len(result) < limit {
+					result = append(result, &EvidenceRef{
+						Hash:   evdHash,
+						Height: height,
+					})
+				}
+				total++
+			}
+			return nil
+		})
+	}
+	if err := s.view(rf); err != nil {
+		return nil, 0, err
+	}
+	return result, total, nil
+}
+
+// Truncate removes the blocks higher than the height from top to bottom,
+// the indexes of the unreadable blocks are left;
+// while reindexing, only the indexes of blocks under the height have been rebuilt, they are untouched
+func (s *store) Truncate(height uint64) error {
+	if height == 0 {
+		return fmt.Errorf("the genesis block can't be removed")
+	}
+
+	latestHeight, err := s.GetLatestHeight()
+	if err != nil {
+		return err
+	}
+	withIndexes := !s.IsReindexing()
+
+	for h := latestHeight; h > height; h-- {
+		hash, _ := s.GetHash(h)
+		var block *cp.Block
+		if withIndexes && hash != nil {
+			if block, err = s.getCPBlock(h, hash); err != nil {
+				logger.Warn("height %d, unreadable block, its indexes are left:%v\n", h, err)
+			}
+		}
+
+		var keys [][]byte
+		for _, prefix := range [][]byte{headerPrefix, blockPrefix, evidencePrefix} {
+			heightKeys, err := s.keysWithPrefix(append(prefix, hbyte(h)...))
+			if err != nil {
+				return err
+			}
+			keys = append(keys, heightKeys...)
+		}
+
+		wf := func(tx txn) error {
+			if block != nil {
+				if err := s.removeIndexesTX(block, hash, h, tx); err != nil {
+					return err
+				}
+			}
+			for _, key := range keys {
+				if err := tx.Delete(key); err != nil {
+					return err
+				}
+			}
+			return s.updateLatestHeightTX(h-1, tx)
+		}
+		if err := s.update(wf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) keysWithPrefix(prefix []byte) ([][]byte, error) {
+	var result [][]byte
+
+	rf := func(tx txn) error {
+		return tx.Iterate(prefix, nil, func(key []byte, value []byte) error {
+			result = append(result, key)
+			return nil
+		})
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) walkPrefix(prefix []byte, fn func(key, value []byte) error) error {
+	rf := func(tx txn) error {
+		return tx.Iterate(prefix, nil, fn)
+	}
+
+	return s.view(rf)
+}
+
+func (s *store) hasMeta(key []byte) bool {
+	rf := func(tx txn) error {
+		_, err := tx.Get(key)
+		return err
+	}
+
+	err := s.engine.View(rf)
+	if err == nil {
+		return true
+	} else if err == ErrNotFound {
+		return false
+	} else {
+		logger.Fatal("check meta %s failed:%v\n", key, err)
+		return false
+	}
+}
+
+func (s *store) deletePrefix(prefix []byte) error {
+	keys, err := s.keysWithPrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	for len(keys) != 0 {
+		batch := keys
+		if len(batch) > writeBatchSize {
+			batch = batch[:writeBatchSize]
+		}
+		keys = keys[len(batch):]
+
+		wf := func(tx txn) error {
+			for _, key := range batch {
+				if err := tx.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := s.update(wf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) getHeaderHeight(hash []byte) (uint64, error) {
+	var result uint64
+	headerHeightKey := getHeaderHeightKey(hash)
+
+	rf := func(tx txn) error {
+		val, err := tx.Get(headerHeightKey)
+		if err != nil {
+			return err
+		}
+
+		result = byteh(val)
+		return nil
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) getEvidenceHeight(hash []byte) (uint64, error) {
+	var result uint64
+	evidenceHeightKey := getEvidenceHeightKey(hash)
+
+	rf := func(tx txn) error {
+		val, err := tx.Get(evidenceHeightKey)
+		if err != nil {
+			return err
+		}
+
+		result = byteh(val)
+		return nil
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) getHeader(height uint64, hash []byte) (*storage.BlockHeader, error) {
+	var result *storage.BlockHeader
+	headerKey := getHeaderKey(height, hash)
+
+	rf := func(tx txn) error {
+		val, err := tx.Get(headerKey)
+		if err != nil {
+			return err
+		}
+
+		result, err = storage.UnmarshalBlockHeader(bytes.NewReader(val))
+		return err
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) getBlock(height uint64, hash []byte) (*storage.Block, error) {
+	var result *storage.Block
+	blockKey := getBlockKey(height, hash)
+
+	rf := func(tx txn) error {
+		val, err := tx.Get(blockKey)
+		if err != nil {
+			return err
+		}
+
+		result, err = storage.UnmarshalBlock(bytes.NewReader(val))
+		return err
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) getEvidence(height uint64, hash []byte) (*storage.Evidence, error) {
+	var result *storage.Evidence
+	evidenceKey := getEvidenceKey(height, hash)
+
+	rf := func(tx txn) error {
+		val, err := tx.Get(evidenceKey)
+		if err != nil {
+			return err
+		}
+
+		result, err = storage.UnmarshalEvidence(bytes.NewReader(val))
+		return err
+	}
+
+	return result, s.view(rf)
+}
+
+func (s *store) getCPBlock(height uint64, hash []byte) (*cp.Block, error) {
+	header, err := s.getHeader(height, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var evds []*cp.Evidence
+
+	if !header.BlockHeader.IsEmptyEvidenceRoot() {
+		storageBlock, err := s.getBlock(height, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, eHash := range storageBlock.EvdsHash {
+			evd, err := s.getEvidence(height, eHash)
+			if err != nil {
+				return nil, err
+			}
+			evds = append(evds, evd.Evidence)
+		}
+	}
+
+	return &cp.Block{
+		BlockHeader: header.BlockHeader,
+		Evds:        evds,
+	}, nil
+}
+
+func (s *store) putBlockTX(block *cp.Block, height uint64, tx txn) error {
+	hash := block.GetSerializedHash()
+	header := storage.NewBlockHeader(block.BlockHeader, height)
+
+	if !block.IsEmptyEvidenceRoot() {
+		if err := s.putEvidenceTX(hash, block.Evds, height, tx); err != nil {
+			return err
+		}
+	} else {
+		header.SetEmptyEvdsRoot()
+	}
+
+	storageData := header.Marshal()
+
+	if err := tx.Set(getHeaderKey(height, hash), storageData); err != nil {
+		return err
+	}
+	if err := tx.Set(getHashKey(height), hash); err != nil {
+		return err
+	}
+
+	return s.putIndexesTX(block, hash, height, tx)
+}
+
+func (s *store) putEvidenceTX(hash []byte, evds []*cp.Evidence, height uint64, tx txn) error {
+	var evdsHash [][]byte
+	for _, e := range evds {
+		storageData := e.Marshal()
+
+		if err := tx.Set(getEvidenceKey(height, e.Hash), storageData); err != nil {
+			return err
+		}
+
+		evdsHash = append(evdsHash, e.Hash)
+	}
+
+	block := storage.NewBlock(evdsHash)
+	storageData := block.Marshal()
+
+	if err := tx.Set(getBlockKey(height, hash), storageData); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// putIndexesTX stores the indexes derived from the block:
+// header height, block time, evidence height, account evidence, description and score
+func (s *store) putIndexesTX(block *cp.Block, hash []byte, height uint64, tx txn) error {
+	if err := tx.Set(getHeaderHeightKey(hash), hbyte(height)); err != nil {
+		return err
+	}
+	if err := tx.Set(getTimeKey(block.Time, height), hash); err != nil {
+		return err
+	}
+
+	for _, e := range block.Evds {
+		if err := tx.Set(getEvidenceHeightKey(e.Hash), hbyte(height)); err != nil {
+			return err
+		}
+		if err := s.updateAccountEvidenceTX(e, height, tx); err != nil {
+			return err
+		}
+		for _, key := range getDescriptionKeys(e, height) {
+			if err := tx.Set(key, e.PubKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.updateScoreTX(block.Miner, 1, tx)
+}
+
+// removeIndexesTX removes the indexes derived from the block
+func (s *store) removeIndexesTX(block *cp.Block, hash []byte, height uint64, tx txn) error {
+	if err := tx.Delete(getHeaderHeightKey(hash)); err != nil {
+		return err
+	}
+	if err := tx.Delete(getTimeKey(block.Time, height)); err != nil {
+		return err
+	}
+
+	for _, e := range block.Evds {
+		if err := tx.Delete(getEvidenceHeightKey(e.Hash)); err != nil {
+			return err
+		}
+		accountEvidenceKey := append(getAccountEvidenceKeyPrefix(e.PubKey), e.Hash...)
+		if err := tx.Delete(accountEvidenceKey); err != nil {
+			return err
+		}
+		for _, key := range getDescriptionKeys(e, height) {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.updateScoreTX(block.Miner, -1, tx)
+}
+
+func (s *store) updateAccountEvidenceTX(evd *cp.Evidence, height uint64, tx txn) error {
+	accountEvidenceKey := append(getAccountEvidenceKeyPrefix(evd.PubKey), evd.Hash...)
+	heightValue := hbyte(height)
+	return tx.Set(accountEvidenceKey, heightValue)
+}
+
+func (s *store) updateLatestHeightTX(height uint64, tx txn) error {
+	if err := tx.Set(mLatestHeight, hbyte(height)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *store) updateScoreTX(pubKey []byte, delta int, tx txn) error {
+	scoreKey := getScoreKey(pubKey)
+
+	val, err := tx.Get(scoreKey)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	origin := uint64(0)
+	if err != ErrNotFound {
+		origin = byteh(val)
+	}
+
+	if delta < 0 {
+		if origin <= uint64(-delta) {
+			return tx.Delete(scoreKey)
+		}
+		return tx.Set(scoreKey, hbyte(origin-uint64(-delta)))
+	}
+	return tx.Set(scoreKey, hbyte(origin+uint64(delta)))
+}
+
+func (s *store) view(fn func(txn txn) error) error {
+	return s.wrapError(s.engine.View(fn))
+}
+
+func (s *store) update(fn func(txn txn) error) error {
+	return s.wrapError(s.engine.Update(fn))
+}
+
+// wrap the error directly get from the engine
+func (s *store) wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == ErrNotFound {
+		return ErrNotFound
+	}
+
+	logger.Warn("db engine got unexpect err:%v\n", err)
+	return ErrInternal
+}
+
+func (s *store) start() {
+	go s.gcLoop()
+	s.lm.StartWorking()
+}
+
+func (s *store) stop() {
+	s.lm.Stop()
+}
+
+func (s *store) gcLoop() {
+	s.lm.Add()
+	defer s.lm.Done()
+
+	ticker := time.NewTicker(10 * time.Minute)
+
+	for {
+		select {
+		case <-s.lm.D:
+			return
+		case <-ticker.C:
+			s.engine.GC()
+		}
+	}
+}
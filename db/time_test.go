@@ -0,0 +1,100 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/serialize/cp"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func testTimeIndex(t *testing.T) {
+	tv := dbTestVar
+	setup()
+	defer cleanup()
+	insertGenesis(t)
+
+	// the second and the third blocks have the same time
+	base := tv.genesis.Time
+	var blocks []*cp.Block
+	for i, offset := range []int64{100, 100, 300} {
+		block := cp.GenBlockFromParams(cp.NewBlockParams(false))
+		block.Time = base + offset
+		if err := PutBlock(block, uint64(i+2)); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	if _, err := GetHeightViaTime(base - 1); err != ErrNotFound {
+		t.Fatalf("expect not found before the genesis, but %v", err)
+	}
+	for _, c := range []struct {
+		time   int64
+		height uint64
+	}{
+		{base, 1},
+		{base + 99, 1},
+		{base + 100, 3},
+		{base + 299, 3},
+		{base + 300, 4},
+		{base + 10000, 4},
+	} {
+		height, err := GetHeightViaTime(c.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := utils.TCheckUint64("height at the time", c.height, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secondNum := len(blocks[0].Evds)
+	thirdNum := len(blocks[1].Evds)
+	refs, total, err := GetEvidenceViaTime(base+1, base+200, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("total in the window", secondNum+thirdNum, total); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("evidences in the window", total, len(refs)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("the older first", blocks[0].Evds[0].Hash, refs[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("the newest height", 3, refs[len(refs)-1].Height); err != nil {
+		t.Fatal(err)
+	}
+
+	// the page across the blocks
+	refs, total, err = GetEvidenceViaTime(base+1, base+300, secondNum, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("total after the genesis", secondNum+thirdNum+len(blocks[2].Evds), total); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("page size", 1, len(refs)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("the page", blocks[1].Evds[0].Hash, refs[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, total, _ = GetEvidenceViaTime(base+301, base+400, 0, 100); total != 0 {
+		t.Fatalf("expect no evidence after the latest block, but %d", total)
+	}
+
+	// the index is removed with the truncated block
+	if err := Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	height, err := GetHeightViaTime(base + 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("height after truncated", 3, height); err != nil {
+		t.Fatal(err)
+	}
+}
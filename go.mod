@@ -6,5 +6,6 @@ require (
 	github.com/btcsuite/btcd v0.0.0-20190427004231-96897255fd17
 	github.com/dgraph-io/badger v1.6.0
 	github.com/howeyc/gopass v0.0.0-20170109162249-bf9dde6d0d2c
+	go.etcd.io/bbolt v1.3.3
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 )
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/996BC/996.Blockchain/p2p/peer"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// maxAnchors is the number of the longest connected outbound peers
+// saved at exit and connected first at startup, an attacker can't take
+// all the outbound places even if it fills the peer table during the restart
+const maxAnchors = 3
+
+// loadAnchors reads and removes the anchors file, so that
+// an anchor failing the node is not connected again after the next restart
+func loadAnchors(path string) []*peer.Peer {
+	if len(path) == 0 {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("read anchors %s failed:%v\n", path, err)
+		}
+		return nil
+	}
+	os.Remove(path)
+
+	var anchors []*peer.Record
+	if err := json.Unmarshal(content, &anchors); err != nil {
+		logger.Warn("parse anchors %s failed:%v\n", path, err)
+		return nil
+	}
+
+	var result []*peer.Peer
+	for _, a := range anchors {
+		p, err := a.Parse()
+		if err != nil {
+			logger.Warn("invalid anchor %s:%v\n", a.Key, err)
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func saveAnchors(path string, peers []*peer.Peer) {
+	if len(path) == 0 {
+		return
+	}
+
+	var anchors []peer.Record
+	for _, p := range peers {
+		if p.Key == nil {
+			continue
+		}
+		anchors = append(anchors, peer.NewRecord(p))
+	}
+	content, err := json.Marshal(anchors)
+	if err != nil {
+		logger.Warn("marshal anchors failed:%v\n", err)
+		return
+	}
+	if err := utils.WriteFileAtomic(path, content, 0644); err != nil {
+		logger.Warn("save anchors failed:%v\n", err)
+	}
+}
@@ -0,0 +1,227 @@
+package p2p
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	// BanScore is the misbehavior score at which the peer is banned
+	BanScore = 100
+
+	// DefaultBanDuration is how long the peer is banned for reaching BanScore
+	DefaultBanDuration = 24 * time.Hour
+
+	// the misbehavior score decreases by 1 every scoreDecayInterval,
+	// so the occasional faults of an honest peer don't add up to a ban
+	scoreDecayInterval = 1 * time.Minute
+)
+
+// Ban is a peer refused to connect until the time
+type Ban struct {
+	ID     string `json:"id"`
+	Until  int64  `json:"until"`
+	Reason string `json:"reason"`
+}
+
+type misbehavior struct {
+	score   int
+	updated time.Time
+}
+
+// banList keeps the misbehavior scores of the peers and the bans,
+// the bans are saved into the file to survive restarts
+type banList struct {
+	mutex  sync.Mutex
+	path   string // no persistence if empty
+	scores map[string]*misbehavior
+	bans   map[string]*Ban
+}
+
+func newBanList(path string) *banList {
+	result := &banList{
+		path:   path,
+		scores: make(map[string]*misbehavior),
+		bans:   make(map[string]*Ban),
+	}
+	if len(path) == 0 {
+		return result
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("read ban list %s failed:%v\n", path, err)
+		}
+		return result
+	}
+
+	var bans []*Ban
+	if err := json.Unmarshal(content, &bans); err != nil {
+		logger.Warn("parse ban list %s failed:%v\n", path, err)
+		return result
+	}
+	now := time.Now().Unix()
+	for _, b := range bans {
+		if b.Until > now {
+			result.bans[b.ID] = b
+		}
+	}
+	return result
+}
+
+// misbehave adds the score to the peer and bans it if the score reaches BanScore,
+// returns true if the peer is banned
+func (b *banList) misbehave(peerID string, score int, reason string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	m, ok := b.scores[peerID]
+	if !ok {
+		m = &misbehavior{updated: now}
+		b.scores[peerID] = m
+	}
+	m.decay(now)
+	m.score += score
+	if m.score < BanScore {
+		return false
+	}
+
+	delete(b.scores, peerID)
+	b.bans[peerID] = &Ban{
+		ID:     peerID,
+		Until:  now.Add(DefaultBanDuration).Unix(),
+		Reason: reason,
+	}
+	b.save()
+	return true
+}
+
+func (b *banList) ban(peerID string, duration time.Duration, reason string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.scores, peerID)
+	b.bans[peerID] = &Ban{
+		ID:     peerID,
+		Until:  time.Now().Add(duration).Unix(),
+		Reason: reason,
+	}
+	b.save()
+}
+
+// unban returns false if the peer is not banned
+func (b *banList) unban(peerID string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.scores, peerID)
+	if _, ok := b.bans[peerID]; !ok {
+		return false
+	}
+	delete(b.bans, peerID)
+	b.save()
+	return true
+}
+
+func (b *banList) isBanned(peerID string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ban, ok := b.bans[peerID]
+	return ok && ban.Until > time.Now().Unix()
+}
+
+func (b *banList) getScore(peerID string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	m, ok := b.scores[peerID]
+	if !ok {
+		return 0
+	}
+	m.decay(time.Now())
+	return m.score
+}
+
+// list returns the bans ordered by the expiry
+func (b *banList) list() []*Ban {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now().Unix()
+	var result []*Ban
+	for _, ban := range b.bans {
+		if ban.Until > now {
+			copied := *ban
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Until < result[j].Until
+	})
+	return result
+}
+
+// clean removes the expired bans and the decayed scores
+func (b *banList) clean() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	for k, m := range b.scores {
+		if m.decay(now); m.score <= 0 {
+			delete(b.scores, k)
+		}
+	}
+
+	expired := false
+	for k, ban := range b.bans {
+		if ban.Until <= now.Unix() {
+			delete(b.bans, k)
+			expired = true
+		}
+	}
+	if expired {
+		b.save()
+	}
+}
+
+func (b *banList) save() {
+	if len(b.path) == 0 {
+		return
+	}
+
+	var bans []*Ban
+	for _, ban := range b.bans {
+		bans = append(bans, ban)
+	}
+	content, err := json.Marshal(bans)
+	if err != nil {
+		logger.Warn("marshal ban list failed:%v\n", err)
+		return
+	}
+	if err := utils.WriteFileAtomic(b.path, content, 0644); err != nil {
+		logger.Warn("save ban list failed:%v\n", err)
+	}
+}
+
+func (m *misbehavior) decay(now time.Time) {
+	decayed := int(now.Sub(m.updated) / scoreDecayInterval)
+	if decayed <= 0 {
+		return
+	}
+
+	m.score -= decayed
+	if m.score < 0 {
+		m.score = 0
+	}
+	m.updated = m.updated.Add(time.Duration(decayed) * scoreDecayInterval)
+}
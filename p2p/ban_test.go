@@ -0,0 +1,76 @@
+package p2p
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestBanListPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans.json")
+
+	b := newBanList(path)
+	if b.misbehave("Peer_A", BanScore-1, "almost") {
+		t.Fatal("expect not banned under the ban score")
+	}
+	if !b.misbehave("Peer_A", 1, "bad block") {
+		t.Fatal("expect banned at the ban score")
+	}
+	b.ban("Peer_B", time.Hour, "manual")
+	b.ban("Peer_C", time.Hour, "manual")
+	b.unban("Peer_C")
+
+	// reloaded after restart
+	reloaded := newBanList(path)
+	bans := reloaded.list()
+	if err := utils.TCheckInt("bans", 2, len(bans)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckString("the earlier expiry first", "Peer_B", bans[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckString("ban reason", "bad block", bans[1].Reason); err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.isBanned("Peer_A") || reloaded.isBanned("Peer_C") {
+		t.Fatal("expect the bans restored")
+	}
+
+	// expired
+	reloaded.bans["Peer_B"].Until = time.Now().Unix() - 1
+	reloaded.clean()
+	if reloaded.isBanned("Peer_B") {
+		t.Fatal("expect the expired ban removed")
+	}
+	if err := utils.TCheckInt("bans after cleaned", 1, len(newBanList(path).list())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMisbehaviorDecay(t *testing.T) {
+	b := newBanList("")
+	b.misbehave("Peer_A", 50, "test")
+
+	b.scores["Peer_A"].updated = time.Now().Add(-10 * scoreDecayInterval)
+	if err := utils.TCheckInt("decayed score", 40, b.getScore("Peer_A")); err != nil {
+		t.Fatal(err)
+	}
+
+	b.scores["Peer_A"].updated = time.Now().Add(-time.Hour)
+	b.clean()
+	if err := utils.TCheckInt("score after decayed", 0, b.getScore("Peer_A")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.scores["Peer_A"]; ok {
+		t.Fatal("expect the decayed score removed")
+	}
+}
@@ -3,9 +3,13 @@ package p2p
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/sha512"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
 
 	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/hkdf"
 )
 
 // codec is used to encrypt/decrypt message
@@ -14,41 +18,165 @@ type codec interface {
 	decrypt(cipherText []byte) ([]byte, error)
 }
 
+const (
+	// a direction derives the next key after either limit is reached
+	rekeyMessages = 1 << 20
+	rekeyBytes    = 1 << 30
+
+	sequenceSize = 8
+)
+
+var (
+	initiatorKeyInfo = []byte("996 handshake v2 initiator key")
+	responderKeyInfo = []byte("996 handshake v2 responder key")
+	rekeyInfo        = []byte("996 handshake v2 rekey")
+)
+
 // implement of 'codec'
+// the message is
+//
+//	| sequence (8 bytes) | AES-GCM cipher text |
+//
+// every direction has its own key, the sequence counts the messages of the direction from 0,
+// it is the nonce and the additional data of the cipher text;
+// the receiver only accepts the next sequence, so the replayed or reordered messages are rejected
 type aesgcmCodec struct {
-	aead  cipher.AEAD
-	nonce []byte
+	send *codecDirection
+	recv *codecDirection
+}
+
+type codecDirection struct {
+	lock     sync.Mutex
+	aead     cipher.AEAD
+	key      []byte
+	sequence uint64
+
+	// counted since the last rekey
+	messages      uint64
+	bytes         uint64
+	rekeyMessages uint64
+	rekeyBytes    uint64
 }
 
 func (aes *aesgcmCodec) encrypt(plainText []byte) ([]byte, error) {
-	cipherText := aes.aead.Seal(nil, aes.nonce, plainText, nil)
+	d := aes.send
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	header := make([]byte, sequenceSize)
+	binary.BigEndian.PutUint64(header, d.sequence)
+	cipherText := d.aead.Seal(header, d.nonce(), plainText, header)
+
+	if err := d.next(len(plainText)); err != nil {
+		return nil, err
+	}
 	return cipherText, nil
 }
 
 func (aes *aesgcmCodec) decrypt(cipherText []byte) ([]byte, error) {
-	plainText, err := aes.aead.Open(nil, aes.nonce, cipherText, nil)
-	return plainText, err
-}
+	d := aes.recv
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(cipherText) < sequenceSize {
+		return nil, ErrCodecBrokenMessage
+	}
+	sequence := binary.BigEndian.Uint64(cipherText[:sequenceSize])
+	if sequence != d.sequence {
+		return nil, ErrCodecSequenceMismatch{d.sequence, sequence}
+	}
 
-func newAESGCMCodec(remotePubKey *btcec.PublicKey, randPrivKey *btcec.PrivateKey) (*aesgcmCodec, error) {
+	plainText, err := d.aead.Open(nil, d.nonce(), cipherText[sequenceSize:], cipherText[:sequenceSize])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.next(len(plainText)); err != nil {
+		return nil, err
+	}
+	return plainText, nil
+}
 
-	sharedKey := sha512.Sum512(btcec.GenerateSharedSecret(randPrivKey, remotePubKey))
+// newAESGCMCodec derives the keys of the two directions from the shared secret of the session keys,
+// the initiator sends with the initiator key and the responder sends with the responder key
+func newAESGCMCodec(remotePubKey *btcec.PublicKey, randPrivKey *btcec.PrivateKey, initiator bool) (*aesgcmCodec, error) {
+	sharedSecret := btcec.GenerateSharedSecret(randPrivKey, remotePubKey)
 
-	block, err := aes.NewCipher(sharedKey[:32])
+	initiatorDirection, err := newCodecDirection(deriveKey(sharedSecret, initiatorKeyInfo))
 	if err != nil {
 		return nil, err
 	}
-	aesgcm, err := cipher.NewGCM(block)
+	responderDirection, err := newCodecDirection(deriveKey(sharedSecret, responderKeyInfo))
 	if err != nil {
 		return nil, err
 	}
 
+	if initiator {
+		return &aesgcmCodec{
+			send: initiatorDirection,
+			recv: responderDirection,
+		}, nil
+	}
 	return &aesgcmCodec{
-		aead:  aesgcm,
-		nonce: sharedKey[32 : 32+12],
+		send: responderDirection,
+		recv: initiatorDirection,
 	}, nil
 }
 
+func newCodecDirection(key []byte) (*codecDirection, error) {
+	d := &codecDirection{
+		rekeyMessages: rekeyMessages,
+		rekeyBytes:    rekeyBytes,
+	}
+	if err := d.setKey(key); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *codecDirection) setKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	d.aead = aesgcm
+	d.key = key
+	d.messages = 0
+	d.bytes = 0
+	return nil
+}
+
+// nonce is the sequence padded to the nonce size
+func (d *codecDirection) nonce() []byte {
+	result := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(result[nonceSize-sequenceSize:], d.sequence)
+	return result
+}
+
+// next counts the handled message and rekeys the direction if it reaches the limits,
+// both sides count the same messages so that they rekey at the same sequence
+func (d *codecDirection) next(plainTextLen int) error {
+	d.sequence++
+	d.messages++
+	d.bytes += uint64(plainTextLen)
+
+	if d.messages >= d.rekeyMessages || d.bytes >= d.rekeyBytes {
+		return d.setKey(deriveKey(d.key, rekeyInfo))
+	}
+	return nil
+}
+
+func deriveKey(secret []byte, info []byte) []byte {
+	result := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, secret, nil, info), result)
+	return result
+}
+
 func xor(one, other []byte) (xor []byte) {
 	xor = make([]byte, len(one))
 	for i := 0; i < len(one); i++ {
@@ -0,0 +1,144 @@
+package p2p
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+func newCodecPair(t *testing.T) (*aesgcmCodec, *aesgcmCodec) {
+	initiatorKey, _ := btcec.NewPrivateKey(btcec.S256())
+	responderKey, _ := btcec.NewPrivateKey(btcec.S256())
+
+	initiator, err := newAESGCMCodec(responderKey.PubKey(), initiatorKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, err := newAESGCMCodec(initiatorKey.PubKey(), responderKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return initiator, responder
+}
+
+func TestCodecNonce(t *testing.T) {
+	initiator, responder := newCodecPair(t)
+	plainText := []byte("the same message")
+
+	first, _ := initiator.encrypt(plainText)
+	second, _ := initiator.encrypt(plainText)
+	if bytes.Equal(first[sequenceSize:], second[sequenceSize:]) {
+		t.Fatal("expect the same message encrypted differently")
+	}
+
+	// the directions use different keys
+	reflected, _ := responder.encrypt(plainText)
+	if bytes.Equal(first[sequenceSize:], reflected[sequenceSize:]) {
+		t.Fatal("expect the directions encrypt differently")
+	}
+	if _, err := initiator.decrypt(first); err == nil {
+		t.Fatal("expect the reflected message rejected")
+	}
+}
+
+func TestCodecSequence(t *testing.T) {
+	initiator, responder := newCodecPair(t)
+
+	var messages [][]byte
+	for i := 0; i < 3; i++ {
+		m, err := initiator.encrypt([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+
+	plainText, err := responder.decrypt(messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("first message", []byte{0}, plainText); err != nil {
+		t.Fatal(err)
+	}
+
+	// replayed
+	if _, err := responder.decrypt(messages[0]); err == nil {
+		t.Fatal("expect the replayed message rejected")
+	} else if _, ok := err.(ErrCodecSequenceMismatch); !ok {
+		t.Fatalf("expect sequence mismatch, but %v", err)
+	}
+
+	// reordered
+	if _, err := responder.decrypt(messages[2]); err == nil {
+		t.Fatal("expect the reordered message rejected")
+	}
+
+	// the forged sequence
+	forged := append([]byte{}, messages[2]...)
+	copy(forged, messages[1][:sequenceSize])
+	if _, err := responder.decrypt(forged); err == nil {
+		t.Fatal("expect the forged sequence rejected")
+	}
+
+	if _, err := responder.decrypt(messages[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := responder.decrypt(messages[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := responder.decrypt([]byte{1}); err != ErrCodecBrokenMessage {
+		t.Fatalf("expect broken message, but %v", err)
+	}
+}
+
+func TestCodecRekey(t *testing.T) {
+	initiator, responder := newCodecPair(t)
+	initiator.send.rekeyMessages = 3
+	responder.recv.rekeyMessages = 3
+	initiator.send.rekeyBytes = 100
+	responder.recv.rekeyBytes = 100
+
+	firstKey := initiator.send.key
+	check := func(plainText []byte) {
+		cipherText, err := initiator.encrypt(plainText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := responder.decrypt(cipherText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := utils.TCheckBytes("plain text", plainText, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rekeyed by the messages
+	for i := 0; i < 3; i++ {
+		check([]byte("message"))
+	}
+	if bytes.Equal(firstKey, initiator.send.key) {
+		t.Fatal("expect rekeyed after 3 messages")
+	}
+	if !bytes.Equal(initiator.send.key, responder.recv.key) {
+		t.Fatal("expect both sides rekeyed")
+	}
+
+	// rekeyed by the bytes
+	secondKey := initiator.send.key
+	check(make([]byte, 100))
+	if bytes.Equal(secondKey, initiator.send.key) {
+		t.Fatal("expect rekeyed after 100 bytes")
+	}
+	if err := utils.TCheckUint64("sequence", 4, responder.recv.sequence); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other direction is untouched
+	if bytes.Equal(responder.send.key, initiator.send.key) {
+		t.Fatal("expect the directions have different keys")
+	}
+	check([]byte("after rekeyed"))
+}
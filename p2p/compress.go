@@ -0,0 +1,140 @@
+package p2p
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/handshake"
+)
+
+const (
+	// the messages smaller than it are sent raw, the saving doesn't pay for the CPU
+	minCompressSize = 256
+
+	// the decompressed message larger than it is refused to guard against the decompression bombs,
+	// the largest message is the sync response of 16 blocks
+	maxDecompressedSize = 32 * params.BlockSize
+)
+
+// the first byte of the message tells how the rest is compressed
+const (
+	frameRaw   = uint8(0)
+	frameFlate = params.CompressionDeflate
+)
+
+// supportedCompressions are the compression algorithms advertised in the handshake in the preferred order
+var supportedCompressions = []params.Compression{params.CompressionDeflate}
+
+// negotiateCompression decides the algorithm from the extensions both sides signed in the handshake,
+// the first algorithm of the request which the response also lists, 0 if any side doesn't support it
+func negotiateCompression(reqExt, respExt *handshake.Extension) params.Compression {
+	if !advertiseCompression(reqExt) || !advertiseCompression(respExt) {
+		return 0
+	}
+
+	for _, c := range reqExt.Compressions {
+		for _, rc := range respExt.Compressions {
+			if c == rc && isSupportedCompression(c) {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func advertiseCompression(ext *handshake.Extension) bool {
+	return ext != nil && ext.Capabilities&params.CapCompression != 0
+}
+
+func isSupportedCompression(c params.Compression) bool {
+	for _, sc := range supportedCompressions {
+		if c == sc {
+			return true
+		}
+	}
+	return false
+}
+
+var flateWriterPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// implement of 'codec'
+// compressCodec compresses the message with DEFLATE before it's encrypted,
+// it's used only if DEFLATE is negotiated from the extensions both sides signed in the handshake
+//
+//	| frame flag (1 byte) | raw or compressed message |
+type compressCodec struct {
+	ec codec
+}
+
+func newCompressCodec(ec codec) *compressCodec {
+	return &compressCodec{ec: ec}
+}
+
+func (c *compressCodec) encrypt(plainText []byte) ([]byte, error) {
+	return c.ec.encrypt(compressFrame(plainText))
+}
+
+func (c *compressCodec) decrypt(cipherText []byte) ([]byte, error) {
+	frame, err := c.ec.decrypt(cipherText)
+	if err != nil {
+		return nil, err
+	}
+	return decompressFrame(frame)
+}
+
+// compressFrame sends the message raw if it's small or incompressible
+func compressFrame(data []byte) []byte {
+	if len(data) >= minCompressSize {
+		buf := new(bytes.Buffer)
+		buf.WriteByte(frameFlate)
+
+		w := flateWriterPool.Get().(*flate.Writer)
+		w.Reset(buf)
+		w.Write(data)
+		w.Close()
+		flateWriterPool.Put(w)
+
+		if buf.Len() < len(data)+1 {
+			return buf.Bytes()
+		}
+	}
+
+	result := make([]byte, 0, len(data)+1)
+	result = append(result, frameRaw)
+	return append(result, data...)
+}
+
+func decompressFrame(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("empty frame")
+	}
+
+	switch frame[0] {
+	case frameRaw:
+		return frame[1:], nil
+	case frameFlate:
+		r := flate.NewReader(bytes.NewReader(frame[1:]))
+		defer r.Close()
+
+		data, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("decompress failed:%v", err)
+		}
+		if len(data) > maxDecompressedSize {
+			return nil, fmt.Errorf("decompressed size exceeds %d", maxDecompressedSize)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown frame flag %d", frame[0])
+	}
+}
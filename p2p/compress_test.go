@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/handshake"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestCompressCodec(t *testing.T) {
+	initiator, responder := newCodecPair(t)
+	sender := newCompressCodec(initiator)
+	receiver := newCompressCodec(responder)
+
+	compressible := bytes.Repeat([]byte("the evidences share public keys"), 64)
+	incompressible := make([]byte, 1024)
+	rand.Read(incompressible)
+	small := []byte("ping")
+
+	for _, plainText := range [][]byte{compressible, incompressible, small} {
+		cipherText, err := sender.encrypt(plainText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := receiver.decrypt(cipherText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := utils.TCheckBytes("plain text", plainText, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if frame := compressFrame(compressible); frame[0] != frameFlate || len(frame) >= len(compressible) {
+		t.Fatal("expect the message compressed")
+	}
+	if frame := compressFrame(incompressible); frame[0] != frameRaw {
+		t.Fatal("expect the incompressible message sent raw")
+	}
+	if frame := compressFrame(small); frame[0] != frameRaw {
+		t.Fatal("expect the small message sent raw")
+	}
+}
+
+func TestDecompressBomb(t *testing.T) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(frameFlate)
+	w, _ := flate.NewWriter(buf, flate.BestCompression)
+	w.Write(make([]byte, maxDecompressedSize+1))
+	w.Close()
+
+	if _, err := decompressFrame(buf.Bytes()); err == nil {
+		t.Fatal("expect the oversize message refused")
+	}
+
+	if _, err := decompressFrame([]byte{frameFlate + 1, 0}); err == nil {
+		t.Fatal("expect the unknown frame flag refused")
+	}
+	if _, err := decompressFrame(nil); err == nil {
+		t.Fatal("expect the empty frame refused")
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	deflate := params.CompressionDeflate
+	unknown := params.CompressionDeflate + 1
+	genExt := func(caps params.Capability, compressions ...params.Compression) *handshake.Extension {
+		return handshake.NewExtension(caps, 0, nil, 0, compressions)
+	}
+
+	cases := []struct {
+		req    *handshake.Extension
+		resp   *handshake.Extension
+		expect params.Compression
+	}{
+		{nil, genExt(params.CapCompression, deflate), 0},
+		{genExt(params.CapCompression, deflate), nil, 0},
+		{genExt(params.CapCompression, deflate), genExt(0, deflate), 0},
+		{genExt(params.CapCompression, deflate), genExt(params.CapCompression), 0},
+		{genExt(params.CapCompression, unknown), genExt(params.CapCompression, unknown), 0},
+		{genExt(params.CapCompression, unknown, deflate), genExt(params.CapCompression, deflate, unknown), deflate},
+	}
+
+	for i, cs := range cases {
+		if err := utils.TCheckUint8(fmt.Sprintf("[%d] compression", i), cs.expect,
+			negotiateCompression(cs.req, cs.resp)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package p2p
 
 import (
+	"sync"
+	"time"
+
 	"github.com/996BC/996.Blockchain/p2p/peer"
 	"github.com/996BC/996.Blockchain/utils"
 )
@@ -10,19 +13,29 @@ type recvHandler = func(peer string, protocolID uint8, data []byte)
 type conn struct {
 	node    *Node
 	p       *peer.Peer
+	info    *PeerInfo
 	conn    utils.TCPConn
 	ec      codec
 	handler recvHandler
 	lm      *utils.LoopMode
+
+	inbound bool      // connected by the remote peer
+	since   time.Time // the time connected
+
+	// the messages are sent in the order of their sequences
+	sendLock sync.Mutex
 }
 
-func newConn(p *peer.Peer, nc utils.TCPConn, ec codec, handler recvHandler) *conn {
+func newConn(p *peer.Peer, info *PeerInfo, nc utils.TCPConn, ec codec, handler recvHandler, inbound bool) *conn {
 	c := &conn{
 		p:       p,
+		info:    info,
 		conn:    nc,
 		ec:      ec,
 		handler: handler,
 		lm:      utils.NewLoop(1),
+		inbound: inbound,
+		since:   time.Now(),
 	}
 
 	return c
@@ -60,7 +73,7 @@ func (c *conn) loop() {
 
 			plaintext, err := c.ec.decrypt(payload)
 			if err != nil {
-				logger.Warnln("decrypt packet failed, close connection")
+				logger.Warn("decrypt packet failed, close connection:%v\n", err)
 				go c.stop()
 				break
 			}
@@ -70,6 +83,9 @@ func (c *conn) loop() {
 }
 
 func (c *conn) send(protocolID uint8, data []byte) {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+
 	cipherText, err := c.ec.encrypt(data)
 	if err != nil {
 		logger.Warn("encrypt payload failed, close connection")
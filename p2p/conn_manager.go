@@ -3,39 +3,67 @@ package p2p
 import (
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 
 	"github.com/996BC/996.Blockchain/p2p/peer"
 	"github.com/996BC/996.Blockchain/utils"
 )
 
+const (
+	// the outbound peers must be from different address groups
+	maxOutboundPerGroup = 1
+
+	// evicting an inbound peer protects the longest connected peers
+	// and the peers of the least crowded address groups
+	protectedByAge   = 4
+	protectedByGroup = 4
+)
+
 // connManager manages all the conn
 type connManager interface {
 	start()
 	stop()
 	size() int
+	outboundSize() int
 	getIDs() []string
 	isExist(peerID string) bool
 	send(p Protocol, dp *PeerData) error
-	add(peer *peer.Peer, conn utils.TCPConn, ec codec, handler recvHandler) error
+
+	// add adds the conn, the inbound conn might evict another inbound conn if it's full
+	add(peer *peer.Peer, info *PeerInfo, conn utils.TCPConn, ec codec, handler recvHandler, inbound bool) error
+	disconnect(peerID string)
+	// getPeerInfo returns nil if the peer isn't connected
+	getPeerInfo(peerID string) *PeerInfo
+
+	// canAccept returns true if there is room for an inbound conn, or any inbound conn can be evicted
+	canAccept() bool
+	// hasOutboundGroup returns true if the address group can't have more outbound conns
+	hasOutboundGroup(group string) bool
+	// getAnchors returns the longest connected outbound peers
+	getAnchors(num int) []*peer.Peer
 	String() string
 }
 
-func newConnManager(maxPeerNum int) connManager {
+// newConnManager creates the connManager with at most maxPeerNum conns,
+// maxOutbound of them are connected by us and the others are connected by the remote peers
+func newConnManager(maxPeerNum int, maxOutbound int) connManager {
 	return &connManagerImp{
-		conns:      make(map[string]*conn),
-		maxPeerNum: maxPeerNum,
-		removing:   make(chan string, maxPeerNum),
-		lm:         utils.NewLoop(1),
+		conns:       make(map[string]*conn),
+		maxPeerNum:  maxPeerNum,
+		maxOutbound: maxOutbound,
+		removing:    make(chan *conn, maxPeerNum),
+		lm:          utils.NewLoop(1),
 	}
 }
 
 type connManagerImp struct {
-	mutex      sync.Mutex
-	conns      map[string]*conn //<peer ID, conn>
-	maxPeerNum int
-	removing   chan string
-	lm         *utils.LoopMode
+	mutex       sync.Mutex
+	conns       map[string]*conn //<peer ID, conn>
+	maxPeerNum  int
+	maxOutbound int
+	removing    chan *conn
+	lm          *utils.LoopMode
 }
 
 func (c *connManagerImp) start() {
@@ -61,6 +89,13 @@ func (c *connManagerImp) size() int {
 	return len(c.conns)
 }
 
+func (c *connManagerImp) outboundSize() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.count(false)
+}
+
 func (c *connManagerImp) getIDs() []string {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -107,7 +142,8 @@ func (c *connManagerImp) send(p Protocol, dp *PeerData) error {
 	return nil
 }
 
-func (c *connManagerImp) add(peer *peer.Peer, conn utils.TCPConn, ec codec, handler recvHandler) error {
+func (c *connManagerImp) add(peer *peer.Peer, info *PeerInfo, conn utils.TCPConn, ec codec,
+	handler recvHandler, inbound bool) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -115,22 +151,90 @@ func (c *connManagerImp) add(peer *peer.Peer, conn utils.TCPConn, ec codec, hand
 		return fmt.Errorf("already exist a connection with %s", peer.ID)
 	}
 
-	if len(c.conns) >= c.maxPeerNum {
-		return fmt.Errorf("over max peer(%d) limits", len(c.conns))
+	if inbound {
+		if c.count(true) >= c.maxPeerNum-c.maxOutbound {
+			evicted := c.selectEviction()
+			if evicted == nil {
+				return fmt.Errorf("over max inbound peer(%d) limits", c.maxPeerNum-c.maxOutbound)
+			}
+			logger.Debug("evict peer %v for %v\n", evicted.p, peer)
+			delete(c.conns, evicted.p.ID)
+			go evicted.stop()
+		}
+	} else {
+		if c.count(false) >= c.maxOutbound {
+			return fmt.Errorf("over max outbound peer(%d) limits", c.maxOutbound)
+		}
+		if group := peer.Group(); c.groupOutbound(group) >= maxOutboundPerGroup {
+			return fmt.Errorf("over max outbound peer limits of the address group %s", group)
+		}
 	}
 
-	connection := newConn(peer, conn, ec, handler)
+	connection := newConn(peer, info, conn, ec, handler, inbound)
 	c.conns[peer.ID] = connection
 	conn.SetDisconnectCb(func(addr net.Addr) {
 		logger.Debug("disconnect peer %v, address %v\n", peer.ID, addr)
-		c.removeConn(peer.ID)
+		c.removeConn(connection)
 	})
 	connection.start()
 
-	logger.Debug("add conn of %v\n", peer)
+	logger.Debug("add conn of %v, inbound %v\n", peer, inbound)
+	return nil
+}
+
+func (c *connManagerImp) disconnect(peerID string) {
+	c.mutex.Lock()
+	conn, ok := c.conns[peerID]
+	c.mutex.Unlock()
+
+	if ok {
+		// the disconnect callback will remove it from conns
+		conn.stop()
+	}
+}
+
+func (c *connManagerImp) getPeerInfo(peerID string) *PeerInfo {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if conn, ok := c.conns[peerID]; ok {
+		return conn.info
+	}
 	return nil
 }
 
+func (c *connManagerImp) canAccept() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.count(true) < c.maxPeerNum-c.maxOutbound || c.selectEviction() != nil
+}
+
+func (c *connManagerImp) hasOutboundGroup(group string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.groupOutbound(group) >= maxOutboundPerGroup
+}
+
+func (c *connManagerImp) getAnchors(num int) []*peer.Peer {
+	c.mutex.Lock()
+	var outbound []*conn
+	for _, conn := range c.conns {
+		if !conn.inbound {
+			outbound = append(outbound, conn)
+		}
+	}
+	c.mutex.Unlock()
+
+	sortByAge(outbound)
+	var result []*peer.Peer
+	for i := 0; i < len(outbound) && i < num; i++ {
+		result = append(result, outbound[i].p)
+	}
+	return result
+}
+
 func (c *connManagerImp) String() string {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -150,14 +254,103 @@ func (c *connManagerImp) loop() {
 		select {
 		case <-c.lm.D:
 			return
-		case rmID := <-c.removing:
+		case rm := <-c.removing:
 			c.mutex.Lock()
-			delete(c.conns, rmID)
+			// the peer may have connected again after the conn was evicted or disconnected
+			if c.conns[rm.p.ID] == rm {
+				delete(c.conns, rm.p.ID)
+			}
 			c.mutex.Unlock()
 		}
 	}
 }
 
-func (c *connManagerImp) removeConn(peerID string) {
-	c.removing <- peerID
+func (c *connManagerImp) removeConn(connection *conn) {
+	c.removing <- connection
+}
+
+// count helper(should call with lock)
+func (c *connManagerImp) count(inbound bool) int {
+	result := 0
+	for _, conn := range c.conns {
+		if conn.inbound == inbound {
+			result++
+		}
+	}
+	return result
+}
+
+// groupOutbound helper(should call with lock), the local addresses are not limited
+func (c *connManagerImp) groupOutbound(group string) int {
+	if len(group) == 0 {
+		return 0
+	}
+
+	result := 0
+	for _, conn := range c.conns {
+		if !conn.inbound && conn.p.Group() == group {
+			result++
+		}
+	}
+	return result
+}
+
+// selectEviction helper(should call with lock)
+func (c *connManagerImp) selectEviction() *conn {
+	var inbound []*conn
+	for _, conn := range c.conns {
+		if conn.inbound {
+			inbound = append(inbound, conn)
+		}
+	}
+	return selectEviction(inbound)
+}
+
+// selectEviction returns the inbound conn to make room for a new one, or nil if all of them are protected;
+// after protecting the longest connected peers and the peers of the least crowded groups,
+// the latest connected peer of the most crowded group is evicted, it costs an attacker
+// both many address groups and a long time to take the places of the honest peers
+func selectEviction(inbound []*conn) *conn {
+	candidates := append([]*conn{}, inbound...)
+	sortByAge(candidates)
+	if len(candidates) <= protectedByAge {
+		return nil
+	}
+	candidates = candidates[protectedByAge:]
+
+	var groups []string
+	buckets := make(map[string][]*conn)
+	for _, conn := range candidates {
+		group := conn.p.GroupKey()
+		if _, ok := buckets[group]; !ok {
+			groups = append(groups, group)
+		}
+		buckets[group] = append(buckets[group], conn)
+	}
+
+	// protect the longest connected peer of the least crowded groups
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(buckets[groups[i]]) < len(buckets[groups[j]])
+	})
+	for i := 0; i < len(groups) && i < protectedByGroup; i++ {
+		buckets[groups[i]] = buckets[groups[i]][1:]
+	}
+
+	var evicted []*conn
+	for _, group := range groups {
+		if len(buckets[group]) > len(evicted) {
+			evicted = buckets[group]
+		}
+	}
+	if len(evicted) == 0 {
+		return nil
+	}
+	return evicted[len(evicted)-1]
+}
+
+// sortByAge sorts the conns from the longest connected
+func sortByAge(conns []*conn) {
+	sort.SliceStable(conns, func(i, j int) bool {
+		return conns[i].since.Before(conns[j].since)
+	})
 }
@@ -0,0 +1,147 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/996BC/996.Blockchain/p2p/peer"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func newConnForTest(id string, ip string, inbound bool, since time.Time) *conn {
+	p := &peer.Peer{ID: id, IP: net.ParseIP(ip), Port: 10000}
+	c := newConn(p, nil, newTCPConnMock(), nil, nil, inbound)
+	c.since = since
+	return c
+}
+
+func TestSelectEviction(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	var inbound []*conn
+	for i := 0; i < protectedByAge; i++ {
+		inbound = append(inbound, newConnForTest(fmt.Sprintf("Old_%d", i), "5.5.5.5", true, base))
+	}
+	if selectEviction(inbound) != nil {
+		t.Fatal("expect the longest connected peers protected")
+	}
+
+	inbound = append(inbound,
+		newConnForTest("Group_A_1", "1.1.0.1", true, base.Add(1*time.Minute)),
+		newConnForTest("Group_A_2", "1.1.0.2", true, base.Add(2*time.Minute)),
+		newConnForTest("Group_A_3", "1.1.0.3", true, base.Add(3*time.Minute)),
+		newConnForTest("Group_B_1", "2.2.0.1", true, base.Add(4*time.Minute)),
+		newConnForTest("Group_B_2", "2.2.0.2", true, base.Add(5*time.Minute)),
+		newConnForTest("Group_C_1", "3.3.0.1", true, base.Add(6*time.Minute)),
+	)
+
+	// the latest of the most crowded group, though Group_C_1 is the latest one
+	evicted := selectEviction(inbound)
+	if evicted == nil {
+		t.Fatal("expect an evicted peer")
+	}
+	if err := utils.TCheckString("evicted peer", "Group_A_3", evicted.p.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the only peer of a group is protected
+	inbound = append(inbound[:protectedByAge], newConnForTest("Group_D_1", "4.4.0.1", true, base))
+	if selectEviction(inbound) != nil {
+		t.Fatal("expect the peer of the least crowded group protected")
+	}
+}
+
+func TestConnManagerLimits(t *testing.T) {
+	c := newConnManager(protectedByAge+4, 2).(*connManagerImp)
+
+	// outbound
+	if err := c.add(&peer.Peer{ID: "Out_A", IP: net.ParseIP("8.8.0.1")}, nil, newTCPConnMock(), nil, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.add(&peer.Peer{ID: "Out_B", IP: net.ParseIP("8.8.0.2")}, nil, newTCPConnMock(), nil, nil, false); err == nil {
+		t.Fatal("expect one outbound peer for each group")
+	}
+	if !c.hasOutboundGroup("8.8") || c.hasOutboundGroup("9.9") {
+		t.Fatal("expect the group of Out_A full")
+	}
+	if err := c.add(&peer.Peer{ID: "Out_C", IP: net.ParseIP("9.9.0.1")}, nil, newTCPConnMock(), nil, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.add(&peer.Peer{ID: "Out_D", IP: net.ParseIP("7.7.0.1")}, nil, newTCPConnMock(), nil, nil, false); err == nil {
+		t.Fatal("expect over the outbound limits")
+	}
+	if err := utils.TCheckInt("outbound size", 2, c.outboundSize()); err != nil {
+		t.Fatal(err)
+	}
+
+	// inbound, the outbound places are not taken
+	for i := 0; i < protectedByAge+2; i++ {
+		p := &peer.Peer{ID: fmt.Sprintf("In_%d", i), IP: net.ParseIP("1.1.0.1")}
+		if err := c.add(p, nil, newTCPConnMock(), nil, nil, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := utils.TCheckInt("size", protectedByAge+4, c.size()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the latest one of the group is evicted for the new one
+	if !c.canAccept() {
+		t.Fatal("expect accepting by eviction")
+	}
+	last := c.conns[fmt.Sprintf("In_%d", protectedByAge+1)]
+	last.since = time.Now().Add(time.Second)
+	if err := c.add(&peer.Peer{ID: "In_New", IP: net.ParseIP("2.2.0.1")}, nil, newTCPConnMock(), nil, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if c.isExist(last.p.ID) || !c.isExist("In_New") {
+		t.Fatal("expect the latest inbound peer evicted")
+	}
+	if c.canAccept() {
+		t.Fatal("expect all the inbound peers protected")
+	}
+}
+
+func TestRemoveConn(t *testing.T) {
+	c := newConnManager(8, 4).(*connManagerImp)
+	evicted := newConnForTest("Peer_A", "1.1.0.1", true, time.Now())
+	reconnected := newConnForTest("Peer_A", "1.1.0.1", true, time.Now())
+	other := newConnForTest("Peer_B", "2.2.0.1", true, time.Now())
+	c.conns["Peer_A"] = reconnected
+	c.conns["Peer_B"] = other
+	c.start()
+	defer c.stop()
+
+	// the disconnect callback of the evicted conn comes after the peer connected again
+	c.removeConn(evicted)
+	c.removeConn(other)
+	for i := 0; c.isExist("Peer_B"); i++ {
+		if i > 100 {
+			t.Fatal("expect the conn of Peer_B removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !c.isExist("Peer_A") {
+		t.Fatal("expect the reconnected conn kept")
+	}
+}
+
+func TestGetAnchors(t *testing.T) {
+	c := newConnManager(8, 4).(*connManagerImp)
+	base := time.Now()
+	for i, id := range []string{"Out_A", "Out_B", "Out_C"} {
+		c.conns[id] = newConnForTest(id, fmt.Sprintf("8.%d.0.1", i), false, base.Add(-time.Duration(i)*time.Hour))
+	}
+	c.conns["In_A"] = newConnForTest("In_A", "9.9.0.1", true, base.Add(-10*time.Hour))
+
+	anchors := c.getAnchors(2)
+	if err := utils.TCheckInt("anchors", 2, len(anchors)); err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"Out_C", "Out_B"} {
+		if err := utils.TCheckString("the longest connected outbound", id, anchors[i].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
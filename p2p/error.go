@@ -17,6 +17,9 @@ var ErrNegotiateNodeTypeMismatch = errors.New("node type mismatch: 1. the light
 
 var ErrNegotiateTimeout = errors.New("timeout")
 
+// ErrNegotiateMissingExtension means the peer doesn't send the extension required by params.CapCompression
+var ErrNegotiateMissingExtension = errors.New("missing handshake extension")
+
 type ErrNegotiateCodeVersionMismatch struct {
 	minimizeVersionRequired params.CodeVersion
 	remoteVersion           params.CodeVersion
@@ -27,6 +30,15 @@ func (n ErrNegotiateCodeVersionMismatch) Error() string {
 		n.minimizeVersionRequired, n.remoteVersion)
 }
 
+type ErrNegotiateHandshakeVersionMismatch struct {
+	expect uint8
+	remote uint8
+}
+
+func (n ErrNegotiateHandshakeVersionMismatch) Error() string {
+	return fmt.Sprintf("handshake version mismatch, expect %d, got %d", n.expect, n.remote)
+}
+
 type ErrNegotiateBrokenData struct {
 	info string
 }
@@ -34,3 +46,15 @@ type ErrNegotiateBrokenData struct {
 func (n ErrNegotiateBrokenData) Error() string {
 	return n.info
 }
+
+var ErrCodecBrokenMessage = errors.New("broken message")
+
+// ErrCodecSequenceMismatch means the message is replayed, reordered or lost
+type ErrCodecSequenceMismatch struct {
+	expect uint64
+	remote uint64
+}
+
+func (c ErrCodecSequenceMismatch) Error() string {
+	return fmt.Sprintf("message sequence mismatch, expect %d, got %d", c.expect, c.remote)
+}
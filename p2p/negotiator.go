@@ -3,6 +3,8 @@ package p2p
 import (
 	"bytes"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/996BC/996.Blockchain/p2p/peer"
@@ -23,8 +25,13 @@ receiver:
 	5. reply
 final:
 	1. get shared secret P from two temporary key
-	2. sha512(P), use first 32 bytes as secret key and rest 12 bytes as nonce
-	3. use AES-GCM-256 to encrypt/decrypt following message
+	2. HKDF-SHA256(P) derives the keys of the sender to receiver and the receiver to sender directions
+	3. use AES-GCM-256 with the message sequence of each direction as the nonce to encrypt/decrypt
+	   following message, the key is derived again after 2^20 messages or 1GB in the direction
+
+both sides require handshake version 2, the peers of version 1 reuse a nonce and are refused;
+the request and the accept response carry the extension of the capabilities, the best height and
+the listen address, the peers without it are treated as having no capabilities
 */
 
 const (
@@ -33,8 +40,8 @@ const (
 )
 
 type negotiator interface {
-	handshakeTo(conn utils.TCPConn, peer *peer.Peer) (codec, error)
-	recvHandshake(conn utils.TCPConn, accept bool) (*peer.Peer, codec, error)
+	handshakeTo(conn utils.TCPConn, peer *peer.Peer) (*PeerInfo, codec, error)
+	recvHandshake(conn utils.TCPConn, accept bool) (*peer.Peer, *PeerInfo, codec, error)
 }
 
 type negotiatorImp struct {
@@ -45,9 +52,11 @@ type negotiatorImp struct {
 	codeVersion             params.CodeVersion
 	minimizeVersionRequired params.CodeVersion
 	genSessionKeyFunc       func() (*btcec.PrivateKey, error) // for test stub
+	genExtFunc              func() *handshake.Extension       // the extension isn't sent if it's nil
 }
 
-func newNegotiator(privKey *btcec.PrivateKey, chainID uint8, nodeType params.NodeType) negotiator {
+func newNegotiator(privKey *btcec.PrivateKey, chainID uint8, nodeType params.NodeType,
+	genExtFunc func() *handshake.Extension) negotiator {
 	result := &negotiatorImp{
 		privKey:                 privKey,
 		chainID:                 chainID,
@@ -55,53 +64,66 @@ func newNegotiator(privKey *btcec.PrivateKey, chainID uint8, nodeType params.Nod
 		codeVersion:             params.CurrentCodeVersion,
 		minimizeVersionRequired: params.MinimizeVersionRequired,
 		genSessionKeyFunc:       genSessionKeyFunc,
+		genExtFunc:              genExtFunc,
 	}
 	result.pubKey = privKey.PubKey()
 	return result
 }
 
-func (n *negotiatorImp) handshakeTo(conn utils.TCPConn, peer *peer.Peer) (codec, error) {
+func (n *negotiatorImp) handshakeTo(conn utils.TCPConn, peer *peer.Peer) (*PeerInfo, codec, error) {
 	// session temporary key, temporary nonce
 	sessionPrivKey, err := n.genSessionKeyFunc()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// send handshake request
-	requestBytes := n.genRequest(sessionPrivKey, peer.Key)
+	ext := n.genExtension()
+	requestBytes := n.genRequest(sessionPrivKey, peer.Key, ext)
 	conn.Send(requestBytes)
 
 	// wait handshake response
 	response, err := n.waitResponse(conn, sessionPrivKey)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if err := n.whetherRejectResp(response, peer.Key); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if err := requireExtension(ext, response.Ext); err != nil {
+		return nil, nil, err
 	}
 
 	peerSessionKey, err := btcec.ParsePubKey(response.SessionKey, btcec.S256())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	ec, err := newAESGCMCodec(peerSessionKey, sessionPrivKey, true)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return newAESGCMCodec(peerSessionKey, sessionPrivKey)
+	info := newPeerInfo(response.CodeVersion, response.NodeType, response.Ext, conn)
+	info.Compression = negotiateCompression(ext, response.Ext)
+	return info, ec, nil
 }
 
-func (n *negotiatorImp) recvHandshake(conn utils.TCPConn, accept bool) (*peer.Peer, codec, error) {
+func (n *negotiatorImp) recvHandshake(conn utils.TCPConn, accept bool) (*peer.Peer, *PeerInfo, codec, error) {
 	request, err := n.waitRequest(conn)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if !request.Verify() {
-		return nil, nil, ErrNegotiateInvalidSig
+		return nil, nil, nil, ErrNegotiateInvalidSig
 	}
 
 	peerSessionKey, err := btcec.ParsePubKey(request.SessionKey, btcec.S256())
 	if err != nil {
-		return nil, nil, ErrNegotiateBrokenData{
+		return nil, nil, nil, ErrNegotiateBrokenData{
 			info: fmt.Sprintf("parse handshake session public key failed:%v", err),
 		}
 	}
@@ -110,34 +132,41 @@ func (n *negotiatorImp) recvHandshake(conn utils.TCPConn, accept bool) (*peer.Pe
 	if !accept {
 		rejectRsp := n.genRejectResponse()
 		conn.Send(rejectRsp)
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
 
 	if err := n.whetherRejectReq(request); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	ext := n.genExtension()
+	if err := requireExtension(ext, request.Ext); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// accept
 	// session temporary key, temporary nonce
 	sessionPrivKey, err := n.genSessionKeyFunc()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	acceptRsp := n.genAcceptResponse(sessionPrivKey)
+	acceptRsp := n.genAcceptResponse(sessionPrivKey, ext)
 	conn.Send(acceptRsp)
 
-	ec, err := newAESGCMCodec(peerSessionKey, sessionPrivKey)
+	ec, err := newAESGCMCodec(peerSessionKey, sessionPrivKey, false)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	peer, err := n.getPeerFromRequest(conn, request)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	return peer, ec, nil
+	info := newPeerInfo(request.CodeVersion, request.NodeType, request.Ext, conn)
+	info.Compression = negotiateCompression(request.Ext, ext)
+	return peer, info, ec, nil
 }
 
 func (n *negotiatorImp) waitResponse(conn utils.TCPConn, sessionPrivKey *btcec.PrivateKey) (*handshake.Response, error) {
@@ -172,33 +201,42 @@ func (n *negotiatorImp) waitRequest(conn utils.TCPConn) (*handshake.Request, err
 }
 
 func (n *negotiatorImp) genRequest(sessionPrivKey *btcec.PrivateKey,
-	peerKey *btcec.PublicKey) []byte {
+	peerKey *btcec.PublicKey, ext *handshake.Extension) []byte {
 
 	sessionPubKey := sessionPrivKey.PubKey()
 	sessionPubKeyBytes := sessionPubKey.SerializeCompressed()
 
-	req := handshake.NewRequestV1(n.chainID, n.codeVersion, n.nodeType,
+	req := handshake.NewRequestV2(n.chainID, n.codeVersion, n.nodeType,
 		n.pubKey.SerializeCompressed(), sessionPubKeyBytes)
+	req.Ext = ext
 	req.Sign(n.privKey)
 
 	return buildTCPPacket(req.Marshal(), handshakeProtocolID)
 }
 
 func (n *negotiatorImp) genRejectResponse() []byte {
-	resp := handshake.NewRejectResponseV1()
+	resp := handshake.NewRejectResponseV2()
 	resp.Sign(n.privKey)
 
 	return buildTCPPacket(resp.Marshal(), handshakeProtocolID)
 }
 
-func (n *negotiatorImp) genAcceptResponse(sessionPrivKey *btcec.PrivateKey) []byte {
-	resp := handshake.NewAcceptResponseV1(n.codeVersion, n.nodeType,
+func (n *negotiatorImp) genAcceptResponse(sessionPrivKey *btcec.PrivateKey, ext *handshake.Extension) []byte {
+	resp := handshake.NewAcceptResponseV2(n.codeVersion, n.nodeType,
 		sessionPrivKey.PubKey().SerializeCompressed())
+	resp.Ext = ext
 	resp.Sign(n.privKey)
 
 	return buildTCPPacket(resp.Marshal(), handshakeProtocolID)
 }
 
+func (n *negotiatorImp) genExtension() *handshake.Extension {
+	if n.genExtFunc == nil {
+		return nil
+	}
+	return n.genExtFunc()
+}
+
 func (n *negotiatorImp) readPacket(conn utils.TCPConn) ([]byte, error) {
 	timeoutTicker := time.NewTicker(5 * time.Second)
 	recvC := conn.GetRecvChannel()
@@ -227,6 +265,10 @@ func (n *negotiatorImp) readPacket(conn utils.TCPConn) ([]byte, error) {
 }
 
 func (n *negotiatorImp) whetherRejectReq(request *handshake.Request) error {
+	if request.Version != handshake.HandshakeV2 {
+		return ErrNegotiateHandshakeVersionMismatch{handshake.HandshakeV2, request.Version}
+	}
+
 	if request.ChainID != n.chainID {
 		return ErrNegotiateChainIDMismatch
 	}
@@ -251,6 +293,10 @@ func (n *negotiatorImp) whetherRejectResp(response *handshake.Response, remotePu
 		return ErrNegotiateConnectionRefused
 	}
 
+	if response.Version != handshake.HandshakeV2 {
+		return ErrNegotiateHandshakeVersionMismatch{handshake.HandshakeV2, response.Version}
+	}
+
 	if response.CodeVersion < n.minimizeVersionRequired {
 		return ErrNegotiateCodeVersionMismatch{n.minimizeVersionRequired, response.CodeVersion}
 	}
@@ -262,6 +308,15 @@ func (n *negotiatorImp) whetherRejectResp(response *handshake.Response, remotePu
 	return nil
 }
 
+// requireExtension refuses the peer without the extension if the local side advertises params.CapCompression,
+// so that both sides decide the compression from the same signed extensions
+func requireExtension(local, peer *handshake.Extension) error {
+	if advertiseCompression(local) && peer == nil {
+		return ErrNegotiateMissingExtension
+	}
+	return nil
+}
+
 func (n *negotiatorImp) getPeerFromRequest(conn utils.TCPConn, request *handshake.Request) (*peer.Peer, error) {
 	peerPubKey, err := btcec.ParsePubKey(request.PubKey, btcec.S256())
 	if err != nil {
@@ -271,10 +326,38 @@ func (n *negotiatorImp) getPeerFromRequest(conn utils.TCPConn, request *handshak
 	}
 	addr := conn.RemoteAddr()
 	ip, port := utils.ParseIPPort(addr.String())
+	// the remote port of the inbound connection is a temporary one
+	if request.Ext != nil && request.Ext.ListenPort != 0 {
+		port = int(request.Ext.ListenPort)
+	}
 	peer := peer.NewPeer(ip, port, peerPubKey)
 	return peer, nil
 }
 
+// newPeerInfo takes the listen address from the extension,
+// the IP of the connection is used if the peer doesn't know its IP
+func newPeerInfo(codeVersion params.CodeVersion, nodeType params.NodeType,
+	ext *handshake.Extension, conn utils.TCPConn) *PeerInfo {
+	result := &PeerInfo{
+		CodeVersion: codeVersion,
+		NodeType:    nodeType,
+	}
+	if ext == nil {
+		return result
+	}
+
+	result.Capabilities = ext.Capabilities
+	result.BestHeight = ext.BestHeight
+	if ext.ListenPort != 0 {
+		ip := ext.ListenIP
+		if len(ip) == 0 {
+			ip, _ = utils.ParseIPPort(conn.RemoteAddr().String())
+		}
+		result.ListenAddr = net.JoinHostPort(ip.String(), strconv.Itoa(int(ext.ListenPort)))
+	}
+	return result
+}
+
 func genSessionKeyFunc() (*btcec.PrivateKey, error) {
 	sessionPrivKey, err := btcec.NewPrivateKey(btcec.S256())
 	if err != nil {
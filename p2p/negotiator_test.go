@@ -3,6 +3,7 @@ package p2p
 import (
 	"bytes"
 	"net"
+	"strconv"
 	"testing"
 
 	"github.com/996BC/996.Blockchain/p2p/peer"
@@ -23,10 +24,9 @@ var negotiatorTestVar = &struct {
 	recvSessionPrivKey *btcec.PrivateKey
 	recvSessionPubKey  *btcec.PublicKey
 
-	expectCodec codec
-
 	remoteIP   net.IP
 	remotePort int
+	listenPort int
 
 	chainID    uint8
 	errChainID uint8
@@ -51,10 +51,9 @@ func init() {
 	keyBytes, _ = utils.FromHex(recvSessionPrivKeyHex)
 	tv.recvSessionPrivKey, tv.recvSessionPubKey = btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
 
-	tv.expectCodec, _ = newAESGCMCodec(tv.recvSessionPubKey, tv.sendSessionPrivKey)
-
 	tv.remoteIP = net.ParseIP("192.168.1.2")
 	tv.remotePort = 10000
+	tv.listenPort = 20000
 
 	tv.chainID = 1
 	tv.errChainID = 2
@@ -67,12 +66,12 @@ func TestHandshakeTo(t *testing.T) {
 	conn := newTCPConnMock()
 
 	// mock accept response
-	resp := receiver.genAcceptResponse(tv.recvSessionPrivKey)
+	resp := receiver.genAcceptResponse(tv.recvSessionPrivKey, receiver.genExtension())
 	conn.setRecvPkt(resp)
 
 	// a full node handshake to another full node
 	peer := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvPubKey)
-	codec, err := sender.handshakeTo(conn, peer)
+	info, codec, err := sender.handshakeTo(conn, peer)
 	if err != nil {
 		t.Fatalf("handshakeTo err:%v\n", err)
 	}
@@ -85,8 +84,12 @@ func TestHandshakeTo(t *testing.T) {
 	}
 	checkRequest(t, req)
 
-	// check codec
-	checkCodec(t, codec, tv.expectCodec)
+	// check the receiver's info
+	checkPeerInfo(t, info, receiverGenExtFunc())
+
+	// check codec with the receiver's
+	expectCodec, _ := newAESGCMCodec(tv.sendSessionPubKey, tv.recvSessionPrivKey, false)
+	checkCodec(t, codec, expectCodec)
 }
 
 func TestRecvHandshake(t *testing.T) {
@@ -96,11 +99,11 @@ func TestRecvHandshake(t *testing.T) {
 	conn := newTCPConnMock()
 
 	// mock request
-	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey)
+	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension())
 	conn.setRecvPkt(req)
 
 	// a full node wait another full node handshake
-	peer, codec, err := receiver.recvHandshake(conn, true)
+	peer, info, codec, err := receiver.recvHandshake(conn, true)
 	if err != nil {
 		t.Fatalf("recvHandshake err:%v\n", err)
 	}
@@ -114,10 +117,12 @@ func TestRecvHandshake(t *testing.T) {
 	checkResponse(t, resp)
 
 	// check peer
-	checkPeer(t, peer)
+	checkPeer(t, peer, tv.listenPort)
+	checkPeerInfo(t, info, senderGenExtFunc())
 
-	// check codec
-	checkCodec(t, codec, tv.expectCodec)
+	// check codec with the sender's
+	expectCodec, _ := newAESGCMCodec(tv.recvSessionPubKey, tv.sendSessionPrivKey, true)
+	checkCodec(t, codec, expectCodec)
 }
 
 func TestReject(t *testing.T) {
@@ -127,11 +132,11 @@ func TestReject(t *testing.T) {
 	conn := newTCPConnMock()
 
 	// mock request
-	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey)
+	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension())
 	conn.setRecvPkt(req)
 
 	// reject request
-	_, _, err := receiver.recvHandshake(conn, false)
+	_, _, _, err := receiver.recvHandshake(conn, false)
 	if err != nil {
 		t.Fatalf("decrypt response failed:%v\n", err)
 	}
@@ -157,10 +162,10 @@ func TestChainIDMismatch(t *testing.T) {
 	conn := newTCPConnMock()
 
 	// mock request
-	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey)
+	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension())
 	conn.setRecvPkt(req)
 
-	_, _, err := receiver.recvHandshake(conn, true)
+	_, _, _, err := receiver.recvHandshake(conn, true)
 	if err != ErrNegotiateChainIDMismatch {
 		t.Fatalf("expect chain ID mismatch error, %v\n", err)
 	}
@@ -173,10 +178,10 @@ func TestSenderNodeTypeMismatch(t *testing.T) {
 	conn := newTCPConnMock()
 
 	// mock request
-	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey)
+	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension())
 	conn.setRecvPkt(req)
 
-	_, _, err := receiver.recvHandshake(conn, true)
+	_, _, _, err := receiver.recvHandshake(conn, true)
 	if err != ErrNegotiateNodeTypeMismatch {
 		t.Fatalf("expect node type mismatch error, %v\n", err)
 	}
@@ -189,11 +194,11 @@ func TestReceiverNodeTypeMismatch(t *testing.T) {
 	conn := newTCPConnMock()
 
 	// mock accept response
-	resp := receiver.genAcceptResponse(tv.recvSessionPrivKey)
+	resp := receiver.genAcceptResponse(tv.recvSessionPrivKey, receiver.genExtension())
 	conn.setRecvPkt(resp)
 
 	peer := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvPubKey)
-	_, err := sender.handshakeTo(conn, peer)
+	_, _, err := sender.handshakeTo(conn, peer)
 	if err != ErrNegotiateNodeTypeMismatch {
 		t.Fatalf("expect node type mismatch error, %v\n", err)
 	}
@@ -203,14 +208,14 @@ func TestSenderCodeVersionMismatch(t *testing.T) {
 	tv := negotiatorTestVar
 	sender := newSender(params.FullNode)
 	receiver := newReceiver(params.FullNode)
-	receiver.minimizeVersionRequired++
+	receiver.minimizeVersionRequired = params.CurrentCodeVersion + 1
 	conn := newTCPConnMock()
 
 	// mock request
-	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey)
+	req := sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension())
 	conn.setRecvPkt(req)
 
-	_, _, err := receiver.recvHandshake(conn, true)
+	_, _, _, err := receiver.recvHandshake(conn, true)
 	if _, ok := err.(ErrNegotiateCodeVersionMismatch); !ok {
 		t.Fatalf("expect code version mismatch error, %v\n", err)
 	}
@@ -219,24 +224,145 @@ func TestSenderCodeVersionMismatch(t *testing.T) {
 func TestReceiverCoderVersionMismatch(t *testing.T) {
 	tv := negotiatorTestVar
 	sender := newSender(params.FullNode)
-	sender.minimizeVersionRequired++
+	sender.minimizeVersionRequired = params.CurrentCodeVersion + 1
 	receiver := newReceiver(params.LightNode)
 	conn := newTCPConnMock()
 
 	// mock accept response
-	resp := receiver.genAcceptResponse(tv.recvSessionPrivKey)
+	resp := receiver.genAcceptResponse(tv.recvSessionPrivKey, receiver.genExtension())
 	conn.setRecvPkt(resp)
 
 	peer := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvPubKey)
-	_, err := sender.handshakeTo(conn, peer)
+	_, _, err := sender.handshakeTo(conn, peer)
 	if _, ok := err.(ErrNegotiateCodeVersionMismatch); !ok {
 		t.Fatalf("expect code version mismatch error, %v\n", err)
 	}
 }
 
+func TestHandshakeVersionMismatch(t *testing.T) {
+	tv := negotiatorTestVar
+	sender := newSender(params.FullNode)
+	receiver := newReceiver(params.FullNode)
+
+	// the request of version 1
+	conn := newTCPConnMock()
+	req := handshake.NewRequestV1(tv.chainID, params.CurrentCodeVersion, params.FullNode,
+		tv.sendPubKey.SerializeCompressed(), tv.sendSessionPubKey.SerializeCompressed())
+	req.Sign(tv.sendPrivKey)
+	conn.setRecvPkt(buildTCPPacket(req.Marshal(), handshakeProtocolID))
+
+	_, _, _, err := receiver.recvHandshake(conn, true)
+	if _, ok := err.(ErrNegotiateHandshakeVersionMismatch); !ok {
+		t.Fatalf("expect handshake version mismatch error, %v\n", err)
+	}
+
+	// the accept response of version 1
+	conn = newTCPConnMock()
+	resp := handshake.NewAcceptResponseV1(params.CurrentCodeVersion, params.FullNode,
+		tv.recvSessionPubKey.SerializeCompressed())
+	resp.Sign(tv.recvPrivKey)
+	conn.setRecvPkt(buildTCPPacket(resp.Marshal(), handshakeProtocolID))
+
+	peer := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvPubKey)
+	_, _, err = sender.handshakeTo(conn, peer)
+	if _, ok := err.(ErrNegotiateHandshakeVersionMismatch); !ok {
+		t.Fatalf("expect handshake version mismatch error, %v\n", err)
+	}
+}
+
+func TestHandshakeWithoutExtension(t *testing.T) {
+	tv := negotiatorTestVar
+
+	// the request without the extension
+	sender := newSender(params.FullNode)
+	sender.genExtFunc = nil
+	receiver := newReceiver(params.FullNode)
+	conn := newTCPConnMock()
+	conn.setRecvPkt(sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension()))
+
+	p, info, _, err := receiver.recvHandshake(conn, true)
+	if err != nil {
+		t.Fatalf("recvHandshake err:%v\n", err)
+	}
+	checkPeer(t, p, tv.remotePort)
+	if err := utils.TCheckUint32("capabilities", 0, info.Capabilities); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckString("listen address", "", info.ListenAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	// the accept response without the extension
+	receiver.genExtFunc = nil
+	conn = newTCPConnMock()
+	conn.setRecvPkt(receiver.genAcceptResponse(tv.recvSessionPrivKey, receiver.genExtension()))
+
+	p = peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvPubKey)
+	if info, _, err = sender.handshakeTo(conn, p); err != nil {
+		t.Fatalf("handshakeTo err:%v\n", err)
+	}
+	if info.Has(params.CapCompactBlock) {
+		t.Fatal("expect no capabilities")
+	}
+}
+
+func TestHandshakeCompression(t *testing.T) {
+	tv := negotiatorTestVar
+
+	// both sides advertise the compression
+	sender := newSender(params.FullNode)
+	receiver := newReceiver(params.FullNode)
+	receiver.genExtFunc = senderGenExtFunc
+	conn := newTCPConnMock()
+	conn.setRecvPkt(sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, sender.genExtension()))
+
+	_, info, _, err := receiver.recvHandshake(conn, true)
+	if err != nil {
+		t.Fatalf("recvHandshake err:%v\n", err)
+	}
+	if err := utils.TCheckUint8("receiver compression", params.CompressionDeflate, info.Compression); err != nil {
+		t.Fatal(err)
+	}
+
+	conn = newTCPConnMock()
+	conn.setRecvPkt(receiver.genAcceptResponse(tv.recvSessionPrivKey, receiver.genExtension()))
+	p := peer.NewPeer(tv.remoteIP, tv.remotePort, tv.recvPubKey)
+	if info, _, err = sender.handshakeTo(conn, p); err != nil {
+		t.Fatalf("handshakeTo err:%v\n", err)
+	}
+	if err := utils.TCheckUint8("sender compression", params.CompressionDeflate, info.Compression); err != nil {
+		t.Fatal(err)
+	}
+
+	// the accept response misses the extension
+	conn = newTCPConnMock()
+	conn.setRecvPkt(receiver.genAcceptResponse(tv.recvSessionPrivKey, nil))
+	if _, _, err = sender.handshakeTo(conn, p); err != ErrNegotiateMissingExtension {
+		t.Fatalf("expect missing extension error, %v\n", err)
+	}
+
+	// the request misses the extension
+	conn = newTCPConnMock()
+	conn.setRecvPkt(sender.genRequest(tv.sendSessionPrivKey, tv.recvPubKey, nil))
+	if _, _, _, err = receiver.recvHandshake(conn, true); err != ErrNegotiateMissingExtension {
+		t.Fatalf("expect missing extension error, %v\n", err)
+	}
+
+	// the receiver doesn't advertise the compression
+	receiver.genExtFunc = receiverGenExtFunc
+	conn = newTCPConnMock()
+	conn.setRecvPkt(receiver.genAcceptResponse(tv.recvSessionPrivKey, receiver.genExtension()))
+	if info, _, err = sender.handshakeTo(conn, p); err != nil {
+		t.Fatalf("handshakeTo err:%v\n", err)
+	}
+	if err := utils.TCheckUint8("sender compression", 0, info.Compression); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func newSender(nodeType params.NodeType) *negotiatorImp {
 	tv := negotiatorTestVar
-	ng := newNegotiator(tv.sendPrivKey, tv.chainID, nodeType)
+	ng := newNegotiator(tv.sendPrivKey, tv.chainID, nodeType, senderGenExtFunc)
 	result := ng.(*negotiatorImp)
 	result.genSessionKeyFunc = senderGenSessionKeyFunc
 	return result
@@ -244,7 +370,7 @@ func newSender(nodeType params.NodeType) *negotiatorImp {
 
 func newReceiver(nodeType params.NodeType) *negotiatorImp {
 	tv := negotiatorTestVar
-	ng := newNegotiator(tv.recvPrivKey, tv.chainID, nodeType)
+	ng := newNegotiator(tv.recvPrivKey, tv.chainID, nodeType, receiverGenExtFunc)
 	result := ng.(*negotiatorImp)
 	result.genSessionKeyFunc = receiverGenSessionKeyFunc
 	return result
@@ -256,7 +382,7 @@ func checkRequest(t *testing.T, req *handshake.Request) {
 	if !req.Verify() {
 		t.Fatal("verify request failed")
 	}
-	if err := utils.TCheckUint8("version", handshake.HandshakeV1, req.Version); err != nil {
+	if err := utils.TCheckUint8("version", handshake.HandshakeV2, req.Version); err != nil {
 		t.Fatal(err)
 	}
 	if err := utils.TCheckUint8("chain id", tv.chainID, req.ChainID); err != nil {
@@ -283,7 +409,7 @@ func checkResponse(t *testing.T, resp *handshake.Response) {
 	if !resp.Verify(tv.recvPubKey) {
 		t.Fatal("verify response failed")
 	}
-	if err := utils.TCheckUint8("version", handshake.HandshakeV1, resp.Version); err != nil {
+	if err := utils.TCheckUint8("version", handshake.HandshakeV2, resp.Version); err != nil {
 		t.Fatal(err)
 	}
 	if !resp.IsAccept() {
@@ -301,13 +427,13 @@ func checkResponse(t *testing.T, resp *handshake.Response) {
 	}
 }
 
-func checkPeer(t *testing.T, p *peer.Peer) {
+func checkPeer(t *testing.T, p *peer.Peer, port int) {
 	tv := negotiatorTestVar
 
 	if err := utils.TCheckIP("peer IP", tv.remoteIP, p.IP); err != nil {
 		t.Fatal(err)
 	}
-	if err := utils.TCheckInt("peer port", tv.remotePort, p.Port); err != nil {
+	if err := utils.TCheckInt("peer port", port, p.Port); err != nil {
 		t.Fatal(err)
 	}
 	if err := utils.TCheckBytes("peer key", tv.sendPubKey.SerializeCompressed(), p.Key.SerializeCompressed()); err != nil {
@@ -315,6 +441,26 @@ func checkPeer(t *testing.T, p *peer.Peer) {
 	}
 }
 
+func checkPeerInfo(t *testing.T, info *PeerInfo, ext *handshake.Extension) {
+	tv := negotiatorTestVar
+
+	if err := utils.TCheckUint32("capabilities", ext.Capabilities, info.Capabilities); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint64("best height", ext.BestHeight, info.BestHeight); err != nil {
+		t.Fatal(err)
+	}
+
+	ip := ext.ListenIP
+	if len(ip) == 0 {
+		ip = tv.remoteIP
+	}
+	listenAddr := net.JoinHostPort(ip.String(), strconv.Itoa(int(ext.ListenPort)))
+	if err := utils.TCheckString("listen address", listenAddr, info.ListenAddr); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func checkCodec(t *testing.T, result codec, expect codec) {
 	originText := []byte("nieogitator test codec check")
 
@@ -354,6 +500,20 @@ func receiverGenSessionKeyFunc() (*btcec.PrivateKey, error) {
 	return tv.recvSessionPrivKey, nil
 }
 
+///////////////////////////////////////genExtFuncStub
+
+func senderGenExtFunc() *handshake.Extension {
+	tv := negotiatorTestVar
+	return handshake.NewExtension(params.CapCompactBlock|params.CapCompression, 996, nil, uint16(tv.listenPort),
+		[]params.Compression{params.CompressionDeflate})
+}
+
+func receiverGenExtFunc() *handshake.Extension {
+	tv := negotiatorTestVar
+	return handshake.NewExtension(params.CapCompactBlock|params.CapEvidenceProof, 1000,
+		net.ParseIP("10.0.0.1"), uint16(tv.remotePort), nil)
+}
+
 ///////////////////////////////////////tcpConnMock
 
 type tcpConnMock struct {
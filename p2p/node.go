@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/996BC/996.Blockchain/crypto"
 	"github.com/996BC/996.Blockchain/p2p/peer"
 	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/serialize/handshake"
 	"github.com/996BC/996.Blockchain/utils"
 	"github.com/btcsuite/btcd/btcec"
 )
@@ -24,13 +26,38 @@ type Config struct {
 	PrivKey    *btcec.PrivateKey
 	Type       params.NodeType
 	ChainID    uint8
+
+	// Capabilities are advertised in the handshake, the protocols use the features with the peers supporting them
+	Capabilities params.Capability
+
+	// BanListPath is the file saving the banned peers, they are not saved if it's empty
+	BanListPath string
+
+	// AnchorsPath is the file saving the anchor peers, they are not saved if it's empty
+	AnchorsPath string
 }
 
+// a full node connects to at most maxOutboundPeers peers itself,
+// the other places are left for the peers connecting to it
+const maxOutboundPeers = 16
+
 // Node is a node that can communicate with others in the p2p network.
 type Node interface {
 	AddProtocol(p Protocol) ProtocolRunner
 	Start()
 	Stop()
+
+	// GetBans returns the banned peers
+	GetBans() []*Ban
+
+	// BanPeer disconnects the peer and refuses to connect it for the duration
+	BanPeer(peerID string, duration time.Duration, reason string)
+
+	// UnbanPeer returns false if the peer is not banned
+	UnbanPeer(peerID string) bool
+
+	// SetBestHeightFunc sets the function returning the best height advertised in the handshake
+	SetBestHeightFunc(f func() uint64)
 }
 
 // NewNode returns a p2p network Node
@@ -38,25 +65,43 @@ func NewNode(c *Config) Node {
 	if c.Type != params.FullNode && c.Type != params.LightNode {
 		logger.Fatal("invalid node type %d\n", c.Type)
 	}
+
+	// the light nodes are never connected by others
+	maxOutbound := c.MaxPeerNum
+	if c.Type == params.FullNode {
+		if maxOutbound = (c.MaxPeerNum + 1) / 2; maxOutbound > maxOutboundPeers {
+			maxOutbound = maxOutboundPeers
+		}
+	}
+
 	n := &node{
 		privKey:        c.PrivKey,
 		chainID:        c.ChainID,
 		nodeType:       c.Type,
+		capabilities:   c.Capabilities,
+		listenPort:     uint16(c.NodePort),
 		maxPeersNum:    c.MaxPeerNum,
+		maxOutbound:    maxOutbound,
 		peerProvider:   c.Provider,
 		protocols:      make(map[uint8]*protocolRunner),
 		ngBlackList:    make(map[string]time.Time),
+		bans:           newBanList(c.BanListPath),
+		anchorsPath:    c.AnchorsPath,
 		tcpConnectFunc: utils.TCPConnectTo,
 		connectTask:    make(chan *peer.Peer, c.MaxPeerNum),
-		connMgr:        newConnManager(c.MaxPeerNum),
+		connMgr:        newConnManager(c.MaxPeerNum, maxOutbound),
 		lm:             utils.NewLoop(1),
 	}
-	n.ng = newNegotiator(n.privKey, n.chainID, n.nodeType)
+	n.ng = newNegotiator(n.privKey, n.chainID, n.nodeType, n.genExtension)
 
 	var ip net.IP
 	if ip = net.ParseIP(c.NodeIP); ip == nil {
 		logger.Fatal("parse ip for tcp server failed:%s\n", c.NodeIP)
 	}
+	// the peers use the IP of the connection if we listen on all the addresses
+	if !ip.IsUnspecified() {
+		n.listenIP = ip
+	}
 	n.tcpServer = utils.NewTCPServer(ip, c.NodePort)
 
 	return n
@@ -68,8 +113,15 @@ type node struct {
 	chainID   uint8
 	nodeType  params.NodeType
 
+	capabilities   params.Capability
+	listenIP       net.IP
+	listenPort     uint16
+	bestHeightFunc atomic.Value // func() uint64
+
 	maxPeersNum  int
+	maxOutbound  int
 	peerProvider peer.Provider
+	anchorsPath  string
 
 	protocolsMutex sync.Mutex
 	protocols      map[uint8]*protocolRunner //<Protocol ID, ProtocolRunner>
@@ -77,6 +129,7 @@ type node struct {
 	ng          negotiator
 	ngMutex     sync.Mutex
 	ngBlackList map[string]time.Time
+	bans        *banList
 
 	tcpConnectFunc func(ip net.IP, port int) (utils.TCPConn, error) // easily mock in test
 	connectTask    chan *peer.Peer
@@ -94,7 +147,7 @@ func (n *node) AddProtocol(p Protocol) ProtocolRunner {
 		logger.Fatal("protocol conflicts in ID:%s, exists:%s, wanted to add:%s",
 			p.ID(), v.protocol.Name(), v.protocol.Name())
 	}
-	runner := newProtocolRunner(p, n.send)
+	runner := newProtocolRunner(p, n.send, n.punish, n.connMgr.getPeerInfo)
 	n.protocols[p.ID()] = runner
 	return runner
 }
@@ -105,6 +158,16 @@ func (n *node) Start() {
 	}
 	n.connMgr.start()
 
+	for _, anchor := range loadAnchors(n.anchorsPath) {
+		if n.bans.isBanned(anchor.ID) {
+			continue
+		}
+		select {
+		case n.connectTask <- anchor:
+		default:
+		}
+	}
+
 	go n.loop()
 	n.lm.StartWorking()
 }
@@ -112,10 +175,27 @@ func (n *node) Start() {
 func (n *node) Stop() {
 	if n.lm.Stop() {
 		n.tcpServer.Stop()
+		saveAnchors(n.anchorsPath, n.connMgr.getAnchors(maxAnchors))
 		n.connMgr.stop()
 	}
 }
 
+func (n *node) SetBestHeightFunc(f func() uint64) {
+	n.bestHeightFunc.Store(f)
+}
+
+func (n *node) genExtension() *handshake.Extension {
+	var bestHeight uint64
+	if f, ok := n.bestHeightFunc.Load().(func() uint64); ok {
+		bestHeight = f()
+	}
+	var compressions []params.Compression
+	if n.capabilities&params.CapCompression != 0 {
+		compressions = supportedCompressions
+	}
+	return handshake.NewExtension(n.capabilities, bestHeight, n.listenIP, n.listenPort, compressions)
+}
+
 func (n *node) String() string {
 	return fmt.Sprintf("[node] listen on %v", n.tcpServer.Addr())
 }
@@ -139,6 +219,7 @@ func (n *node) loop() {
 			n.statusReport()
 		case <-ngBlackListCleanTicker.C:
 			n.cleanNgBlackList()
+			n.bans.clean()
 		case newPeer := <-n.connectTask:
 			go func() {
 				n.lm.Add()
@@ -157,12 +238,12 @@ func (n *node) loop() {
 }
 
 func (n *node) getPeersToConnect() {
-	peersNum := n.connMgr.size()
-	if peersNum >= n.maxPeersNum {
+	outboundNum := n.connMgr.outboundSize()
+	if outboundNum >= n.maxOutbound {
 		return
 	}
 
-	expectNum := n.maxPeersNum - peersNum
+	expectNum := n.maxOutbound - outboundNum
 	excludePeers := n.getExcludePeers()
 	newPeers, err := n.peerProvider.GetPeers(expectNum, excludePeers)
 	if err != nil {
@@ -170,7 +251,15 @@ func (n *node) getPeersToConnect() {
 		return
 	}
 
+	// one outbound peer for each address group
+	groups := make(map[string]bool)
 	for _, newPeer := range newPeers {
+		if group := newPeer.Group(); len(group) != 0 {
+			if groups[group] || n.connMgr.hasOutboundGroup(group) {
+				continue
+			}
+			groups[group] = true
+		}
 		n.connectTask <- newPeer
 	}
 }
@@ -200,24 +289,25 @@ func (n *node) setupConn(newPeer *peer.Peer) {
 	}
 	conn.SetSplitFunc(splitTCPStream)
 
-	ec, err := n.ng.handshakeTo(conn, newPeer)
+	info, ec, err := n.ng.handshakeTo(conn, newPeer)
 	if err != nil {
 		logger.Warn("handshake to %v failed:%v", newPeer, err)
 		conn.Disconnect()
-		n.addNgBlackList(newPeer.ID)
+		// the light node is not misbehaving, it will connect to us;
+		// neither is the node refusing for its inbound places are full
+		if err != ErrNegotiateNodeTypeMismatch && err != ErrNegotiateConnectionRefused {
+			n.addNgBlackList(newPeer.ID)
+		}
 		return
 	}
 
-	n.addConn(newPeer, conn, ec)
+	n.addConn(newPeer, info, conn, ec, false)
 }
 
 func (n *node) recvConn(conn utils.TCPConn) {
-	accept := false
-	if n.connMgr.size() < n.maxPeersNum {
-		accept = true
-	}
+	accept := n.connMgr.canAccept()
 
-	peer, ec, err := n.ng.recvHandshake(conn, accept)
+	peer, info, ec, err := n.ng.recvHandshake(conn, accept)
 	if err != nil {
 		logger.Warn("handle handshake from remote failed:%v\n", err)
 		conn.Disconnect()
@@ -229,11 +319,28 @@ func (n *node) recvConn(conn utils.TCPConn) {
 		return
 	}
 
-	n.addConn(peer, conn, ec)
+	if n.isInNgBlackList(peer.ID) {
+		logger.Debug("refuse connection from black list peer %s\n", peer.ID)
+		conn.Disconnect()
+		return
+	}
+
+	if n.bans.isBanned(peer.ID) {
+		logger.Debug("refuse connection from banned peer %s\n", peer.ID)
+		conn.Disconnect()
+		return
+	}
+
+	n.addConn(peer, info, conn, ec, true)
 }
 
-func (n *node) addConn(peer *peer.Peer, conn utils.TCPConn, ec codec) {
-	if err := n.connMgr.add(peer, conn, ec, n.recv); err != nil {
+func (n *node) addConn(peer *peer.Peer, info *PeerInfo, conn utils.TCPConn, ec codec, inbound bool) {
+	// the compression is negotiated in the handshake, both sides get the same algorithm
+	if info.Compression == params.CompressionDeflate {
+		ec = newCompressCodec(ec)
+	}
+
+	if err := n.connMgr.add(peer, info, conn, ec, n.recv, inbound); err != nil {
 		logger.Debug("addConn failed:%v\n", err)
 		conn.Disconnect()
 	}
@@ -258,6 +365,36 @@ func (n *node) recv(peer string, protocolID uint8, data []byte) {
 	}
 }
 
+func (n *node) punish(p Protocol, peerID string, score int, reason string) {
+	logger.Warn("protocol %s punishes peer %s with score %d:%s\n", p.Name(), peerID, score, reason)
+	if n.bans.misbehave(peerID, score, reason) {
+		logger.Warn("ban peer %s for %v\n", peerID, DefaultBanDuration)
+		n.connMgr.disconnect(peerID)
+	}
+}
+
+func (n *node) GetBans() []*Ban {
+	return n.bans.list()
+}
+
+func (n *node) BanPeer(peerID string, duration time.Duration, reason string) {
+	logger.Info("ban peer %s for %v:%s\n", peerID, duration, reason)
+	n.bans.ban(peerID, duration, reason)
+	n.connMgr.disconnect(peerID)
+}
+
+func (n *node) UnbanPeer(peerID string) bool {
+	logger.Info("unban peer %s\n", peerID)
+	return n.bans.unban(peerID)
+}
+
+func (n *node) isInNgBlackList(peerID string) bool {
+	n.ngMutex.Lock()
+	defer n.ngMutex.Unlock()
+	_, ok := n.ngBlackList[peerID]
+	return ok
+}
+
 func (n *node) addNgBlackList(peerID string) {
 	n.ngMutex.Lock()
 	defer n.ngMutex.Unlock()
@@ -285,6 +422,10 @@ func (n *node) getExcludePeers() map[string]bool {
 	}
 	n.ngMutex.Unlock()
 
+	for _, b := range n.bans.list() {
+		result[b.ID] = true
+	}
+
 	connectedID := n.connMgr.getIDs()
 	for _, id := range connectedID {
 		result[id] = true
@@ -34,12 +34,14 @@ func newNodeForTest() *node {
 	n := &node{
 		privKey:      key,
 		maxPeersNum:  128,
+		maxOutbound:  16,
 		peerProvider: newProviderMock(tv.peers),
 
 		protocols: make(map[uint8]*protocolRunner),
 
 		ng:          newNegotiatorMock(true),
 		ngBlackList: make(map[string]time.Time),
+		bans:        newBanList(""),
 
 		tcpConnectFunc: tcpConnectSuccMock,
 		connectTask:    make(chan *peer.Peer, 128),
@@ -79,7 +81,7 @@ func TestGetPeersToConnect(t *testing.T) {
 	}
 
 	// GetPeers() expectNum
-	if err := utils.TCheckInt("GetPeers() expectNum", n.maxPeersNum-n.connMgr.size(), provider.getPeersExpect); err != nil {
+	if err := utils.TCheckInt("GetPeers() expectNum", n.maxOutbound-n.connMgr.outboundSize(), provider.getPeersExpect); err != nil {
 		t.Fatal(err)
 	}
 
@@ -96,7 +98,7 @@ func TestGetPeersToConnect(t *testing.T) {
 
 func TestMaxPeerLimit(t *testing.T) {
 	n := newNodeForTest()
-	n.maxPeersNum = 1
+	n.maxOutbound = 1
 	n.getPeersToConnect()
 
 	select {
@@ -106,6 +108,34 @@ func TestMaxPeerLimit(t *testing.T) {
 	}
 }
 
+func TestGetPeersToConnectByGroup(t *testing.T) {
+	n := newNodeForTest()
+	n.peerProvider = newProviderMock([]*peer.Peer{
+		&peer.Peer{ID: "Peer_A", IP: net.ParseIP("8.8.1.1")},
+		&peer.Peer{ID: "Peer_B", IP: net.ParseIP("8.8.2.2")},
+		&peer.Peer{ID: "Peer_C", IP: net.ParseIP("9.9.1.1")},
+		&peer.Peer{ID: "Peer_D", IP: net.ParseIP("7.7.1.1")},
+		&peer.Peer{ID: "Peer_E", IP: net.ParseIP("127.0.0.1"), Port: 1},
+		&peer.Peer{ID: "Peer_F", IP: net.ParseIP("127.0.0.1"), Port: 2},
+	})
+	n.connMgr.(*connManagerMock).groups = map[string]bool{"7.7": true}
+	n.getPeersToConnect()
+
+	var ids []string
+	for len(n.connectTask) > 0 {
+		ids = append(ids, (<-n.connectTask).ID)
+	}
+	// one for each group, the local addresses are not grouped
+	if err := utils.TCheckInt("peers to connect", 4, len(ids)); err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"Peer_A", "Peer_C", "Peer_E", "Peer_F"} {
+		if err := utils.TCheckString("peer to connect", id, ids[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestSetupConn(t *testing.T) {
 	// success
 	targetPeer := &peer.Peer{
@@ -139,6 +169,17 @@ func TestSetupConn(t *testing.T) {
 	if connManager.addPeer != nil {
 		t.Fatal("expect not adding peer")
 	}
+	if !n.isInNgBlackList(targetPeer.ID) {
+		t.Fatal("expect the failed peer in the black list")
+	}
+
+	// refused for the full inbound places
+	n = newNodeForTest()
+	n.ng = &negotiatorMock{err: ErrNegotiateConnectionRefused}
+	n.setupConn(targetPeer)
+	if n.isInNgBlackList(targetPeer.ID) {
+		t.Fatal("expect the refusing peer not in the black list")
+	}
 }
 
 func TestRecvConn(t *testing.T) {
@@ -153,12 +194,16 @@ func TestRecvConn(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if !connManager.addInbound {
+		t.Fatal("expect an inbound conn")
+	}
+
 	// fail via maxPeer
 	n = newNodeForTest()
-	n.maxPeersNum = n.connMgr.size() // reach the limit, will not accept connection
+	connManager = n.connMgr.(*connManagerMock)
+	connManager.full = true // reach the limit, will not accept connection
 	n.recvConn(newTCPConnMock())
 
-	connManager = n.connMgr.(*connManagerMock)
 	if connManager.addPeer != nil {
 		t.Fatal("expect not adding peer")
 	}
@@ -174,6 +219,67 @@ func TestRecvConn(t *testing.T) {
 	}
 }
 
+func TestPunish(t *testing.T) {
+	tv := nodeTestVar
+	n := newNodeForTest()
+	p := &nodeTestProtocol{}
+
+	runner := n.AddProtocol(p)
+	runner.Punish(tv.remotePeer.ID, BanScore/2, "test")
+
+	connManager := n.connMgr.(*connManagerMock)
+	if n.bans.isBanned(tv.remotePeer.ID) || len(connManager.disconnectPeer) != 0 {
+		t.Fatal("expect the peer not banned under the ban score")
+	}
+
+	runner.Punish(tv.remotePeer.ID, BanScore/2, "test")
+	if !n.bans.isBanned(tv.remotePeer.ID) {
+		t.Fatal("expect punished peer banned")
+	}
+	if err := utils.TCheckString("disconnect peer", tv.remotePeer.ID, connManager.disconnectPeer); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := n.getExcludePeers()[tv.remotePeer.ID]; !ok {
+		t.Fatal("expect the banned peer excluded")
+	}
+
+	// refuse the punished peer
+	n.recvConn(newTCPConnMock())
+	if connManager.addPeer != nil {
+		t.Fatal("expect not adding peer")
+	}
+}
+
+func TestBanPeer(t *testing.T) {
+	tv := nodeTestVar
+	n := newNodeForTest()
+
+	n.BanPeer(tv.remotePeer.ID, time.Hour, "test")
+	connManager := n.connMgr.(*connManagerMock)
+	if err := utils.TCheckString("disconnect peer", tv.remotePeer.ID, connManager.disconnectPeer); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("bans", 1, len(n.GetBans())); err != nil {
+		t.Fatal(err)
+	}
+
+	n.recvConn(newTCPConnMock())
+	if connManager.addPeer != nil {
+		t.Fatal("expect not adding the banned peer")
+	}
+
+	if !n.UnbanPeer(tv.remotePeer.ID) {
+		t.Fatal("expect the peer unbanned")
+	}
+	if n.UnbanPeer(tv.remotePeer.ID) {
+		t.Fatal("expect the peer not banned")
+	}
+	n.recvConn(newTCPConnMock())
+	if connManager.addPeer == nil {
+		t.Fatal("expect adding the unbanned peer")
+	}
+}
+
 func TestCleanNgBlackList(t *testing.T) {
 	tv := nodeTestVar
 	n := newNodeForTest()
@@ -232,7 +338,7 @@ func TestProtocolRecv(t *testing.T) {
 	}
 }
 
-///////////////////////////////////////providerMock
+// /////////////////////////////////////providerMock
 type providerMock struct {
 	peers           []*peer.Peer
 	getPeersExpect  int
@@ -254,9 +360,10 @@ func (p *providerMock) GetPeers(expect int, exclude map[string]bool) ([]*peer.Pe
 }
 func (p *providerMock) AddSeeds(seeds []*peer.Peer) {}
 
-///////////////////////////////////////negotiatorMock
+// /////////////////////////////////////negotiatorMock
 type negotiatorMock struct {
 	success bool
+	err     error
 }
 
 func newNegotiatorMock(success bool) *negotiatorMock {
@@ -265,27 +372,34 @@ func newNegotiatorMock(success bool) *negotiatorMock {
 	}
 }
 
-func (n *negotiatorMock) handshakeTo(conn utils.TCPConn, peer *peer.Peer) (codec, error) {
+func (n *negotiatorMock) handshakeTo(conn utils.TCPConn, peer *peer.Peer) (*PeerInfo, codec, error) {
 	if n.success {
-		return nil, nil
+		return &PeerInfo{}, nil, nil
 	}
-	return nil, errors.New("")
+	if n.err != nil {
+		return nil, nil, n.err
+	}
+	return nil, nil, errors.New("")
 }
-func (n *negotiatorMock) recvHandshake(conn utils.TCPConn, accept bool) (*peer.Peer, codec, error) {
+func (n *negotiatorMock) recvHandshake(conn utils.TCPConn, accept bool) (*peer.Peer, *PeerInfo, codec, error) {
 	tv := nodeTestVar
 	if n.success {
-		return tv.remotePeer, nil, nil
+		return tv.remotePeer, &PeerInfo{}, nil, nil
 	}
-	return nil, nil, errors.New("")
+	return nil, nil, nil, errors.New("")
 }
 
-///////////////////////////////////////connManagerMock
+// /////////////////////////////////////connManagerMock
 type connManagerMock struct {
-	ids     []string
-	addPeer *peer.Peer
-
-	sendProtocol Protocol
-	sendData     *PeerData
+	ids        []string
+	addPeer    *peer.Peer
+	addInbound bool
+	full       bool
+	groups     map[string]bool
+
+	sendProtocol   Protocol
+	sendData       *PeerData
+	disconnectPeer string
 }
 
 func newConnManagerMock(ids []string) *connManagerMock {
@@ -299,6 +413,9 @@ func (c *connManagerMock) stop()  {}
 func (c *connManagerMock) size() int {
 	return len(c.ids)
 }
+func (c *connManagerMock) outboundSize() int {
+	return len(c.ids)
+}
 func (c *connManagerMock) getIDs() []string {
 	return c.ids
 }
@@ -316,15 +433,31 @@ func (c *connManagerMock) send(p Protocol, dp *PeerData) error {
 	c.sendData = dp
 	return nil
 }
-func (c *connManagerMock) add(peer *peer.Peer, conn utils.TCPConn, ec codec, handler recvHandler) error {
+func (c *connManagerMock) add(peer *peer.Peer, info *PeerInfo, conn utils.TCPConn, ec codec, handler recvHandler, inbound bool) error {
 	c.addPeer = peer
+	c.addInbound = inbound
+	return nil
+}
+func (c *connManagerMock) canAccept() bool {
+	return !c.full
+}
+func (c *connManagerMock) hasOutboundGroup(group string) bool {
+	return c.groups[group]
+}
+func (c *connManagerMock) getAnchors(num int) []*peer.Peer {
+	return nil
+}
+func (c *connManagerMock) disconnect(peerID string) {
+	c.disconnectPeer = peerID
+}
+func (c *connManagerMock) getPeerInfo(peerID string) *PeerInfo {
 	return nil
 }
 func (c *connManagerMock) String() string {
 	return ""
 }
 
-///////////////////////////////////////tcpConnectFuncMock
+// /////////////////////////////////////tcpConnectFuncMock
 func tcpConnectSuccMock(ip net.IP, port int) (utils.TCPConn, error) {
 	// tcpConnMock declare in negotiator_test.go
 	return newTCPConnMock(), nil
@@ -0,0 +1,59 @@
+package peer
+
+import (
+	"fmt"
+	"net"
+)
+
+var unroutableNets []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		unroutableNets = append(unroutableNets, n)
+	}
+}
+
+// AddrGroup returns the network the ip belongs to, /16 for IPv4 and /32 for IPv6,
+// the peers in the same group are likely controlled by the same operator.
+// It returns empty for the local and private addresses, they are not grouped
+// so that a test network on a single host still works
+func AddrGroup(ip net.IP) string {
+	if ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	for _, n := range unroutableNets {
+		if n.Contains(ip) {
+			return ""
+		}
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d", v4[0], v4[1])
+	}
+	return fmt.Sprintf("%x:%x", []byte(ip[:2]), []byte(ip[2:4]))
+}
+
+// Group returns the address group of the peer
+func (p *Peer) Group() string {
+	return AddrGroup(p.IP)
+}
+
+// GroupKey is the address group of the peer, or its address if it's not grouped
+func (p *Peer) GroupKey() string {
+	if group := p.Group(); len(group) != 0 {
+		return group
+	}
+	return p.Address()
+}
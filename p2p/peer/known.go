@@ -0,0 +1,113 @@
+package peer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	// the known peers not seen for knownPeerExpiredTime are forgotten
+	knownPeerExpiredTime = 7 * 24 * time.Hour
+	maxKnownPeers        = 512
+
+	// the best ranked known peers are restored into the table at startup
+	maxRestoredPeers = 32
+)
+
+// peerRecord is the history of a known peer, it's saved into the file
+// so that the node doesn't only depend on the seeds after restarts
+type peerRecord struct {
+	Record
+	LastSeen  int64  `json:"last_seen"`
+	Successes uint32 `json:"successes"` // times it answered after being unavailable
+	Failures  uint32 `json:"failures"`  // times it timed out
+
+	peer *Peer
+}
+
+func newPeerRecord(p *Peer) *peerRecord {
+	return &peerRecord{
+		Record: NewRecord(p),
+		peer:   p,
+	}
+}
+
+// parse restores the peer of the record loaded from the file
+func (r *peerRecord) parse() error {
+	p, err := r.Record.Parse()
+	if err != nil {
+		return err
+	}
+	r.peer = p
+	return nil
+}
+
+func (r *peerRecord) seen(p *Peer, now time.Time) {
+	r.IP = p.IP.String()
+	r.Port = p.Port
+	r.LastSeen = now.Unix()
+	r.peer = p
+}
+
+func (r *peerRecord) isExpired(now time.Time) bool {
+	return now.Sub(time.Unix(r.LastSeen, 0)) > knownPeerExpiredTime
+}
+
+// rank prefers the peers answering reliably and seen recently
+func (r *peerRecord) rank(now time.Time) float64 {
+	reliability := float64(r.Successes+1) / float64(r.Successes+r.Failures+2)
+	days := now.Sub(time.Unix(r.LastSeen, 0)).Hours() / 24
+	if days < 0 {
+		days = 0
+	}
+	return reliability / (1 + days)
+}
+
+// sortPeerRecords sorts the records from the best ranked
+func sortPeerRecords(records []*peerRecord, now time.Time) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].rank(now) > records[j].rank(now)
+	})
+}
+
+func loadPeerRecords(path string) []*peerRecord {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("read peer table %s failed:%v\n", path, err)
+		}
+		return nil
+	}
+
+	var records []*peerRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		logger.Warn("parse peer table %s failed:%v\n", path, err)
+		return nil
+	}
+
+	var result []*peerRecord
+	for _, r := range records {
+		if err := r.parse(); err != nil {
+			logger.Warn("invalid peer record %s:%v\n", r.Key, err)
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func savePeerRecords(path string, records []*peerRecord) {
+	content, err := json.Marshal(records)
+	if err != nil {
+		logger.Warn("marshal peer table failed:%v\n", err)
+		return
+	}
+	if err := utils.WriteFileAtomic(path, content, 0644); err != nil {
+		logger.Warn("save peer table failed:%v\n", err)
+	}
+}
@@ -0,0 +1,112 @@
+package peer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestKnownPeersHistory(t *testing.T) {
+	tv := tableTestVar
+	table := newTableImp()
+	peer := tv.peers[2]
+
+	// answered after being unavailable
+	table.recvPong(peer)
+	table.recvPong(peer)
+	record, ok := table.known[peer.ID]
+	if !ok {
+		t.Fatal("expect the answered peer known")
+	}
+	if err := utils.TCheckUint32("successes", 1, record.Successes); err != nil {
+		t.Fatal(err)
+	}
+
+	// timed out
+	pst := table.peers[peer.ID]
+	pst.doPing()
+	pst.lastActiveTime = initTimepoint
+	table.refresh()
+	if table.exists(peer.ID) {
+		t.Fatal("expect the timeout peer removed")
+	}
+	if err := utils.TCheckUint32("failures", 1, record.Failures); err != nil {
+		t.Fatal(err)
+	}
+
+	// the peers never answered are not known
+	if err := utils.TCheckInt("known peers", 1, len(table.getKnownPeers())); err != nil {
+		t.Fatal(err)
+	}
+
+	// stale
+	record.LastSeen = time.Now().Add(-knownPeerExpiredTime - time.Minute).Unix()
+	table.refresh()
+	if err := utils.TCheckInt("known peers after expired", 0, len(table.getKnownPeers())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKnownPeersPersistence(t *testing.T) {
+	tv := tableTestVar
+	dir, err := ioutil.TempDir("", "peertable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "peers.json")
+
+	now := time.Now()
+	reliable := newPeerRecord(tv.peers[2])
+	reliable.LastSeen = now.Add(-time.Hour).Unix()
+	reliable.Successes = 10
+	flaky := newPeerRecord(tv.peers[3])
+	flaky.LastSeen = now.Unix()
+	flaky.Successes = 1
+	flaky.Failures = 9
+	stale := newPeerRecord(tv.peers[1])
+	stale.LastSeen = now.Add(-knownPeerExpiredTime - time.Hour).Unix()
+	stale.Successes = 100
+	self := newPeerRecord(tv.peers[tv.selfPeerIndex])
+	self.LastSeen = now.Unix()
+
+	savePeerRecords(path, []*peerRecord{flaky, stale, reliable, self})
+	records := loadPeerRecords(path)
+	if err := utils.TCheckInt("loaded records", 4, len(records)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckString("restored peer", tv.peers[2].ID, records[2].peer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	sortPeerRecords(records, now)
+	if err := utils.TCheckString("the best ranked", tv.peers[2].ID, records[0].peer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale one and self are skipped
+	table := newTable(tv.peers[tv.selfPeerIndex].ID).(*tableImp)
+	table.restore(loadPeerRecords(path))
+	if err := utils.TCheckInt("restored peers", 2, len(table.peers)); err != nil {
+		t.Fatal(err)
+	}
+	if !table.exists(tv.peers[2].ID) || !table.exists(tv.peers[3].ID) {
+		t.Fatal("expect the known peers restored")
+	}
+	if len(table.getPeers(2, nil)) != 0 {
+		t.Fatal("expect the restored peers unavailable before answering the ping")
+	}
+	if err := utils.TCheckInt("peers to ping", 2, len(table.getPeersToPing())); err != nil {
+		t.Fatal(err)
+	}
+
+	// broken file
+	ioutil.WriteFile(path, []byte("broken"), 0644)
+	if len(loadPeerRecords(path)) != 0 {
+		t.Fatal("expect no records from the broken file")
+	}
+}
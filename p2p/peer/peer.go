@@ -5,6 +5,7 @@ import (
 	"net"
 
 	"github.com/996BC/996.Blockchain/crypto"
+	"github.com/996BC/996.Blockchain/utils"
 	"github.com/btcsuite/btcd/btcec"
 )
 
@@ -50,6 +51,39 @@ func (p *Peer) Address() string {
 	return fmt.Sprintf("[%s]:%d", p.IP.String(), p.Port)
 }
 
+// Record is the peer's representation saved into the files
+type Record struct {
+	Key  string `json:"key"` // hex of the compressed public key
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+}
+
+// NewRecord create a Record of p, p.Key must not be nil
+func NewRecord(p *Peer) Record {
+	return Record{
+		Key:  utils.ToHex(p.Key.SerializeCompressed()),
+		IP:   p.IP.String(),
+		Port: p.Port,
+	}
+}
+
+// Parse restores the Peer of the record loaded from the file
+func (r *Record) Parse() (*Peer, error) {
+	keyBytes, err := utils.FromHex(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	key, err := btcec.ParsePubKey(keyBytes, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(r.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip:%s", r.IP)
+	}
+	return NewPeer(ip, r.Port, key), nil
+}
+
 // Provider defines the interface for the peer provider
 type Provider interface {
 	Start()
@@ -19,6 +19,12 @@ const (
 	pingHashExpiredTime       = peerExpiredTime
 )
 
+// signedPacket is the discover packet of version 2
+type signedPacket interface {
+	Verify() bool
+	SignContentHash() []byte
+}
+
 var (
 	logger = utils.NewLogger("discover")
 )
@@ -26,30 +32,58 @@ var (
 type provider struct {
 	ip            net.IP
 	port          int
+	privKey       *btcec.PrivateKey
 	compressedKey []byte
 	udp           utils.UDPServer
 	table         table
-	pingHash      map[string]time.Time // hash as key
+	pingHash      map[string]*pingRecord // pingKey as key
+
+	// the unsigned version 1 packets are accepted during the transition
+	acceptV1 bool
+	// the hash of the received signed content and its head time, to reject the replayed packets
+	received map[string]int64
+
+	// the known peers are saved into the file, no persistence if empty
+	tablePath string
 
 	lm *utils.LoopMode
 }
 
-func NewProvider(ipstr string, port int, publicKey *btcec.PublicKey) Provider {
+// pingRecord is the ping waiting for the pong
+type pingRecord struct {
+	time time.Time
+	addr string
+	id   string // empty if the key of the seed is unknown
+}
+
+// NewProvider creates the provider signing the packets with privKey,
+// acceptV1 keeps accepting the unsigned packets of the nodes not upgraded yet,
+// the known peers saved in tablePath are restored and pinged besides the seeds
+func NewProvider(ipstr string, port int, privKey *btcec.PrivateKey, acceptV1 bool, tablePath string) Provider {
 	ip := net.ParseIP(ipstr)
 	if ip == nil {
 		logger.Fatal("invalid ip:%s\n", ipstr)
 	}
 
+	publicKey := privKey.PubKey()
 	p := &provider{
 		ip:            ip,
 		port:          port,
+		privKey:       privKey,
 		compressedKey: publicKey.SerializeCompressed(),
 		table:         newTable(crypto.PubKeyToID(publicKey)),
-		pingHash:      make(map[string]time.Time),
+		pingHash:      make(map[string]*pingRecord),
+		acceptV1:      acceptV1,
+		received:      make(map[string]int64),
+		tablePath:     tablePath,
 		lm:            utils.NewLoop(1),
 	}
 	p.udp = utils.NewUDPServer(ip, port)
 
+	if len(tablePath) != 0 {
+		p.table.restore(loadPeerRecords(tablePath))
+	}
+
 	return p
 }
 
@@ -65,6 +99,7 @@ func (p *provider) Start() {
 func (p *provider) Stop() {
 	if p.lm.Stop() {
 		p.udp.Stop()
+		p.saveTable()
 	}
 }
 
@@ -116,6 +151,10 @@ func (p *provider) handleRecv(pkt *utils.UDPPacket) {
 		logger.Debug("expired Packet from %v\n", pkt.Addr)
 		return
 	}
+	if head.Time > now+msgDiscardTime {
+		logger.Debug("Packet from the future from %v\n", pkt.Addr)
+		return
+	}
 
 	switch head.Type {
 	case discover.MsgPing:
@@ -144,11 +183,17 @@ func (p *provider) ping() {
 	targets := p.table.getPeersToPing()
 
 	for _, peer := range targets {
-		pkt := discover.NewPing(p.compressedKey).Marshal()
+		ping := discover.NewPing(p.compressedKey)
+		ping.Sign(p.privKey)
+		pkt := ping.Marshal()
 
 		if addr, err := net.ResolveUDPAddr("udp", peer.Address()); err == nil {
 			p.send(pkt, addr)
-			p.pingHash[utils.ToHex(utils.Hash(pkt))] = time.Now()
+			p.pingHash[pingKey(utils.Hash(pkt), addr)] = &pingRecord{
+				time: time.Now(),
+				addr: addr.String(),
+				id:   peer.ID,
+			}
 		}
 	}
 }
@@ -157,7 +202,9 @@ func (p *provider) getNeighbours() {
 	targets := p.table.getPeersToGetNeighbours()
 
 	for _, peer := range targets {
-		pkt := discover.NewGetNeighbours(p.compressedKey).Marshal()
+		getNeighbours := discover.NewGetNeighbours(p.compressedKey)
+		getNeighbours.Sign(p.privKey)
+		pkt := getNeighbours.Marshal()
 
 		if addr, err := net.ResolveUDPAddr("udp", peer.Address()); err == nil {
 			p.send(pkt, addr)
@@ -171,21 +218,22 @@ func (p *provider) handlePing(data []byte, remoteAddr *net.UDPAddr) {
 		logger.Warn("receive error ping:%v\n", err)
 		return
 	}
+	if !p.authenticate(ping.Head, ping, remoteAddr) {
+		return
+	}
 
 	key, err := btcec.ParsePubKey(ping.PubKey, btcec.S256())
 	if err != nil {
 		logger.Warn("parse ping key failed:%v\n", err)
+		return
 	}
 	p.table.recvPing(NewPeer(remoteAddr.IP, remoteAddr.Port, key))
 
 	// response ping
 	pingHash := utils.Hash(data)
-	pong := discover.NewPong(pingHash, p.compressedKey).Marshal()
-	if pong == nil {
-		logger.Warn("generate Pong failed\n")
-		return
-	}
-	p.send(pong, remoteAddr)
+	pong := discover.NewPong(pingHash, p.compressedKey)
+	pong.Sign(p.privKey)
+	p.send(pong.Marshal(), remoteAddr)
 }
 
 func (p *provider) handlePong(data []byte, remoteAddr *net.UDPAddr) {
@@ -194,16 +242,27 @@ func (p *provider) handlePong(data []byte, remoteAddr *net.UDPAddr) {
 		logger.Warn("receive error Pong:%v\n", err)
 		return
 	}
+	if !p.authenticate(pong.Head, pong, remoteAddr) {
+		return
+	}
 
-	pingHash := utils.ToHex(pong.PingHash)
-	if _, ok := p.pingHash[pingHash]; !ok {
+	// the pong must answer the ping sent to the address, from the pinged node
+	recordKey := pingKey(pong.PingHash, remoteAddr)
+	record, ok := p.pingHash[recordKey]
+	if !ok {
+		logger.Debug("Pong from %v answers no ping to the address\n", remoteAddr)
 		return
 	}
-	delete(p.pingHash, pingHash)
+	if len(record.id) != 0 && record.id != crypto.BytesToID(pong.PubKey) {
+		logger.Warn("Pong from %v is not from the pinged node %s\n", remoteAddr, record.id)
+		return
+	}
+	delete(p.pingHash, recordKey)
 
 	key, err := btcec.ParsePubKey(pong.PubKey, btcec.S256())
 	if err != nil {
 		logger.Warn("parse ping key failed:%v\n", err)
+		return
 	}
 	p.table.recvPong(NewPeer(remoteAddr.IP, remoteAddr.Port, key))
 }
@@ -214,6 +273,9 @@ func (p *provider) handleGetNeigoubours(data []byte, remoteAddr *net.UDPAddr) {
 		logger.Warn("receive error GetNeighbours:%v\n", err)
 		return
 	}
+	if !p.authenticate(getNeibours.Head, getNeibours, remoteAddr) {
+		return
+	}
 
 	remotePubKey, err := btcec.ParsePubKey(getNeibours.PubKey, btcec.S256())
 	if err != nil {
@@ -249,6 +311,13 @@ func (p *provider) handleNeigoubours(data []byte, remoteAddr *net.UDPAddr) {
 		logger.Warn("receive error Neighbours:%v\n", err)
 		return
 	}
+	if !p.authenticate(neighbours.Head, neighbours, remoteAddr) {
+		return
+	}
+	if neighbours.Signed() && !p.table.exists(crypto.BytesToID(neighbours.PubKey)) {
+		logger.Warn("Neighbours is not from my peer and ignore it: %v\n", remoteAddr)
+		return
+	}
 
 	var peers []*Peer
 	for _, n := range neighbours.Nodes {
@@ -265,13 +334,58 @@ func (p *provider) handleNeigoubours(data []byte, remoteAddr *net.UDPAddr) {
 
 func (p *provider) refresh() {
 	p.table.refresh()
+	p.saveTable()
 
 	curr := time.Now()
 	for k, v := range p.pingHash {
-		if curr.Sub(v) > pingHashExpiredTime {
+		if curr.Sub(v.time) > pingHashExpiredTime {
 			delete(p.pingHash, k)
 		}
 	}
+
+	// the replayed packets after the window are discarded as expired
+	for k, t := range p.received {
+		if t+msgDiscardTime < curr.Unix() {
+			delete(p.received, k)
+		}
+	}
+}
+
+func (p *provider) saveTable() {
+	if len(p.tablePath) == 0 {
+		return
+	}
+	savePeerRecords(p.tablePath, p.table.getKnownPeers())
+}
+
+// authenticate checks the packet is signed by the sender and not replayed,
+// the unsigned version 1 packets are only accepted during the transition
+func (p *provider) authenticate(head *discover.Head, pkt signedPacket, remoteAddr *net.UDPAddr) bool {
+	switch head.Version {
+	case discover.DiscoverV1:
+		if !p.acceptV1 {
+			logger.Debug("unsigned Packet from %v\n", remoteAddr)
+			return false
+		}
+		return true
+	case discover.DiscoverV2:
+	default:
+		logger.Debug("unknown version %d Packet from %v\n", head.Version, remoteAddr)
+		return false
+	}
+
+	if !pkt.Verify() {
+		logger.Warn("invalid signature of Packet from %v\n", remoteAddr)
+		return false
+	}
+
+	key := utils.ToHex(pkt.SignContentHash())
+	if _, ok := p.received[key]; ok {
+		logger.Debug("replayed Packet from %v\n", remoteAddr)
+		return false
+	}
+	p.received[key] = head.Time
+	return true
 }
 
 func (p *provider) genNeighbours(peers []*Peer) []byte {
@@ -282,10 +396,17 @@ func (p *provider) genNeighbours(peers []*Peer) []byte {
 		nodes = append(nodes, node)
 	}
 
-	neighbours := discover.NewNeighbours(nodes)
+	neighbours := discover.NewNeighbours(nodes, p.compressedKey)
+	neighbours.Sign(p.privKey)
 	return neighbours.Marshal()
 }
 
+// pingKey identifies the ping with the target address as well,
+// the pings sent to different addresses in the same second are the same packet
+func pingKey(hash []byte, addr *net.UDPAddr) string {
+	return utils.ToHex(hash) + "@" + addr.String()
+}
+
 // only used in test
 func (p *provider) getAllPeersForTest() map[string]*Peer {
 	result := make(map[string]*Peer)
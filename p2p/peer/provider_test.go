@@ -7,9 +7,10 @@ import (
 	"testing"
 	"time"
 
-	"github.com/btcsuite/btcd/btcec"
+	"github.com/996BC/996.Blockchain/crypto"
 	"github.com/996BC/996.Blockchain/serialize/discover"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 var providerTestVar = &struct {
@@ -19,7 +20,7 @@ var providerTestVar = &struct {
 	ip          net.IP
 	port        int
 	addr        *net.UDPAddr
-	pubKeyHex   string
+	privKey     *btcec.PrivateKey
 	pubKeyBytes []byte
 	pubKey      *btcec.PublicKey
 
@@ -27,37 +28,39 @@ var providerTestVar = &struct {
 	remoteIP          net.IP
 	remotePort        int
 	remoteAddr        *net.UDPAddr
-	remotePubKeyHex   string
+	remotePrivKey     *btcec.PrivateKey
 	remotePubKeyBytes []byte
 	remotePubKey      *btcec.PublicKey
 }{
-	ip:        net.ParseIP("192.168.1.1"),
-	port:      10000,
-	pubKeyHex: "029ab6627bffd4ee5b5a6f1f96b2730980ca14033bd6f3a63764c1f1aedd3634eb",
+	ip:   net.ParseIP("192.168.1.1"),
+	port: 10000,
 
-	remoteIP:        net.ParseIP("192.168.1.2"),
-	remotePort:      10081,
-	remotePubKeyHex: "031ceff33b51b2b013cc7139981dad78f919bdf4d9d0f767cfdec6ed96c8b2492b",
+	remoteIP:   net.ParseIP("192.168.1.2"),
+	remotePort: 10081,
 }
 
 func init() {
 	tv := providerTestVar
 
 	tv.addr = &net.UDPAddr{IP: tv.ip, Port: tv.port}
-	tv.pubKeyBytes, _ = utils.FromHex(tv.pubKeyHex)
-	tv.pubKey, _ = btcec.ParsePubKey(tv.pubKeyBytes, btcec.S256())
+	tv.privKey, _ = btcec.NewPrivateKey(btcec.S256())
+	tv.pubKey = tv.privKey.PubKey()
+	tv.pubKeyBytes = tv.pubKey.SerializeCompressed()
 
 	tv.remoteAddr = &net.UDPAddr{IP: tv.remoteIP, Port: tv.remotePort}
-	tv.remotePubKeyBytes, _ = utils.FromHex(tv.remotePubKeyHex)
-	tv.remotePubKey, _ = btcec.ParsePubKey(tv.remotePubKeyBytes, btcec.S256())
+	tv.remotePrivKey, _ = btcec.NewPrivateKey(btcec.S256())
+	tv.remotePubKey = tv.remotePrivKey.PubKey()
+	tv.remotePubKeyBytes = tv.remotePubKey.SerializeCompressed()
 
 	tv.p = &provider{
 		ip:            tv.ip,
 		port:          tv.port,
+		privKey:       tv.privKey,
 		compressedKey: tv.pubKeyBytes,
 		udp:           newUDPServerMock(),
 		table:         newTableStub(),
-		pingHash:      make(map[string]time.Time),
+		pingHash:      make(map[string]*pingRecord),
+		received:      make(map[string]int64),
 	}
 }
 
@@ -86,12 +89,19 @@ func TestPing(t *testing.T) {
 	if err := utils.TCheckBytes("request public key", tv.pubKeyBytes, ping.PubKey); err != nil {
 		t.Fatal(err)
 	}
+	if !ping.Verify() {
+		t.Fatal("expect signed Ping")
+	}
 
 	// check pingHash and cleanup
-	pingHashKey := utils.ToHex(utils.Hash(pingPkt))
-	if _, ok := p.pingHash[pingHashKey]; !ok {
+	pingHashKey := pingKey(utils.Hash(pingPkt), tv.remoteAddr)
+	record, ok := p.pingHash[pingHashKey]
+	if !ok {
 		t.Fatalf("expect existing pingHash %s\n", pingHashKey)
 	}
+	if err := utils.TCheckString("pinged address", tv.remoteAddr.String(), record.addr); err != nil {
+		t.Fatal(err)
+	}
 	delete(p.pingHash, pingHashKey)
 }
 
@@ -120,13 +130,18 @@ func TestGetNeighbours(t *testing.T) {
 	if err := utils.TCheckBytes("request public key", tv.pubKeyBytes, getNeighbour.PubKey); err != nil {
 		t.Fatal(err)
 	}
+	if !getNeighbour.Verify() {
+		t.Fatal("expect signed GetNeighbours")
+	}
 }
 
 func TestHandlePing(t *testing.T) {
 	tv := providerTestVar
 	p := providerTestVar.p
 
-	remotePingPkt := discover.NewPing(tv.remotePubKeyBytes).Marshal()
+	remotePing := discover.NewPing(tv.remotePubKeyBytes)
+	remotePing.Sign(tv.remotePrivKey)
+	remotePingPkt := remotePing.Marshal()
 	p.handlePing(remotePingPkt, tv.remoteAddr)
 
 	// verify response
@@ -151,6 +166,15 @@ func TestHandlePing(t *testing.T) {
 	if err := utils.TCheckBytes("response public key", p.compressedKey, pong.PubKey); err != nil {
 		t.Fatal(err)
 	}
+	if !pong.Verify() {
+		t.Fatal("expect signed Pong")
+	}
+
+	// replayed
+	p.handlePing(remotePingPkt, tv.remoteAddr)
+	if err := udpMock.checkSendQSize(0); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestHandlePong(t *testing.T) {
@@ -158,25 +182,61 @@ func TestHandlePong(t *testing.T) {
 	p := providerTestVar.p
 
 	pingHash := utils.Hash([]byte("a_ping_hash"))
-	pingHashKey := utils.ToHex(pingHash)
-	pongPkt := discover.NewPong(pingHash, tv.remotePubKeyBytes).Marshal()
+	pingHashKey := pingKey(pingHash, tv.remoteAddr)
+	p.pingHash[pingHashKey] = &pingRecord{
+		time: time.Now(),
+		addr: tv.remoteAddr.String(),
+		id:   crypto.PubKeyToID(tv.remotePubKey),
+	}
+
+	// not from the pinged node
+	otherKey, _ := btcec.NewPrivateKey(btcec.S256())
+	forgedPong := discover.NewPong(pingHash, otherKey.PubKey().SerializeCompressed())
+	forgedPong.Sign(otherKey)
+	p.handlePong(forgedPong.Marshal(), tv.remoteAddr)
+
+	// signed by another key
+	unsignedPong := discover.NewPong(pingHash, tv.remotePubKeyBytes)
+	unsignedPong.Sign(otherKey)
+	p.handlePong(unsignedPong.Marshal(), tv.remoteAddr)
+
+	// not from the pinged address
+	misaddressedPong := discover.NewPong(pingHash, tv.remotePubKeyBytes)
+	misaddressedPong.Time--
+	misaddressedPong.Sign(tv.remotePrivKey)
+	p.handlePong(misaddressedPong.Marshal(), &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 999})
+
+	if len(p.pingHash) != 1 {
+		t.Fatal("expect the forged pong ignored\n")
+	}
 
-	p.pingHash[pingHashKey] = time.Now()
-	p.handlePong(pongPkt, tv.remoteAddr)
+	// the same ping sent to another address in the same second
+	otherAddr := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 999}
+	p.pingHash[pingKey(pingHash, otherAddr)] = &pingRecord{
+		time: time.Now(),
+		addr: otherAddr.String(),
+	}
 
-	if len(p.pingHash) != 0 {
+	pong := discover.NewPong(pingHash, tv.remotePubKeyBytes)
+	pong.Sign(tv.remotePrivKey)
+	p.handlePong(pong.Marshal(), tv.remoteAddr)
+	if _, ok := p.pingHash[pingHashKey]; ok {
 		t.Fatal("expect clean pingHash after handle pong\n")
 	}
+	if _, ok := p.pingHash[pingKey(pingHash, otherAddr)]; !ok {
+		t.Fatal("expect the ping to the other address kept\n")
+	}
+	delete(p.pingHash, pingKey(pingHash, otherAddr))
 }
 
 func TestHandleGetNeighboursNotFromMyPeers(t *testing.T) {
 	p := providerTestVar.p
 
-	unknownPeerKeyHex := "0429a89e5077cb36383e81b43bd06e4aa0bc7ffd55acf15e5406233614b5f95942a33e817823a04d606c6309cbfdee533340a679d734883beea5101b69cb309c4e"
-	unknownPeerKeyBytes, _ := utils.FromHex(unknownPeerKeyHex)
+	unknownPeerKey, _ := btcec.NewPrivateKey(btcec.S256())
 
-	getNeighboursPkt := discover.NewGetNeighbours(unknownPeerKeyBytes).Marshal()
-	p.handleGetNeigoubours(getNeighboursPkt, &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 999})
+	getNeighbours := discover.NewGetNeighbours(unknownPeerKey.PubKey().SerializeUncompressed())
+	getNeighbours.Sign(unknownPeerKey)
+	p.handleGetNeigoubours(getNeighbours.Marshal(), &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 999})
 
 	// verify response
 	udpMock := p.udp.(*udpServerMock)
@@ -189,8 +249,9 @@ func TestHandleGetNeighbours(t *testing.T) {
 	tv := providerTestVar
 	p := providerTestVar.p
 
-	getNeighboursPkt := discover.NewGetNeighbours(tv.remotePubKeyBytes).Marshal()
-	p.handleGetNeigoubours(getNeighboursPkt, tv.remoteAddr)
+	getNeighbours := discover.NewGetNeighbours(tv.remotePubKeyBytes)
+	getNeighbours.Sign(tv.remotePrivKey)
+	p.handleGetNeigoubours(getNeighbours.Marshal(), tv.remoteAddr)
 
 	// verify response
 	udpMock := p.udp.(*udpServerMock)
@@ -208,6 +269,9 @@ func TestHandleGetNeighbours(t *testing.T) {
 		t.Fatal("unmarshal Neighbours failed\n")
 	}
 
+	if !neighbours.Verify() {
+		t.Fatal("expect signed Neighbours\n")
+	}
 	if len(neighbours.Nodes) != 1 {
 		t.Fatal("expect 1 node in Neighbours\n")
 	}
@@ -228,13 +292,26 @@ func TestHandleNeighbours(t *testing.T) {
 	tv := providerTestVar
 	p := providerTestVar.p
 
-	neighbourPkt := discover.NewNeighbours([]*discover.Node{
+	nodes := []*discover.Node{
 		discover.NewNode(discover.NewAddress(tv.remoteIP.String(), int32(tv.remotePort)), tv.remotePubKeyBytes),
-	}).Marshal()
-	p.handleNeigoubours(neighbourPkt, tv.remoteAddr)
+	}
+	table := p.table.(*tableMock)
+	table.add = nil
+
+	// not from my peer
+	unknownPeerKey, _ := btcec.NewPrivateKey(btcec.S256())
+	junk := discover.NewNeighbours(nodes, unknownPeerKey.PubKey().SerializeCompressed())
+	junk.Sign(unknownPeerKey)
+	p.handleNeigoubours(junk.Marshal(), &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 999})
+	if err := utils.TCheckInt("table add list size of the junk", 0, len(table.add)); err != nil {
+		t.Fatal(err)
+	}
+
+	neighbours := discover.NewNeighbours(nodes, tv.remotePubKeyBytes)
+	neighbours.Sign(tv.remotePrivKey)
+	p.handleNeigoubours(neighbours.Marshal(), tv.remoteAddr)
 
 	// verify add result
-	table := p.table.(*tableMock)
 	if err := utils.TCheckInt("table add list size", 1, len(table.add)); err != nil {
 		t.Fatal(err)
 	}
@@ -248,6 +325,32 @@ func TestHandleNeighbours(t *testing.T) {
 	}
 }
 
+func TestHandleUnsignedV1(t *testing.T) {
+	tv := providerTestVar
+	p := providerTestVar.p
+	udpMock := p.udp.(*udpServerMock)
+	udpMock.sendQ = nil
+	defer func() { p.acceptV1 = false }()
+
+	ping := discover.NewPing(tv.remotePubKeyBytes)
+	ping.Head = discover.NewHeadV1(discover.MsgPing)
+	pingPkt := ping.Marshal()
+
+	p.acceptV1 = false
+	p.handlePing(pingPkt, tv.remoteAddr)
+	if err := udpMock.checkSendQSize(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// during the transition
+	p.acceptV1 = true
+	p.handlePing(pingPkt, tv.remoteAddr)
+	if err := udpMock.checkSendQSize(1); err != nil {
+		t.Fatal(err)
+	}
+	udpMock.pop()
+}
+
 /////////////////////////////////////////////////tableMock
 
 type tableMock struct {
@@ -275,9 +378,13 @@ func (t *tableMock) getPeersToPing() []*Peer {
 func (t *tableMock) getPeersToGetNeighbours() []*Peer {
 	return []*Peer{t.peer}
 }
-func (t *tableMock) recvPing(p *Peer) {}
-func (t *tableMock) recvPong(p *Peer) {}
-func (t *tableMock) refresh()         {}
+func (t *tableMock) recvPing(p *Peer)              {}
+func (t *tableMock) recvPong(p *Peer)              {}
+func (t *tableMock) refresh()                      {}
+func (t *tableMock) restore(records []*peerRecord) {}
+func (t *tableMock) getKnownPeers() []*peerRecord {
+	return nil
+}
 
 ////////////////////////////////////////////////udpServerMock
 
@@ -20,6 +20,11 @@ type table interface {
 	recvPong(p *Peer)
 
 	refresh()
+
+	// restore adds the best ranked known peers saved before
+	restore(records []*peerRecord)
+	// getKnownPeers returns the history of the known peers to save
+	getKnownPeers() []*peerRecord
 }
 
 const (
@@ -29,9 +34,10 @@ const (
 
 type tableImp struct {
 	selfID       string
-	seeds        map[string]*pstate   // "ip:port" as key
-	peers        map[string]*pstate   // ID as key, ID = base32(compressPubKey)
-	coolingPeers map[string]time.Time // ID as key
+	seeds        map[string]*pstate     // "ip:port" as key
+	peers        map[string]*pstate     // ID as key, ID = base32(compressPubKey)
+	coolingPeers map[string]time.Time   // ID as key
+	known        map[string]*peerRecord // ID as key, the peers ever answered the ping
 	r            *rand.Rand
 	lock         sync.Mutex
 }
@@ -42,6 +48,7 @@ func newTable(selfID string) table {
 		seeds:        make(map[string]*pstate),
 		peers:        make(map[string]*pstate),
 		coolingPeers: make(map[string]time.Time),
+		known:        make(map[string]*peerRecord),
 		r:            rand.New(rand.NewSource(time.Now().Unix())),
 	}
 }
@@ -82,7 +89,35 @@ func (t *tableImp) getPeers(expect int, exclude map[string]bool) []*Peer {
 		peers[i], peers[j] = peers[j], peers[i]
 	}
 
-	return peers[:expect]
+	return pickDiverse(peers, expect)
+}
+
+// pickDiverse picks the peers from the address groups in turn, so that
+// the peers of a single operator with many addresses can't take all the places
+func pickDiverse(peers []*Peer, expect int) []*Peer {
+	var groups []string
+	buckets := make(map[string][]*Peer)
+	for _, p := range peers {
+		group := p.GroupKey()
+		if _, ok := buckets[group]; !ok {
+			groups = append(groups, group)
+		}
+		buckets[group] = append(buckets[group], p)
+	}
+
+	var result []*Peer
+	for len(result) < expect {
+		for _, group := range groups {
+			if len(result) == expect {
+				break
+			}
+			if bucket := buckets[group]; len(bucket) != 0 {
+				result = append(result, bucket[0])
+				buckets[group] = bucket[1:]
+			}
+		}
+	}
+	return result
 }
 
 func (t *tableImp) exists(id string) bool {
@@ -149,6 +184,7 @@ func (t *tableImp) recvPong(p *Peer) {
 	defer t.lock.Unlock()
 
 	if peer, ok := t.peers[p.ID]; ok {
+		t.recordSeen(p, !peer.isAvaible())
 		peer.updateActiveTime()
 		return
 	}
@@ -158,6 +194,7 @@ func (t *tableImp) recvPong(p *Peer) {
 		pst := newPState(p, true)
 		pst.updateActiveTime()
 		t.add(pst)
+		t.recordSeen(p, true)
 
 		delete(t.seeds, addr)
 	}
@@ -171,6 +208,9 @@ func (t *tableImp) refresh() {
 		if peer.isToRemove() {
 			logger.Debug("p2p peer %v timeout, clean\n", peer.Peer)
 			delete(t.peers, peer.ID)
+			if record, ok := t.known[peer.ID]; ok {
+				record.Failures++
+			}
 		}
 	}
 
@@ -180,6 +220,78 @@ func (t *tableImp) refresh() {
 			delete(t.coolingPeers, k)
 		}
 	}
+
+	for k, v := range t.known {
+		if v.isExpired(curr) {
+			delete(t.known, k)
+		}
+	}
+	if len(t.known) > maxKnownPeers {
+		records := t.knownList()
+		sortPeerRecords(records, curr)
+		for _, r := range records[maxKnownPeers:] {
+			delete(t.known, r.peer.ID)
+		}
+	}
+}
+
+func (t *tableImp) restore(records []*peerRecord) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	curr := time.Now()
+	var restored []*peerRecord
+	for _, r := range records {
+		if r.isExpired(curr) || r.peer.ID == t.selfID {
+			continue
+		}
+		t.known[r.peer.ID] = r
+		restored = append(restored, r)
+	}
+
+	// the restored peers are pinged like the new ones,
+	// those not answering are removed by refresh and counted as failures
+	sortPeerRecords(restored, curr)
+	for i, r := range restored {
+		if i >= maxRestoredPeers {
+			break
+		}
+		t.add(newPState(r.peer, false))
+	}
+}
+
+func (t *tableImp) getKnownPeers() []*peerRecord {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var result []*peerRecord
+	for _, r := range t.knownList() {
+		copied := *r
+		result = append(result, &copied)
+	}
+	return result
+}
+
+// knownList helper(should call with lock)
+func (t *tableImp) knownList() []*peerRecord {
+	var result []*peerRecord
+	for _, r := range t.known {
+		result = append(result, r)
+	}
+	return result
+}
+
+// recordSeen helper(should call with lock), reconnected is true if the peer was unavailable
+func (t *tableImp) recordSeen(p *Peer, reconnected bool) {
+	record, ok := t.known[p.ID]
+	if !ok {
+		record = newPeerRecord(p)
+		t.known[p.ID] = record
+	}
+	record.seen(p, time.Now())
+	if reconnected {
+		record.Successes++
+	}
 }
 
 // add helper(should call with lock)
@@ -1,13 +1,14 @@
 package peer
 
 import (
+	"fmt"
 	"net"
 	"testing"
 	"time"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/crypto"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 var tableTestVar = &struct {
@@ -265,3 +266,53 @@ func newTableImp() *tableImp {
 
 	return tImp
 }
+
+func TestAddrGroup(t *testing.T) {
+	for _, c := range []struct {
+		ip    string
+		group string
+	}{
+		{"8.8.8.8", "8.8"},
+		{"8.8.4.4", "8.8"},
+		{"::ffff:8.8.4.4", "8.8"},
+		{"2001:db8:85a3::7344", "2001:0db8"},
+		{"127.0.0.1", ""},
+		{"192.168.1.1", ""},
+		{"10.1.2.3", ""},
+		{"fe80::1", ""},
+	} {
+		if err := utils.TCheckString("group of "+c.ip, c.group, AddrGroup(net.ParseIP(c.ip))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetPeersDiverse(t *testing.T) {
+	table := newTable("self").(*tableImp)
+
+	// a single operator with many addresses in a group
+	var peers []*Peer
+	for i := 0; i < 20; i++ {
+		privKey, _ := btcec.NewPrivateKey(btcec.S256())
+		peers = append(peers, NewPeer(net.ParseIP(fmt.Sprintf("6.6.%d.1", i)), 10000, privKey.PubKey()))
+	}
+	for i := 0; i < 3; i++ {
+		privKey, _ := btcec.NewPrivateKey(btcec.S256())
+		peers = append(peers, NewPeer(net.ParseIP(fmt.Sprintf("%d.1.1.1", i+1)), 10000, privKey.PubKey()))
+	}
+	table.addPeers(peers, false)
+	for _, v := range table.peers {
+		v.updateActiveTime()
+	}
+
+	groups := make(map[string]int)
+	for _, p := range table.getPeers(4, nil) {
+		groups[p.Group()]++
+	}
+	if err := utils.TCheckInt("groups", 4, len(groups)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("peers of the crowded group", 1, groups["6.6"]); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,6 +3,8 @@ package p2p
 import (
 	"errors"
 	"fmt"
+
+	"github.com/996BC/996.Blockchain/params"
 )
 
 // Protocol is the interface that the p2p network protocols must implement
@@ -19,6 +21,13 @@ type ProtocolRunner interface {
 
 	// GetRecvChan returns a channel for getting network data
 	GetRecvChan() <-chan *PeerData
+
+	// Punish adds the misbehavior score to the peer,
+	// the peer is disconnected and banned for a while once its score reaches BanScore
+	Punish(peer string, score int, reason string)
+
+	// GetPeerInfo returns what the peer advertised in the handshake, or nil if it's not connected
+	GetPeerInfo(peer string) *PeerInfo
 }
 
 // PeerData is the data struct used in sending or receiving from netwoks
@@ -30,6 +39,21 @@ type PeerData struct {
 	Data []byte
 }
 
+// PeerInfo is what the peer advertised in the handshake
+type PeerInfo struct {
+	CodeVersion  params.CodeVersion
+	NodeType     params.NodeType
+	Capabilities params.Capability  // 0 if the peer doesn't advertise
+	BestHeight   uint64             // the best height when connected
+	ListenAddr   string             // the address accepting connections, empty if unknown
+	Compression  params.Compression // negotiated from the extensions of both sides, 0 if not compressed
+}
+
+// Has returns true if the peer supports the capability
+func (p *PeerInfo) Has(c params.Capability) bool {
+	return p.Capabilities&c == c
+}
+
 // ErrPeerNotFound means Peer not found
 type ErrPeerNotFound struct {
 	Peer string
@@ -42,19 +66,25 @@ func (p ErrPeerNotFound) Error() string {
 // ErrNoPeers means don't find any peers on the network
 var ErrNoPeers = errors.New("Not found any peers on the network yet")
 
-//////////////////////////////////////////////////////////////////////////////////////
+// ////////////////////////////////////////////////////////////////////////////////////
 type protocolRunner struct {
-	protocol Protocol
-	Data     chan *PeerData
-	sendFunc func(p Protocol, dp *PeerData) error
-	n        *node
+	protocol   Protocol
+	Data       chan *PeerData
+	sendFunc   func(p Protocol, dp *PeerData) error
+	punishFunc func(p Protocol, peer string, score int, reason string)
+	infoFunc   func(peer string) *PeerInfo
+	n          *node
 }
 
-func newProtocolRunner(protocol Protocol, sendFunc func(p Protocol, dp *PeerData) error) *protocolRunner {
+func newProtocolRunner(protocol Protocol, sendFunc func(p Protocol, dp *PeerData) error,
+	punishFunc func(p Protocol, peer string, score int, reason string),
+	infoFunc func(peer string) *PeerInfo) *protocolRunner {
 	runner := &protocolRunner{
-		protocol: protocol,
-		Data:     make(chan *PeerData, 2048),
-		sendFunc: sendFunc,
+		protocol:   protocol,
+		Data:       make(chan *PeerData, 2048),
+		sendFunc:   sendFunc,
+		punishFunc: punishFunc,
+		infoFunc:   infoFunc,
 	}
 	return runner
 }
@@ -66,3 +96,11 @@ func (p *protocolRunner) Send(dp *PeerData) error {
 func (p *protocolRunner) GetRecvChan() <-chan *PeerData {
 	return p.Data
 }
+
+func (p *protocolRunner) Punish(peer string, score int, reason string) {
+	p.punishFunc(p.protocol, peer, score, reason)
+}
+
+func (p *protocolRunner) GetPeerInfo(peer string) *PeerInfo {
+	return p.infoFunc(peer)
+}
@@ -14,14 +14,71 @@ type CodeVersion uint16
 const (
 	// NodeVersionV1 starts from v1.0.0
 	NodeVersionV1 = CodeVersion(1)
+
+	// NodeVersionV2 negotiates the capabilities in the handshake
+	NodeVersionV2 = CodeVersion(2)
 )
 
-var CurrentCodeVersion = NodeVersionV1
+var CurrentCodeVersion = NodeVersionV2
 var MinimizeVersionRequired = NodeVersionV1
 
+/////////////////////////////////////////////////////////////////
+
+// Capability is the bitfield of the features supported by the node,
+// the features are only used with the peers advertising them in the handshake
+type Capability = uint32
+
+const (
+	// CapCompactBlock relays the blocks as compact blocks
+	CapCompactBlock = Capability(1 << 0)
+
+	// CapCompression compresses the messages of the connection with an algorithm
+	// listed by both sides in the handshake extension
+	CapCompression = Capability(1 << 1)
+
+	// CapLightServing serves the block headers and evidences for the light nodes
+	CapLightServing = Capability(1 << 2)
+
+	// CapEvidenceProof replies the evidence proofs
+	CapEvidenceProof = Capability(1 << 3)
+)
+
+// Compression identifies the compression algorithm of the messages
+type Compression = uint8
+
+const (
+	// CompressionDeflate is DEFLATE of RFC 1951
+	CompressionDeflate = Compression(1)
+)
+
+// NodeCapabilities returns the capabilities supported by the node type
+func NodeCapabilities(t NodeType) Capability {
+	if t == LightNode {
+		return CapCompactBlock
+	}
+	return CapCompactBlock | CapLightServing | CapEvidenceProof
+}
+
 ////////////////////////////////////////////////////////////////
 
 const (
 	// BlockSize is 1MB
 	BlockSize = 1024 * 1024
+
+	// MaxEvidencesInBlock limits the evidence number of a block
+	MaxEvidencesInBlock = 4096
+)
+
+////////////////////////////////////////////////////////////////
+
+const (
+	// DevnetChainID is the chain ID of the local development network,
+	// the handshake refuses peers with different chain ID, so devnet peers never connect to other networks
+	DevnetChainID = uint8(0xDE)
+
+	// DevnetTargetLimit is the minimal difficulty, nearly half of the pow values satisfy it
+	DevnetTargetLimit = uint32(0xFFFFFFFF)
+
+	// DevnetBlockInterval is the expected block interval(seconds) of devnet
+	DevnetBlockInterval = 1
 )
@@ -0,0 +1,219 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/996BC/996.Blockchain/p2p"
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	adminPath = "/admin"
+
+	maxMineBlocksNum = 1024
+)
+
+var (
+	// AdminV1Path /v1/admin
+	AdminV1Path = version1Path + adminPath
+
+	// MineBlocksV1Path POST /v1/admin/mine
+	MineBlocksV1Path = AdminV1Path + "/mine"
+
+	// BackupV1Path GET /v1/admin/backup
+	BackupV1Path = AdminV1Path + "/backup"
+
+	// GetBansV1Path GET /v1/admin/peer/bans
+	GetBansV1Path = AdminV1Path + "/peer/bans"
+
+	// BanPeerV1Path POST /v1/admin/peer/ban
+	BanPeerV1Path = AdminV1Path + "/peer/ban"
+
+	// UnbanPeerV1Path POST /v1/admin/peer/unban
+	UnbanPeerV1Path = AdminV1Path + "/peer/unban"
+
+	adminHandlers = HTTPHandlers{
+		{MineBlocksV1Path, mineBlocks},
+		{BackupV1Path, backup},
+		{GetBansV1Path, getBans},
+		{BanPeerV1Path, banPeer},
+		{UnbanPeerV1Path, unbanPeer},
+	}
+)
+
+// BackupContentType is the content type of the backup response,
+// the failure before streaming is responded in json as usual
+const BackupContentType = "application/octet-stream"
+
+/*
+POST /v1/admin/mine?num=...
+
+mines 'num' blocks immediately, only available in devnet
+*/
+type MineBlocksResponse struct {
+	Hash []string `json:"hash"`
+}
+
+func mineBlocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		badRequestResponse(w)
+		return
+	}
+
+	param, ok := r.URL.Query()[GetNumParam]
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+
+	num, err := strconv.Atoi(param[0])
+	if err != nil || num <= 0 || num > maxMineBlocksNum {
+		badRequestResponse(w)
+		return
+	}
+
+	hashes, err := globalSvr.c.MineBlocks(num)
+	if err != nil {
+		logger.Info("mine blocks failed:%v\n", err)
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	resp := &MineBlocksResponse{}
+	for _, hash := range hashes {
+		resp.Hash = append(resp.Hash, utils.ToHex(hash))
+	}
+	successWithDataResponse(resp, w)
+}
+
+/*
+GET /v1/admin/backup
+
+streams a consistent backup of the database while the node keeps running,
+the height and hash of the latest block in it are recorded in the backup header
+*/
+func backup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		badRequestResponse(w)
+		return
+	}
+
+	bw := &backupWriter{w: w}
+	header, err := globalSvr.c.Backup(bw)
+	if err != nil {
+		logger.Warn("backup failed:%v\n", err)
+		// the truncated backup is found by its checksum
+		if !bw.started {
+			failedResponse(err.Error(), w)
+		}
+		return
+	}
+	logger.Info("backup finished, the latest block is %d %X\n", header.Height, header.Hash)
+}
+
+// backupWriter writes the response header before the first write
+type backupWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (b *backupWriter) Write(p []byte) (int, error) {
+	if !b.started {
+		b.w.Header().Set("Content-Type", BackupContentType)
+		b.w.WriteHeader(http.StatusOK)
+		b.started = true
+	}
+	return b.w.Write(p)
+}
+
+/*
+GET /v1/admin/peer/bans
+
+lists the banned peers, the peers are banned by the admin or for misbehaving
+*/
+type GetBansResponse struct {
+	Bans []*BanInfo `json:"bans"`
+}
+
+type BanInfo struct {
+	ID     string `json:"id"`
+	Until  int64  `json:"until"`
+	Reason string `json:"reason"`
+}
+
+func getBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		badRequestResponse(w)
+		return
+	}
+
+	resp := &GetBansResponse{}
+	for _, b := range globalSvr.c.GetBans() {
+		resp.Bans = append(resp.Bans, &BanInfo{
+			ID:     b.ID,
+			Until:  b.Until,
+			Reason: b.Reason,
+		})
+	}
+	successWithDataResponse(resp, w)
+}
+
+/*
+POST /v1/admin/peer/ban?id=...&duration=...
+
+disconnects the peer and refuses to connect it for the duration like "72h",
+the default duration is 24h
+*/
+func banPeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		badRequestResponse(w)
+		return
+	}
+
+	id, ok := r.URL.Query()[GetIDParam]
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+
+	duration := p2p.DefaultBanDuration
+	if param, ok := r.URL.Query()[GetDurationParam]; ok {
+		var err error
+		if duration, err = time.ParseDuration(param[0]); err != nil || duration <= 0 {
+			badRequestResponse(w)
+			return
+		}
+	}
+
+	if err := globalSvr.c.BanPeer(id[0], duration); err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+	successResponse(w)
+}
+
+/*
+POST /v1/admin/peer/unban?id=...
+
+allows the banned peer to connect again
+*/
+func unbanPeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		badRequestResponse(w)
+		return
+	}
+
+	id, ok := r.URL.Query()[GetIDParam]
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+
+	if err := globalSvr.c.UnbanPeer(id[0]); err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+	successResponse(w)
+}
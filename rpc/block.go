@@ -25,9 +25,13 @@ var (
 	// QueryBlockViaHashV1Path GET /v1/block/query-via-hash
 	QueryBlockViaHashV1Path = BlocksV1Path + "/query-via-hash"
 
+	// QueryBlockViaTimeV1Path GET /v1/block/query-via-time
+	QueryBlockViaTimeV1Path = BlocksV1Path + "/query-via-time"
+
 	blockHandler = HTTPHandlers{
 		{QueryBlockViaRangeV1Path, getBlockViaRange},
 		{QueryBlockViaHashV1Path, getBlockViaHash},
+		{QueryBlockViaTimeV1Path, getBlockViaTime},
 	}
 )
 
@@ -50,7 +54,7 @@ type BlockJSON struct {
 	EvidenceRoot string                 `json:"evidence_root"`
 	Height       uint64                 `json:"height"`
 	Hash         string                 `json:"hash"`
-	Evds         []*EvidenceInBlockJSON `json:"evds`
+	Evds         []*EvidenceInBlockJSON `json:"evds"`
 }
 
 func (b *BlockJSON) fromBlockInfo(info *core.BlockInfo) {
@@ -191,3 +195,29 @@ func getBlockViaHash(w http.ResponseWriter, r *http.Request) {
 	responseBlocks(w, result)
 	return
 }
+
+/*
+GET /v1/block/query-via-time?time=...
+
+returns the chain head at the time (unix seconds),
+which is the highest block whose time is not after it
+*/
+
+type getBlockViaTimeResponse = GetBlocksResponse
+
+func getBlockViaTime(w http.ResponseWriter, r *http.Request) {
+	param, ok := r.URL.Query()[GetTimeParam]
+	if !ok {
+		badRequestResponse(w)
+		return
+	}
+
+	t, err := strconv.ParseInt(param[0], 10, 64)
+	if err != nil || t < 0 {
+		badRequestResponse(w)
+		return
+	}
+
+	result := globalSvr.c.QueryBlockViaTime(t)
+	responseBlocks(w, []*core.BlockInfo{result})
+}
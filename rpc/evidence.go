@@ -8,13 +8,20 @@ import (
 
 	"github.com/996BC/996.Blockchain/core"
 	"github.com/996BC/996.Blockchain/core/blockchain"
+	"github.com/996BC/996.Blockchain/crypto"
 	"github.com/996BC/996.Blockchain/serialize/cp"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 const (
 	evdPath          = "/evidence"
 	maxBatchQueryNum = 40
+
+	defaultPageSize = 20
+
+	// maxInt is the max value of int, math.MaxInt requires go 1.17
+	maxInt = int(^uint(0) >> 1)
 )
 
 var (
@@ -31,10 +38,18 @@ var (
 	// QueryEvidenceV1Path POST /v1/evidence/query
 	QueryEvidenceV1Path = EvidenceV1Path + "/query"
 
+	// SearchEvidenceV1Path POST /v1/evidence/search
+	SearchEvidenceV1Path = EvidenceV1Path + "/search"
+
+	// QueryEvidenceViaTimeV1Path POST /v1/evidence/query-via-time
+	QueryEvidenceViaTimeV1Path = EvidenceV1Path + "/query-via-time"
+
 	evidenceHandlers = HTTPHandlers{
 		{UploadEvidenceV1Path, uploadEvds},
 		{UploadEvidenceRawV1Path, uploadRaw},
 		{QueryEvidenceV1Path, queryEvidence},
+		{SearchEvidenceV1Path, searchEvidence},
+		{QueryEvidenceViaTimeV1Path, queryEvidenceViaTime},
 	}
 )
 
@@ -93,16 +108,17 @@ func (e *EvidenceJSON) fromEvidenceInfo(info *core.EvidenceInfo) {
 
 /*
 POST /v1/evidence/upload
-{
-	"data": [{
-		"version": 1,
-		"hash": "xxxx",
-		"description": "xxxx",
-		"public_key": "xxxx",
-		"sigature": "xxxx",
-		"nonce": 10000
-	}]
-}
+
+	{
+		"data": [{
+			"version": 1,
+			"hash": "xxxx",
+			"description": "xxxx",
+			"public_key": "xxxx",
+			"sigature": "xxxx",
+			"nonce": 10000
+		}]
+	}
 */
 type UploadEvdsReq struct {
 	Data []*EvidenceJSON `json:"data"`
@@ -136,6 +152,10 @@ func uploadEvds(w http.ResponseWriter, r *http.Request) {
 			failedResponse(existErr.Error(), w)
 			return
 		}
+		if err == core.ErrLightNode {
+			failedResponse(err.Error(), w)
+			return
+		}
 
 		logger.Info("upload failed:%v\n", err)
 		badRequestResponse(w)
@@ -147,18 +167,19 @@ func uploadEvds(w http.ResponseWriter, r *http.Request) {
 
 /*
 POST /v1/evidence/upload-raw
-{
-   "evds":[
-      {
-         "hash":"xxx",
-         "description":"yyy"
-      },
-      {
-         "hash":"xxx",
-         "description":"yyy"
-      }
-   ]
-}
+
+	{
+	   "evds":[
+	      {
+	         "hash":"xxx",
+	         "description":"yyy"
+	      },
+	      {
+	         "hash":"xxx",
+	         "description":"yyy"
+	      }
+	   ]
+	}
 */
 type rawEvidenceJSON struct {
 	Hash        string `json:"hash"`
@@ -181,7 +202,7 @@ func (r *rawEvidenceJSON) toRawEvidence() (*core.RawEvidence, error) {
 }
 
 type uploadRawReq struct {
-	evds []*rawEvidenceJSON `json:"evds"`
+	Evds []*rawEvidenceJSON `json:"evds"`
 }
 
 func uploadRaw(w http.ResponseWriter, r *http.Request) {
@@ -198,7 +219,7 @@ func uploadRaw(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var rEvds []*core.RawEvidence
-	for _, evd := range query.evds {
+	for _, evd := range query.Evds {
 		rEvd, err := evd.toRawEvidence()
 		if err != nil {
 			badRequestResponse(w)
@@ -209,6 +230,11 @@ func uploadRaw(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := globalSvr.c.UploadEvidenceRaw(rEvds); err != nil {
+		if err == core.ErrLightNode {
+			failedResponse(err.Error(), w)
+			return
+		}
+
 		logger.Info("upload raw failed:%v\n", err)
 		badRequestResponse(w)
 		return
@@ -274,3 +300,155 @@ func queryEvidence(w http.ResponseWriter, r *http.Request) {
 	successWithDataResponse(resp, w)
 	return
 }
+
+/*
+POST /v1/evidence/search
+
+	{
+		"keywords": "xxxx",
+		"account": "xxxx",
+		"begin": 1556640000,
+		"end": 1559318400,
+		"page": 1,
+		"size": 20
+	}
+
+finds the evidences whose descriptions contain all the keywords from the newer to the older,
+the account and the block time range (unix seconds) are optional,
+the page begins from 1 and the size is at most 40
+*/
+type SearchEvidenceReq struct {
+	Keywords string `json:"keywords"`
+	Account  string `json:"account"`
+	Begin    int64  `json:"begin"`
+	End      int64  `json:"end"`
+	Page     int    `json:"page"`
+	Size     int    `json:"size"`
+}
+
+type SearchEvidenceResp struct {
+	Total int             `json:"total"`
+	Data  []*EvidenceJSON `json:"data"`
+}
+
+func searchEvidence(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+
+	req := &SearchEvidenceReq{}
+	if err := json.Unmarshal(body, req); err != nil {
+		badRequestResponse(w)
+		return
+	}
+
+	offset, limit, ok := pageToRange(req.Page, req.Size)
+	if len(req.Keywords) == 0 || !ok {
+		badRequestResponse(w)
+		return
+	}
+
+	query := &core.SearchQuery{
+		Keywords: req.Keywords,
+		Begin:    req.Begin,
+		End:      req.End,
+		Offset:   offset,
+		Limit:    limit,
+	}
+	if len(req.Account) != 0 {
+		query.PubKey = crypto.IDToBytes(req.Account)
+		if query.PubKey == nil || len(query.PubKey) != btcec.PubKeyBytesLenCompressed {
+			badRequestResponse(w)
+			return
+		}
+	}
+
+	evidenceInfo, total, err := globalSvr.c.SearchEvidence(query)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	responseEvidencePage(w, evidenceInfo, total)
+}
+
+/*
+POST /v1/evidence/query-via-time
+
+	{
+		"begin": 1556640000,
+		"end": 1559318400,
+		"page": 1,
+		"size": 20
+	}
+
+lists the evidences in the blocks whose time (unix seconds) is in [begin, end] from the older to the newer,
+the page begins from 1 and the size is at most 40
+*/
+type QueryEvidenceViaTimeReq struct {
+	Begin int64 `json:"begin"`
+	End   int64 `json:"end"`
+	Page  int   `json:"page"`
+	Size  int   `json:"size"`
+}
+
+type QueryEvidenceViaTimeResp = SearchEvidenceResp
+
+func queryEvidenceViaTime(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		badRequestResponse(w)
+		return
+	}
+
+	req := &QueryEvidenceViaTimeReq{}
+	if err := json.Unmarshal(body, req); err != nil {
+		badRequestResponse(w)
+		return
+	}
+
+	offset, limit, ok := pageToRange(req.Page, req.Size)
+	if req.Begin < 0 || req.Begin > req.End || !ok {
+		badRequestResponse(w)
+		return
+	}
+
+	evidenceInfo, total, err := globalSvr.c.QueryEvidenceViaTime(req.Begin, req.End, offset, limit)
+	if err != nil {
+		failedResponse(err.Error(), w)
+		return
+	}
+
+	responseEvidencePage(w, evidenceInfo, total)
+}
+
+// pageToRange converts the page beginning from 1 to the offset and the limit,
+// the zero page and size mean the first page and the default size
+func pageToRange(page, size int) (int, int, bool) {
+	if page == 0 {
+		page = 1
+	}
+	if size == 0 {
+		size = defaultPageSize
+	}
+	if page < 0 || size < 0 || size > maxBatchQueryNum {
+		return 0, 0, false
+	}
+	// the offset of a huge page overflows
+	if page > maxInt/size {
+		return 0, 0, false
+	}
+	return (page - 1) * size, size, true
+}
+
+func responseEvidencePage(w http.ResponseWriter, evidenceInfo []*core.EvidenceInfo, total int) {
+	resp := &SearchEvidenceResp{Total: total}
+	for _, e := range evidenceInfo {
+		eJSON := &EvidenceJSON{}
+		eJSON.fromEvidenceInfo(e)
+		resp.Data = append(resp.Data, eJSON)
+	}
+	successWithDataResponse(resp, w)
+}
@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+func TestPageToRange(t *testing.T) {
+	var cases = []struct {
+		page   int
+		size   int
+		offset int
+		limit  int
+		ok     bool
+	}{
+		{0, 0, 0, defaultPageSize, true},
+		{3, 10, 20, 10, true},
+		{-1, 10, 0, 0, false},
+		{1, maxBatchQueryNum + 1, 0, 0, false},
+		{maxInt/10 + 1, 10, 0, 0, false}, // the offset overflows
+		{maxInt / 10, 10, (maxInt/10 - 1) * 10, 10, true},
+		{maxInt, 1, maxInt - 1, 1, true},
+	}
+	for i, cs := range cases {
+		offset, limit, ok := pageToRange(cs.page, cs.size)
+		if ok != cs.ok {
+			t.Fatalf("case %d expect ok %v, but %v", i, cs.ok, ok)
+		}
+		if err := utils.TCheckInt("offset", cs.offset, offset); err != nil {
+			t.Fatalf("case %d %v", i, err)
+		}
+		if err := utils.TCheckInt("limit", cs.limit, limit); err != nil {
+			t.Fatalf("case %d %v", i, err)
+		}
+	}
+}
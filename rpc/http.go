@@ -22,11 +22,19 @@ const (
 	GetRangeParam = "range"
 	GetHashParam  = "hash"
 	GetIDParam    = "id"
+	GetNumParam   = "num"
+	GetTimeParam  = "time"
+
+	GetDurationParam = "duration"
 )
 
 type Config struct {
 	Port int
 	C    *core.Core
+
+	// Admin mounts the admin interfaces like backup and ban,
+	// any local process can call them once they are mounted
+	Admin bool
 }
 
 // Server is a http server provides interfaces for querying,uploading evidence and so on;
@@ -58,6 +66,14 @@ func NewServer(conf *Config) *Server {
 		sMux.HandleFunc(handler.Path, handler.F)
 	}
 
+	// admin
+	if conf.Admin {
+		for _, handler := range adminHandlers {
+			sMux.HandleFunc(handler.Path, handler.F)
+		}
+		logger.Infoln("admin interfaces are enabled")
+	}
+
 	//default handler
 	sMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
@@ -0,0 +1,292 @@
+package cp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// ShortIDLength is the length of the evidence short id in the CompactBlock
+const ShortIDLength = 6
+
+// ShortID identifies the evidence in the block, it's salted with the block hash
+// so that the collisions can't be computed before the block is mined
+func ShortID(blockHash []byte, e *Evidence) []byte {
+	data := append(append([]byte{}, blockHash...), e.GetSerializedHash()...)
+	return utils.Hash(data)[:ShortIDLength]
+}
+
+// CompactBlock relays the block with the short ids of its evidences,
+// the receiver rebuilds the block from the evidences it already has and
+// requests the missing ones with CompactRequest
+type CompactBlock struct {
+	*Head
+	Header   *BlockHeader
+	ShortIDs [][]byte
+}
+
+func NewCompactBlock(b *Block) *CompactBlock {
+	hash := b.GetSerializedHash()
+	var ids [][]byte
+	for _, e := range b.Evds {
+		ids = append(ids, ShortID(hash, e))
+	}
+
+	return &CompactBlock{
+		Head:     NewHeadV1(MsgCompactBlock),
+		Header:   b.BlockHeader,
+		ShortIDs: ids,
+	}
+}
+
+func UnmarshalCompactBlock(data io.Reader) (*CompactBlock, error) {
+	result := &CompactBlock{}
+	var idsSize uint16
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+	if result.Header, err = UnmarshalBlockHeader(data); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &idsSize); err != nil {
+		return nil, err
+	}
+	for i := uint16(0); i < idsSize; i++ {
+		id := make([]byte, ShortIDLength)
+		if err = binary.Read(data, binary.BigEndian, id); err != nil {
+			return nil, err
+		}
+		result.ShortIDs = append(result.ShortIDs, id)
+	}
+
+	return result, nil
+}
+
+func (c *CompactBlock) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, c.Head.Marshal())
+	binary.Write(result, binary.BigEndian, c.Header.Marshal())
+
+	idsSize := uint16(len(c.ShortIDs))
+	binary.Write(result, binary.BigEndian, idsSize)
+	for _, id := range c.ShortIDs {
+		binary.Write(result, binary.BigEndian, id)
+	}
+	return result.Bytes()
+}
+
+func (c *CompactBlock) Verify() error {
+	if c.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", c.Version)
+	}
+
+	if c.Type != MsgCompactBlock {
+		return fmt.Errorf("invalid type %d", c.Type)
+	}
+
+	if c.Header == nil {
+		return fmt.Errorf("nil header")
+	}
+
+	if err := c.Header.Verify(); err != nil {
+		return fmt.Errorf("block header verify failed:%v", err)
+	}
+
+	if c.Header.IsEmptyEvidenceRoot() != (len(c.ShortIDs) == 0) {
+		return fmt.Errorf("mismatch evidence root with %d short ids", len(c.ShortIDs))
+	}
+
+	for _, id := range c.ShortIDs {
+		if len(id) != ShortIDLength {
+			return fmt.Errorf("invalid short id %X", id)
+		}
+	}
+
+	return nil
+}
+
+func (c *CompactBlock) String() string {
+	return fmt.Sprintf("block %X, %d evidences", c.Header.GetSerializedHash(), len(c.ShortIDs))
+}
+
+// CompactRequest requests the evidences of the CompactBlock via their indexes in the block
+type CompactRequest struct {
+	*Head
+	BlockHash []byte
+	Indexes   []uint16
+}
+
+func NewCompactRequest(blockHash []byte, indexes []uint16) *CompactRequest {
+	return &CompactRequest{
+		Head:      NewHeadV1(MsgCompactRequest),
+		BlockHash: blockHash,
+		Indexes:   indexes,
+	}
+}
+
+func UnmarshalCompactRequest(data io.Reader) (*CompactRequest, error) {
+	result := &CompactRequest{}
+	var indexesSize uint16
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+	if result.BlockHash, err = unmarshalBlockHash(data); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &indexesSize); err != nil {
+		return nil, err
+	}
+	result.Indexes = make([]uint16, indexesSize)
+	if err = binary.Read(data, binary.BigEndian, result.Indexes); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *CompactRequest) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, c.Head.Marshal())
+	binary.Write(result, binary.BigEndian, marshalBlockHash(c.BlockHash))
+
+	indexesSize := uint16(len(c.Indexes))
+	binary.Write(result, binary.BigEndian, indexesSize)
+	binary.Write(result, binary.BigEndian, c.Indexes)
+	return result.Bytes()
+}
+
+func (c *CompactRequest) Verify() error {
+	if c.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", c.Version)
+	}
+
+	if c.Type != MsgCompactRequest {
+		return fmt.Errorf("invalid type %d", c.Type)
+	}
+
+	if len(c.BlockHash) != utils.HashLength {
+		return fmt.Errorf("invalid block hash %X", c.BlockHash)
+	}
+
+	if len(c.Indexes) == 0 {
+		return fmt.Errorf("empty indexes")
+	}
+
+	return nil
+}
+
+func (c *CompactRequest) String() string {
+	return fmt.Sprintf("block %X, %d evidences", c.BlockHash, len(c.Indexes))
+}
+
+// CompactResponse replies the evidences requested by CompactRequest in the same order
+type CompactResponse struct {
+	*Head
+	BlockHash []byte
+	Evds      []*Evidence
+}
+
+func NewCompactResponse(blockHash []byte, evds []*Evidence) *CompactResponse {
+	return &CompactResponse{
+		Head:      NewHeadV1(MsgCompactResponse),
+		BlockHash: blockHash,
+		Evds:      evds,
+	}
+}
+
+func UnmarshalCompactResponse(data io.Reader) (*CompactResponse, error) {
+	result := &CompactResponse{}
+	var evdsSize uint16
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+	if result.BlockHash, err = unmarshalBlockHash(data); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &evdsSize); err != nil {
+		return nil, err
+	}
+	for i := uint16(0); i < evdsSize; i++ {
+		var evd *Evidence
+		if evd, err = UnmarshalEvidence(data); err != nil {
+			return nil, err
+		}
+		result.Evds = append(result.Evds, evd)
+	}
+
+	return result, nil
+}
+
+func (c *CompactResponse) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, c.Head.Marshal())
+	binary.Write(result, binary.BigEndian, marshalBlockHash(c.BlockHash))
+
+	evdsSize := uint16(len(c.Evds))
+	binary.Write(result, binary.BigEndian, evdsSize)
+	for _, evd := range c.Evds {
+		binary.Write(result, binary.BigEndian, evd.Marshal())
+	}
+	return result.Bytes()
+}
+
+func (c *CompactResponse) Verify() error {
+	if c.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", c.Version)
+	}
+
+	if c.Type != MsgCompactResponse {
+		return fmt.Errorf("invalid type %d", c.Type)
+	}
+
+	if len(c.BlockHash) != utils.HashLength {
+		return fmt.Errorf("invalid block hash %X", c.BlockHash)
+	}
+
+	if len(c.Evds) == 0 {
+		return fmt.Errorf("empty evidences")
+	}
+
+	for _, evd := range c.Evds {
+		if err := evd.Verify(); err != nil {
+			return fmt.Errorf("invalid evidence:%v", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *CompactResponse) String() string {
+	return fmt.Sprintf("block %X, %d evidences", c.BlockHash, len(c.Evds))
+}
+
+func unmarshalBlockHash(data io.Reader) ([]byte, error) {
+	var hashLen uint8
+	if err := binary.Read(data, binary.BigEndian, &hashLen); err != nil {
+		return nil, err
+	}
+	hash := make([]byte, hashLen)
+	if err := binary.Read(data, binary.BigEndian, hash); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+func marshalBlockHash(hash []byte) []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, utils.Uint8Len(hash))
+	binary.Write(result, binary.BigEndian, hash)
+	return result.Bytes()
+}
@@ -13,6 +13,13 @@ const (
 	MsgBlockResponse     = 4
 	MsgBlockBroadcast    = 5
 	MsgEvidenceBroadcast = 6
+	MsgEvidenceRequest   = 7
+	MsgEvidenceResponse  = 8
+	MsgInventory         = 9
+	MsgGetData           = 10
+	MsgCompactBlock      = 11
+	MsgCompactRequest    = 12
+	MsgCompactResponse   = 13
 )
 
 var (
@@ -169,4 +176,110 @@ EvidenceBroadcast
 (bytes)
 Evds size       2
 Evds            sizeof(Evidence) * Evds size
+
+
+EvidenceProof
++-----------------------------+
+|     Evidence:(Evidence)     |
++------------+----------------+
+| BlockHashL |   BlockHash    |
++------------+--+-------------+
+|     Index     |   LeafNum   |
++---------------+-------------+
+| Siblings size | Siblings    |
++---------------+-------------+
+(bytes)
+BlockHash length    1
+BlockHash           -
+Index               2
+LeafNum             2
+Siblings size       1
+Siblings            (length 1 + sibling) * Siblings size
+
+
+EvidenceRequest
++-----------------------------+
+|           (Head)            |
++-----------------------------+
+|             ID              |
++----------+------------------+
+| AccountL |     Account      |
++----------+--+---------------+
+| Hashes size |    Hashes     |
++-------------+---------------+
+(bytes)
+ID                  4
+Account length      1
+Account             -
+Hashes size         2
+Hashes              (length 1 + hash) * Hashes size
+
+
+EvidenceResponse
++-----------------------------+
+|           (Head)            |
++--------------+--------------+
+|      ID      |    Remain    |
++--------------+--------------+
+| Proofs size  |    Proofs    |
++--------------+--------------+
+(bytes)
+ID              4
+Remain          2
+Proofs size     2
+Proofs          sizeof(EvidenceProof) * Proofs size
+
+
+Inventory, GetData
++-----------------------------+
+|           (Head)            |
++-------------+---------------+
+| Items size  |    Items      |
++-------------+---------------+
+(bytes)
+Items size      2
+Items           (type 1 + length 1 + hash) * Items size
+
+
+CompactBlock
++-----------------------------+
+|           (Head)            |
++-----------------------------+
+|    Header:(BlockHeader)     |
++---------------+-------------+
+| ShortIDs size |  ShortIDs   |
++---------------+-------------+
+(bytes)
+ShortIDs size   2
+ShortIDs        6 * ShortIDs size
+
+
+CompactRequest
++-----------------------------+
+|           (Head)            |
++------------+----------------+
+| BlockHashL |   BlockHash    |
++------------+--+-------------+
+| Indexes size  |   Indexes   |
++---------------+-------------+
+(bytes)
+BlockHash length    1
+BlockHash           -
+Indexes size        2
+Indexes             2 * Indexes size
+
+
+CompactResponse
++-----------------------------+
+|           (Head)            |
++------------+----------------+
+| BlockHashL |   BlockHash    |
++------------+--+-------------+
+| Evds size     |    Evds     |
++---------------+-------------+
+(bytes)
+BlockHash length    1
+BlockHash           -
+Evds size           2
+Evds                sizeof(Evidence) * Evds size
 */
@@ -390,3 +390,206 @@ func TestEvidenceBroadcast(t *testing.T) {
 		}
 	}
 }
+
+func TestEvidenceRequest(t *testing.T) {
+	hashes := [][]byte{utils.Hash(randBytes()), utils.Hash(randBytes())}
+	request := NewEvidenceRequest(randNum(), nil, hashes)
+	requestBytes := request.Marshal()
+
+	rRequest, err := UnmarshalEvidenceRequest(bytes.NewReader(requestBytes))
+	if err != nil {
+		t.Fatalf("unmarshal evidence request failed:%v\n", err)
+	}
+
+	if err := utils.TCheckUint8("type", MsgEvidenceRequest, rRequest.Type); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint32("id", request.ID, rRequest.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("hashes number", len(hashes), len(rRequest.Hashes)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range hashes {
+		if err := utils.TCheckBytes("hash", hashes[i], rRequest.Hashes[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rRequest.Verify(); err != nil {
+		t.Fatalf("verify evidence request failed:%v\n", err)
+	}
+
+	account := NewEvidenceParams().pubKeyBytes
+	rRequest, err = UnmarshalEvidenceRequest(bytes.NewReader(NewEvidenceRequest(1, account, nil).Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal evidence request failed:%v\n", err)
+	}
+	if !rRequest.IsAccountRequest() {
+		t.Fatal("expect account request")
+	}
+	if err := utils.TCheckBytes("account", account, rRequest.Account); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewEvidenceRequest(1, account, hashes).Verify(); err == nil {
+		t.Fatal("expect verifying request with both account and hashes failed")
+	}
+}
+
+func TestEvidenceResponse(t *testing.T) {
+	ep := NewEvidenceParams()
+	blockHash := utils.Hash(randBytes())
+	siblings := [][]byte{utils.Hash(randBytes()), utils.Hash(randBytes())}
+	proof := NewEvidenceProof(GenEvidenceFromParams(ep), blockHash, 2, 3, siblings)
+
+	response := NewEvidenceResponse(randNum(), 1, []*EvidenceProof{proof})
+	responseBytes := response.Marshal()
+
+	rResponse, err := UnmarshalEvidenceResponse(bytes.NewReader(responseBytes))
+	if err != nil {
+		t.Fatalf("unmarshal evidence response failed:%v\n", err)
+	}
+
+	if err := utils.TCheckUint8("type", MsgEvidenceResponse, rResponse.Type); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint32("id", response.ID, rResponse.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint16("remain", 1, rResponse.Remain); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("proofs number", 1, len(rResponse.Proofs)); err != nil {
+		t.Fatal(err)
+	}
+
+	rProof := rResponse.Proofs[0]
+	if err := CheckEvidence(rProof.Evidence, ep); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("block hash", blockHash, rProof.BlockHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint16("index", 2, rProof.Index); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint16("leaf number", 3, rProof.LeafNum); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("siblings number", len(siblings), len(rProof.Siblings)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range siblings {
+		if err := utils.TCheckBytes("sibling", siblings[i], rProof.Siblings[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rResponse.Verify(); err != nil {
+		t.Fatalf("verify evidence response failed:%v\n", err)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	items := []*InvItem{
+		NewInvItem(InvBlock, utils.Hash(randBytes())),
+		NewInvItem(InvEvidence, utils.Hash(randBytes())),
+	}
+
+	inv, err := UnmarshalInventory(bytes.NewReader(NewInventory(items).Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal inventory failed:%v\n", err)
+	}
+	if err := utils.TCheckUint8("type", MsgInventory, inv.Type); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("items number", len(items), len(inv.Items)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range items {
+		if err := utils.TCheckString("item", items[i].Key(), inv.Items[i].Key()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := inv.Verify(); err != nil {
+		t.Fatalf("verify inventory failed:%v\n", err)
+	}
+
+	getData, err := UnmarshalGetData(bytes.NewReader(NewGetData(items[1:]).Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal get data failed:%v\n", err)
+	}
+	if err := utils.TCheckUint8("type", MsgGetData, getData.Type); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("item hash", items[1].Hash, getData.Items[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := getData.Verify(); err != nil {
+		t.Fatalf("verify get data failed:%v\n", err)
+	}
+
+	if err := NewInventory(nil).Verify(); err == nil {
+		t.Fatal("expect the empty inventory invalid")
+	}
+	if err := NewGetData([]*InvItem{NewInvItem(3, items[0].Hash)}).Verify(); err == nil {
+		t.Fatal("expect the unknown item type invalid")
+	}
+	if err := NewInventory([]*InvItem{NewInvItem(InvBlock, []byte{1})}).Verify(); err == nil {
+		t.Fatal("expect the invalid hash invalid")
+	}
+}
+
+func TestCompactBlock(t *testing.T) {
+	block := GenBlockFromParams(NewBlockParams(false))
+	hash := block.GetSerializedHash()
+
+	compact, err := UnmarshalCompactBlock(bytes.NewReader(NewCompactBlock(block).Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal compact block failed:%v\n", err)
+	}
+	if err := utils.TCheckBytes("block hash", hash, compact.Header.GetSerializedHash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckInt("short ids", len(block.Evds), len(compact.ShortIDs)); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range block.Evds {
+		if err := utils.TCheckBytes("short id", ShortID(hash, e), compact.ShortIDs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := compact.Verify(); err != nil {
+		t.Fatalf("verify compact block failed:%v\n", err)
+	}
+	compact.ShortIDs = nil
+	if err := compact.Verify(); err == nil {
+		t.Fatal("expect the compact block without short ids invalid")
+	}
+
+	// request and response
+	request, err := UnmarshalCompactRequest(bytes.NewReader(NewCompactRequest(hash, []uint16{0, 3}).Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal compact request failed:%v\n", err)
+	}
+	if err := utils.TCheckInt("indexes", 2, len(request.Indexes)); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint16("index", 3, request.Indexes[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := request.Verify(); err != nil {
+		t.Fatalf("verify compact request failed:%v\n", err)
+	}
+
+	response, err := UnmarshalCompactResponse(bytes.NewReader(NewCompactResponse(hash, block.Evds[:1]).Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal compact response failed:%v\n", err)
+	}
+	if err := utils.TCheckBytes("evidence", block.Evds[0].GetSerializedHash(),
+		response.Evds[0].GetSerializedHash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Verify(); err != nil {
+		t.Fatalf("verify compact response failed:%v\n", err)
+	}
+}
@@ -0,0 +1,117 @@
+package cp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// EvidenceProof proves the evidence belongs to the block via the merkle path
+type EvidenceProof struct {
+	*Evidence
+	BlockHash []byte
+	Index     uint16
+	LeafNum   uint16
+	Siblings  [][]byte
+}
+
+func NewEvidenceProof(evd *Evidence, blockHash []byte, index uint16, leafNum uint16, siblings [][]byte) *EvidenceProof {
+	return &EvidenceProof{
+		Evidence:  evd,
+		BlockHash: blockHash,
+		Index:     index,
+		LeafNum:   leafNum,
+		Siblings:  siblings,
+	}
+}
+
+func UnmarshalEvidenceProof(data io.Reader) (*EvidenceProof, error) {
+	result := &EvidenceProof{}
+	var blockHashLen uint8
+	var siblingsSize uint8
+	var err error
+
+	if result.Evidence, err = UnmarshalEvidence(data); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &blockHashLen); err != nil {
+		return nil, err
+	}
+	result.BlockHash = make([]byte, blockHashLen)
+	if err = binary.Read(data, binary.BigEndian, result.BlockHash); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &result.Index); err != nil {
+		return nil, err
+	}
+	if err = binary.Read(data, binary.BigEndian, &result.LeafNum); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &siblingsSize); err != nil {
+		return nil, err
+	}
+	for i := uint8(0); i < siblingsSize; i++ {
+		var siblingLen uint8
+		if err = binary.Read(data, binary.BigEndian, &siblingLen); err != nil {
+			return nil, err
+		}
+		sibling := make([]byte, siblingLen)
+		if err = binary.Read(data, binary.BigEndian, sibling); err != nil {
+			return nil, err
+		}
+		result.Siblings = append(result.Siblings, sibling)
+	}
+
+	return result, nil
+}
+
+func (e *EvidenceProof) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, e.Evidence.Marshal())
+
+	blockHashLen := utils.Uint8Len(e.BlockHash)
+	binary.Write(result, binary.BigEndian, blockHashLen)
+	binary.Write(result, binary.BigEndian, e.BlockHash)
+
+	binary.Write(result, binary.BigEndian, e.Index)
+	binary.Write(result, binary.BigEndian, e.LeafNum)
+
+	siblingsSize := uint8(len(e.Siblings))
+	binary.Write(result, binary.BigEndian, siblingsSize)
+	for _, sibling := range e.Siblings {
+		siblingLen := utils.Uint8Len(sibling)
+		binary.Write(result, binary.BigEndian, siblingLen)
+		binary.Write(result, binary.BigEndian, sibling)
+	}
+
+	return result.Bytes()
+}
+
+// Verify checks the evidence and the proof struct, but not whether the proof matches the block
+func (e *EvidenceProof) Verify() error {
+	if err := e.Evidence.Verify(); err != nil {
+		return fmt.Errorf("evidence verify failed:%v", err)
+	}
+
+	if len(e.BlockHash) != utils.HashLength {
+		return fmt.Errorf("invalid BlockHash %X", e.BlockHash)
+	}
+
+	if e.Index >= e.LeafNum {
+		return fmt.Errorf("invalid index %d of %d leafs", e.Index, e.LeafNum)
+	}
+
+	for _, sibling := range e.Siblings {
+		if len(sibling) != utils.HashLength {
+			return fmt.Errorf("invalid sibling %X", sibling)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package cp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+// EvidenceRequest requests the evidences with their proofs,
+// either via the evidence hashes or via the account
+type EvidenceRequest struct {
+	*Head
+	ID      uint32
+	Account []byte
+	Hashes  [][]byte
+}
+
+func NewEvidenceRequest(id uint32, account []byte, hashes [][]byte) *EvidenceRequest {
+	return &EvidenceRequest{
+		Head:    NewHeadV1(MsgEvidenceRequest),
+		ID:      id,
+		Account: account,
+		Hashes:  hashes,
+	}
+}
+
+func UnmarshalEvidenceRequest(data io.Reader) (*EvidenceRequest, error) {
+	result := &EvidenceRequest{}
+	var accountLen uint8
+	var hashesSize uint16
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &result.ID); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &accountLen); err != nil {
+		return nil, err
+	}
+	result.Account = make([]byte, accountLen)
+	if err = binary.Read(data, binary.BigEndian, result.Account); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &hashesSize); err != nil {
+		return nil, err
+	}
+	for i := uint16(0); i < hashesSize; i++ {
+		var hashLen uint8
+		if err = binary.Read(data, binary.BigEndian, &hashLen); err != nil {
+			return nil, err
+		}
+		hash := make([]byte, hashLen)
+		if err = binary.Read(data, binary.BigEndian, hash); err != nil {
+			return nil, err
+		}
+		result.Hashes = append(result.Hashes, hash)
+	}
+
+	return result, nil
+}
+
+func (e *EvidenceRequest) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, e.Head.Marshal())
+	binary.Write(result, binary.BigEndian, e.ID)
+
+	accountLen := utils.Uint8Len(e.Account)
+	binary.Write(result, binary.BigEndian, accountLen)
+	binary.Write(result, binary.BigEndian, e.Account)
+
+	hashesSize := uint16(len(e.Hashes))
+	binary.Write(result, binary.BigEndian, hashesSize)
+	for _, hash := range e.Hashes {
+		hashLen := utils.Uint8Len(hash)
+		binary.Write(result, binary.BigEndian, hashLen)
+		binary.Write(result, binary.BigEndian, hash)
+	}
+
+	return result.Bytes()
+}
+
+func (e *EvidenceRequest) Verify() error {
+	if e.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", e.Version)
+	}
+
+	if e.Type != MsgEvidenceRequest {
+		return fmt.Errorf("invalid type %d", e.Type)
+	}
+
+	if e.IsAccountRequest() == (len(e.Hashes) != 0) {
+		return fmt.Errorf("expect either account or hashes")
+	}
+
+	for _, hash := range e.Hashes {
+		if len(hash) != utils.HashLength {
+			return fmt.Errorf("invalid hash %X", hash)
+		}
+	}
+
+	return nil
+}
+
+// IsAccountRequest returns true if it requests the evidences of the account
+func (e *EvidenceRequest) IsAccountRequest() bool {
+	return len(e.Account) != 0
+}
+
+func (e *EvidenceRequest) String() string {
+	if e.IsAccountRequest() {
+		return fmt.Sprintf("ID %d Account %X", e.ID, e.Account)
+	}
+	return fmt.Sprintf("ID %d %d hashes", e.ID, len(e.Hashes))
+}
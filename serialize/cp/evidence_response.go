@@ -0,0 +1,93 @@
+package cp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// EvidenceResponse replies the EvidenceRequest with the same ID,
+// a request may be replied by several responses, Remain is the number of the responses after it
+type EvidenceResponse struct {
+	*Head
+	ID     uint32
+	Remain uint16
+	Proofs []*EvidenceProof
+}
+
+func NewEvidenceResponse(id uint32, remain uint16, proofs []*EvidenceProof) *EvidenceResponse {
+	return &EvidenceResponse{
+		Head:   NewHeadV1(MsgEvidenceResponse),
+		ID:     id,
+		Remain: remain,
+		Proofs: proofs,
+	}
+}
+
+func UnmarshalEvidenceResponse(data io.Reader) (*EvidenceResponse, error) {
+	result := &EvidenceResponse{}
+	var proofsSize uint16
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &result.ID); err != nil {
+		return nil, err
+	}
+	if err = binary.Read(data, binary.BigEndian, &result.Remain); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &proofsSize); err != nil {
+		return nil, err
+	}
+	for i := uint16(0); i < proofsSize; i++ {
+		var proof *EvidenceProof
+		if proof, err = UnmarshalEvidenceProof(data); err != nil {
+			return nil, err
+		}
+		result.Proofs = append(result.Proofs, proof)
+	}
+
+	return result, nil
+}
+
+func (e *EvidenceResponse) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, e.Head.Marshal())
+	binary.Write(result, binary.BigEndian, e.ID)
+	binary.Write(result, binary.BigEndian, e.Remain)
+
+	proofsSize := uint16(len(e.Proofs))
+	binary.Write(result, binary.BigEndian, proofsSize)
+	for _, proof := range e.Proofs {
+		binary.Write(result, binary.BigEndian, proof.Marshal())
+	}
+
+	return result.Bytes()
+}
+
+func (e *EvidenceResponse) Verify() error {
+	if e.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", e.Version)
+	}
+
+	if e.Type != MsgEvidenceResponse {
+		return fmt.Errorf("invalid type %d", e.Type)
+	}
+
+	for _, proof := range e.Proofs {
+		if err := proof.Verify(); err != nil {
+			return fmt.Errorf("invalid proof:%v", err)
+		}
+	}
+
+	return nil
+}
+
+func (e *EvidenceResponse) String() string {
+	return fmt.Sprintf("ID %d Remain %d %d proofs", e.ID, e.Remain, len(e.Proofs))
+}
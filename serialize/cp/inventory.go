@@ -0,0 +1,191 @@
+package cp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/996BC/996.Blockchain/utils"
+)
+
+const (
+	// the inventory item type
+	InvBlock    = 1
+	InvEvidence = 2
+
+	// MaxInvItems is the max number of the items in an Inventory or a GetData
+	MaxInvItems = 1024
+)
+
+// InvItem identifies a block via its header hash or an evidence via its hash
+type InvItem struct {
+	Type uint8
+	Hash []byte
+}
+
+func NewInvItem(invType uint8, hash []byte) *InvItem {
+	return &InvItem{
+		Type: invType,
+		Hash: hash,
+	}
+}
+
+// Key is the unique string of the item
+func (i *InvItem) Key() string {
+	return fmt.Sprintf("%d-%X", i.Type, i.Hash)
+}
+
+// Inventory announces the hashes of the new blocks and evidences,
+// the receiver requests the items it doesn't have with GetData
+type Inventory struct {
+	*Head
+	Items []*InvItem
+}
+
+func NewInventory(items []*InvItem) *Inventory {
+	return &Inventory{
+		Head:  NewHeadV1(MsgInventory),
+		Items: items,
+	}
+}
+
+func UnmarshalInventory(data io.Reader) (*Inventory, error) {
+	result := &Inventory{}
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+	if result.Items, err = unmarshalInvItems(data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (i *Inventory) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, i.Head.Marshal())
+	binary.Write(result, binary.BigEndian, marshalInvItems(i.Items))
+	return result.Bytes()
+}
+
+func (i *Inventory) Verify() error {
+	if i.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", i.Version)
+	}
+
+	if i.Type != MsgInventory {
+		return fmt.Errorf("invalid type %d", i.Type)
+	}
+
+	return verifyInvItems(i.Items)
+}
+
+func (i *Inventory) String() string {
+	return fmt.Sprintf("%d items", len(i.Items))
+}
+
+// GetData requests the announced items, the blocks are replied
+// with BlockBroadcast and the evidences are replied with EvidenceBroadcast
+type GetData struct {
+	*Head
+	Items []*InvItem
+}
+
+func NewGetData(items []*InvItem) *GetData {
+	return &GetData{
+		Head:  NewHeadV1(MsgGetData),
+		Items: items,
+	}
+}
+
+func UnmarshalGetData(data io.Reader) (*GetData, error) {
+	result := &GetData{}
+	var err error
+
+	if result.Head, err = UnmarshalHead(data); err != nil {
+		return nil, err
+	}
+	if result.Items, err = unmarshalInvItems(data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (g *GetData) Marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, g.Head.Marshal())
+	binary.Write(result, binary.BigEndian, marshalInvItems(g.Items))
+	return result.Bytes()
+}
+
+func (g *GetData) Verify() error {
+	if g.Version != CoreProtocolV1 {
+		return fmt.Errorf("invalid version %d", g.Version)
+	}
+
+	if g.Type != MsgGetData {
+		return fmt.Errorf("invalid type %d", g.Type)
+	}
+
+	return verifyInvItems(g.Items)
+}
+
+func (g *GetData) String() string {
+	return fmt.Sprintf("%d items", len(g.Items))
+}
+
+func unmarshalInvItems(data io.Reader) ([]*InvItem, error) {
+	var itemsSize uint16
+	if err := binary.Read(data, binary.BigEndian, &itemsSize); err != nil {
+		return nil, err
+	}
+
+	var result []*InvItem
+	for i := uint16(0); i < itemsSize; i++ {
+		item := &InvItem{}
+		var hashLen uint8
+		if err := binary.Read(data, binary.BigEndian, &item.Type); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(data, binary.BigEndian, &hashLen); err != nil {
+			return nil, err
+		}
+		item.Hash = make([]byte, hashLen)
+		if err := binary.Read(data, binary.BigEndian, item.Hash); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func marshalInvItems(items []*InvItem) []byte {
+	result := new(bytes.Buffer)
+	itemsSize := uint16(len(items))
+	binary.Write(result, binary.BigEndian, itemsSize)
+	for _, item := range items {
+		binary.Write(result, binary.BigEndian, item.Type)
+		hashLen := utils.Uint8Len(item.Hash)
+		binary.Write(result, binary.BigEndian, hashLen)
+		binary.Write(result, binary.BigEndian, item.Hash)
+	}
+	return result.Bytes()
+}
+
+func verifyInvItems(items []*InvItem) error {
+	if len(items) == 0 || len(items) > MaxInvItems {
+		return fmt.Errorf("invalid items size %d", len(items))
+	}
+
+	for _, item := range items {
+		if item.Type != InvBlock && item.Type != InvEvidence {
+			return fmt.Errorf("invalid item type %d", item.Type)
+		}
+		if len(item.Hash) != utils.HashLength {
+			return fmt.Errorf("invalid item hash %X", item.Hash)
+		}
+	}
+	return nil
+}
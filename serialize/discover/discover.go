@@ -3,14 +3,18 @@ package discover
 type DiscvMsgType = uint8
 
 const (
-    // DiscoverV1 is the version 1 of the discover protocol
-    DiscoverV1 = 1
-
-    // discover message type
-    MsgPing          = DiscvMsgType(1)
-    MsgPong          = DiscvMsgType(2)
-    MsgGetNeighbours = DiscvMsgType(3)
-    MsgNeighbours    = DiscvMsgType(4)
+	// DiscoverV1 is the version 1 of the discover protocol
+	DiscoverV1 = 1
+
+	// DiscoverV2 is the version 2 of the discover protocol,
+	// every packet is signed by the sender's node key
+	DiscoverV2 = 2
+
+	// discover message type
+	MsgPing          = DiscvMsgType(1)
+	MsgPong          = DiscvMsgType(2)
+	MsgGetNeighbours = DiscvMsgType(3)
+	MsgNeighbours    = DiscvMsgType(4)
 )
 
 /*
@@ -91,7 +95,24 @@ Neighboures
 +---------------------------+
 |       Nodes:(Node)        |
 +---------------------------+
+| PubKeyL |     PubKey      |  (version 2)
++---------+-----------------+
 (bytes)
 Nodes size      2
 Nodes           sizeof(Node) * Nodes size
+PubKey length   1
+PubKey          -
+
+
+Version 2 appends the signature to every packet above,
+it signs the hash of the whole packet before it (the head Time included);
+the version 1 receivers ignore the trailing fields
++---------------------------+
+|         (Packet)          |
++---------------------------+
+|  SigL   |       Sig       |
++---------+-----------------+
+(bytes)
+Sig length      2
+Sig             -
 */
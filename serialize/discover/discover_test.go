@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 func verifyHead(t *testing.T, expect *Head, result *Head) {
@@ -78,7 +79,7 @@ func TestGetNeighbours(t *testing.T) {
 
 func TestNeighbours(t *testing.T) {
 	// empty
-	emptyNeighbour := NewNeighbours(nil)
+	emptyNeighbour := NewNeighbours(nil, []byte("neighbours_key"))
 	emptyNeighbourBytes := emptyNeighbour.Marshal()
 	rEmptyNeighbour, err := UnmarshalNeighbours(bytes.NewReader(emptyNeighbourBytes))
 	if err != nil {
@@ -95,13 +96,16 @@ func TestNeighbours(t *testing.T) {
 		NewNode(NewAddress("8.8.8.8", int32(10000)), []byte("Node_A_PubKey")),
 		NewNode(NewAddress("6.6.6.6", int32(10080)), []byte("Node_B_PubKey")),
 	}
-	neighbours := NewNeighbours(nodes)
+	neighbours := NewNeighbours(nodes, []byte("neighbours_key"))
 	neighboursBytes := neighbours.Marshal()
 	rNeighbours, err := UnmarshalNeighbours(bytes.NewReader(neighboursBytes))
 	if err != nil {
 		t.Fatalf("unmarshal Neighbours failed:%v\n", err)
 	}
 	verifyHead(t, neighbours.Head, rNeighbours.Head)
+	if err := utils.TCheckBytes("public key", neighbours.PubKey, rNeighbours.PubKey); err != nil {
+		t.Fatal(err)
+	}
 
 	for i, node := range rNeighbours.Nodes {
 		if err := utils.TCheckIP("neighbour ip", nodes[i].Addr.IP, node.Addr.IP); err != nil {
@@ -115,3 +119,71 @@ func TestNeighbours(t *testing.T) {
 		}
 	}
 }
+
+func TestSignature(t *testing.T) {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	pubKey := privKey.PubKey().SerializeCompressed()
+
+	ping := NewPing(pubKey)
+	ping.Sign(privKey)
+	rPing, err := UnmarshalPing(bytes.NewReader(ping.Marshal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rPing.Verify() {
+		t.Fatal("expect the signed ping verified")
+	}
+
+	// the time is signed
+	rPing.Time++
+	if rPing.Verify() {
+		t.Fatal("expect the ping with modified time rejected")
+	}
+
+	// signed by another key
+	otherKey, _ := btcec.NewPrivateKey(btcec.S256())
+	pong := NewPong([]byte("ping_hash"), pubKey)
+	pong.Sign(otherKey)
+	if pong.Verify() {
+		t.Fatal("expect the pong signed by another key rejected")
+	}
+	pong.Sign(privKey)
+	pong.PingHash = []byte("other_ping_hash")
+	if pong.Verify() {
+		t.Fatal("expect the pong quoting another ping rejected")
+	}
+
+	neighbours := NewNeighbours([]*Node{
+		NewNode(NewAddress("8.8.8.8", int32(10000)), []byte("Node_A_PubKey")),
+	}, pubKey)
+	neighbours.Sign(privKey)
+	rNeighbours, err := UnmarshalNeighbours(bytes.NewReader(neighbours.Marshal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rNeighbours.Verify() {
+		t.Fatal("expect the signed neighbours verified")
+	}
+	rNeighbours.Nodes[0].Addr.Port++
+	if rNeighbours.Verify() {
+		t.Fatal("expect the neighbours with modified nodes rejected")
+	}
+}
+
+func TestUnsignedV1(t *testing.T) {
+	neighbours := NewNeighbours([]*Node{
+		NewNode(NewAddress("8.8.8.8", int32(10000)), []byte("Node_A_PubKey")),
+	}, nil)
+	neighbours.Head = NewHeadV1(MsgNeighbours)
+
+	rNeighbours, err := UnmarshalNeighbours(bytes.NewReader(neighbours.Marshal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rNeighbours.Signed() || rNeighbours.Verify() {
+		t.Fatal("expect the version 1 packet unsigned")
+	}
+	if err := utils.TCheckInt("nodes number", 1, len(rNeighbours.Nodes)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,16 +7,18 @@ import (
 	"io"
 
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 type GetNeighbours struct {
 	*Head
 	PubKey []byte
+	Sig    []byte
 }
 
 func NewGetNeighbours(pubKey []byte) *GetNeighbours {
 	return &GetNeighbours{
-		Head:   NewHeadV1(MsgGetNeighbours),
+		Head:   NewHeadV2(MsgGetNeighbours),
 		PubKey: pubKey,
 	}
 }
@@ -38,10 +40,39 @@ func UnmarshalGetNeighbours(data io.Reader) (*GetNeighbours, error) {
 		return nil, err
 	}
 
+	if result.Signed() {
+		if result.Sig, err = unmarshalSig(data); err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
 func (g *GetNeighbours) Marshal() []byte {
+	result := bytes.NewBuffer(g.content())
+	if g.Signed() {
+		marshalSig(result, g.Sig)
+	}
+	return result.Bytes()
+}
+
+// Sign generates the signature with the sender's node key
+func (g *GetNeighbours) Sign(privKey *btcec.PrivateKey) {
+	g.Sig = signContent(privKey, g.content())
+}
+
+// Verify checks the packet is signed by PubKey
+func (g *GetNeighbours) Verify() bool {
+	return verifyContent(g.PubKey, g.content(), g.Sig)
+}
+
+// SignContentHash returns the hash of the signed content
+func (g *GetNeighbours) SignContentHash() []byte {
+	return utils.Hash(g.content())
+}
+
+func (g *GetNeighbours) content() []byte {
 	result := new(bytes.Buffer)
 	binary.Write(result, binary.BigEndian, g.Head.Marshal())
 	binary.Write(result, binary.BigEndian, utils.Uint8Len(g.PubKey))
@@ -26,6 +26,13 @@ func NewHeadV1(t DiscvMsgType) *Head {
 	}
 }
 
+// NewHeadV2 creates the head of the signed packets
+func NewHeadV2(t DiscvMsgType) *Head {
+	result := NewHeadV1(t)
+	result.Version = DiscoverV2
+	return result
+}
+
 func UnmarshalHead(data io.Reader) (*Head, error) {
 	result := &Head{}
 	if err := binary.Read(data, binary.BigEndian, &result.Version); err != nil {
@@ -52,6 +59,11 @@ func (h *Head) Marshal() []byte {
 	return result.Bytes()
 }
 
+// Signed returns whether the packet of the head carries a signature
+func (h *Head) Signed() bool {
+	return h.Version >= DiscoverV2
+}
+
 func (h *Head) String() string {
 	return fmt.Sprintf("Version %d Type %d Time %s",
 		h.Version, h.Type, utils.TimeToString(h.Time))
@@ -5,17 +5,25 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 type Neighbours struct {
 	*Head
 	Nodes []*Node
+
+	// the sender, only in version 2
+	PubKey []byte
+	Sig    []byte
 }
 
-func NewNeighbours(nodes []*Node) *Neighbours {
+func NewNeighbours(nodes []*Node, pubKey []byte) *Neighbours {
 	return &Neighbours{
-		Head:  NewHeadV1(MsgNeighbours),
-		Nodes: nodes,
+		Head:   NewHeadV2(MsgNeighbours),
+		Nodes:  nodes,
+		PubKey: pubKey,
 	}
 }
 
@@ -41,10 +49,49 @@ func UnmarshalNeighbours(data io.Reader) (*Neighbours, error) {
 	}
 	result.Nodes = nodes
 
+	if result.Signed() {
+		var pubKeyLen uint8
+		if err = binary.Read(data, binary.BigEndian, &pubKeyLen); err != nil {
+			return nil, err
+		}
+		result.PubKey = make([]byte, pubKeyLen)
+		if err = binary.Read(data, binary.BigEndian, result.PubKey); err != nil {
+			return nil, err
+		}
+
+		if result.Sig, err = unmarshalSig(data); err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
 func (n *Neighbours) Marshal() []byte {
+	result := bytes.NewBuffer(n.content())
+	if n.Signed() {
+		marshalSig(result, n.Sig)
+	}
+	return result.Bytes()
+}
+
+// Sign generates the signature with the sender's node key
+func (n *Neighbours) Sign(privKey *btcec.PrivateKey) {
+	n.Sig = signContent(privKey, n.content())
+}
+
+// Verify checks the packet is signed by PubKey
+func (n *Neighbours) Verify() bool {
+	return verifyContent(n.PubKey, n.content(), n.Sig)
+}
+
+// SignContentHash returns the hash of the signed content
+func (n *Neighbours) SignContentHash() []byte {
+	return utils.Hash(n.content())
+}
+
+// the PubKey follows the nodes so that the version 1 receivers can still parse the packet
+func (n *Neighbours) content() []byte {
 	result := new(bytes.Buffer)
 	binary.Write(result, binary.BigEndian, n.Head.Marshal())
 
@@ -54,11 +101,16 @@ func (n *Neighbours) Marshal() []byte {
 	for i := uint16(0); i < nodesNum; i++ {
 		binary.Write(result, binary.BigEndian, n.Nodes[i].Marshal())
 	}
+
+	if n.Signed() {
+		binary.Write(result, binary.BigEndian, utils.Uint8Len(n.PubKey))
+		binary.Write(result, binary.BigEndian, n.PubKey)
+	}
 	return result.Bytes()
 }
 
 func (n *Neighbours) String() string {
-	result := fmt.Sprintf("Head %v", n.Head)
+	result := fmt.Sprintf("Head %v PubKey %X", n.Head, n.PubKey)
 	for i, node := range n.Nodes {
 		result += fmt.Sprintf("[%d] %v", i, node)
 	}
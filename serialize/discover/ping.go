@@ -7,22 +7,47 @@ import (
 	"io"
 
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 // Head(12) | From(-) | To(-)
 type Ping struct {
 	*Head
 	PubKey []byte
+	Sig    []byte
 }
 
 func NewPing(pubKey []byte) *Ping {
 	return &Ping{
-		Head:   NewHeadV1(MsgPing),
+		Head:   NewHeadV2(MsgPing),
 		PubKey: pubKey,
 	}
 }
 
 func (p *Ping) Marshal() []byte {
+	result := bytes.NewBuffer(p.content())
+	if p.Signed() {
+		marshalSig(result, p.Sig)
+	}
+	return result.Bytes()
+}
+
+// Sign generates the signature with the sender's node key
+func (p *Ping) Sign(privKey *btcec.PrivateKey) {
+	p.Sig = signContent(privKey, p.content())
+}
+
+// Verify checks the packet is signed by PubKey
+func (p *Ping) Verify() bool {
+	return verifyContent(p.PubKey, p.content(), p.Sig)
+}
+
+// SignContentHash returns the hash of the signed content
+func (p *Ping) SignContentHash() []byte {
+	return utils.Hash(p.content())
+}
+
+func (p *Ping) content() []byte {
 	result := new(bytes.Buffer)
 	binary.Write(result, binary.BigEndian, p.Head.Marshal())
 
@@ -54,5 +79,11 @@ func UnmarshalPing(data io.Reader) (*Ping, error) {
 		return nil, err
 	}
 
+	if result.Signed() {
+		if result.Sig, err = unmarshalSig(data); err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
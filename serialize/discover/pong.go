@@ -7,17 +7,19 @@ import (
 	"io"
 
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 type Pong struct {
 	*Head
 	PingHash []byte
 	PubKey   []byte
+	Sig      []byte
 }
 
 func NewPong(pingHash []byte, pubKey []byte) *Pong {
 	return &Pong{
-		Head:     NewHeadV1(MsgPong),
+		Head:     NewHeadV2(MsgPong),
 		PingHash: pingHash,
 		PubKey:   pubKey,
 	}
@@ -49,10 +51,40 @@ func UnmarshalPong(data io.Reader) (*Pong, error) {
 		return nil, err
 	}
 
+	if result.Signed() {
+		if result.Sig, err = unmarshalSig(data); err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
 func (p *Pong) Marshal() []byte {
+	result := bytes.NewBuffer(p.content())
+	if p.Signed() {
+		marshalSig(result, p.Sig)
+	}
+	return result.Bytes()
+}
+
+// Sign generates the signature with the sender's node key,
+// the signed PingHash proves the sender has received the ping
+func (p *Pong) Sign(privKey *btcec.PrivateKey) {
+	p.Sig = signContent(privKey, p.content())
+}
+
+// Verify checks the packet is signed by PubKey
+func (p *Pong) Verify() bool {
+	return verifyContent(p.PubKey, p.content(), p.Sig)
+}
+
+// SignContentHash returns the hash of the signed content
+func (p *Pong) SignContentHash() []byte {
+	return utils.Hash(p.content())
+}
+
+func (p *Pong) content() []byte {
 	result := new(bytes.Buffer)
 	binary.Write(result, binary.BigEndian, p.Head.Marshal())
 
@@ -0,0 +1,48 @@
+package discover
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// the packets of version 2 end with the signature of the sender's node key,
+// it signs the hash of everything before it, so the head Time and the payload are covered
+
+func signContent(privKey *btcec.PrivateKey, content []byte) []byte {
+	sig, _ := privKey.Sign(utils.Hash(content))
+	return sig.Serialize()
+}
+
+func verifyContent(pubKey []byte, content []byte, sig []byte) bool {
+	key, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return false
+	}
+
+	signature, err := btcec.ParseDERSignature(sig, btcec.S256())
+	if err != nil {
+		return false
+	}
+
+	return signature.Verify(utils.Hash(content), key)
+}
+
+func marshalSig(w io.Writer, sig []byte) {
+	binary.Write(w, binary.BigEndian, utils.Uint16Len(sig))
+	binary.Write(w, binary.BigEndian, sig)
+}
+
+func unmarshalSig(data io.Reader) ([]byte, error) {
+	var sigLen uint16
+	if err := binary.Read(data, binary.BigEndian, &sigLen); err != nil {
+		return nil, err
+	}
+	result := make([]byte, sigLen)
+	if err := binary.Read(data, binary.BigEndian, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
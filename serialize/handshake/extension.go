@@ -0,0 +1,144 @@
+package handshake
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/996BC/996.Blockchain/params"
+	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// Extension follows the Sig of the Request and the accept Response,
+// the nodes without it ignore the trailing bytes, so it's added without changing the handshake version
+type Extension struct {
+	Capabilities params.Capability
+	BestHeight   uint64
+	ListenIP     net.IP // empty if the node doesn't know its address
+	ListenPort   uint16
+	Compressions []params.Compression // the supported compression algorithms in the preferred order
+	Sig          []byte
+}
+
+func NewExtension(capabilities params.Capability, bestHeight uint64,
+	listenIP net.IP, listenPort uint16, compressions []params.Compression) *Extension {
+	return &Extension{
+		Capabilities: capabilities,
+		BestHeight:   bestHeight,
+		ListenIP:     listenIP,
+		ListenPort:   listenPort,
+		Compressions: compressions,
+	}
+}
+
+// Has returns true if the capability is advertised
+func (e *Extension) Has(c params.Capability) bool {
+	return e.Capabilities&c == c
+}
+
+// unmarshalExtension returns nil if there isn't an extension
+func unmarshalExtension(data io.Reader) (*Extension, error) {
+	result := &Extension{}
+	var ipLen uint8
+	var compressionsLen uint8
+	var sigLen uint16
+	var err error
+
+	if err = binary.Read(data, binary.BigEndian, &result.Capabilities); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err = binary.Read(data, binary.BigEndian, &result.BestHeight); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &ipLen); err != nil {
+		return nil, err
+	}
+	if ipLen != 0 {
+		result.ListenIP = make(net.IP, ipLen)
+		if err = binary.Read(data, binary.BigEndian, result.ListenIP); err != nil {
+			return nil, err
+		}
+	}
+	if err = binary.Read(data, binary.BigEndian, &result.ListenPort); err != nil {
+		return nil, err
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &compressionsLen); err != nil {
+		return nil, err
+	}
+	if compressionsLen != 0 {
+		result.Compressions = make([]params.Compression, compressionsLen)
+		if err = binary.Read(data, binary.BigEndian, result.Compressions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = binary.Read(data, binary.BigEndian, &sigLen); err != nil {
+		return nil, err
+	}
+	result.Sig = make([]byte, sigLen)
+	if err = binary.Read(data, binary.BigEndian, result.Sig); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (e *Extension) marshal() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, e.marshalContent())
+
+	sigLen := utils.Uint16Len(e.Sig)
+	binary.Write(result, binary.BigEndian, sigLen)
+	binary.Write(result, binary.BigEndian, e.Sig)
+
+	return result.Bytes()
+}
+
+func (e *Extension) marshalContent() []byte {
+	result := new(bytes.Buffer)
+	binary.Write(result, binary.BigEndian, e.Capabilities)
+	binary.Write(result, binary.BigEndian, e.BestHeight)
+
+	ipLen := utils.Uint8Len(e.ListenIP)
+	binary.Write(result, binary.BigEndian, ipLen)
+	binary.Write(result, binary.BigEndian, []byte(e.ListenIP))
+	binary.Write(result, binary.BigEndian, e.ListenPort)
+
+	compressionsLen := utils.Uint8Len(e.Compressions)
+	binary.Write(result, binary.BigEndian, compressionsLen)
+	binary.Write(result, binary.BigEndian, e.Compressions)
+
+	return result.Bytes()
+}
+
+// the extension is signed together with the content signed by the Sig of the handshake
+func (e *Extension) sign(privKey *btcec.PrivateKey, baseContentHash []byte) {
+	sig, _ := privKey.Sign(e.getSignContentHash(baseContentHash))
+	e.Sig = sig.Serialize()
+}
+
+func (e *Extension) verify(pubKey *btcec.PublicKey, baseContentHash []byte) bool {
+	sig, err := btcec.ParseSignature(e.Sig, btcec.S256())
+	if err != nil {
+		return false
+	}
+
+	return sig.Verify(e.getSignContentHash(baseContentHash), pubKey)
+}
+
+func (e *Extension) getSignContentHash(baseContentHash []byte) []byte {
+	buf := utils.GetBuf()
+	defer utils.ReturnBuf(buf)
+
+	binary.Write(buf, binary.BigEndian, baseContentHash)
+	binary.Write(buf, binary.BigEndian, e.marshalContent())
+
+	return utils.Hash(buf.Bytes())
+}
@@ -8,6 +8,10 @@ import (
 const (
 	// HandshakeV1 (handshake vesion 1)
 	HandshakeV1 = 1
+
+	// HandshakeV2 (handshake vesion 2) has the same format as version 1,
+	// the following messages are encrypted with the keys of each direction and the message sequences
+	HandshakeV2 = 2
 )
 
 var hsSigContentBufPool = sync.Pool{
@@ -58,4 +62,26 @@ SessionKey length   1
 SessionKey          -
 Sig lenghth         2
 Sig                 -
+
+Extension (optional, follows the Sig of the Request and the accept Response)
++------------------------------+------------------------------------------+
+|         Capabilities         |               BestHeight                 |
++-----------+------------------+-------------+--------+-------------------+
+| ListenIPL |        ListenIP                | ListenPort                 |
++-----------+--------------+-----------------+----------------------------+
+| CompressionsL |          Compressions                                   |
++------+--------+---------------------------------------------------------+
+| SigL |                        Sig                                       |
++------+------------------------------------------------------------------+
+
+(bytes)
+Capabilities        4
+BestHeight          8
+ListenIP length     1
+ListenIP            - (empty if unknown)
+ListenPort          2
+Compressions length 1
+Compressions        - (the compression algorithm ids in the preferred order, 1 byte each)
+Sig length          2
+Sig                 - (signs the content signed by the Sig before the extension and the extension fields)
 */
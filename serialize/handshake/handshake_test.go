@@ -2,11 +2,12 @@ package handshake
 
 import (
 	"bytes"
+	"net"
 	"testing"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 func TestRequest(t *testing.T) {
@@ -107,3 +108,86 @@ func TestRejectResponse(t *testing.T) {
 		t.Fatal("verify failed\n")
 	}
 }
+
+func TestExtension(t *testing.T) {
+	longtermKey, _ := btcec.NewPrivateKey(btcec.S256())
+	longtermPubKeyBytes := longtermKey.PubKey().SerializeCompressed()
+	sessionPrivKey, _ := btcec.NewPrivateKey(btcec.S256())
+	sessionKey := sessionPrivKey.PubKey().SerializeCompressed()
+	capabilities := params.CapCompactBlock | params.CapEvidenceProof
+	bestHeight := uint64(996)
+	listenIP := net.ParseIP("192.168.1.2").To4()
+	listenPort := uint16(10000)
+	compressions := []params.Compression{params.CompressionDeflate, 2}
+
+	request := NewRequestV2(1, params.CurrentCodeVersion, params.FullNode, longtermPubKeyBytes, sessionKey)
+	request.Ext = NewExtension(capabilities, bestHeight, listenIP, listenPort, compressions)
+	request.Sign(longtermKey)
+	requestBytes := request.Marshal()
+
+	rRequest, err := UnmarshalRequest(bytes.NewReader(requestBytes))
+	if err != nil {
+		t.Fatalf("unmarshal Request failed:%v\n", err)
+	}
+	if rRequest.Ext == nil {
+		t.Fatal("expect the extension")
+	}
+	if err := utils.TCheckUint32("capabilities", capabilities, rRequest.Ext.Capabilities); err != nil {
+		t.Fatal(err)
+	}
+	if !rRequest.Ext.Has(params.CapCompactBlock) || rRequest.Ext.Has(params.CapCompression) {
+		t.Fatal("unexpected capabilities")
+	}
+	if err := utils.TCheckUint64("best height", bestHeight, rRequest.Ext.BestHeight); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckIP("listen IP", listenIP, rRequest.Ext.ListenIP); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckUint16("listen port", listenPort, rRequest.Ext.ListenPort); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.TCheckBytes("compressions", compressions, rRequest.Ext.Compressions); err != nil {
+		t.Fatal(err)
+	}
+	if !rRequest.Verify() {
+		t.Fatal("verify failed\n")
+	}
+
+	// the nodes without the extension ignore it
+	request.Ext = nil
+	if !request.Verify() {
+		t.Fatal("expect the signature valid without the extension")
+	}
+
+	// the extension is signed
+	rRequest.Ext.BestHeight++
+	if rRequest.Verify() {
+		t.Fatal("expect verify failed with the modified extension")
+	}
+
+	// the accept response without the listen address
+	response := NewAcceptResponseV2(params.CurrentCodeVersion, params.LightNode, sessionKey)
+	response.Ext = NewExtension(capabilities, bestHeight, nil, 0, nil)
+	response.Sign(longtermKey)
+
+	rResponse, err := UnmarshalResponse(bytes.NewReader(response.Marshal()))
+	if err != nil {
+		t.Fatalf("unmarshal Response failed:%v\n", err)
+	}
+	if rResponse.Ext == nil {
+		t.Fatal("expect the extension")
+	}
+	if err := utils.TCheckInt("listen IP length", 0, len(rResponse.Ext.ListenIP)); err != nil {
+		t.Fatal(err)
+	}
+	if !rResponse.Verify(longtermKey.PubKey()) {
+		t.Fatal("verify failed\n")
+	}
+
+	// the truncated extension is broken
+	responseBytes := response.Marshal()
+	if _, err := UnmarshalResponse(bytes.NewReader(responseBytes[:len(responseBytes)-1])); err == nil {
+		t.Fatal("expect unmarshal failed with the truncated extension")
+	}
+}
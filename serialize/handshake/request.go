@@ -5,9 +5,9 @@ import (
 	"encoding/binary"
 	"io"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 type Request struct {
@@ -18,6 +18,9 @@ type Request struct {
 	PubKey      []byte
 	SessionKey  []byte
 	Sig         []byte
+
+	// Ext is nil if the peer doesn't send the extension
+	Ext *Extension
 }
 
 func NewRequestV1(chainID uint8, codeVersion params.CodeVersion, nodeType params.NodeType,
@@ -32,6 +35,14 @@ func NewRequestV1(chainID uint8, codeVersion params.CodeVersion, nodeType params
 	}
 }
 
+// NewRequestV2 creates the request of the peer using the transport of handshake version 2
+func NewRequestV2(chainID uint8, codeVersion params.CodeVersion, nodeType params.NodeType,
+	pubKey []byte, sessionKey []byte) *Request {
+	result := NewRequestV1(chainID, codeVersion, nodeType, pubKey, sessionKey)
+	result.Version = HandshakeV2
+	return result
+}
+
 func UnmarshalRequest(data io.Reader) (*Request, error) {
 	result := &Request{}
 	var pubKeyLen uint8
@@ -76,6 +87,10 @@ func UnmarshalRequest(data io.Reader) (*Request, error) {
 		return nil, err
 	}
 
+	if result.Ext, err = unmarshalExtension(data); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -99,13 +114,21 @@ func (r *Request) Marshal() []byte {
 	binary.Write(result, binary.BigEndian, sigLen)
 	binary.Write(result, binary.BigEndian, r.Sig)
 
+	if r.Ext != nil {
+		binary.Write(result, binary.BigEndian, r.Ext.marshal())
+	}
+
 	return result.Bytes()
 }
 
-// Sign generate the signature set to the field Sig
+// Sign generate the signature set to the field Sig, and the signature of the extension
 func (r *Request) Sign(privKey *btcec.PrivateKey) {
 	sig, _ := privKey.Sign(r.getSignContentHash())
 	r.Sig = sig.Serialize()
+
+	if r.Ext != nil {
+		r.Ext.sign(privKey, r.getSignContentHash())
+	}
 }
 
 // Verify checks the response is valid or not
@@ -120,7 +143,11 @@ func (r *Request) Verify() bool {
 		return false
 	}
 
-	return sig.Verify(r.getSignContentHash(), peerKey)
+	if !sig.Verify(r.getSignContentHash(), peerKey) {
+		return false
+	}
+
+	return r.Ext == nil || r.Ext.verify(peerKey, r.getSignContentHash())
 }
 
 func (r *Request) getSignContentHash() []byte {
@@ -5,9 +5,9 @@ import (
 	"encoding/binary"
 	"io"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/996BC/996.Blockchain/params"
 	"github.com/996BC/996.Blockchain/utils"
+	"github.com/btcsuite/btcd/btcec"
 )
 
 const (
@@ -22,6 +22,9 @@ type Response struct {
 	NodeType    params.NodeType
 	SessionKey  []byte
 	Sig         []byte
+
+	// Ext is nil if the peer doesn't send the extension
+	Ext *Extension
 }
 
 func NewAcceptResponseV1(codeVersion params.CodeVersion, nodeType params.NodeType,
@@ -42,6 +45,20 @@ func NewRejectResponseV1() *Response {
 	}
 }
 
+// NewAcceptResponseV2 creates the accept response of the peer using the transport of handshake version 2
+func NewAcceptResponseV2(codeVersion params.CodeVersion, nodeType params.NodeType,
+	sessionKey []byte) *Response {
+	result := NewAcceptResponseV1(codeVersion, nodeType, sessionKey)
+	result.Version = HandshakeV2
+	return result
+}
+
+func NewRejectResponseV2() *Response {
+	result := NewRejectResponseV1()
+	result.Version = HandshakeV2
+	return result
+}
+
 func UnmarshalResponse(data io.Reader) (*Response, error) {
 	result := &Response{}
 	var sessionKeyLen uint8
@@ -77,6 +94,10 @@ func UnmarshalResponse(data io.Reader) (*Response, error) {
 		return nil, err
 	}
 
+	if result.Ext, err = unmarshalExtension(data); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -96,6 +117,10 @@ func (r *Response) Marshal() []byte {
 	binary.Write(result, binary.BigEndian, sigLen)
 	binary.Write(result, binary.BigEndian, r.Sig)
 
+	if r.Ext != nil {
+		binary.Write(result, binary.BigEndian, r.Ext.marshal())
+	}
+
 	return result.Bytes()
 }
 
@@ -103,6 +128,10 @@ func (r *Response) Marshal() []byte {
 func (r *Response) Sign(privKey *btcec.PrivateKey) {
 	sig, _ := privKey.Sign(r.getSignContentHash())
 	r.Sig = sig.Serialize()
+
+	if r.Ext != nil {
+		r.Ext.sign(privKey, r.getSignContentHash())
+	}
 }
 
 // Verify checks the response is valid or not
@@ -112,7 +141,11 @@ func (r *Response) Verify(pubKey *btcec.PublicKey) bool {
 		return false
 	}
 
-	return sig.Verify(r.getSignContentHash(), pubKey)
+	if !sig.Verify(r.getSignContentHash(), pubKey) {
+		return false
+	}
+
+	return r.Ext == nil || r.Ext.verify(pubKey, r.getSignContentHash())
 }
 
 func (r *Response) IsAccept() bool {
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTokenLength limits the bytes of a token
+const maxTokenLength = 64
+
+// IndexTokens splits the text into the searchable tokens: the lower case words of letters and digits,
+// the single characters and the adjacent character pairs of the CJK text which has no spaces between words
+func IndexTokens(text string) []string {
+	return tokenize(text, true)
+}
+
+// QueryTokens splits the keywords into the tokens which must all be in the IndexTokens of the matched text,
+// the CJK keywords longer than one character are split into the adjacent pairs only
+func QueryTokens(keywords string) []string {
+	return tokenize(keywords, false)
+}
+
+func tokenize(text string, unigrams bool) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(token string) {
+		if len(token) == 0 || len(token) > maxTokenLength || seen[token] {
+			return
+		}
+		seen[token] = true
+		result = append(result, token)
+	}
+
+	var word, cjk []rune
+	flushWord := func() {
+		add(string(word))
+		word = word[:0]
+	}
+	flushCJK := func() {
+		for i := range cjk {
+			if unigrams || len(cjk) == 1 {
+				add(string(cjk[i]))
+			}
+			if i+1 < len(cjk) {
+				add(string(cjk[i : i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return result
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/big"
 	"net"
@@ -51,6 +52,16 @@ func AccessCheck(path string) error {
 	return nil
 }
 
+// WriteFileAtomic writes the content into a temporary file and renames it to path,
+// so a crash during the write never leaves a broken file behind
+func WriteFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
 // ParseIPPort parse IP:Port format sring
 func ParseIPPort(ipPort string) (net.IP, int) {
 	s := strings.Split(ipPort, ":")